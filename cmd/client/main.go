@@ -2,23 +2,25 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
-	"strconv"
-	"strings"
 	"syscall"
 
 	"github.com/joho/godotenv"
 	"github.com/keylime/keylime-mcp/internal/agent"
+	keylimeconfig "github.com/keylime/keylime-mcp/internal/config"
 	"github.com/keylime/keylime-mcp/internal/masking"
 	"github.com/keylime/keylime-mcp/internal/web"
 )
 
 type config struct {
 	ServerPath     string
+	ServerArgs     []string
 	Port           string
+	Provider       string
 	OllamaURL      string
 	OllamaModel    string
 	AnthropicKey   string
@@ -37,7 +39,15 @@ func main() {
 		cancel()
 	}()
 
-	cfg := loadConfig()
+	configPath := flag.String("config", os.Getenv(keylimeconfig.EnvConfigPath), "path to a YAML config file")
+	profile := flag.String("profile", os.Getenv(keylimeconfig.EnvProfile), "config file profile to use")
+	flag.Parse()
+
+	cfg, err := loadConfig(*configPath, *profile)
+	if err != nil {
+		log.Printf("Failed to load configuration: %v", err)
+		return
+	}
 
 	if _, err := os.Stat(cfg.ServerPath); os.IsNotExist(err) { // #nosec G703 -- serverPath from env/default, not user input
 		log.Printf("Warning: MCP server not found at %s", cfg.ServerPath)
@@ -47,7 +57,7 @@ func main() {
 
 	providers, initialProvider, initialModel := createProviders(cfg)
 
-	agentCfg := agent.Config{ServerPath: cfg.ServerPath, Model: initialModel}
+	agentCfg := agent.Config{ServerPath: cfg.ServerPath, ServerArgs: cfg.ServerArgs, Model: initialModel}
 	if agentCfg.Model == "" {
 		if models, err := initialProvider.ListModels(ctx); err == nil && len(models) > 0 {
 			agentCfg.Model = models[0].ID
@@ -85,30 +95,33 @@ func main() {
 	}
 }
 
-func loadConfig() config {
+// loadConfig resolves the client settings. The MCP server subprocess is pointed
+// at the same config file and profile so both sides agree.
+func loadConfig(path, profile string) (config, error) {
 	if err := godotenv.Load("./../.env"); err != nil {
 		log.Printf("Warning: .env file not loaded: %v", err)
 	}
-	return config{
-		ServerPath:     getEnv("MCP_SERVER_PATH", "./server"),
-		Port:           getEnv("PORT", "3000"),
-		OllamaURL:      getEnv("OLLAMA_URL", "http://localhost:11434"),
-		OllamaModel:    os.Getenv("OLLAMA_MODEL"),
-		AnthropicKey:   strings.TrimSpace(os.Getenv("ANTHROPIC_API_KEY")),
-		MaskingEnabled: parseBool(getEnv("MASKING_ENABLED", "true")),
+	c, err := keylimeconfig.LoadClient(path, profile)
+	if err != nil {
+		return config{}, err
 	}
-}
-
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+	var serverArgs []string
+	if path != "" {
+		serverArgs = append(serverArgs, "--config", path)
 	}
-	return defaultValue
-}
-
-func parseBool(s string) bool {
-	v, _ := strconv.ParseBool(s)
-	return v
+	if profile != "" {
+		serverArgs = append(serverArgs, "--profile", profile)
+	}
+	return config{
+		ServerPath:     c.ServerPath,
+		ServerArgs:     serverArgs,
+		Port:           c.Port,
+		Provider:       c.Provider,
+		OllamaURL:      c.OllamaURL,
+		OllamaModel:    c.OllamaModel,
+		AnthropicKey:   c.AnthropicKey,
+		MaskingEnabled: c.MaskingEnabled,
+	}, nil
 }
 
 func createProviders(cfg config) ([]agent.LLMProvider, agent.LLMProvider, string) {
@@ -123,7 +136,11 @@ func createProviders(cfg config) ([]agent.LLMProvider, agent.LLMProvider, string
 	ollamaProvider := agent.NewOllamaProvider(cfg.OllamaURL)
 	providers = append(providers, ollamaProvider)
 
-	if cfg.OllamaModel != "" || os.Getenv("OLLAMA_URL") != "" {
+	useOllama := cfg.Provider == "ollama" || cfg.OllamaModel != "" || os.Getenv("OLLAMA_URL") != ""
+	if cfg.Provider == "anthropic" {
+		useOllama = false
+	}
+	if useOllama {
 		log.Printf("Using Ollama provider at %s", cfg.OllamaURL)
 		return providers, ollamaProvider, cfg.OllamaModel
 	}
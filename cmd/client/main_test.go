@@ -1,63 +1,30 @@
 package main
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 const testAnthropicKey = "sk-test"
 
-func TestGetEnv(t *testing.T) {
-	t.Run("returns env value when set", func(t *testing.T) {
-		t.Setenv("TEST_KEYLIME_CLIENT_KEY", "test_value")
-		assert.Equal(t, "test_value", getEnv("TEST_KEYLIME_CLIENT_KEY", "default"))
-	})
-
-	t.Run("returns default when unset", func(t *testing.T) {
-		assert.Equal(t, "default", getEnv("KEYLIME_MCP_NONEXISTENT_VAR", "default"))
-	})
-
-	t.Run("returns default when empty string", func(t *testing.T) {
-		t.Setenv("TEST_KEYLIME_CLIENT_EMPTY", "")
-		assert.Equal(t, "default", getEnv("TEST_KEYLIME_CLIENT_EMPTY", "default"))
-	})
-}
-
-func TestParseBool(t *testing.T) {
-	tests := []struct {
-		input    string
-		expected bool
-	}{
-		{"true", true},
-		{"false", false},
-		{"1", true},
-		{"0", false},
-		{"", false},
-		{"invalid", false},
-		{"TRUE", true},
-		{"True", true},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.input, func(t *testing.T) {
-			assert.Equal(t, tt.expected, parseBool(tt.input))
-		})
-	}
-}
-
 func TestLoadConfig(t *testing.T) {
 	t.Run("default values", func(t *testing.T) {
 		for _, key := range []string{
 			"MCP_SERVER_PATH", "PORT", "OLLAMA_URL", "OLLAMA_MODEL",
-			"ANTHROPIC_API_KEY", "MASKING_ENABLED",
+			"ANTHROPIC_API_KEY", "MASKING_ENABLED", "LLM_PROVIDER",
 		} {
 			t.Setenv(key, "")
 		}
 
-		cfg := loadConfig()
+		cfg, err := loadConfig("", "")
+		require.NoError(t, err)
 
 		assert.Equal(t, "./server", cfg.ServerPath)
+		assert.Empty(t, cfg.ServerArgs)
 		assert.Equal(t, "3000", cfg.Port)
 		assert.Equal(t, "http://localhost:11434", cfg.OllamaURL)
 		assert.Equal(t, "", cfg.OllamaModel)
@@ -72,8 +39,10 @@ func TestLoadConfig(t *testing.T) {
 		t.Setenv("OLLAMA_MODEL", "llama3")
 		t.Setenv("ANTHROPIC_API_KEY", "sk-test-key")
 		t.Setenv("MASKING_ENABLED", "false")
+		t.Setenv("LLM_PROVIDER", "")
 
-		cfg := loadConfig()
+		cfg, err := loadConfig("", "")
+		require.NoError(t, err)
 
 		assert.Equal(t, "/custom/server", cfg.ServerPath)
 		assert.Equal(t, "8080", cfg.Port)
@@ -90,10 +59,36 @@ func TestLoadConfig(t *testing.T) {
 		t.Setenv("OLLAMA_URL", "")
 		t.Setenv("OLLAMA_MODEL", "")
 		t.Setenv("MASKING_ENABLED", "")
+		t.Setenv("LLM_PROVIDER", "")
 
-		cfg := loadConfig()
+		cfg, err := loadConfig("", "")
+		require.NoError(t, err)
 		assert.Equal(t, "sk-test-key", cfg.AnthropicKey)
 	})
+
+	t.Run("invalid boolean rejected", func(t *testing.T) {
+		t.Setenv("MASKING_ENABLED", "invalid")
+
+		_, err := loadConfig("", "")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "MASKING_ENABLED")
+	})
+
+	t.Run("config file and profile passed to server", func(t *testing.T) {
+		for _, key := range []string{
+			"MCP_SERVER_PATH", "PORT", "OLLAMA_URL", "OLLAMA_MODEL",
+			"ANTHROPIC_API_KEY", "MASKING_ENABLED", "LLM_PROVIDER",
+		} {
+			t.Setenv(key, "")
+		}
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		require.NoError(t, os.WriteFile(path, []byte("profiles:\n  prod:\n    llm:\n      provider: anthropic\n"), 0600))
+
+		cfg, err := loadConfig(path, "prod")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"--config", path, "--profile", "prod"}, cfg.ServerArgs)
+		assert.Equal(t, "anthropic", cfg.Provider)
+	})
 }
 
 func TestCreateProviders(t *testing.T) {
@@ -141,6 +136,21 @@ func TestCreateProviders(t *testing.T) {
 		assert.Equal(t, "llama3", model)
 	})
 
+	t.Run("provider setting selects anthropic over ollama model", func(t *testing.T) {
+		t.Setenv("OLLAMA_URL", "")
+		t.Setenv("OLLAMA_MODEL", "")
+
+		cfg := config{
+			AnthropicKey: testAnthropicKey,
+			OllamaURL:    "http://localhost:11434",
+			OllamaModel:  "llama3",
+			Provider:     "anthropic",
+		}
+
+		_, initial, _ := createProviders(cfg)
+		assert.Equal(t, "anthropic", initial.Name())
+	})
+
 	t.Run("both providers in list", func(t *testing.T) {
 		t.Setenv("OLLAMA_URL", "")
 		t.Setenv("OLLAMA_MODEL", "")
@@ -0,0 +1,122 @@
+// Command fake-keylime runs an in-memory Keylime verifier and registrar for offline
+// development of keylime-mcp. Point the server at it with KEYLIME_TLS_ENABLED=false.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/keylime/keylime-mcp/internal/keylimetest"
+)
+
+func main() {
+	verifierAddr := flag.String("verifier-addr", "127.0.0.1:8881", "verifier listen address")
+	registrarAddr := flag.String("registrar-addr", "127.0.0.1:8891", "registrar listen address")
+	controlAddr := flag.String("control-addr", "127.0.0.1:8899", "control API listen address (empty disables)")
+	tick := flag.Duration("tick", 2*time.Second, "attestation polling interval (0 disables; use POST /tick)")
+	agents := flag.Int("agents", 3, "number of enrolled agents to start with when no scenario is given")
+	scenarioPath := flag.String("scenario", "", "JSON scenario with agents, policies and faults to load at startup")
+	versions := flag.String("api-versions", "", "comma-separated API versions to advertise (default: all supported)")
+	push := flag.Bool("push", false, "simulate a push-model verifier that records attestation resources (API 3.0)")
+	flag.Parse()
+
+	config := keylimetest.Config{PushMode: *push}
+	if *versions != "" {
+		config.APIVersions = strings.Split(*versions, ",")
+	}
+	fake := keylimetest.New(config)
+
+	scenario := defaultScenario(*agents)
+	if *scenarioPath != "" {
+		var err error
+		if scenario, err = keylimetest.ReadScenario(*scenarioPath); err != nil {
+			log.Fatalf("Failed to read scenario: %v", err)
+		}
+	}
+	if err := fake.Load(scenario); err != nil {
+		log.Fatalf("Failed to load scenario: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	servers := []*http.Server{
+		newServer(*verifierAddr, fake.VerifierHandler()),
+		newServer(*registrarAddr, fake.RegistrarHandler()),
+	}
+	if *controlAddr != "" {
+		servers = append(servers, newServer(*controlAddr, fake.ControlHandler()))
+	}
+	errs := make(chan error, len(servers))
+	for _, server := range servers {
+		go func() {
+			if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				errs <- err
+			}
+		}()
+	}
+	log.Printf("Fake verifier on http://%s, registrar on http://%s, control API on %s", *verifierAddr, *registrarAddr, orNone(*controlAddr))
+
+	if *tick > 0 {
+		go runTicker(ctx, fake, *tick)
+	}
+
+	select {
+	case <-ctx.Done():
+	case err := <-errs:
+		log.Printf("Server failed: %v", err)
+	}
+	shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, server := range servers {
+		_ = server.Shutdown(shutdown)
+	}
+}
+
+func newServer(addr string, handler http.Handler) *http.Server {
+	return &http.Server{Addr: addr, Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+}
+
+func runTicker(ctx context.Context, fake *keylimetest.Fake, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			fake.Tick()
+		}
+	}
+}
+
+// defaultScenario registers and enrolls n agents with predictable UUIDs.
+func defaultScenario(n int) keylimetest.Scenario {
+	var scenario keylimetest.Scenario
+	for i := range n {
+		scenario.Agents = append(scenario.Agents, keylimetest.ScenarioAgent{
+			Agent: keylimetest.Agent{
+				UUID: fmt.Sprintf("00000000-0000-4000-8000-%012d", i+1),
+				Port: 9002 + i,
+			},
+			Enroll: true,
+		})
+	}
+	return scenario
+}
+
+func orNone(addr string) string {
+	if addr == "" {
+		return "(disabled)"
+	}
+	return "http://" + addr
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/keylime/keylime-mcp/internal/keylime"
+	"github.com/keylime/keylime-mcp/internal/keylimetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultScenario(t *testing.T) {
+	fake := keylimetest.New(keylimetest.Config{})
+	require.NoError(t, fake.Load(defaultScenario(2)))
+	fake.Tick()
+
+	snapshot := fake.Snapshot()
+	require.Len(t, snapshot.Agents, 2)
+	agent := snapshot.Agents["00000000-0000-4000-8000-000000000002"]
+	assert.True(t, agent.Registered)
+	assert.True(t, agent.Enrolled)
+	assert.Equal(t, keylime.StateGetQuote, *agent.OperationalState)
+}
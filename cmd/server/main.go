@@ -2,11 +2,18 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
 	"os"
-	"strconv"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
+	"github.com/keylime/keylime-mcp/internal/config"
+	"github.com/keylime/keylime-mcp/internal/history"
 	"github.com/keylime/keylime-mcp/internal/keylime"
 	"github.com/keylime/keylime-mcp/internal/masking"
 	"github.com/keylime/keylime-mcp/internal/mcptools"
@@ -14,74 +21,177 @@ import (
 )
 
 func main() {
+	configPath := flag.String("config", os.Getenv(config.EnvConfigPath), "path to a YAML config file")
+	profile := flag.String("profile", os.Getenv(config.EnvProfile), "config file profile to use")
+	record := flag.String("record", "", "record Keylime traffic, redacted, to this cassette file")
+	replay := flag.String("replay", "", "answer Keylime requests from this cassette file instead of the network")
+	flag.Parse()
+
 	err1 := godotenv.Load(".env")
 	err2 := godotenv.Load("../.env")
 	if err1 != nil && err2 != nil {
 		log.Printf("No .env file found, using defaults")
 	}
-	config := loadConfig()
-	keylimeService, err := keylime.NewService(&config)
+	settings, err := config.LoadServer(*configPath, *profile)
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	if *record != "" {
+		settings.RecordCassette = *record
+	}
+	if *replay != "" {
+		settings.ReplayCassette = *replay
+	}
+	if err := run(settings); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run serves MCP on stdio until the client disconnects. It returns instead of exiting on
+// errors, so that a recorded cassette is always closed.
+func run(settings *config.Server) error {
+	cassette, err := openCassette(settings)
+	if err != nil {
+		return fmt.Errorf("failed to open cassette: %w", err)
+	}
+	defer cassette.Close()
+	for _, cluster := range settings.Clusters {
+		cluster.Cassette = cassette
+	}
+	clusters, err := keylime.NewClusters(settings.Clusters, settings.PrimaryCluster)
 	if err != nil {
-		log.Fatalf("Failed to initialize Keylime service: %v", err)
+		return fmt.Errorf("failed to initialize Keylime service: %w", err)
 	}
-	toolHandler := mcptools.NewToolHandler(keylimeService)
-	mask := masking.NewEngine(config.MaskingEnabled)
+	negotiateAPIVersions(clusters)
+	toolHandler := mcptools.NewClusterToolHandler(clusters)
+	if settings.HistoryDir != "" {
+		store, err := history.Open(settings.HistoryDir)
+		if err != nil {
+			return fmt.Errorf("failed to open policy history: %w", err)
+		}
+		toolHandler.SetPolicyHistory(store)
+		log.Printf("Keeping policy versions in %s", settings.HistoryDir)
+	} else {
+		log.Printf("Policy history is disabled: %s", settings.HistoryOff)
+	}
+	mask := masking.NewEngine(settings.MaskingEnabled)
 
 	server := mcp.NewServer(&mcp.Implementation{Name: "Keylime", Version: "v1.0.0"}, nil)
-	mcp.AddTool(server, &mcp.Tool{Name: "Get_version_and_health", Description: "Retrieves current and supported API Keylime Verifier and Registrar versions and checks if the services are reachable"}, masking.WrapTool(mask, toolHandler.GetVersionAndHealth))
-	mcp.AddTool(server, &mcp.Tool{Name: "Get_all_agents", Description: "Retrieves a list of all registered agent UUIDs from the registrar"}, masking.WrapTool(mask, toolHandler.GetAllAgents))
-	mcp.AddTool(server, &mcp.Tool{Name: "Get_verifier_enrolled_agents", Description: "Retrieves a list of agent UUIDs enrolled in the verifier for active attestation"}, masking.WrapTool(mask, toolHandler.GetVerifierEnrolledAgents))
-	mcp.AddTool(server, &mcp.Tool{Name: "Get_agent_status", Description: "Retrieves attestation status from the verifier: operational state, attestation count, severity, last quote timestamps, and algorithms."}, masking.WrapTool(mask, toolHandler.GetAgentStatus))
-	mcp.AddTool(server, &mcp.Tool{Name: "Get_failed_agents", Description: "Retrieves all agents currently in a failed operational state with their detailed status information including attestation history and failure reasons"}, masking.WrapTool(mask, toolHandler.GetFailedAgents))
-	mcp.AddTool(server, &mcp.Tool{Name: "Reactivate_agent", Description: "Reactivates a failed agent identified by its UUID"}, masking.WrapTool(mask, toolHandler.ReactivateAgent))
-	mcp.AddTool(server, &mcp.Tool{Name: "Get_agent_policies", Description: "Retrieves policy configuration (TPM, vTPM, runtime policies) for a specific agent"}, masking.WrapTool(mask, toolHandler.GetAgentPolicies))
-	mcp.AddTool(server, &mcp.Tool{Name: "Get_agent_details", Description: "Retrieves hardware identity from the registrar: EK certificate, AIK, mTLS cert, IP and port. Not attestation status — use Get_agent_status for that."}, masking.WrapTool(mask, toolHandler.RegistrarGetAgentDetails))
-	mcp.AddTool(server, &mcp.Tool{Name: "Registrar_remove_agent", Description: "Removes an agent from the registrar (NOT the verifier)"}, masking.WrapTool(mask, toolHandler.RegistrarRemoveAgent))
-	mcp.AddTool(server, &mcp.Tool{Name: "Enroll_agent_to_verifier", Description: "Enrolls a registered agent into the verifier for active attestation. Optional runtime_policy_name (use List_runtime_policies for names) and mb_policy_name (use List_mb_policies for names) refer to existing policies on the verifier. Leave empty to enroll without policy."}, masking.WrapTool(mask, toolHandler.EnrollAgentToVerifier))
-	mcp.AddTool(server, &mcp.Tool{Name: "Update_agent", Description: "Re-enrolls an agent with a new policy. Safely validates everything before unenrolling, then re-enrolls. Use this instead of manually calling Unenroll + Enroll."}, masking.WrapTool(mask, toolHandler.UpdateAgent))
-	mcp.AddTool(server, &mcp.Tool{Name: "Unenroll_agent_from_verifier", Description: "Unenrolls an agent from the verifier (NOT the registrar)"}, masking.WrapTool(mask, toolHandler.UnenrollAgentFromVerifier))
-	mcp.AddTool(server, &mcp.Tool{Name: "Stop_agent", Description: "Stop Verifier polling on an agent identified by its UUID, but does not remove the agent"}, masking.WrapTool(mask, toolHandler.StopAgent))
-	mcp.AddTool(server, &mcp.Tool{Name: "List_runtime_policies", Description: "Lists names of runtime policies already uploaded to the verifier. These are policies available for assigning to agents during enrollment."}, masking.WrapTool(mask, toolHandler.ListRuntimePolicies))
-	mcp.AddTool(server, &mcp.Tool{Name: "Get_runtime_policy", Description: "Gets the content of a specific runtime policy stored on the verifier by name. Returns the policy JSON including digests, excludes, and keyrings. Use List_runtime_policies first to see available names."}, masking.WrapTool(mask, toolHandler.GetRuntimePolicy))
-	mcp.AddTool(server, &mcp.Tool{Name: "Import_runtime_policy", Description: "Uploads a local runtime policy JSON file to the verifier. If the user has no policy file, ask whether they want to generate it from a local filesystem or a remote RPM repo. For local: 'sudo keylime-policy create runtime --rootfs / -o /tmp/runtime_policy.json'. For RPM repo: 'sudo keylime-policy create runtime --remote-rpm-repo <URL> -o /tmp/runtime_policy.json'. Then provide the output path to this tool."}, masking.WrapTool(mask, toolHandler.ImportRuntimePolicy))
-	mcp.AddTool(server, &mcp.Tool{Name: "Update_runtime_policy", Description: "Updates an existing runtime policy on the verifier. Can add or remove excludes and digests. Fetches the current policy, applies changes, and re-uploads. Requires at least one of add_excludes, remove_excludes, add_digests, or remove_digests."}, masking.WrapTool(mask, toolHandler.UpdateRuntimePolicy))
-	mcp.AddTool(server, &mcp.Tool{Name: "Delete_runtime_policy", Description: "Deletes a runtime policy from the verifier by name. Use List_runtime_policies first to see available names."}, masking.WrapTool(mask, toolHandler.DeleteRuntimePolicy))
-	mcp.AddTool(server, &mcp.Tool{Name: "List_mb_policies", Description: "Lists names of measured boot policies already uploaded to the verifier. These are policies available for assigning to agents during enrollment."}, masking.WrapTool(mask, toolHandler.ListMBPolicies))
-	mcp.AddTool(server, &mcp.Tool{Name: "Get_mb_policy", Description: "Gets the content of a specific measured boot policy stored on the verifier by name. Returns the policy JSON including boot event logs and expected PCR values. Use List_mb_policies first to see available names."}, masking.WrapTool(mask, toolHandler.GetMBPolicy))
-	mcp.AddTool(server, &mcp.Tool{Name: "Import_mb_policy", Description: "Uploads a local measured boot policy JSON file to the verifier. If the user has no policy file, tell them to generate one with: 'sudo keylime-policy create measured-boot -e /sys/kernel/security/tpm0/binary_bios_measurements -o /tmp/mb_policy.json'. If it fails with a SecureBoot error, add the -i flag to generate without SecureBoot validation. Then provide the output path to this tool."}, masking.WrapTool(mask, toolHandler.ImportMBPolicy))
-	mcp.AddTool(server, &mcp.Tool{Name: "Delete_mb_policy", Description: "Deletes a measured boot policy from the verifier by name. Use List_mb_policies first to see available names."}, masking.WrapTool(mask, toolHandler.DeleteMBPolicy))
-	mcp.AddTool(server, &mcp.Tool{Name: "Get_verifier_logs", Description: "Investigates attestation failures and retrieves Keylime Verifier logs from journalctl. Requires co-located verifier. Filter by agent_uuid and use filter parameter: 'attestation_failures' for file mismatches, invalid quotes and policy violations, 'errors' for error-level messages, 'all' for unfiltered output (default). Lines parameter controls log window (default 50, max 200)."}, masking.WrapTool(mask, toolHandler.InvestigateVerifierLogs))
-	if err := server.Run(context.Background(), &mcp.StdioTransport{}); err != nil {
-		log.Fatal(err)
+	registry := newToolRegistry(server, mask, settings.AllowedTools)
+	registerTools(registry, toolHandler)
+	if unknown := registry.unknownAllowed(); len(unknown) > 0 {
+		return fmt.Errorf("failed to load configuration: tools.allow: unknown tools %s", strings.Join(unknown, ", "))
+	}
+	return server.Run(context.Background(), &mcp.StdioTransport{})
+}
+
+// openCassette opens the configured recording or replay cassette, if any. Recordings are
+// always redacted, independent of whether masking is enabled for the LLM.
+func openCassette(settings *config.Server) (*keylime.Cassette, error) {
+	switch {
+	case settings.RecordCassette != "" && settings.ReplayCassette != "":
+		return nil, errors.New("-record and -replay cannot be used together")
+	case settings.RecordCassette != "":
+		log.Printf("Recording Keylime traffic to %s", settings.RecordCassette)
+		return keylime.RecordCassette(settings.RecordCassette, masking.NewRedactor())
+	case settings.ReplayCassette != "":
+		log.Printf("Replaying Keylime traffic from %s", settings.ReplayCassette)
+		return keylime.ReplayCassette(settings.ReplayCassette)
+	}
+	return nil, nil
+}
+
+// negotiateAPIVersions selects the Keylime API version of every cluster at startup. Failures
+// are logged, not fatal: unreachable services negotiate again on their first request.
+func negotiateAPIVersions(clusters *keylime.Clusters) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	for _, name := range clusters.Names() {
+		svc, err := clusters.Get(name)
+		if err != nil {
+			continue
+		}
+		if err := svc.NegotiateAPIVersions(ctx); err != nil {
+			log.Printf("Cluster %s: API version negotiation failed, falling back to verifier API %s, registrar API %s until it succeeds: %v",
+				name, svc.Verifier.APIVersion(), svc.Registrar.APIVersion(), err)
+			continue
+		}
+		log.Printf("Cluster %s: using verifier API %s, registrar API %s", name, svc.Verifier.APIVersion(), svc.Registrar.APIVersion())
 	}
 }
 
-func loadConfig() keylime.Config {
-	certDir := getEnv("KEYLIME_CERT_DIR", "/var/lib/keylime/cv_ca")
+// toolRegistry adds tools to the MCP server, skipping those not in the configured allowlist.
+type toolRegistry struct {
+	server  *mcp.Server
+	mask    *masking.Engine
+	allowed map[string]bool // nil exposes every tool
+	known   map[string]bool
+	added   []string
+}
+
+func newToolRegistry(server *mcp.Server, mask *masking.Engine, allowed []string) *toolRegistry {
+	r := &toolRegistry{server: server, mask: mask, known: map[string]bool{}}
+	if len(allowed) > 0 {
+		r.allowed = make(map[string]bool, len(allowed))
+		for _, name := range allowed {
+			r.allowed[name] = true
+		}
+	}
+	return r
+}
 
-	return keylime.Config{
-		VerifierURL:    getEnv("KEYLIME_VERIFIER_URL", "https://localhost:8881"),
-		RegistrarURL:   getEnv("KEYLIME_REGISTRAR_URL", "https://localhost:8891"),
-		CertDir:        certDir,
-		TLSEnabled:     parseBool(getEnv("KEYLIME_TLS_ENABLED", "true")),
-		TLSServerName:  getEnv("KEYLIME_TLS_SERVER_NAME", "localhost"),
-		APIVersion:     getEnv("KEYLIME_API_VERSION", "v2.5"),
-		ClientCert:     getEnv("KEYLIME_CLIENT_CERT", certDir+"/client-cert.crt"),
-		ClientKey:      getEnv("KEYLIME_CLIENT_KEY", certDir+"/client-private.pem"),
-		CAPath:         getEnv("KEYLIME_CA_CERT", certDir+"/cacert.crt"),
-		Port:           getEnv("PORT", "8080"),
-		MaskingEnabled: parseBool(getEnv("MASKING_ENABLED", "true")),
+func addTool[In, Out any](r *toolRegistry, tool *mcp.Tool, handler mcp.ToolHandlerFor[In, Out]) {
+	r.known[tool.Name] = true
+	if r.allowed != nil && !r.allowed[tool.Name] {
+		return
 	}
+	mcp.AddTool(r.server, tool, masking.WrapTool(r.mask, mcptools.WithErrorCodes(handler)))
+	r.added = append(r.added, tool.Name)
 }
 
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+// unknownAllowed returns allowlist entries that do not name any tool, which usually means a typo.
+func (r *toolRegistry) unknownAllowed() []string {
+	var unknown []string
+	for name := range r.allowed {
+		if !r.known[name] {
+			unknown = append(unknown, name)
+		}
 	}
-	return defaultValue
+	sort.Strings(unknown)
+	return unknown
 }
 
-func parseBool(s string) bool {
-	v, _ := strconv.ParseBool(s)
-	return v
+func registerTools(r *toolRegistry, h *mcptools.ToolHandler) {
+	addTool(r, &mcp.Tool{Name: "Get_version_and_health", Description: "Retrieves current and supported API Keylime Verifier and Registrar versions and checks if the services are reachable. Checks every cluster unless a cluster is given."}, h.GetVersionAndHealth)
+	addTool(r, &mcp.Tool{Name: "List_clusters", Description: "Lists the Keylime clusters (verifier/registrar pairs) this server manages and which one is primary. Other tools accept a cluster name and default to the primary cluster."}, h.ListClusters)
+	addTool(r, &mcp.Tool{Name: "Get_all_agents", Description: "Retrieves a list of all registered agent UUIDs from the registrar"}, h.GetAllAgents)
+	addTool(r, &mcp.Tool{Name: "Get_verifier_enrolled_agents", Description: "Retrieves a list of agent UUIDs enrolled in the verifier for active attestation"}, h.GetVerifierEnrolledAgents)
+	addTool(r, &mcp.Tool{Name: "Get_agent_status", Description: "Retrieves attestation status from the verifier: operational state, attestation count, severity, last quote timestamps, and algorithms. For push-model verifiers, reports the evaluation of the latest attestation (pass/fail/pending), its failure_reason, and the recent attestations instead."}, h.GetAgentStatus)
+	addTool(r, &mcp.Tool{Name: "Get_failed_agents", Description: "Retrieves all agents currently in a failed operational state with their detailed status information including attestation history and failure reasons. Searches every cluster unless a cluster is given; each result is tagged with its cluster. Agents that could not be checked are listed in skipped_agents (not enrolled) or errored_agents instead of being dropped. Optionally filter by verifier_id (pull model only). On push-model verifiers, agents whose latest attestation failed are listed in failed_push_agents."}, h.GetFailedAgents)
+	addTool(r, &mcp.Tool{Name: "Reactivate_agent", Description: "Reactivates a failed agent identified by its UUID. Push-model verifiers have no reactivation: the agent's attestation status is returned with an explanation, and the agent recovers when its next pushed attestation passes."}, h.ReactivateAgent)
+	addTool(r, &mcp.Tool{Name: "Get_agent_policies", Description: "Retrieves policy configuration (TPM, vTPM, runtime policies) for a specific agent"}, h.GetAgentPolicies)
+	addTool(r, &mcp.Tool{Name: "Get_agent_details", Description: "Retrieves hardware identity from the registrar: EK certificate, AIK, mTLS cert, IP and port. Not attestation status — use Get_agent_status for that."}, h.RegistrarGetAgentDetails)
+	addTool(r, &mcp.Tool{Name: "Registrar_remove_agent", Description: "Removes an agent from the registrar (NOT the verifier)"}, h.RegistrarRemoveAgent)
+	addTool(r, &mcp.Tool{Name: "Enroll_agent_to_verifier", Description: "Enrolls a registered agent into the verifier for active attestation. Optional runtime_policy_name (use List_runtime_policies for names) and mb_policy_name (use List_mb_policies for names) refer to existing policies on the verifier. Leave empty to enroll without policy. Optional settings: extra pcrs, expected_pcr_values, accepted TPM algorithms (e.g. ecc/ecdsa for ECC-only TPMs), a metadata object, ima_sign_verification_keys, and cloudagent_ip/cloudagent_port to override the registrar address for agents behind NAT. verify_identity checks the EK certificate and an identity quote from the agent first (always done when the server enforces it). payload (a file or directory on the server host, plus an optional payload_script run as autorun.sh) is encrypted under a new bootstrap key and released to the agent by the verifier after its first successful attestation. All options are validated before anything is sent."}, h.EnrollAgentToVerifier)
+	addTool(r, &mcp.Tool{Name: "Update_agent", Description: "Re-enrolls an agent with a new policy. Validates everything and snapshots the current enrollment before unenrolling, waits for the verifier to remove the agent, then re-enrolls; if that fails, the previous enrollment is restored and status is rolled_back. Policies the agent references by name cannot be read back (listed in previous_enrollment.missing); if they could not be restored, status is partially_restored and the agent must be re-enrolled with them. Use this instead of manually calling Unenroll + Enroll. Accepts the same enrollment options as Enroll_agent_to_verifier."}, h.UpdateAgent)
+	addTool(r, &mcp.Tool{Name: "Unenroll_agent_from_verifier", Description: "Unenrolls an agent from the verifier (NOT the registrar)"}, h.UnenrollAgentFromVerifier)
+	addTool(r, &mcp.Tool{Name: "Stop_agent", Description: "Stop Verifier polling on an agent identified by its UUID, but does not remove the agent"}, h.StopAgent)
+	addTool(r, &mcp.Tool{Name: "List_runtime_policies", Description: "Lists names of runtime policies already uploaded to the verifier. These are policies available for assigning to agents during enrollment."}, h.ListRuntimePolicies)
+	addTool(r, &mcp.Tool{Name: "Evaluate_ima_log_against_policy", Description: "Checks every entry of a saved IMA measurement list (a copy of /sys/kernel/security/ima/ascii_runtime_measurements from the agent) against a runtime policy, either stored on the verifier (policy_name) or a local file (policy_path), with the verifier's rules: exclude regexes, ignored keyrings, keyrings, ima-buf and file digests. Reports each entry as allowed, excluded or failing with the reason and Keylime failure type (not_in_allowlist or runtime_policy_hash), so all offending entries are known before the policy is changed. Set failures_only for large logs. ima-sig signatures are not verified."}, h.EvaluateIMALog)
+	addTool(r, &mcp.Tool{Name: "Diff_runtime_policies", Description: "Compares two runtime policies before importing or after editing. from and to are each a policy name stored on the verifier (use List_runtime_policies) or an absolute path of a local policy .json file. Reports paths added to or removed from digests, keyrings and ima-buf with their digests, digests added or removed for paths in both, excludes added or removed, and changed meta, release, ima and verification-keys settings. Large diffs list at most max_entries (default 50) entries per section with full counts and truncated set."}, h.DiffRuntimePolicies)
+	addTool(r, &mcp.Tool{Name: "Get_runtime_policy", Description: "Gets the content of a specific runtime policy stored on the verifier by name. Returns the policy JSON including digests, excludes, and keyrings, and its revision for Update_runtime_policy expected_revision. Use List_runtime_policies first to see available names."}, h.GetRuntimePolicy)
+	addTool(r, &mcp.Tool{Name: "Import_runtime_policy", Description: "Uploads a runtime policy to the verifier, from a file on the server host (file_path) or given inline as JSON or base64 (content), e.g. when the file is on the user's machine. Legacy Keylime allowlists (flat '<digest> <path>' lines or JSON with a hashes section) are converted to a runtime policy, and a legacy exclude list (exclude_list_path or exclude_list) is added to the excludes; the conversion is reported. The policy is linted first: policies with errors are rejected unless ignore_lint_errors is set, and the findings are returned as warnings. If the user has no policy file, ask whether they want to generate it from a local filesystem or a remote RPM repo. For a local filesystem or mounted image, use Create_runtime_policy; for the IMA log of a running known-good machine, use Create_runtime_policy_from_ima_log. For RPM repo: 'sudo keylime-policy create runtime --remote-rpm-repo <URL> -o /tmp/runtime_policy.json'. Then provide the output path to this tool."}, h.ImportRuntimePolicy)
+	addTool(r, &mcp.Tool{Name: "Create_runtime_policy", Description: "Generates a runtime policy from a directory on the server host (/ or a mounted image of the attested system): hashes executables, shared libraries and other ELF files with hash_alg (default sha256), leaves out paths matching the excludes regexes (also written to the policy) and skips /dev, /proc, /sys, /run, /tmp, /var, /mnt, /media, /snap and /lost+found. Writes the policy JSON to output_path and, with policy_name, uploads it to the verifier. Set incremental to only rehash files changed since the last run with the same output_path."}, h.CreateRuntimePolicy)
+	addTool(r, &mcp.Tool{Name: "Create_runtime_policy_from_ima_log", Description: "Converts a saved IMA measurement list (a copy of /sys/kernel/security/ima/ascii_runtime_measurements from a known-good machine; ima, ima-ng, ima-sig and ima-buf templates) into a runtime policy. Every measured digest is accepted for its path, keyring measurements go to keyrings and other ima-buf entries to ima-buf; paths matching the excludes regexes are left out. Writes the policy to output_path (usable with Import_runtime_policy), uploads it as policy_name, or both."}, h.CreateRuntimePolicyFromIMALog)
+	addTool(r, &mcp.Tool{Name: "Update_runtime_policy", Description: "Updates an existing runtime policy on the verifier. Fetches the current policy, applies changes, and re-uploads. Can add or remove excludes; append digests to a path (add_digests keeps the digests already accepted), remove single digests (remove_digest_values) or whole paths (remove_digests); add or remove keyrings and ima-buf digests; add or remove ima.ignored_keyrings; and set ima.log_hash_alg or verification_keys. The edited policy is checked against the Keylime runtime policy schema and not uploaded if it fails. If the policy changes concurrently the edit is re-applied to the new version; pass expected_revision from Get_runtime_policy to get a conflict error instead. Requires at least one change."}, h.UpdateRuntimePolicy)
+	addTool(r, &mcp.Tool{Name: "Delete_runtime_policy", Description: "Deletes a runtime policy from the verifier by name; the deleted version stays restorable with Rollback_policy. Use List_runtime_policies first to see available names."}, h.DeleteRuntimePolicy)
+	addTool(r, &mcp.Tool{Name: "List_mb_policies", Description: "Lists names of measured boot policies already uploaded to the verifier. These are policies available for assigning to agents during enrollment."}, h.ListMBPolicies)
+	addTool(r, &mcp.Tool{Name: "Get_mb_policy", Description: "Gets the content of a specific measured boot policy stored on the verifier by name. Returns the policy JSON including boot event logs and expected PCR values. Use List_mb_policies first to see available names."}, h.GetMBPolicy)
+	addTool(r, &mcp.Tool{Name: "Import_mb_policy", Description: "Uploads a measured boot policy JSON to the verifier, from a file on the server host (file_path) or given inline as JSON or base64 (content). The policy is linted first: policies with errors are rejected unless ignore_lint_errors is set, and the findings are returned as warnings. If the user has no policy file, generate one with Create_mb_policy from a saved copy of /sys/kernel/security/tpm0/binary_bios_measurements."}, h.ImportMBPolicy)
+	addTool(r, &mcp.Tool{Name: "Create_mb_policy", Description: "Generates a measured boot policy (Keylime reference state) from a saved TPM2 binary event log (a copy of /sys/kernel/security/tpm0/binary_bios_measurements from a known-good boot; no TPM needed). Records the SecureBoot PK, KEK, db and dbx entries, the shim, grub and kernel Authenticode digests, the initrd digest, MOK list digests and firmware digests. If it fails because SecureBoot is disabled, set skip_secureboot to generate without SecureBoot validation. Writes the policy to output_path (usable with Import_mb_policy), uploads it as policy_name, or both."}, h.CreateMBPolicy)
+	addTool(r, &mcp.Tool{Name: "Lint_policy", Description: "Checks a runtime or measured boot policy, from a local file_path or stored on the verifier as policy_name, against the Keylime schema and for common mistakes: missing meta.version, invalid or overly broad excludes such as /.*, SHA-1-only digests, paths without digests, and measured boot policies without kernels or SecureBoot keys. Errors make the import tools reject the policy; warnings do not."}, h.LintPolicy)
+	addTool(r, &mcp.Tool{Name: "Delete_mb_policy", Description: "Deletes a measured boot policy from the verifier by name; the deleted version stays restorable with Rollback_policy. Use List_mb_policies first to see available names."}, h.DeleteMBPolicy)
+	addTool(r, &mcp.Tool{Name: "List_policy_history", Description: "Lists the runtime and measured boot policy versions this server uploaded, overwrote or deleted, newest first, with time, cluster, tool, action and the reason given. Filter by policy_name, kind (runtime or mb) or cluster. Use a version with Rollback_policy."}, h.ListPolicyHistory)
+	addTool(r, &mcp.Tool{Name: "Rollback_policy", Description: "Restores a policy version from List_policy_history on the cluster it came from: overwrites the current policy, or recreates it if it was deleted. The overwritten version is kept in the history, so a rollback can be undone. Give a reason."}, h.RollbackPolicy)
+	addTool(r, &mcp.Tool{Name: "Get_verifier_logs", Description: "Investigates attestation failures and retrieves Keylime Verifier logs from journalctl. Requires co-located verifier. Filter by agent_uuid and use filter parameter: 'attestation_failures' for file mismatches, invalid quotes and policy violations, 'errors' for error-level messages, 'all' for unfiltered output (default). Lines parameter controls log window (default 50, max 200)."}, h.InvestigateVerifierLogs)
 }
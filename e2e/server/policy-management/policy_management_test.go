@@ -53,7 +53,7 @@ func TestPolicyManagement(t *testing.T) {
 			"policy_name":    policyName,
 			"add_excludes":   []string{"/var/log/test"},
 			"remove_excludes": []string{},
-			"add_digests":    map[string]string{},
+			"add_digests":    map[string][]string{},
 			"remove_digests": []string{},
 		})
 		require.False(t, result.IsError)
@@ -7,6 +7,7 @@ import (
 	"log"
 	"os"
 	"os/exec"
+	"regexp"
 	"strings"
 	"sync"
 
@@ -21,7 +22,7 @@ const (
 	DefaultMaxTokens    = 2048
 	DefaultSystemPrompt = `You are a Keylime infrastructure assistant with access to tools. You help users manage and monitor Keylime agents.
 
-When users request information or actions, call the appropriate tool directly. You can call tools in sequence to complete multi-step tasks. After receiving tool results, summarize them for the user. If a tool returns an error, explain the issue and suggest a resolution.`
+When users request information or actions, call the appropriate tool directly. You can call tools in sequence to complete multi-step tasks. After receiving tool results, summarize them for the user. If a tool returns an error, explain the issue and suggest a resolution. Tool errors start with a code in brackets, such as [not_found], [invalid_input] or [unavailable]: fix the arguments for invalid_input, retry later for unavailable or timeout, and do not retry not_found or conflict unchanged.`
 )
 
 type mcpSession interface {
@@ -32,6 +33,7 @@ type mcpSession interface {
 
 type Config struct {
 	ServerPath   string
+	ServerArgs   []string
 	Model        string
 	MaxTokens    int64
 	SystemPrompt string
@@ -71,7 +73,7 @@ func (a *Agent) Connect(ctx context.Context) error {
 		Name:    mcpClientName,
 		Version: mcpClientVersion,
 	}, nil)
-	cmd := exec.Command(a.config.ServerPath) // #nosec G204 -- ServerPath is from trusted config, not user input
+	cmd := exec.Command(a.config.ServerPath, a.config.ServerArgs...) // #nosec G204 -- ServerPath and ServerArgs are from trusted config, not user input
 	cmd.Env = append(os.Environ(), "MASKING_ENABLED=false")
 	transport := &mcp.CommandTransport{Command: cmd}
 	session, err := client.Connect(ctx, transport, nil)
@@ -186,14 +188,17 @@ func (a *Agent) ExecuteTool(ctx context.Context, toolRequest *ToolRequest, onMes
 
 	var resultText string
 	var isError bool
+	var errorCode string
 
 	switch {
 	case err != nil:
 		resultText = fmt.Sprintf("Error: %v", err)
 		isError = true
 	case result.IsError:
-		resultText = fmt.Sprintf("Tool '%s' execution failed: %s", toolRequest.Name, extractTextContent(result.Content))
+		text := extractTextContent(result.Content)
+		resultText = fmt.Sprintf("Tool '%s' execution failed: %s", toolRequest.Name, text)
 		isError = true
+		errorCode = parseErrorCode(text)
 	default:
 		resultText = extractTextContent(result.Content)
 	}
@@ -201,9 +206,10 @@ func (a *Agent) ExecuteTool(ctx context.Context, toolRequest *ToolRequest, onMes
 	msg := Message{
 		Role: RoleTool,
 		ToolResult: &ToolResult{
-			ToolID:  toolRequest.ID,
-			Output:  resultText,
-			IsError: isError,
+			ToolID:    toolRequest.ID,
+			Output:    resultText,
+			IsError:   isError,
+			ErrorCode: errorCode,
 		},
 	}
 
@@ -277,6 +283,16 @@ func (a *Agent) unmaskToolRequest(tr ToolRequest) ToolRequest {
 	return ToolRequest{ID: tr.ID, Name: tr.Name, Arguments: realArgs}
 }
 
+var errorCodeRE = regexp.MustCompile(`^\[([a-z_]+)\] `)
+
+// parseErrorCode returns the "[code]" prefix the Keylime MCP server puts on tool errors.
+func parseErrorCode(text string) string {
+	if m := errorCodeRE.FindStringSubmatch(text); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
 func extractTextContent(content []mcp.Content) string {
 	var resultText strings.Builder
 
@@ -273,6 +273,26 @@ func TestExecuteTool(t *testing.T) {
 		assert.Contains(t, received[0].ToolResult.Output, "agent not found")
 	})
 
+	t.Run("tool error code extracted", func(t *testing.T) {
+		a, _, _ := newTestAgent(testAgentOpts{
+			session: &mockSession{
+				callResult: &mcp.CallToolResult{
+					IsError: true,
+					Content: []mcp.Content{&mcp.TextContent{Text: "[not_found] API error (HTTP 404): agent not found"}},
+				},
+			},
+			provider: &mockProvider{response: &LLMResponse{TextBlocks: []string{"sorry"}}},
+		})
+		a.toolQueue = []ToolRequest{{ID: "t1", Name: testToolGetStatus}}
+
+		var received []Message
+		err := a.ExecuteTool(ctx, &a.toolQueue[0], func(m Message) { received = append(received, m) })
+		require.NoError(t, err)
+
+		require.NotEmpty(t, received)
+		assert.Equal(t, "not_found", received[0].ToolResult.ErrorCode)
+	})
+
 	t.Run("advances to next tool in queue", func(t *testing.T) {
 		a, _, _ := newTestAgent(testAgentOpts{
 			session: &mockSession{
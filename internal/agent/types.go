@@ -22,9 +22,10 @@ type ToolRequest struct {
 }
 
 type ToolResult struct {
-	ToolID  string
-	Output  string
-	IsError bool
+	ToolID    string
+	Output    string
+	IsError   bool
+	ErrorCode string // machine-readable code of a failed tool call, e.g. "not_found"
 }
 
 type ModelInfo struct {
@@ -0,0 +1,644 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/keylime/keylime-mcp/internal/keylime"
+	"gopkg.in/yaml.v3"
+)
+
+// Environment variables that select the config file and profile when no flag is given.
+const (
+	EnvConfigPath = "KEYLIME_MCP_CONFIG"
+	EnvProfile    = "KEYLIME_MCP_PROFILE"
+)
+
+const (
+	defaultCertDir = "/var/lib/keylime/cv_ca"
+
+	providerAnthropic = "anthropic"
+	providerOllama    = "ollama"
+)
+
+// File is the top-level layout of a keylime-mcp YAML config file
+type File struct {
+	DefaultProfile string              `yaml:"default_profile"`
+	Profiles       map[string]*Profile `yaml:"profiles"`
+}
+
+// Profile groups the settings for one deployment, e.g. "staging" or "prod"
+type Profile struct {
+	Keylime        Endpoint            `yaml:"keylime"`
+	Clusters       map[string]Endpoint `yaml:"clusters"`
+	PrimaryCluster string              `yaml:"primary_cluster"`
+	Masking        *bool               `yaml:"masking"`
+	Tools          Tools               `yaml:"tools"`
+	LLM            LLM                 `yaml:"llm"`
+	Web            Web                 `yaml:"web"`
+	Cassette       Cassette            `yaml:"cassette"`
+	History        History             `yaml:"history"`
+}
+
+// Endpoint holds connection settings for a verifier/registrar pair. Empty fields are inherited.
+type Endpoint struct {
+	VerifierURL   string `yaml:"verifier_url"`
+	RegistrarURL  string `yaml:"registrar_url"`
+	APIVersion    string `yaml:"api_version"`
+	TLSEnabled    *bool  `yaml:"tls_enabled"`
+	TLSServerName string `yaml:"tls_server_name"`
+	CertDir       string `yaml:"cert_dir"`
+	ClientCert    string `yaml:"client_cert"`
+	ClientKey     string `yaml:"client_key"` // #nosec G117 -- path to the key file, not the key itself
+	CACert        string `yaml:"ca_cert"`
+
+	ClientKeyPassphraseFile       string `yaml:"client_key_passphrase_file"`
+	ClientKeyPassphraseEnv        string `yaml:"client_key_passphrase_env"`
+	ClientKeyPassphraseCredential string `yaml:"client_key_passphrase_credential"`
+
+	RequestTimeout   string `yaml:"request_timeout"`
+	MaxRetries       *int   `yaml:"max_retries"`
+	RetryBaseDelay   string `yaml:"retry_base_delay"`
+	RetryMaxDelay    string `yaml:"retry_max_delay"`
+	BreakerThreshold *int   `yaml:"breaker_threshold"`
+	BreakerCooldown  string `yaml:"breaker_cooldown"`
+
+	TLSReloadInterval string `yaml:"tls_reload_interval"`
+
+	TPMCertStore        string `yaml:"tpm_cert_store"`
+	VerifyAgentIdentity *bool  `yaml:"verify_agent_identity"`
+
+	AttestationMode string `yaml:"attestation_mode"`
+}
+
+// Tools restricts which MCP tools the server exposes. An empty allowlist exposes all tools.
+type Tools struct {
+	Allow []string `yaml:"allow"`
+}
+
+type LLM struct {
+	Provider        string `yaml:"provider"`
+	AnthropicAPIKey string `yaml:"anthropic_api_key"` // #nosec G117 -- loaded from operator config, never logged
+	OllamaURL       string `yaml:"ollama_url"`
+	OllamaModel     string `yaml:"ollama_model"`
+}
+
+// Cassette selects a file to record Keylime traffic to, or to replay it from
+type Cassette struct {
+	Record string `yaml:"record"`
+	Replay string `yaml:"replay"`
+}
+
+// History configures the local store of every policy version the server uploads or deletes
+type History struct {
+	Enabled *bool  `yaml:"enabled"`
+	Dir     string `yaml:"dir"`
+}
+
+type Web struct {
+	Port       string `yaml:"port"`
+	ServerPath string `yaml:"server_path"`
+}
+
+// Server is the resolved configuration of the MCP server
+type Server struct {
+	Clusters       map[string]*keylime.Config
+	PrimaryCluster string
+	MaskingEnabled bool
+	AllowedTools   []string
+	RecordCassette string
+	ReplayCassette string
+	HistoryDir     string // empty disables the policy history
+	HistoryOff     string // why HistoryDir is empty
+}
+
+// Client is the resolved configuration of the web client
+type Client struct {
+	ServerPath     string
+	Port           string
+	Provider       string
+	OllamaURL      string
+	OllamaModel    string
+	AnthropicKey   string
+	MaskingEnabled bool
+}
+
+// FieldError describes a single invalid setting. Field is either a config file
+// path such as profiles.prod.keylime.verifier_url or an environment variable name.
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+// ValidationError collects every invalid setting found while loading.
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, fe := range e.Errors {
+		msgs[i] = fmt.Sprintf("%s: %s", fe.Field, fe.Message)
+	}
+	return "invalid configuration: " + strings.Join(msgs, "; ")
+}
+
+type validator struct {
+	errs []FieldError
+}
+
+func (v *validator) add(field, format string, args ...any) {
+	v.errs = append(v.errs, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) err() error {
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return &ValidationError{Errors: v.errs}
+}
+
+var (
+	apiVersionRE = regexp.MustCompile(`^v\d+\.\d+$`)
+	toolNameRE   = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+)
+
+// LoadServer resolves the MCP server configuration: built-in defaults, then the
+// selected profile of the config file at path (if any), then environment variables.
+func LoadServer(path, profile string) (*Server, error) {
+	p, field, err := loadProfile(path, profile)
+	if err != nil {
+		return nil, err
+	}
+	v := &validator{}
+
+	base := keylime.Config{
+		VerifierURL:    "https://localhost:8881",
+		RegistrarURL:   "https://localhost:8891",
+		TLSEnabled:     true,
+		TLSServerName:  "localhost",
+		Port:           getEnv("PORT", "8080"),
+		MaskingEnabled: true,
+
+		RequestTimeout:   30 * time.Second,
+		MaxRetries:       3,
+		RetryBaseDelay:   250 * time.Millisecond,
+		RetryMaxDelay:    5 * time.Second,
+		BreakerThreshold: 5,
+		BreakerCooldown:  30 * time.Second,
+
+		TLSReloadInterval: 30 * time.Second,
+		KeyPassphraseEnv:  "KEYLIME_CLIENT_KEY_PASSPHRASE",
+		TPMCertStore:      "/var/lib/keylime/tpm_cert_store",
+	}
+	setCertDir(&base, defaultCertDir)
+	applyEndpoint(&base, p.Keylime, field+".keylime", v)
+	applyEndpointEnv(&base, "KEYLIME_", v)
+
+	if p.Masking != nil {
+		base.MaskingEnabled = *p.Masking
+	}
+	base.MaskingEnabled = envBool("MASKING_ENABLED", base.MaskingEnabled, v)
+
+	names, primary := clusterNames(p, field, v)
+	clusters := make(map[string]*keylime.Config, len(names))
+	for _, name := range names {
+		config := base
+		if e, ok := p.Clusters[name]; ok {
+			applyEndpoint(&config, e, fmt.Sprintf("%s.clusters.%s", field, name), v)
+		}
+		applyEndpointEnv(&config, "KEYLIME_"+strings.ToUpper(strings.ReplaceAll(name, "-", "_"))+"_", v)
+		clusters[name] = &config
+	}
+
+	allowed := p.Tools.Allow
+	allowedField := field + ".tools.allow"
+	if env := os.Getenv("KEYLIME_MCP_ALLOWED_TOOLS"); env != "" {
+		allowed = splitList(env)
+		allowedField = "KEYLIME_MCP_ALLOWED_TOOLS"
+	}
+	for _, name := range allowed {
+		if !toolNameRE.MatchString(name) {
+			v.add(allowedField, "invalid tool name %q", name)
+		}
+	}
+
+	record := getEnv("KEYLIME_MCP_RECORD", p.Cassette.Record)
+	replay := getEnv("KEYLIME_MCP_REPLAY", p.Cassette.Replay)
+	if record != "" && replay != "" {
+		v.add(field+".cassette", "record and replay cannot be used together")
+	}
+
+	historyEnabled := p.History.Enabled == nil || *p.History.Enabled
+	historyEnabled = envBool("KEYLIME_MCP_HISTORY_ENABLED", historyEnabled, v)
+	historyDir := getEnv("KEYLIME_MCP_HISTORY_DIR", p.History.Dir)
+	var historyOff string
+	switch {
+	case !historyEnabled:
+		historyDir, historyOff = "", "turned off by history.enabled or KEYLIME_MCP_HISTORY_ENABLED"
+	case historyDir == "":
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			historyOff = fmt.Sprintf("no directory to keep it in (%v); set history.dir or KEYLIME_MCP_HISTORY_DIR", err)
+		} else {
+			historyDir = filepath.Join(dir, "keylime-mcp", "history")
+		}
+	}
+
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+	return &Server{
+		Clusters:       clusters,
+		PrimaryCluster: primary,
+		MaskingEnabled: base.MaskingEnabled,
+		AllowedTools:   allowed,
+		RecordCassette: record,
+		ReplayCassette: replay,
+		HistoryDir:     historyDir,
+		HistoryOff:     historyOff,
+	}, nil
+}
+
+// LoadClient resolves the web client configuration with the same precedence as LoadServer.
+func LoadClient(path, profile string) (*Client, error) {
+	p, field, err := loadProfile(path, profile)
+	if err != nil {
+		return nil, err
+	}
+	v := &validator{}
+
+	c := &Client{
+		ServerPath:     "./server",
+		Port:           "3000",
+		OllamaURL:      "http://localhost:11434",
+		MaskingEnabled: true,
+	}
+
+	if p.Web.ServerPath != "" {
+		c.ServerPath = p.Web.ServerPath
+	}
+	if p.Web.Port != "" {
+		c.Port = checkPort(p.Web.Port, field+".web.port", v)
+	}
+	if p.LLM.Provider != "" {
+		c.Provider = checkProvider(p.LLM.Provider, field+".llm.provider", v)
+	}
+	if p.LLM.OllamaURL != "" {
+		c.OllamaURL = checkURL(p.LLM.OllamaURL, field+".llm.ollama_url", v)
+	}
+	c.OllamaModel = p.LLM.OllamaModel
+	c.AnthropicKey = strings.TrimSpace(p.LLM.AnthropicAPIKey)
+	if p.Masking != nil {
+		c.MaskingEnabled = *p.Masking
+	}
+
+	c.ServerPath = getEnv("MCP_SERVER_PATH", c.ServerPath)
+	if env := os.Getenv("PORT"); env != "" {
+		c.Port = checkPort(env, "PORT", v)
+	}
+	if env := os.Getenv("LLM_PROVIDER"); env != "" {
+		c.Provider = checkProvider(env, "LLM_PROVIDER", v)
+	}
+	if env := os.Getenv("OLLAMA_URL"); env != "" {
+		c.OllamaURL = checkURL(env, "OLLAMA_URL", v)
+	}
+	c.OllamaModel = getEnv("OLLAMA_MODEL", c.OllamaModel)
+	if env := strings.TrimSpace(os.Getenv("ANTHROPIC_API_KEY")); env != "" {
+		c.AnthropicKey = env
+	}
+	c.MaskingEnabled = envBool("MASKING_ENABLED", c.MaskingEnabled, v)
+
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// loadProfile reads the config file and returns the selected profile together
+// with its field path prefix for error messages. Without a file an empty profile is returned.
+func loadProfile(path, name string) (*Profile, string, error) {
+	if path == "" {
+		if name != "" {
+			return nil, "", fmt.Errorf("profile %q requested but no config file given", name)
+		}
+		return &Profile{}, "", nil
+	}
+
+	data, err := os.ReadFile(path) // #nosec G304 -- path is given by the operator via flag or env
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var file File
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&file); err != nil && !errors.Is(err, io.EOF) {
+		return nil, "", fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	if name == "" {
+		name = file.DefaultProfile
+	}
+	if name == "" && len(file.Profiles) == 1 {
+		for only := range file.Profiles {
+			name = only
+		}
+	}
+	if name == "" {
+		return nil, "", fmt.Errorf("config file %s: no profile selected and no default_profile set (available: %s)", path, profileNames(file))
+	}
+	profile, ok := file.Profiles[name]
+	if !ok {
+		return nil, "", fmt.Errorf("config file %s: unknown profile %q (available: %s)", path, name, profileNames(file))
+	}
+	if profile == nil {
+		profile = &Profile{}
+	}
+	return profile, "profiles." + name, nil
+}
+
+func profileNames(file File) string {
+	names := make([]string, 0, len(file.Profiles))
+	for name := range file.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// clusterNames returns the configured cluster names and the primary one.
+// KEYLIME_CLUSTERS replaces the clusters listed in the profile. Either way, a primary
+// cluster is required once there is more than one.
+func clusterNames(p *Profile, field string, v *validator) ([]string, string) {
+	var names []string
+	primaryField := field + ".primary_cluster"
+	if env := os.Getenv("KEYLIME_CLUSTERS"); env != "" {
+		names = splitList(env)
+	} else {
+		for name := range p.Clusters {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+	if len(names) == 0 {
+		names = []string{keylime.DefaultClusterName}
+	}
+
+	primary := p.PrimaryCluster
+	if env := os.Getenv("KEYLIME_PRIMARY_CLUSTER"); env != "" {
+		primary = env
+		primaryField = "KEYLIME_PRIMARY_CLUSTER"
+	}
+	if primary == "" {
+		if len(names) > 1 {
+			if os.Getenv("KEYLIME_CLUSTERS") != "" {
+				primaryField = "KEYLIME_PRIMARY_CLUSTER"
+			}
+			v.add(primaryField, "required when more than one cluster is configured")
+		}
+		return names, names[0]
+	}
+	for _, name := range names {
+		if name == primary {
+			return names, primary
+		}
+	}
+	v.add(primaryField, "cluster %q is not configured (available: %s)", primary, strings.Join(names, ", "))
+	return names, primary
+}
+
+// setCertDir points the client certificate paths at the standard file names inside dir.
+func setCertDir(config *keylime.Config, dir string) {
+	config.CertDir = dir
+	config.ClientCert = dir + "/client-cert.crt"
+	config.ClientKey = dir + "/client-private.pem"
+	config.CAPath = dir + "/cacert.crt"
+}
+
+func applyEndpoint(config *keylime.Config, e Endpoint, field string, v *validator) {
+	if e.VerifierURL != "" {
+		config.VerifierURL = checkURL(e.VerifierURL, field+".verifier_url", v)
+	}
+	if e.RegistrarURL != "" {
+		config.RegistrarURL = checkURL(e.RegistrarURL, field+".registrar_url", v)
+	}
+	if e.APIVersion != "" {
+		config.APIVersion = checkAPIVersion(e.APIVersion, field+".api_version", v)
+	}
+	if e.TLSEnabled != nil {
+		config.TLSEnabled = *e.TLSEnabled
+	}
+	if e.TLSServerName != "" {
+		config.TLSServerName = e.TLSServerName
+	}
+	if e.CertDir != "" {
+		setCertDir(config, e.CertDir)
+	}
+	if e.ClientCert != "" {
+		config.ClientCert = e.ClientCert
+	}
+	if e.ClientKey != "" {
+		config.ClientKey = e.ClientKey
+	}
+	if e.CACert != "" {
+		config.CAPath = e.CACert
+	}
+	if e.ClientKeyPassphraseFile != "" {
+		config.KeyPassphraseFile = e.ClientKeyPassphraseFile
+	}
+	if e.ClientKeyPassphraseEnv != "" {
+		config.KeyPassphraseEnv = e.ClientKeyPassphraseEnv
+	}
+	if e.ClientKeyPassphraseCredential != "" {
+		config.KeyPassphraseCredential = e.ClientKeyPassphraseCredential
+	}
+	if e.RequestTimeout != "" {
+		config.RequestTimeout = checkDuration(e.RequestTimeout, field+".request_timeout", config.RequestTimeout, v)
+	}
+	if e.MaxRetries != nil {
+		config.MaxRetries = checkCount(*e.MaxRetries, field+".max_retries", v)
+	}
+	if e.RetryBaseDelay != "" {
+		config.RetryBaseDelay = checkDuration(e.RetryBaseDelay, field+".retry_base_delay", config.RetryBaseDelay, v)
+	}
+	if e.RetryMaxDelay != "" {
+		config.RetryMaxDelay = checkDuration(e.RetryMaxDelay, field+".retry_max_delay", config.RetryMaxDelay, v)
+	}
+	if e.BreakerThreshold != nil {
+		config.BreakerThreshold = checkCount(*e.BreakerThreshold, field+".breaker_threshold", v)
+	}
+	if e.BreakerCooldown != "" {
+		config.BreakerCooldown = checkDuration(e.BreakerCooldown, field+".breaker_cooldown", config.BreakerCooldown, v)
+	}
+	if e.TLSReloadInterval != "" {
+		config.TLSReloadInterval = checkDuration(e.TLSReloadInterval, field+".tls_reload_interval", config.TLSReloadInterval, v)
+	}
+	if e.TPMCertStore != "" {
+		config.TPMCertStore = e.TPMCertStore
+	}
+	if e.VerifyAgentIdentity != nil {
+		config.VerifyAgentIdentity = *e.VerifyAgentIdentity
+	}
+	if e.AttestationMode != "" {
+		config.AttestationMode = checkAttestationMode(e.AttestationMode, field+".attestation_mode", v)
+	}
+}
+
+func applyEndpointEnv(config *keylime.Config, prefix string, v *validator) {
+	if env := os.Getenv(prefix + "VERIFIER_URL"); env != "" {
+		config.VerifierURL = checkURL(env, prefix+"VERIFIER_URL", v)
+	}
+	if env := os.Getenv(prefix + "REGISTRAR_URL"); env != "" {
+		config.RegistrarURL = checkURL(env, prefix+"REGISTRAR_URL", v)
+	}
+	if env := os.Getenv(prefix + "API_VERSION"); env != "" {
+		config.APIVersion = checkAPIVersion(env, prefix+"API_VERSION", v)
+	}
+	config.TLSEnabled = envBool(prefix+"TLS_ENABLED", config.TLSEnabled, v)
+	config.TLSServerName = getEnv(prefix+"TLS_SERVER_NAME", config.TLSServerName)
+	if env := os.Getenv(prefix + "CERT_DIR"); env != "" {
+		setCertDir(config, env)
+	}
+	config.ClientCert = getEnv(prefix+"CLIENT_CERT", config.ClientCert)
+	config.ClientKey = getEnv(prefix+"CLIENT_KEY", config.ClientKey)
+	config.CAPath = getEnv(prefix+"CA_CERT", config.CAPath)
+	config.KeyPassphraseFile = getEnv(prefix+"CLIENT_KEY_PASSPHRASE_FILE", config.KeyPassphraseFile)
+	if os.Getenv(prefix+"CLIENT_KEY_PASSPHRASE") != "" {
+		config.KeyPassphraseEnv = prefix + "CLIENT_KEY_PASSPHRASE"
+	}
+	config.KeyPassphraseCredential = getEnv(prefix+"CLIENT_KEY_PASSPHRASE_CREDENTIAL", config.KeyPassphraseCredential)
+	if env := os.Getenv(prefix + "REQUEST_TIMEOUT"); env != "" {
+		config.RequestTimeout = checkDuration(env, prefix+"REQUEST_TIMEOUT", config.RequestTimeout, v)
+	}
+	config.MaxRetries = envCount(prefix+"MAX_RETRIES", config.MaxRetries, v)
+	if env := os.Getenv(prefix + "RETRY_BASE_DELAY"); env != "" {
+		config.RetryBaseDelay = checkDuration(env, prefix+"RETRY_BASE_DELAY", config.RetryBaseDelay, v)
+	}
+	if env := os.Getenv(prefix + "RETRY_MAX_DELAY"); env != "" {
+		config.RetryMaxDelay = checkDuration(env, prefix+"RETRY_MAX_DELAY", config.RetryMaxDelay, v)
+	}
+	config.BreakerThreshold = envCount(prefix+"BREAKER_THRESHOLD", config.BreakerThreshold, v)
+	if env := os.Getenv(prefix + "BREAKER_COOLDOWN"); env != "" {
+		config.BreakerCooldown = checkDuration(env, prefix+"BREAKER_COOLDOWN", config.BreakerCooldown, v)
+	}
+	if env := os.Getenv(prefix + "TLS_RELOAD_INTERVAL"); env != "" {
+		config.TLSReloadInterval = checkDuration(env, prefix+"TLS_RELOAD_INTERVAL", config.TLSReloadInterval, v)
+	}
+	config.TPMCertStore = getEnv(prefix+"TPM_CERT_STORE", config.TPMCertStore)
+	config.VerifyAgentIdentity = envBool(prefix+"VERIFY_AGENT_IDENTITY", config.VerifyAgentIdentity, v)
+	if env := os.Getenv(prefix + "ATTESTATION_MODE"); env != "" {
+		config.AttestationMode = checkAttestationMode(env, prefix+"ATTESTATION_MODE", v)
+	}
+}
+
+func checkURL(value, field string, v *validator) string {
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		v.add(field, "must be an http:// or https:// URL with a host, got %q", value)
+	}
+	return value
+}
+
+func checkAPIVersion(value, field string, v *validator) string {
+	if !apiVersionRE.MatchString(value) {
+		v.add(field, "must look like v2.5, got %q", value)
+	}
+	return value
+}
+
+// checkDuration parses a Go duration such as "250ms" or "30s"; fallback is kept on error.
+func checkDuration(value, field string, fallback time.Duration, v *validator) time.Duration {
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		v.add(field, "must be a non-negative duration like 30s, got %q", value)
+		return fallback
+	}
+	return d
+}
+
+func checkCount(value int, field string, v *validator) int {
+	if value < 0 {
+		v.add(field, "must not be negative, got %d", value)
+		return 0
+	}
+	return value
+}
+
+func envCount(key string, fallback int, v *validator) int {
+	env := os.Getenv(key)
+	if env == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(env)
+	if err != nil {
+		v.add(key, "must be a whole number, got %q", env)
+		return fallback
+	}
+	return checkCount(n, key, v)
+}
+
+func checkPort(value, field string, v *validator) string {
+	port, err := strconv.Atoi(value)
+	if err != nil || port < 1 || port > 65535 {
+		v.add(field, "must be a port number between 1 and 65535, got %q", value)
+	}
+	return value
+}
+
+func checkProvider(value, field string, v *validator) string {
+	if value != providerAnthropic && value != providerOllama {
+		v.add(field, "must be %q or %q, got %q", providerAnthropic, providerOllama, value)
+	}
+	return value
+}
+
+func checkAttestationMode(value, field string, v *validator) string {
+	switch value {
+	case keylime.AttestationModeAuto, keylime.AttestationModePull, keylime.AttestationModePush:
+	default:
+		v.add(field, "must be %q, %q or %q, got %q", keylime.AttestationModeAuto, keylime.AttestationModePull, keylime.AttestationModePush, value)
+	}
+	return value
+}
+
+// envBool parses a boolean environment variable strictly; unset or empty keeps the current value.
+func envBool(key string, current bool, v *validator) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return current
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		v.add(key, "must be a boolean (true/false/1/0), got %q", value)
+		return current
+	}
+	return b
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,695 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/keylime/keylime-mcp/internal/keylime"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var serverEnvKeys = []string{
+	"KEYLIME_VERIFIER_URL", "KEYLIME_REGISTRAR_URL", "KEYLIME_CERT_DIR",
+	"KEYLIME_TLS_ENABLED", "KEYLIME_TLS_SERVER_NAME", "KEYLIME_API_VERSION",
+	"KEYLIME_CLIENT_CERT", "KEYLIME_CLIENT_KEY", "KEYLIME_CA_CERT", "PORT",
+	"MASKING_ENABLED", "KEYLIME_CLUSTERS", "KEYLIME_PRIMARY_CLUSTER", "KEYLIME_MCP_ALLOWED_TOOLS",
+	"KEYLIME_REQUEST_TIMEOUT", "KEYLIME_MAX_RETRIES", "KEYLIME_RETRY_BASE_DELAY",
+	"KEYLIME_RETRY_MAX_DELAY", "KEYLIME_BREAKER_THRESHOLD", "KEYLIME_BREAKER_COOLDOWN",
+	"KEYLIME_TLS_RELOAD_INTERVAL", "KEYLIME_CLIENT_KEY_PASSPHRASE", "KEYLIME_CLIENT_KEY_PASSPHRASE_FILE",
+	"KEYLIME_CLIENT_KEY_PASSPHRASE_CREDENTIAL", "KEYLIME_MCP_RECORD", "KEYLIME_MCP_REPLAY",
+	"KEYLIME_TPM_CERT_STORE", "KEYLIME_VERIFY_AGENT_IDENTITY", "KEYLIME_ATTESTATION_MODE",
+	"KEYLIME_MCP_HISTORY_DIR", "KEYLIME_MCP_HISTORY_ENABLED",
+}
+
+var clientEnvKeys = []string{
+	"MCP_SERVER_PATH", "PORT", "OLLAMA_URL", "OLLAMA_MODEL",
+	"ANTHROPIC_API_KEY", "MASKING_ENABLED", "LLM_PROVIDER",
+}
+
+func clearEnv(t *testing.T, keys []string) {
+	t.Helper()
+	for _, key := range keys {
+		t.Setenv(key, "")
+	}
+}
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func fieldErrors(t *testing.T, err error) map[string]string {
+	t.Helper()
+	var verr *ValidationError
+	require.True(t, errors.As(err, &verr), "expected ValidationError, got %v", err)
+	fields := map[string]string{}
+	for _, fe := range verr.Errors {
+		fields[fe.Field] = fe.Message
+	}
+	return fields
+}
+
+func TestGetEnv(t *testing.T) {
+	t.Run("returns env value when set", func(t *testing.T) {
+		t.Setenv("TEST_KEYLIME_MCP_KEY", "test_value")
+		assert.Equal(t, "test_value", getEnv("TEST_KEYLIME_MCP_KEY", "default"))
+	})
+
+	t.Run("returns default when unset", func(t *testing.T) {
+		assert.Equal(t, "default", getEnv("KEYLIME_MCP_NONEXISTENT_VAR", "default"))
+	})
+
+	t.Run("returns default when empty string", func(t *testing.T) {
+		t.Setenv("TEST_KEYLIME_MCP_EMPTY", "")
+		assert.Equal(t, "default", getEnv("TEST_KEYLIME_MCP_EMPTY", "default"))
+	})
+}
+
+func TestEnvBool(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+		valid    bool
+	}{
+		{"true", true, true},
+		{"false", false, true},
+		{"1", true, true},
+		{"0", false, true},
+		{"TRUE", true, true},
+		{"True", true, true},
+		{"", true, true}, // unset keeps the current value
+		{"invalid", true, false},
+		{"yes", true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			t.Setenv("TEST_KEYLIME_MCP_BOOL", tt.input)
+			v := &validator{}
+			assert.Equal(t, tt.expected, envBool("TEST_KEYLIME_MCP_BOOL", true, v))
+			if tt.valid {
+				assert.NoError(t, v.err())
+			} else {
+				assert.Contains(t, fieldErrors(t, v.err()), "TEST_KEYLIME_MCP_BOOL")
+			}
+		})
+	}
+}
+
+func TestLoadServerFromEnv(t *testing.T) {
+	t.Run("default values", func(t *testing.T) {
+		clearEnv(t, serverEnvKeys)
+
+		settings, err := LoadServer("", "")
+		require.NoError(t, err)
+
+		assert.Equal(t, keylime.DefaultClusterName, settings.PrimaryCluster)
+		require.Len(t, settings.Clusters, 1)
+		config := settings.Clusters[keylime.DefaultClusterName]
+		assert.Equal(t, "https://localhost:8881", config.VerifierURL)
+		assert.Equal(t, "https://localhost:8891", config.RegistrarURL)
+		assert.Equal(t, "/var/lib/keylime/cv_ca", config.CertDir)
+		assert.True(t, config.TLSEnabled)
+		assert.Equal(t, "localhost", config.TLSServerName)
+		assert.Empty(t, config.APIVersion, "empty API version means negotiate")
+		assert.Equal(t, "/var/lib/keylime/cv_ca/client-cert.crt", config.ClientCert)
+		assert.Equal(t, "/var/lib/keylime/cv_ca/client-private.pem", config.ClientKey)
+		assert.Equal(t, "/var/lib/keylime/cv_ca/cacert.crt", config.CAPath)
+		assert.Equal(t, "8080", config.Port)
+		assert.True(t, settings.MaskingEnabled)
+		assert.Empty(t, settings.AllowedTools)
+	})
+
+	t.Run("env vars override defaults", func(t *testing.T) {
+		clearEnv(t, serverEnvKeys)
+		t.Setenv("KEYLIME_VERIFIER_URL", "https://custom:9999")
+		t.Setenv("KEYLIME_REGISTRAR_URL", "https://custom:9998")
+		t.Setenv("KEYLIME_CERT_DIR", "/custom/certs")
+		t.Setenv("KEYLIME_TLS_ENABLED", "false")
+		t.Setenv("KEYLIME_API_VERSION", "v3.0")
+		t.Setenv("PORT", "9090")
+		t.Setenv("MASKING_ENABLED", "0")
+
+		settings, err := LoadServer("", "")
+		require.NoError(t, err)
+
+		config := settings.Clusters[keylime.DefaultClusterName]
+		assert.Equal(t, "https://custom:9999", config.VerifierURL)
+		assert.Equal(t, "https://custom:9998", config.RegistrarURL)
+		assert.Equal(t, "/custom/certs", config.CertDir)
+		assert.False(t, config.TLSEnabled)
+		assert.Equal(t, "v3.0", config.APIVersion)
+		assert.Equal(t, "9090", config.Port)
+		assert.Equal(t, "localhost", config.TLSServerName)
+		assert.Equal(t, "/custom/certs/client-cert.crt", config.ClientCert)
+		assert.Equal(t, "/custom/certs/client-private.pem", config.ClientKey)
+		assert.Equal(t, "/custom/certs/cacert.crt", config.CAPath)
+		assert.False(t, settings.MaskingEnabled)
+	})
+
+	t.Run("named clusters with per-cluster overrides", func(t *testing.T) {
+		clearEnv(t, serverEnvKeys)
+		t.Setenv("KEYLIME_CLUSTERS", "dc1, eu-west")
+		t.Setenv("KEYLIME_PRIMARY_CLUSTER", "eu-west")
+		t.Setenv("KEYLIME_DC1_VERIFIER_URL", "https://dc1:8881")
+		t.Setenv("KEYLIME_EU_WEST_VERIFIER_URL", "https://eu:8881")
+		t.Setenv("KEYLIME_EU_WEST_CERT_DIR", "/etc/keylime/eu")
+		t.Setenv("KEYLIME_EU_WEST_TLS_ENABLED", "false")
+
+		settings, err := LoadServer("", "")
+		require.NoError(t, err)
+
+		assert.Equal(t, "eu-west", settings.PrimaryCluster)
+		require.Len(t, settings.Clusters, 2)
+
+		dc1 := settings.Clusters["dc1"]
+		assert.Equal(t, "https://dc1:8881", dc1.VerifierURL)
+		assert.Equal(t, "https://localhost:8891", dc1.RegistrarURL)
+		assert.Equal(t, "/var/lib/keylime/cv_ca/client-cert.crt", dc1.ClientCert)
+		assert.True(t, dc1.TLSEnabled)
+
+		eu := settings.Clusters["eu-west"]
+		assert.Equal(t, "https://eu:8881", eu.VerifierURL)
+		assert.Equal(t, "/etc/keylime/eu/client-cert.crt", eu.ClientCert)
+		assert.Equal(t, "/etc/keylime/eu/cacert.crt", eu.CAPath)
+		assert.False(t, eu.TLSEnabled)
+	})
+
+	t.Run("primary required for several listed clusters", func(t *testing.T) {
+		clearEnv(t, serverEnvKeys)
+		t.Setenv("KEYLIME_CLUSTERS", "dc2,dc1")
+
+		_, err := LoadServer("", "")
+		fields := fieldErrors(t, err)
+		assert.Contains(t, fields["KEYLIME_PRIMARY_CLUSTER"], "required")
+
+		t.Setenv("KEYLIME_CLUSTERS", "dc2")
+		settings, err := LoadServer("", "")
+		require.NoError(t, err)
+		assert.Equal(t, "dc2", settings.PrimaryCluster)
+	})
+
+	t.Run("invalid env values are rejected with their names", func(t *testing.T) {
+		clearEnv(t, serverEnvKeys)
+		t.Setenv("KEYLIME_TLS_ENABLED", "maybe")
+		t.Setenv("MASKING_ENABLED", "nope")
+		t.Setenv("KEYLIME_VERIFIER_URL", "localhost:8881")
+		t.Setenv("KEYLIME_API_VERSION", "2.5")
+
+		_, err := LoadServer("", "")
+		require.Error(t, err)
+
+		fields := fieldErrors(t, err)
+		assert.Contains(t, fields, "KEYLIME_TLS_ENABLED")
+		assert.Contains(t, fields, "MASKING_ENABLED")
+		assert.Contains(t, fields, "KEYLIME_VERIFIER_URL")
+		assert.Contains(t, fields, "KEYLIME_API_VERSION")
+	})
+}
+
+const testConfigFile = `
+default_profile: staging
+profiles:
+  staging:
+    keylime:
+      verifier_url: https://staging-verifier:8881
+      registrar_url: https://staging-registrar:8891
+      cert_dir: /etc/keylime/staging
+    masking: false
+    tools:
+      allow: [Get_agent_status, Get_failed_agents]
+    llm:
+      provider: ollama
+      ollama_url: http://gpu-host:11434
+      ollama_model: llama3
+    web:
+      port: "4000"
+      server_path: /usr/libexec/keylime-mcp/server
+  prod:
+    keylime:
+      api_version: v2.4
+      client_key: /etc/keylime/prod/key.pem
+    primary_cluster: dc1
+    clusters:
+      dc1:
+        verifier_url: https://dc1-verifier:8881
+        registrar_url: https://dc1-registrar:8891
+      dc2:
+        verifier_url: https://dc2-verifier:8881
+        registrar_url: https://dc2-registrar:8891
+        cert_dir: /etc/keylime/dc2
+`
+
+func TestLoadServerFromFile(t *testing.T) {
+	path := writeConfig(t, testConfigFile)
+
+	t.Run("default profile", func(t *testing.T) {
+		clearEnv(t, serverEnvKeys)
+
+		settings, err := LoadServer(path, "")
+		require.NoError(t, err)
+
+		config := settings.Clusters[keylime.DefaultClusterName]
+		require.NotNil(t, config)
+		assert.Equal(t, "https://staging-verifier:8881", config.VerifierURL)
+		assert.Equal(t, "/etc/keylime/staging/client-cert.crt", config.ClientCert)
+		assert.False(t, settings.MaskingEnabled)
+		assert.Equal(t, []string{"Get_agent_status", "Get_failed_agents"}, settings.AllowedTools)
+	})
+
+	t.Run("named profile with clusters", func(t *testing.T) {
+		clearEnv(t, serverEnvKeys)
+
+		settings, err := LoadServer(path, "prod")
+		require.NoError(t, err)
+
+		assert.Equal(t, "dc1", settings.PrimaryCluster)
+		require.Len(t, settings.Clusters, 2)
+		assert.Equal(t, "https://dc1-verifier:8881", settings.Clusters["dc1"].VerifierURL)
+		assert.Equal(t, "v2.4", settings.Clusters["dc1"].APIVersion)
+		assert.Equal(t, "/etc/keylime/prod/key.pem", settings.Clusters["dc1"].ClientKey)
+		assert.Equal(t, "/etc/keylime/dc2/client-private.pem", settings.Clusters["dc2"].ClientKey)
+		assert.True(t, settings.MaskingEnabled)
+	})
+
+	t.Run("env overrides file", func(t *testing.T) {
+		clearEnv(t, serverEnvKeys)
+		t.Setenv("KEYLIME_VERIFIER_URL", "https://env-verifier:8881")
+		t.Setenv("KEYLIME_DC2_VERIFIER_URL", "https://env-dc2:8881")
+		t.Setenv("MASKING_ENABLED", "true")
+		t.Setenv("KEYLIME_MCP_ALLOWED_TOOLS", "Get_all_agents")
+
+		settings, err := LoadServer(path, "staging")
+		require.NoError(t, err)
+		assert.Equal(t, "https://env-verifier:8881", settings.Clusters[keylime.DefaultClusterName].VerifierURL)
+		assert.True(t, settings.MaskingEnabled)
+		assert.Equal(t, []string{"Get_all_agents"}, settings.AllowedTools)
+
+		settings, err = LoadServer(path, "prod")
+		require.NoError(t, err)
+		assert.Equal(t, "https://dc1-verifier:8881", settings.Clusters["dc1"].VerifierURL)
+		assert.Equal(t, "https://env-dc2:8881", settings.Clusters["dc2"].VerifierURL)
+	})
+
+	t.Run("unknown profile", func(t *testing.T) {
+		clearEnv(t, serverEnvKeys)
+
+		_, err := LoadServer(path, "qa")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `unknown profile "qa"`)
+		assert.Contains(t, err.Error(), "prod, staging")
+	})
+
+	t.Run("profile without file", func(t *testing.T) {
+		_, err := LoadServer("", "prod")
+		assert.Error(t, err)
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		_, err := LoadServer(filepath.Join(t.TempDir(), "missing.yaml"), "")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to read config file")
+	})
+}
+
+func TestLoadServerResilience(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		clearEnv(t, serverEnvKeys)
+
+		settings, err := LoadServer("", "")
+		require.NoError(t, err)
+		config := settings.Clusters[keylime.DefaultClusterName]
+		assert.Equal(t, 30*time.Second, config.RequestTimeout)
+		assert.Equal(t, 3, config.MaxRetries)
+		assert.Equal(t, 250*time.Millisecond, config.RetryBaseDelay)
+		assert.Equal(t, 5*time.Second, config.RetryMaxDelay)
+		assert.Equal(t, 5, config.BreakerThreshold)
+		assert.Equal(t, 30*time.Second, config.BreakerCooldown)
+		assert.Equal(t, 30*time.Second, config.TLSReloadInterval)
+	})
+
+	t.Run("file and env", func(t *testing.T) {
+		clearEnv(t, serverEnvKeys)
+		t.Setenv("KEYLIME_DC2_MAX_RETRIES", "0")
+		t.Setenv("KEYLIME_BREAKER_COOLDOWN", "1m")
+		t.Setenv("KEYLIME_DC1_TLS_RELOAD_INTERVAL", "0s")
+		path := writeConfig(t, `
+profiles:
+  prod:
+    primary_cluster: dc1
+    keylime:
+      request_timeout: 10s
+      max_retries: 5
+      breaker_threshold: 0
+    clusters:
+      dc1: {}
+      dc2:
+        retry_base_delay: 1s
+`)
+
+		settings, err := LoadServer(path, "")
+		require.NoError(t, err)
+		dc1, dc2 := settings.Clusters["dc1"], settings.Clusters["dc2"]
+		assert.Equal(t, 10*time.Second, dc1.RequestTimeout)
+		assert.Equal(t, 5, dc1.MaxRetries)
+		assert.Equal(t, 0, dc1.BreakerThreshold)
+		assert.Equal(t, time.Minute, dc1.BreakerCooldown)
+		assert.Zero(t, dc1.TLSReloadInterval)
+		assert.Equal(t, 30*time.Second, dc2.TLSReloadInterval)
+		assert.Equal(t, 0, dc2.MaxRetries)
+		assert.Equal(t, time.Second, dc2.RetryBaseDelay)
+	})
+
+	t.Run("invalid values", func(t *testing.T) {
+		clearEnv(t, serverEnvKeys)
+		t.Setenv("KEYLIME_MAX_RETRIES", "many")
+		t.Setenv("KEYLIME_BREAKER_THRESHOLD", "-1")
+		path := writeConfig(t, `
+profiles:
+  prod:
+    keylime:
+      request_timeout: soon
+      retry_max_delay: -5s
+`)
+
+		_, err := LoadServer(path, "")
+		fields := fieldErrors(t, err)
+		assert.Contains(t, fields, "profiles.prod.keylime.request_timeout")
+		assert.Contains(t, fields, "profiles.prod.keylime.retry_max_delay")
+		assert.Contains(t, fields, "KEYLIME_MAX_RETRIES")
+		assert.Contains(t, fields, "KEYLIME_BREAKER_THRESHOLD")
+	})
+}
+
+func TestLoadServerRejectsBadFile(t *testing.T) {
+	t.Run("field-level errors", func(t *testing.T) {
+		clearEnv(t, serverEnvKeys)
+		path := writeConfig(t, `
+profiles:
+  prod:
+    keylime:
+      verifier_url: "ftp://verifier"
+      api_version: latest
+    clusters:
+      dc1: {}
+      dc2: {}
+    tools:
+      allow: ["Get agent status"]
+`)
+
+		_, err := LoadServer(path, "")
+		require.Error(t, err)
+
+		fields := fieldErrors(t, err)
+		assert.Contains(t, fields, "profiles.prod.keylime.verifier_url")
+		assert.Contains(t, fields, "profiles.prod.keylime.api_version")
+		assert.Contains(t, fields, "profiles.prod.primary_cluster")
+		assert.Contains(t, fields, "profiles.prod.tools.allow")
+	})
+
+	t.Run("primary cluster must exist", func(t *testing.T) {
+		clearEnv(t, serverEnvKeys)
+		path := writeConfig(t, `
+profiles:
+  prod:
+    primary_cluster: dc3
+    clusters:
+      dc1: {}
+`)
+
+		_, err := LoadServer(path, "")
+		require.Error(t, err)
+		assert.Contains(t, fieldErrors(t, err)["profiles.prod.primary_cluster"], `"dc3"`)
+	})
+
+	t.Run("unknown keys rejected", func(t *testing.T) {
+		path := writeConfig(t, `
+profiles:
+  prod:
+    keylime:
+      verifer_url: https://typo:8881
+`)
+
+		_, err := LoadServer(path, "")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "verifer_url")
+	})
+
+	t.Run("non-boolean value rejected", func(t *testing.T) {
+		path := writeConfig(t, `
+profiles:
+  prod:
+    masking: maybe
+`)
+
+		_, err := LoadServer(path, "")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "maybe")
+	})
+
+	t.Run("ambiguous profile selection", func(t *testing.T) {
+		path := writeConfig(t, `
+profiles:
+  a: {}
+  b: {}
+`)
+
+		_, err := LoadServer(path, "")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "no profile selected")
+	})
+}
+
+func TestLoadClient(t *testing.T) {
+	t.Run("default values", func(t *testing.T) {
+		clearEnv(t, clientEnvKeys)
+
+		cfg, err := LoadClient("", "")
+		require.NoError(t, err)
+
+		assert.Equal(t, "./server", cfg.ServerPath)
+		assert.Equal(t, "3000", cfg.Port)
+		assert.Equal(t, "http://localhost:11434", cfg.OllamaURL)
+		assert.Equal(t, "", cfg.OllamaModel)
+		assert.Equal(t, "", cfg.AnthropicKey)
+		assert.Equal(t, "", cfg.Provider)
+		assert.True(t, cfg.MaskingEnabled)
+	})
+
+	t.Run("env vars override defaults", func(t *testing.T) {
+		clearEnv(t, clientEnvKeys)
+		t.Setenv("MCP_SERVER_PATH", "/custom/server")
+		t.Setenv("PORT", "8080")
+		t.Setenv("OLLAMA_URL", "http://custom:11434")
+		t.Setenv("OLLAMA_MODEL", "llama3")
+		t.Setenv("ANTHROPIC_API_KEY", "  sk-test-key  \n")
+		t.Setenv("MASKING_ENABLED", "false")
+
+		cfg, err := LoadClient("", "")
+		require.NoError(t, err)
+
+		assert.Equal(t, "/custom/server", cfg.ServerPath)
+		assert.Equal(t, "8080", cfg.Port)
+		assert.Equal(t, "http://custom:11434", cfg.OllamaURL)
+		assert.Equal(t, "llama3", cfg.OllamaModel)
+		assert.Equal(t, "sk-test-key", cfg.AnthropicKey)
+		assert.False(t, cfg.MaskingEnabled)
+	})
+
+	t.Run("file profile with env override", func(t *testing.T) {
+		clearEnv(t, clientEnvKeys)
+		t.Setenv("OLLAMA_MODEL", "mistral")
+		path := writeConfig(t, testConfigFile)
+
+		cfg, err := LoadClient(path, "staging")
+		require.NoError(t, err)
+
+		assert.Equal(t, "/usr/libexec/keylime-mcp/server", cfg.ServerPath)
+		assert.Equal(t, "4000", cfg.Port)
+		assert.Equal(t, "ollama", cfg.Provider)
+		assert.Equal(t, "http://gpu-host:11434", cfg.OllamaURL)
+		assert.Equal(t, "mistral", cfg.OllamaModel)
+		assert.False(t, cfg.MaskingEnabled)
+	})
+
+	t.Run("invalid values rejected", func(t *testing.T) {
+		clearEnv(t, clientEnvKeys)
+		t.Setenv("PORT", "http")
+		t.Setenv("LLM_PROVIDER", "gpt")
+		t.Setenv("MASKING_ENABLED", "sometimes")
+
+		_, err := LoadClient("", "")
+		require.Error(t, err)
+
+		fields := fieldErrors(t, err)
+		assert.Contains(t, fields, "PORT")
+		assert.Contains(t, fields, "LLM_PROVIDER")
+		assert.Contains(t, fields, "MASKING_ENABLED")
+	})
+}
+
+func TestLoadServerKeyPassphrase(t *testing.T) {
+	clearEnv(t, serverEnvKeys)
+	t.Setenv("KEYLIME_DC2_CLIENT_KEY_PASSPHRASE", "secret")
+	t.Setenv("KEYLIME_DC3_CLIENT_KEY_PASSPHRASE_CREDENTIAL", "keylime-dc3-key")
+	path := writeConfig(t, `
+profiles:
+  prod:
+    primary_cluster: dc1
+    clusters:
+      dc1:
+        client_key_passphrase_file: /etc/keylime-mcp/dc1.pass
+      dc2: {}
+      dc3: {}
+`)
+
+	settings, err := LoadServer(path, "")
+	require.NoError(t, err)
+	dc1, dc2, dc3 := settings.Clusters["dc1"], settings.Clusters["dc2"], settings.Clusters["dc3"]
+	assert.Equal(t, "/etc/keylime-mcp/dc1.pass", dc1.KeyPassphraseFile)
+	assert.Equal(t, "KEYLIME_CLIENT_KEY_PASSPHRASE", dc1.KeyPassphraseEnv)
+	assert.Equal(t, "KEYLIME_DC2_CLIENT_KEY_PASSPHRASE", dc2.KeyPassphraseEnv, "cluster variable is used when set")
+	assert.Equal(t, "keylime-dc3-key", dc3.KeyPassphraseCredential)
+}
+
+func TestLoadServerCassette(t *testing.T) {
+	t.Run("file and env", func(t *testing.T) {
+		clearEnv(t, serverEnvKeys)
+		path := writeConfig(t, `
+profiles:
+  support:
+    cassette:
+      replay: /tmp/session.jsonl
+`)
+		settings, err := LoadServer(path, "")
+		require.NoError(t, err)
+		assert.Equal(t, "/tmp/session.jsonl", settings.ReplayCassette)
+		assert.Empty(t, settings.RecordCassette)
+
+		t.Setenv("KEYLIME_MCP_RECORD", "/tmp/record.jsonl")
+		_, err = LoadServer(path, "")
+		fields := fieldErrors(t, err)
+		assert.Contains(t, fields["profiles.support.cassette"], "cannot be used together")
+	})
+}
+
+func TestLoadServerHistory(t *testing.T) {
+	t.Run("defaults to the user config directory", func(t *testing.T) {
+		clearEnv(t, serverEnvKeys)
+		t.Setenv("XDG_CONFIG_HOME", "/home/operator/.config")
+		settings, err := LoadServer("", "")
+		require.NoError(t, err)
+		assert.Equal(t, "/home/operator/.config/keylime-mcp/history", settings.HistoryDir)
+	})
+
+	t.Run("file and env", func(t *testing.T) {
+		clearEnv(t, serverEnvKeys)
+		path := writeConfig(t, `
+profiles:
+  prod:
+    history:
+      dir: /var/lib/keylime-mcp/history
+`)
+		settings, err := LoadServer(path, "")
+		require.NoError(t, err)
+		assert.Equal(t, "/var/lib/keylime-mcp/history", settings.HistoryDir)
+
+		t.Setenv("KEYLIME_MCP_HISTORY_ENABLED", "false")
+		settings, err = LoadServer(path, "")
+		require.NoError(t, err)
+		assert.Empty(t, settings.HistoryDir, "disabled")
+		assert.Contains(t, settings.HistoryOff, "turned off")
+	})
+
+	t.Run("no user config directory", func(t *testing.T) {
+		clearEnv(t, serverEnvKeys)
+		t.Setenv("XDG_CONFIG_HOME", "")
+		t.Setenv("HOME", "")
+		settings, err := LoadServer("", "")
+		require.NoError(t, err)
+		assert.Empty(t, settings.HistoryDir)
+		assert.Contains(t, settings.HistoryOff, "set history.dir or KEYLIME_MCP_HISTORY_DIR")
+	})
+}
+
+func TestLoadServerIdentityVerification(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		clearEnv(t, serverEnvKeys)
+		settings, err := LoadServer("", "")
+		require.NoError(t, err)
+		config := settings.Clusters[keylime.DefaultClusterName]
+		assert.Equal(t, "/var/lib/keylime/tpm_cert_store", config.TPMCertStore)
+		assert.False(t, config.VerifyAgentIdentity)
+	})
+
+	t.Run("file and env", func(t *testing.T) {
+		clearEnv(t, serverEnvKeys)
+		t.Setenv("KEYLIME_DC2_VERIFY_AGENT_IDENTITY", "false")
+		path := writeConfig(t, `
+profiles:
+  prod:
+    primary_cluster: dc1
+    keylime:
+      verify_agent_identity: true
+    clusters:
+      dc1:
+        tpm_cert_store: /etc/keylime/tpm_cert_store
+      dc2: {}
+`)
+		settings, err := LoadServer(path, "")
+		require.NoError(t, err)
+		dc1, dc2 := settings.Clusters["dc1"], settings.Clusters["dc2"]
+		assert.True(t, dc1.VerifyAgentIdentity)
+		assert.Equal(t, "/etc/keylime/tpm_cert_store", dc1.TPMCertStore)
+		assert.False(t, dc2.VerifyAgentIdentity, "cluster variable overrides the profile")
+		assert.Equal(t, "/var/lib/keylime/tpm_cert_store", dc2.TPMCertStore)
+	})
+
+	t.Run("invalid flag", func(t *testing.T) {
+		clearEnv(t, serverEnvKeys)
+		t.Setenv("KEYLIME_VERIFY_AGENT_IDENTITY", "sometimes")
+		_, err := LoadServer("", "")
+		assert.Contains(t, fieldErrors(t, err), "KEYLIME_VERIFY_AGENT_IDENTITY")
+	})
+}
+
+func TestLoadServerAttestationMode(t *testing.T) {
+	t.Run("auto-detected by default", func(t *testing.T) {
+		clearEnv(t, serverEnvKeys)
+		settings, err := LoadServer("", "")
+		require.NoError(t, err)
+		assert.Empty(t, settings.Clusters[keylime.DefaultClusterName].AttestationMode)
+	})
+
+	t.Run("file and env", func(t *testing.T) {
+		clearEnv(t, serverEnvKeys)
+		t.Setenv("KEYLIME_DC2_ATTESTATION_MODE", "pull")
+		path := writeConfig(t, `
+profiles:
+  prod:
+    primary_cluster: dc1
+    keylime:
+      attestation_mode: push
+    clusters:
+      dc1: {}
+      dc2: {}
+`)
+		settings, err := LoadServer(path, "")
+		require.NoError(t, err)
+		assert.Equal(t, keylime.AttestationModePush, settings.Clusters["dc1"].AttestationMode)
+		assert.Equal(t, keylime.AttestationModePull, settings.Clusters["dc2"].AttestationMode)
+	})
+
+	t.Run("invalid mode", func(t *testing.T) {
+		clearEnv(t, serverEnvKeys)
+		t.Setenv("KEYLIME_ATTESTATION_MODE", "polling")
+		_, err := LoadServer("", "")
+		assert.Contains(t, fieldErrors(t, err), "KEYLIME_ATTESTATION_MODE")
+	})
+}
@@ -0,0 +1,241 @@
+// Package history keeps every policy version the server uploads to or deletes from a verifier
+// in a local content-addressed store, so that any of them can be restored later.
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Policy kinds
+const (
+	KindRuntime = "runtime"
+	KindMB      = "mb"
+)
+
+// Actions recorded for a version
+const (
+	ActionUploaded = "uploaded" // the version was uploaded by a tool
+	ActionReplaced = "replaced" // the version was on the verifier before a tool overwrote it
+	ActionDeleted  = "deleted"  // the version was on the verifier before a tool deleted it
+)
+
+// ErrNotFound is returned for an unknown entry ID.
+var ErrNotFound = errors.New("history entry not found")
+
+const indexFile = "index.jsonl"
+
+// Entry records one policy version. The content is stored once per digest.
+type Entry struct {
+	ID      int       `json:"id"`
+	Time    time.Time `json:"time"`
+	Cluster string    `json:"cluster"`
+	Kind    string    `json:"kind"` // KindRuntime or KindMB
+	Name    string    `json:"name"`
+	Action  string    `json:"action"`
+	Tool    string    `json:"tool"`
+	Reason  string    `json:"reason,omitempty"`
+	Digest  string    `json:"digest"` // hex SHA-256 of the content, its address in the store
+	Size    int       `json:"size"`
+
+	RestoredFrom int `json:"restored_from,omitempty"` // ID of the entry a rollback uploaded again
+}
+
+// Filter selects entries; empty fields match everything.
+type Filter struct {
+	Cluster string
+	Kind    string
+	Name    string
+}
+
+func (f Filter) match(e Entry) bool {
+	return (f.Cluster == "" || f.Cluster == e.Cluster) &&
+		(f.Kind == "" || f.Kind == e.Kind) &&
+		(f.Name == "" || f.Name == e.Name)
+}
+
+// Store is a policy history in a directory: an append-only index.jsonl of entries and the
+// contents under objects/, named by digest. One Store must own the directory at a time.
+type Store struct {
+	dir string
+	mu  sync.Mutex
+	now func() time.Time
+}
+
+// Open opens the history in dir, creating the directory if needed.
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Join(dir, "objects"), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create policy history: %w", err)
+	}
+	return &Store{dir: dir, now: time.Now}, nil
+}
+
+// Dir returns the directory of the store.
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// Record stores content and appends an entry for it. ID, Time, Digest and Size are filled in.
+func (s *Store) Record(e Entry, content []byte) (Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := s.load()
+	if err != nil {
+		return Entry{}, err
+	}
+	e.Digest, e.Size = Digest(content), len(content)
+	if err := s.writeObject(e.Digest, content); err != nil {
+		return Entry{}, err
+	}
+	e.ID, e.Time = len(entries)+1, s.now().UTC()
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		return Entry{}, err
+	}
+	file, err := os.OpenFile(filepath.Join(s.dir, indexFile), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600) // #nosec G304 -- operator-configured history directory
+	if err != nil {
+		return Entry{}, fmt.Errorf("failed to open policy history: %w", err)
+	}
+	defer file.Close()
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return Entry{}, fmt.Errorf("failed to write policy history: %w", err)
+	}
+	return e, nil
+}
+
+// List returns the entries matching f, newest first.
+func (s *Store) List(f Filter) ([]Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	var matched []Entry
+	for i := len(entries) - 1; i >= 0; i-- {
+		if f.match(entries[i]) {
+			matched = append(matched, entries[i])
+		}
+	}
+	return matched, nil
+}
+
+// Latest returns the newest entry for a policy.
+func (s *Store) Latest(cluster, kind, name string) (Entry, bool, error) {
+	entries, err := s.List(Filter{Cluster: cluster, Kind: kind, Name: name})
+	if err != nil || len(entries) == 0 {
+		return Entry{}, false, err
+	}
+	return entries[0], true, nil
+}
+
+// Get returns the entry with the given ID.
+func (s *Store) Get(id int) (Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries, err := s.load()
+	if err != nil {
+		return Entry{}, err
+	}
+	if id < 1 || id > len(entries) {
+		return Entry{}, fmt.Errorf("%w: %d", ErrNotFound, id)
+	}
+	return entries[id-1], nil
+}
+
+// Content returns the stored content of an entry, checked against its digest.
+func (s *Store) Content(e Entry) ([]byte, error) {
+	path, err := s.objectPath(e.Digest)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path) // #nosec G304 -- path is built from a validated hex digest
+	if err != nil {
+		return nil, fmt.Errorf("failed to read version %d: %w", e.ID, err)
+	}
+	if Digest(data) != e.Digest {
+		return nil, fmt.Errorf("stored content of version %d is corrupted", e.ID)
+	}
+	return data, nil
+}
+
+// Digest returns the address of content in the store.
+func Digest(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *Store) load() ([]Entry, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, indexFile)) // #nosec G304 -- operator-configured history directory
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy history: %w", err)
+	}
+	var entries []Entry
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("policy history %s line %d: %w", indexFile, line, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// writeObject stores content under its digest. Existing objects are kept as they are.
+func (s *Store) writeObject(digest string, content []byte) error {
+	path, err := s.objectPath(digest)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("failed to store policy version: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to store policy version: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to store policy version: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to store policy version: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to store policy version: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) objectPath(digest string) (string, error) {
+	if len(digest) != sha256.Size*2 {
+		return "", fmt.Errorf("invalid digest %q", digest)
+	}
+	if _, err := hex.DecodeString(digest); err != nil {
+		return "", fmt.Errorf("invalid digest %q", digest)
+	}
+	return filepath.Join(s.dir, "objects", digest[:2], digest[2:]), nil
+}
@@ -0,0 +1,96 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore(t *testing.T) {
+	open := func(t *testing.T) *Store {
+		t.Helper()
+		s, err := Open(filepath.Join(t.TempDir(), "history"))
+		require.NoError(t, err)
+		s.now = func() time.Time { return time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC) }
+		return s
+	}
+
+	t.Run("records and lists newest first", func(t *testing.T) {
+		s := open(t)
+		first, err := s.Record(Entry{Cluster: "default", Kind: KindRuntime, Name: "web", Action: ActionUploaded, Tool: "Import_runtime_policy", Reason: "initial"}, []byte(`{"a":1}`))
+		require.NoError(t, err)
+		assert.Equal(t, 1, first.ID)
+		assert.Equal(t, 7, first.Size)
+		assert.Len(t, first.Digest, 64)
+		assert.Equal(t, time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC), first.Time)
+
+		_, err = s.Record(Entry{Cluster: "default", Kind: KindMB, Name: "web", Action: ActionUploaded, Tool: "Import_mb_policy"}, []byte(`{}`))
+		require.NoError(t, err)
+		third, err := s.Record(Entry{Cluster: "default", Kind: KindRuntime, Name: "web", Action: ActionDeleted, Tool: "Delete_runtime_policy"}, []byte(`{"a":1}`))
+		require.NoError(t, err)
+		assert.Equal(t, first.Digest, third.Digest, "content addressed")
+
+		all, err := s.List(Filter{})
+		require.NoError(t, err)
+		require.Len(t, all, 3)
+		assert.Equal(t, []int{3, 2, 1}, []int{all[0].ID, all[1].ID, all[2].ID})
+
+		runtime, err := s.List(Filter{Kind: KindRuntime, Name: "web"})
+		require.NoError(t, err)
+		assert.Len(t, runtime, 2)
+
+		latest, ok, err := s.Latest("default", KindRuntime, "web")
+		require.NoError(t, err)
+		require.True(t, ok)
+		assert.Equal(t, third, latest)
+
+		_, ok, err = s.Latest("other", KindRuntime, "web")
+		require.NoError(t, err)
+		assert.False(t, ok)
+
+		objects, err := filepath.Glob(filepath.Join(s.Dir(), "objects", "*", "*"))
+		require.NoError(t, err)
+		assert.Len(t, objects, 2, "identical contents are stored once")
+	})
+
+	t.Run("content survives reopening", func(t *testing.T) {
+		s := open(t)
+		e, err := s.Record(Entry{Kind: KindRuntime, Name: "web", Action: ActionUploaded}, []byte("v1"))
+		require.NoError(t, err)
+
+		reopened, err := Open(s.Dir())
+		require.NoError(t, err)
+		got, err := reopened.Get(e.ID)
+		require.NoError(t, err)
+		assert.Equal(t, e, got)
+		content, err := reopened.Content(got)
+		require.NoError(t, err)
+		assert.Equal(t, "v1", string(content))
+	})
+
+	t.Run("unknown entry", func(t *testing.T) {
+		s := open(t)
+		_, err := s.Get(1)
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("corrupted content is detected", func(t *testing.T) {
+		s := open(t)
+		e, err := s.Record(Entry{Kind: KindRuntime, Name: "web"}, []byte("v1"))
+		require.NoError(t, err)
+		path := filepath.Join(s.Dir(), "objects", e.Digest[:2], e.Digest[2:])
+		require.NoError(t, os.WriteFile(path, []byte("v2"), 0o600))
+		_, err = s.Content(e)
+		assert.ErrorContains(t, err, "corrupted")
+	})
+
+	t.Run("digest must be hex", func(t *testing.T) {
+		s := open(t)
+		_, err := s.Content(Entry{Digest: "../../../etc/passwd"})
+		assert.ErrorContains(t, err, "invalid digest")
+	})
+}
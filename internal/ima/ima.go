@@ -0,0 +1,144 @@
+// Package ima parses the IMA measurement list in the format of
+// /sys/kernel/security/ima/ascii_runtime_measurements.
+package ima
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Templates supported by Parse
+const (
+	TemplateIMA    = "ima"
+	TemplateIMANG  = "ima-ng"
+	TemplateIMASig = "ima-sig"
+	TemplateIMABuf = "ima-buf"
+)
+
+// BootAggregate is the name of the first entry, which measures the boot PCRs.
+const BootAggregate = "boot_aggregate"
+
+// maxLineSize bounds a measurement list line; ima-buf entries can carry whole certificates.
+const maxLineSize = 1024 * 1024
+
+// Entry is one line of the measurement list.
+type Entry struct {
+	Line         int    // 1-based line number
+	PCR          int    // usually 10
+	TemplateHash string // hex digest of the template data, as extended into the PCR
+	Template     string
+	HashAlg      string // algorithm of Digest; always sha1 for the ima template
+	Digest       string // hex digest of the file, or of the buffer for ima-buf
+	Path         string // file path, or the buffer name for ima-buf
+	Signature    string // hex file signature of ima-sig entries, if any
+	Buffer       string // hex buffer of ima-buf entries
+}
+
+// IsKeyring reports whether an ima-buf entry measures a key added to a kernel keyring,
+// e.g. .ima or .builtin_trusted_keys, rather than other buffer data.
+func (e Entry) IsKeyring() bool {
+	return e.Template == TemplateIMABuf &&
+		(strings.HasPrefix(e.Path, ".") || e.Path == "_ima" || e.Path == "_evm")
+}
+
+// Parse reads a measurement list in ASCII format. Empty lines are skipped.
+func Parse(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		entry, err := ParseLine(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		entry.Line = line
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// ParseLine parses one measurement list line. File paths may contain spaces.
+func ParseLine(line string) (Entry, error) {
+	fields := strings.SplitN(line, " ", 4)
+	if len(fields) < 4 {
+		return Entry{}, fmt.Errorf("expected PCR, template hash, template name and template data")
+	}
+	pcr, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return Entry{}, fmt.Errorf("invalid PCR %q", fields[0])
+	}
+	if !isHex(fields[1]) {
+		return Entry{}, fmt.Errorf("invalid template hash %q", fields[1])
+	}
+	entry := Entry{PCR: pcr, TemplateHash: fields[1], Template: fields[2]}
+
+	digest, rest, ok := strings.Cut(fields[3], " ")
+	if !ok || rest == "" {
+		return Entry{}, fmt.Errorf("%s entry without a file name", entry.Template)
+	}
+	switch entry.Template {
+	case TemplateIMA:
+		entry.HashAlg, entry.Digest, entry.Path = "sha1", digest, rest
+	case TemplateIMANG, TemplateIMASig, TemplateIMABuf:
+		alg, hexDigest, ok := strings.Cut(digest, ":")
+		if !ok {
+			return Entry{}, fmt.Errorf("digest %q has no algorithm prefix", digest)
+		}
+		entry.HashAlg, entry.Digest, entry.Path = alg, hexDigest, rest
+	default:
+		return Entry{}, fmt.Errorf("unsupported template %q", entry.Template)
+	}
+	if !isHex(entry.Digest) {
+		return Entry{}, fmt.Errorf("invalid digest %q", entry.Digest)
+	}
+
+	switch entry.Template {
+	case TemplateIMASig:
+		// the signature is the last field; signature format v2 starts with 0x03
+		if i := strings.LastIndexByte(rest, ' '); i > 0 && strings.HasPrefix(rest[i+1:], "03") && isHex(rest[i+1:]) {
+			entry.Path, entry.Signature = rest[:i], rest[i+1:]
+		}
+	case TemplateIMABuf:
+		i := strings.LastIndexByte(rest, ' ')
+		if i <= 0 || !isHex(rest[i+1:]) {
+			return Entry{}, fmt.Errorf("ima-buf entry without buffer data")
+		}
+		entry.Path, entry.Buffer = rest[:i], rest[i+1:]
+	}
+	return entry, nil
+}
+
+// TemplateHashAlg guesses the algorithm of the template hashes from their length.
+func TemplateHashAlg(entries []Entry) string {
+	if len(entries) == 0 {
+		return "sha1"
+	}
+	switch len(entries[0].TemplateHash) {
+	case 64:
+		return "sha256"
+	case 96:
+		return "sha384"
+	case 128:
+		return "sha512"
+	}
+	return "sha1"
+}
+
+func isHex(s string) bool {
+	if s == "" || len(s)%2 != 0 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
@@ -0,0 +1,85 @@
+package ima
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	sha1Hex   = "c00dbbc9dadfbe1e232e93a729dd4752fade0abf"
+	sha256Hex = "37d2b12d5d9abc2a364ef9448767ee03938e383c0284193477dc7618f4b7c6c2"
+)
+
+func TestParse(t *testing.T) {
+	f, err := os.Open("testdata/ascii_runtime_measurements")
+	require.NoError(t, err)
+	defer f.Close()
+
+	entries, err := Parse(f)
+	require.NoError(t, err)
+	require.Len(t, entries, 12)
+
+	assert.Equal(t, BootAggregate, entries[0].Path)
+	assert.Equal(t, 1, entries[0].Line)
+	assert.Equal(t, 10, entries[0].PCR)
+
+	ls := entries[3]
+	assert.Equal(t, TemplateIMASig, ls.Template)
+	assert.Equal(t, "/usr/bin/ls", ls.Path)
+	assert.Equal(t, "030204aabbccdd0100", ls.Signature)
+	assert.Empty(t, entries[4].Signature, "ima-sig without a signature")
+
+	legacy := entries[5]
+	assert.Equal(t, TemplateIMA, legacy.Template)
+	assert.Equal(t, "sha1", legacy.HashAlg)
+	assert.Equal(t, sha1Hex, legacy.Digest)
+
+	assert.Equal(t, "/opt/my app/run tool", entries[6].Path)
+
+	key, buf := entries[7], entries[8]
+	assert.True(t, key.IsKeyring())
+	assert.Equal(t, ".ima", key.Path)
+	assert.Equal(t, "308201aa", key.Buffer)
+	assert.False(t, buf.IsKeyring())
+	assert.Equal(t, "kernel_version", buf.Path)
+
+	assert.Equal(t, "sha1", TemplateHashAlg(entries))
+}
+
+func TestParseLine(t *testing.T) {
+	t.Run("ima-ng", func(t *testing.T) {
+		entry, err := ParseLine("10 " + sha1Hex + " ima-ng sha256:" + sha256Hex + " /usr/bin/bash")
+		require.NoError(t, err)
+		assert.Equal(t, Entry{PCR: 10, TemplateHash: sha1Hex, Template: TemplateIMANG, HashAlg: "sha256", Digest: sha256Hex, Path: "/usr/bin/bash"}, entry)
+	})
+
+	tests := []struct {
+		name    string
+		line    string
+		wantErr string
+	}{
+		{"too few fields", "10 " + sha1Hex + " ima-ng", "expected PCR"},
+		{"invalid PCR", "ten " + sha1Hex + " ima-ng sha256:" + sha256Hex + " /bin/sh", "invalid PCR"},
+		{"invalid template hash", "10 xyz ima-ng sha256:" + sha256Hex + " /bin/sh", "invalid template hash"},
+		{"unsupported template", "10 " + sha1Hex + " ima-modsig sha256:" + sha256Hex + " /bin/sh", "unsupported template"},
+		{"missing algorithm", "10 " + sha1Hex + " ima-ng " + sha256Hex + " /bin/sh", "no algorithm prefix"},
+		{"invalid digest", "10 " + sha1Hex + " ima-ng sha256:zz /bin/sh", "invalid digest"},
+		{"missing path", "10 " + sha1Hex + " ima-ng sha256:" + sha256Hex, "without a file name"},
+		{"ima-buf without buffer", "10 " + sha1Hex + " ima-buf sha256:" + sha256Hex + " kernel_version", "without buffer data"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseLine(tt.line)
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+
+	t.Run("error names the line", func(t *testing.T) {
+		_, err := Parse(strings.NewReader("\n10 " + sha1Hex + " ima-ng sha256:" + sha256Hex + " /bin/sh\nbroken\n"))
+		assert.ErrorContains(t, err, "line 3")
+	})
+}
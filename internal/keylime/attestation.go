@@ -0,0 +1,163 @@
+package keylime
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// Attestation modes of a verifier. In the pull model the verifier polls each agent and
+// reports an operational_state; in the push model agents submit evidence to the verifier,
+// which keeps a list of attestation resources per agent instead.
+const (
+	AttestationModeAuto = "auto"
+	AttestationModePull = "pull"
+	AttestationModePush = "push"
+)
+
+// Evaluation results of a push-model attestation
+const (
+	EvaluationPending = "pending"
+	EvaluationPass    = "pass"
+	EvaluationFail    = "fail"
+)
+
+// pushMinMajorVersion is the first verifier API major version that serves attestation resources.
+const pushMinMajorVersion = 3
+
+// Attestation is one round of evidence an agent pushed to the verifier, with its evaluation.
+type Attestation struct {
+	Index                   int    `json:"index"`
+	Stage                   string `json:"stage"`
+	Evaluation              string `json:"evaluation"`
+	FailureReason           string `json:"failure_reason,omitempty"`
+	CapabilitiesReceivedAt  string `json:"capabilities_received_at,omitempty"`
+	EvidenceReceivedAt      string `json:"evidence_received_at,omitempty"`
+	VerificationCompletedAt string `json:"verification_completed_at,omitempty"`
+}
+
+// attestationResource is the JSON:API envelope of an attestation.
+type attestationResource struct {
+	Type       string      `json:"type"`
+	ID         string      `json:"id"`
+	Attributes Attestation `json:"attributes"`
+}
+
+// AttestationMode returns the attestation mode configured for the verifier: pull, push, or
+// auto, in which case AgentAttestationMode tells the mode of each agent from its record.
+func (s *Service) AttestationMode() string {
+	if s.configuredMode == "" {
+		return AttestationModeAuto
+	}
+	return s.configuredMode
+}
+
+// AgentAttestationMode returns the attestation mode of an agent with the given verifier record.
+// Unless the mode is configured, an agent is in push mode when its record has
+// accept_attestations, which only push-mode verifiers keep.
+func (s *Service) AgentAttestationMode(details AgentDetails) string {
+	if mode := s.AttestationMode(); mode != AttestationModeAuto {
+		return mode
+	}
+	if details.AcceptAttestations != nil {
+		return AttestationModePush
+	}
+	return AttestationModePull
+}
+
+// pushAPIVersion returns the API version that serves attestation resources: the latest version
+// of 3.0 or later the verifier lists, or 3.0 if it lists none. A version the verifier could be
+// asked for is kept; the lock is not held while asking.
+func (s *Service) pushAPIVersion(ctx context.Context) string {
+	s.versionMu.Lock()
+	version := s.pushVersion
+	s.versionMu.Unlock()
+	if version != "" {
+		return version
+	}
+
+	// the versions are read without negotiating, as a push-only verifier shares none with keylime-mcp
+	versions, ok := s.verifierVersions(ctx)
+	best := ""
+	for _, v := range versions {
+		v = strings.TrimPrefix(v, "v")
+		if major, _ := splitVersion(v); major >= pushMinMajorVersion && (best == "" || compareVersions(v, best) > 0) {
+			best = v
+		}
+	}
+	version = fmt.Sprintf("v%d.0", pushMinMajorVersion)
+	if best != "" {
+		version = "v" + best
+	}
+	if ok {
+		s.versionMu.Lock()
+		s.pushVersion = version
+		s.versionMu.Unlock()
+	}
+	return version
+}
+
+// verifierVersions returns the API versions listed by the verifier's /version endpoint. It
+// reports false when the verifier could not be asked; a verifier without the endpoint lists none.
+func (s *Service) verifierVersions(ctx context.Context) ([]string, bool) {
+	resp, err := s.Verifier.GetRaw(ctx, "version")
+	if err != nil {
+		return nil, false
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, true
+	}
+	var out GetVersionOutput
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 || json.NewDecoder(resp.Body).Decode(&out) != nil {
+		return nil, false
+	}
+	if len(out.Results.SupportedVersions) == 0 && out.Results.CurrentVersion != "" {
+		return []string{out.Results.CurrentVersion}, true
+	}
+	return out.Results.SupportedVersions, true
+}
+
+// FetchAttestations returns the attestations of a push-model agent, newest first.
+func (s *Service) FetchAttestations(ctx context.Context, agentUUID string) ([]Attestation, error) {
+	var list struct {
+		Data []attestationResource `json:"data"`
+	}
+	if err := s.getAttestationResource(ctx, fmt.Sprintf("agents/%s/attestations", agentUUID), &list); err != nil {
+		return nil, err
+	}
+	attestations := make([]Attestation, 0, len(list.Data))
+	for _, resource := range list.Data {
+		attestations = append(attestations, resource.Attributes)
+	}
+	slices.SortFunc(attestations, func(a, b Attestation) int { return b.Index - a.Index })
+	return attestations, nil
+}
+
+func (s *Service) getAttestationResource(ctx context.Context, endpoint string, out any) error {
+	if s.AttestationMode() == AttestationModePull {
+		return fmt.Errorf("verifier %s is not in push mode", s.Verifier.baseURL)
+	}
+	resp, err := s.Verifier.GetAtVersion(ctx, s.pushAPIVersion(ctx), endpoint)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s: %w", endpoint, ExtractAPIError(resp))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", endpoint, err)
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package keylime
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newModeTestService(t *testing.T, handler http.Handler, mode string) *Service {
+	t.Helper()
+	ts := httptest.NewServer(handler)
+	t.Cleanup(ts.Close)
+	svc, err := NewService(&Config{
+		VerifierURL:     ts.URL,
+		RegistrarURL:    ts.URL,
+		APIVersion:      testAPIVersion,
+		AttestationMode: mode,
+	})
+	require.NoError(t, err)
+	return svc
+}
+
+func TestAttestationMode(t *testing.T) {
+	accept := true
+	pushRecord := AgentDetails{AcceptAttestations: &accept}
+	tests := []struct {
+		name       string
+		configured string
+		record     AgentDetails
+		wantMode   string
+		wantAgent  string
+	}{
+		{"auto reads a push record", "", pushRecord, AttestationModeAuto, AttestationModePush},
+		{"auto reads a pull record", AttestationModeAuto, AgentDetails{}, AttestationModeAuto, AttestationModePull},
+		{"configured pull", AttestationModePull, pushRecord, AttestationModePull, AttestationModePull},
+		{"configured push", AttestationModePush, AgentDetails{}, AttestationModePush, AttestationModePush},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := newModeTestService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				t.Errorf("unexpected request %s", r.URL.Path)
+			}), tt.configured)
+
+			assert.Equal(t, tt.wantMode, svc.AttestationMode())
+			assert.Equal(t, tt.wantAgent, svc.AgentAttestationMode(tt.record))
+		})
+	}
+
+	t.Run("verifier API 3.0 is not push mode", func(t *testing.T) {
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /version", versionHandler("2.5", "3.0"))
+		mux.HandleFunc("GET /v2.5/agents/{uuid}", func(w http.ResponseWriter, r *http.Request) {
+			w.Write(loadTestdata(t, "agent_status.json"))
+		})
+		svc := newModeTestService(t, mux, "")
+
+		details, err := svc.FetchAgentDetails(context.Background(), enrolledUUID)
+		require.NoError(t, err)
+		assert.Equal(t, AttestationModePull, svc.AgentAttestationMode(details.Results))
+	})
+}
+
+func TestPushAPIVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		version http.HandlerFunc
+		want    string
+	}{
+		{"verifier lists 3.x", versionHandler("2.5", "3.0", "3.1"), "v3.1"},
+		{"verifier lists only 2.x", versionHandler("2.4", "2.5"), "v3.0"},
+		{"verifier without /version", http.NotFound, "v3.0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc("GET /version", tt.version)
+			svc := newModeTestService(t, mux, "")
+			assert.Equal(t, tt.want, svc.pushAPIVersion(context.Background()))
+		})
+	}
+
+	t.Run("read once", func(t *testing.T) {
+		requests := 0
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /version", func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			versionHandler("3.0")(w, r)
+		})
+		svc := newModeTestService(t, mux, "")
+
+		assert.Equal(t, "v3.0", svc.pushAPIVersion(context.Background()))
+		assert.Equal(t, "v3.0", svc.pushAPIVersion(context.Background()))
+		assert.Equal(t, 1, requests)
+	})
+
+	t.Run("unavailable verifier is asked again", func(t *testing.T) {
+		requests := 0
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /version", func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			http.Error(w, `{"code": 503, "status": "Service Unavailable"}`, http.StatusServiceUnavailable)
+		})
+		svc := newModeTestService(t, mux, "")
+
+		assert.Equal(t, "v3.0", svc.pushAPIVersion(context.Background()))
+		assert.Equal(t, "v3.0", svc.pushAPIVersion(context.Background()))
+		assert.Equal(t, 2, requests)
+	})
+}
+
+func TestFetchAttestations(t *testing.T) {
+	t.Run("newest first", func(t *testing.T) {
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /version", versionHandler("2.5", "3.0"))
+		mux.HandleFunc("GET /v3.0/agents/{uuid}/attestations", func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, enrolledUUID, r.PathValue("uuid"))
+			w.Write([]byte(`{"data": [
+				{"type": "attestation", "id": "0", "attributes": {"index": 0, "stage": "verification_complete", "evaluation": "pass"}},
+				{"type": "attestation", "id": "2", "attributes": {"index": 2, "stage": "awaiting_evidence", "evaluation": "pending"}},
+				{"type": "attestation", "id": "1", "attributes": {"index": 1, "stage": "verification_complete", "evaluation": "fail", "failure_reason": "policy_violation"}}
+			]}`))
+		})
+		svc := newModeTestService(t, mux, "")
+
+		attestations, err := svc.FetchAttestations(context.Background(), enrolledUUID)
+		require.NoError(t, err)
+		require.Len(t, attestations, 3)
+		assert.Equal(t, []int{2, 1, 0}, []int{attestations[0].Index, attestations[1].Index, attestations[2].Index})
+		assert.Equal(t, "policy_violation", attestations[1].FailureReason)
+	})
+
+	t.Run("agent not enrolled", func(t *testing.T) {
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /version", versionHandler("3.0"))
+		svc := newModeTestService(t, mux, "")
+
+		_, err := svc.FetchAttestations(context.Background(), enrolledUUID)
+		assert.True(t, IsNotFound(err))
+	})
+
+	t.Run("pull-mode verifier", func(t *testing.T) {
+		svc := newModeTestService(t, http.NotFoundHandler(), AttestationModePull)
+		_, err := svc.FetchAttestations(context.Background(), enrolledUUID)
+		assert.ErrorContains(t, err, "not in push mode")
+	})
+}
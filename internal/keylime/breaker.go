@@ -0,0 +1,100 @@
+package keylime
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Circuit breaker states reported by BreakerStatus
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+)
+
+// ErrCircuitOpen is returned without contacting the endpoint while its breaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// breaker fails requests fast after threshold consecutive failures and lets a
+// single probe through once cooldown has passed. A nil breaker allows everything.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func newBreaker(threshold int, cooldown time.Duration) *breaker {
+	if threshold <= 0 {
+		return nil
+	}
+	return &breaker{threshold: threshold, cooldown: cooldown, now: time.Now, state: BreakerClosed}
+}
+
+// allow reports whether a request may be sent now.
+func (b *breaker) allow() error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if wait := b.cooldown - b.now().Sub(b.openedAt); wait > 0 {
+			return fmt.Errorf("%w after %d consecutive failures, retry in %s", ErrCircuitOpen, b.failures, wait.Round(time.Second))
+		}
+		b.state = BreakerHalfOpen
+		b.probing = true
+		return nil
+	case BreakerHalfOpen:
+		if b.probing {
+			return fmt.Errorf("%w, recovery probe in progress", ErrCircuitOpen)
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// record updates the breaker with the outcome of a request that allow let through.
+func (b *breaker) record(success bool) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if success {
+		b.state = BreakerClosed
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.threshold {
+		b.state = BreakerOpen
+		b.openedAt = b.now()
+	}
+}
+
+func (b *breaker) status() *BreakerStatus {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := &BreakerStatus{State: b.state, ConsecutiveFailures: b.failures}
+	if b.state != BreakerClosed {
+		openedAt := b.openedAt.UTC()
+		status.OpenedAt = &openedAt
+	}
+	return status
+}
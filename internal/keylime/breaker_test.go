@@ -0,0 +1,80 @@
+package keylime
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestBreaker(threshold int, cooldown time.Duration) (*breaker, *time.Time) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	b := newBreaker(threshold, cooldown)
+	b.now = func() time.Time { return now }
+	return b, &now
+}
+
+func TestBreaker(t *testing.T) {
+	t.Run("nil breaker allows everything", func(t *testing.T) {
+		b := newBreaker(0, time.Minute)
+		assert.Nil(t, b)
+		assert.NoError(t, b.allow())
+		b.record(false)
+		assert.Nil(t, b.status())
+	})
+
+	t.Run("opens after threshold consecutive failures", func(t *testing.T) {
+		b, _ := newTestBreaker(3, time.Minute)
+		for range 2 {
+			require.NoError(t, b.allow())
+			b.record(false)
+		}
+		assert.Equal(t, BreakerClosed, b.status().State)
+
+		require.NoError(t, b.allow())
+		b.record(false)
+		status := b.status()
+		assert.Equal(t, BreakerOpen, status.State)
+		assert.Equal(t, 3, status.ConsecutiveFailures)
+		assert.NotNil(t, status.OpenedAt)
+
+		assert.ErrorIs(t, b.allow(), ErrCircuitOpen)
+	})
+
+	t.Run("success resets failure count", func(t *testing.T) {
+		b, _ := newTestBreaker(2, time.Minute)
+		b.record(false)
+		b.record(true)
+		b.record(false)
+		assert.Equal(t, BreakerClosed, b.status().State)
+		assert.Equal(t, 1, b.status().ConsecutiveFailures)
+	})
+
+	t.Run("half-open lets a single probe through", func(t *testing.T) {
+		b, now := newTestBreaker(1, time.Minute)
+		b.record(false)
+		require.ErrorIs(t, b.allow(), ErrCircuitOpen)
+
+		*now = now.Add(time.Minute)
+		require.NoError(t, b.allow())
+		assert.Equal(t, BreakerHalfOpen, b.status().State)
+		assert.ErrorIs(t, b.allow(), ErrCircuitOpen)
+
+		b.record(true)
+		assert.Equal(t, BreakerClosed, b.status().State)
+		assert.Nil(t, b.status().OpenedAt)
+		assert.NoError(t, b.allow())
+	})
+
+	t.Run("failed probe reopens", func(t *testing.T) {
+		b, now := newTestBreaker(1, time.Minute)
+		b.record(false)
+		*now = now.Add(2 * time.Minute)
+		require.NoError(t, b.allow())
+
+		b.record(false)
+		assert.Equal(t, BreakerOpen, b.status().State)
+		assert.ErrorIs(t, b.allow(), ErrCircuitOpen)
+	})
+}
@@ -0,0 +1,244 @@
+package keylime
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotRecorded is returned in replay mode for a request the cassette has no response for.
+var ErrNotRecorded = errors.New("request not recorded in cassette")
+
+// Interaction is one recorded request to a verifier or registrar and its outcome.
+type Interaction struct {
+	Cluster      string    `json:"cluster"`
+	Service      string    `json:"service"` // "verifier" or "registrar"
+	Method       string    `json:"method"`
+	Path         string    `json:"path"` // URL path and query, e.g. "/v2.5/agents/?bulk=true"
+	RequestBody  string    `json:"request_body,omitempty"`
+	StatusCode   int       `json:"status_code,omitempty"`
+	ContentType  string    `json:"content_type,omitempty"`
+	Location     string    `json:"location,omitempty"` // redirect target
+	ResponseBody string    `json:"response_body,omitempty"`
+	Error        string    `json:"error,omitempty"` // transport error instead of a response
+	DurationMS   int64     `json:"duration_ms"`
+	RecordedAt   time.Time `json:"recorded_at"`
+}
+
+// Cassette records Keylime HTTP traffic to a JSON Lines file, or replays a recorded file in
+// place of the network. Recorded interactions pass through a redact function first, so a
+// cassette can be shared without exposing agent identities, addresses or key material.
+type Cassette struct {
+	path   string
+	replay bool
+
+	mu       sync.Mutex
+	file     *os.File
+	redactor Redactor
+
+	interactions []Interaction
+	queues       map[string][]int // replay: interaction indexes per request key, in recorded order
+	served       map[string]int
+	clusters     map[string]bool
+}
+
+// Redactor hides sensitive values in recorded interactions, see masking.NewRedactor.
+type Redactor interface {
+	// Mask redacts paths, response bodies and errors.
+	Mask(text string) string
+	// MaskRequest redacts a request body; method and path tell which secrets it may carry.
+	MaskRequest(method, path, body string) string
+}
+
+// RecordCassette writes interactions to the file at path, replacing an earlier recording:
+// redactors number their aliases per recording, so an appended recording would reuse the
+// aliases of the earlier one for other values. redactor is applied to paths, bodies and
+// errors before they are written; nil records them as they are.
+func RecordCassette(path string, redactor Redactor) (*Cassette, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600) // #nosec G304 -- operator-supplied cassette path
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cassette: %w", err)
+	}
+	return &Cassette{path: path, file: file, redactor: redactor}, nil
+}
+
+// ReplayCassette loads a recorded cassette. Requests are answered from it in recorded order;
+// once all recordings of a request are used up, the last one is repeated.
+func ReplayCassette(path string) (*Cassette, error) {
+	file, err := os.Open(path) // #nosec G304 -- operator-supplied cassette path
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cassette: %w", err)
+	}
+	defer file.Close()
+
+	c := &Cassette{path: path, replay: true, queues: map[string][]int{}, served: map[string]int{}, clusters: map[string]bool{}}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var in Interaction
+		if err := json.Unmarshal(scanner.Bytes(), &in); err != nil {
+			return nil, fmt.Errorf("cassette %s line %d: %w", path, line, err)
+		}
+		key := in.key()
+		c.queues[key] = append(c.queues[key], len(c.interactions))
+		c.interactions = append(c.interactions, in)
+		c.clusters[in.Cluster] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read cassette %s: %w", path, err)
+	}
+	return c, nil
+}
+
+func (in Interaction) key() string {
+	return strings.Join([]string{in.Cluster, in.Service, in.Method, in.Path}, " ")
+}
+
+// Replaying reports whether the cassette replaces the network.
+func (c *Cassette) Replaying() bool {
+	return c != nil && c.replay
+}
+
+// Close closes the cassette file of a recording.
+func (c *Cassette) Close() error {
+	if c == nil || c.file == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.file.Close()
+}
+
+// transport wraps next so that requests of one cluster service are recorded, or replays them.
+func (c *Cassette) transport(cluster, service string, next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &cassetteTransport{cassette: c, cluster: cluster, service: service, next: next}
+}
+
+type cassetteTransport struct {
+	cassette *Cassette
+	cluster  string
+	service  string
+	next     http.RoundTripper
+}
+
+func (t *cassetteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.cassette.replay {
+		return t.cassette.play(t.cluster, t.service, req)
+	}
+
+	var reqBody []byte
+	if req.Body != nil && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err == nil {
+			reqBody, _ = io.ReadAll(body)
+			_ = body.Close()
+		}
+	}
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	in := Interaction{
+		Cluster:     t.cluster,
+		Service:     t.service,
+		Method:      req.Method,
+		Path:        req.URL.RequestURI(),
+		RequestBody: string(reqBody),
+		DurationMS:  time.Since(start).Milliseconds(),
+		RecordedAt:  start.UTC(),
+	}
+	if err != nil {
+		in.Error = err.Error()
+		t.cassette.record(in)
+		return resp, err
+	}
+
+	body, readErr := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	in.StatusCode = resp.StatusCode
+	in.ContentType = resp.Header.Get("Content-Type")
+	in.Location = resp.Header.Get("Location")
+	in.ResponseBody = string(body)
+	if readErr != nil {
+		in.Error = readErr.Error()
+	}
+	t.cassette.record(in)
+	return resp, nil
+}
+
+func (c *Cassette) record(in Interaction) {
+	if c.redactor != nil {
+		in.RequestBody = c.redactor.MaskRequest(in.Method, in.Path, in.RequestBody)
+		in.Path = c.redactor.Mask(in.Path)
+		in.Location = c.redactor.Mask(in.Location)
+		in.ResponseBody = c.redactor.Mask(in.ResponseBody)
+		in.Error = c.redactor.Mask(in.Error)
+	}
+	line, err := json.Marshal(in)
+	if err != nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, _ = c.file.Write(append(line, '\n'))
+}
+
+func (c *Cassette) play(cluster, service string, req *http.Request) (*http.Response, error) {
+	key := Interaction{Cluster: cluster, Service: service, Method: req.Method, Path: req.URL.RequestURI()}.key()
+
+	c.mu.Lock()
+	queue, ok := c.queues[key]
+	if !ok && len(c.clusters) == 1 {
+		// a single-cluster recording replays under whatever name the cluster has now
+		for recorded := range c.clusters {
+			key = Interaction{Cluster: recorded, Service: service, Method: req.Method, Path: req.URL.RequestURI()}.key()
+		}
+		queue, ok = c.queues[key]
+	}
+	if !ok {
+		c.mu.Unlock()
+		return nil, fmt.Errorf("%w: %s %s %s", ErrNotRecorded, service, req.Method, req.URL.RequestURI())
+	}
+	n := c.served[key]
+	if n < len(queue)-1 {
+		c.served[key] = n + 1
+	}
+	in := c.interactions[queue[n]]
+	c.mu.Unlock()
+
+	if in.Error != "" && in.StatusCode == 0 {
+		return nil, fmt.Errorf("recorded error: %s", in.Error)
+	}
+	header := http.Header{}
+	if in.ContentType != "" {
+		header.Set("Content-Type", in.ContentType)
+	}
+	if in.Location != "" {
+		header.Set("Location", in.Location)
+	}
+	return &http.Response{
+		StatusCode:    in.StatusCode,
+		Status:        fmt.Sprintf("%d %s", in.StatusCode, http.StatusText(in.StatusCode)),
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(in.ResponseBody)),
+		ContentLength: int64(len(in.ResponseBody)),
+		Request:       req,
+	}, nil
+}
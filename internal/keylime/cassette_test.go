@@ -0,0 +1,177 @@
+package keylime
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/keylime/keylime-mcp/internal/masking"
+)
+
+const (
+	recordedUUID = "d432fbb3-d2f1-4a97-9ef7-75bd81c00000"
+	redactedUUID = "00000000-0000-4000-8000-000000000001"
+)
+
+func newCassetteService(t *testing.T, handler http.Handler, cassette *Cassette) *Service {
+	t.Helper()
+	svc := newTestService(t, handler)
+	svc.Verifier.useCassette(cassette, DefaultClusterName, "verifier")
+	svc.Registrar.useCassette(cassette, DefaultClusterName, "registrar")
+	return svc
+}
+
+func recordCassette(t *testing.T, handler http.Handler, run func(svc *Service)) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "incident.jsonl")
+	cassette, err := RecordCassette(path, masking.NewRedactor())
+	require.NoError(t, err)
+	run(newCassetteService(t, handler, cassette))
+	require.NoError(t, cassette.Close())
+	return path
+}
+
+func TestCassette(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v2.5/agents/{$}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(loadTestdata(t, "agent_list.json"))
+	})
+	mux.HandleFunc("GET /v2.5/agents/{uuid}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(loadTestdata(t, "agent_status.json"))
+	})
+
+	path := recordCassette(t, mux, func(svc *Service) {
+		uuids, err := svc.FetchAllAgentUUIDs(context.Background())
+		require.NoError(t, err)
+		require.Len(t, uuids, 2)
+		_, err = svc.FetchAgentDetails(context.Background(), uuids[0])
+		require.NoError(t, err)
+	})
+
+	t.Run("recording is redacted", func(t *testing.T) {
+		data, err := os.ReadFile(path) // #nosec G304 -- test temp file
+		require.NoError(t, err)
+		assert.NotContains(t, string(data), recordedUUID)
+		assert.NotContains(t, string(data), "192.168.1.100")
+		assert.Contains(t, string(data), redactedUUID)
+	})
+
+	t.Run("replays recorded responses", func(t *testing.T) {
+		cassette, err := ReplayCassette(path)
+		require.NoError(t, err)
+		svc, err := NewService(&Config{
+			VerifierURL:  "https://verifier.invalid:8881",
+			RegistrarURL: "https://registrar.invalid:8891",
+			TLSEnabled:   true,
+			CertDir:      filepath.Join(t.TempDir(), "missing"),
+			APIVersion:   testAPIVersion,
+			Cassette:     cassette,
+		})
+		require.NoError(t, err, "replay does not need client certificates")
+
+		uuids, err := svc.FetchAllAgentUUIDs(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, redactedUUID, uuids[0])
+
+		status, err := svc.FetchAgentDetails(context.Background(), uuids[0])
+		require.NoError(t, err)
+		assert.Equal(t, StateGetQuote, status.Results.OperationalState)
+		assert.Equal(t, "198.18.0.1", status.Results.IP)
+	})
+
+	t.Run("unknown request", func(t *testing.T) {
+		cassette, err := ReplayCassette(path)
+		require.NoError(t, err)
+		svc := newCassetteService(t, http.NotFoundHandler(), cassette)
+
+		_, err = svc.FetchAgentDetails(context.Background(), recordedUUID)
+		assert.ErrorIs(t, err, ErrNotRecorded)
+	})
+
+	t.Run("replays under another cluster name", func(t *testing.T) {
+		cassette, err := ReplayCassette(path)
+		require.NoError(t, err)
+		clusters, err := NewClusters(map[string]*Config{
+			"prod": {VerifierURL: "http://verifier", RegistrarURL: "http://registrar", APIVersion: testAPIVersion, Cassette: cassette},
+		}, "prod")
+		require.NoError(t, err)
+		svc, err := clusters.Get("prod")
+		require.NoError(t, err)
+
+		uuids, err := svc.FetchAllAgentUUIDs(context.Background())
+		require.NoError(t, err)
+		assert.Len(t, uuids, 2)
+	})
+}
+
+func TestCassetteReplayOrder(t *testing.T) {
+	calls := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v2.5/agents/{uuid}", func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			http.Error(w, `{"code": 503, "status": "Service Unavailable"}`, http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(loadTestdata(t, "agent_status.json"))
+	})
+
+	path := recordCassette(t, mux, func(svc *Service) {
+		_, err := svc.Verifier.Get(context.Background(), "agents/"+recordedUUID)
+		require.NoError(t, err)
+		_, err = svc.Verifier.Get(context.Background(), "agents/"+recordedUUID)
+		require.NoError(t, err)
+	})
+
+	cassette, err := ReplayCassette(path)
+	require.NoError(t, err)
+	svc := newCassetteService(t, http.NotFoundHandler(), cassette)
+
+	for _, want := range []int{http.StatusServiceUnavailable, http.StatusOK, http.StatusOK} {
+		resp, err := svc.Verifier.Get(context.Background(), "agents/"+redactedUUID)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		assert.Equal(t, want, resp.StatusCode)
+	}
+}
+
+func TestCassetteRecordsTransportErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "down.jsonl")
+	cassette, err := RecordCassette(path, nil)
+	require.NoError(t, err)
+	client, err := newClient("http://127.0.0.1:1", &Config{APIVersion: testAPIVersion})
+	require.NoError(t, err)
+	client.useCassette(cassette, DefaultClusterName, "verifier")
+
+	_, err = client.Get(context.Background(), "agents/")
+	require.Error(t, err)
+	require.NoError(t, cassette.Close())
+
+	replay, err := ReplayCassette(path)
+	require.NoError(t, err)
+	client.useCassette(replay, DefaultClusterName, "verifier")
+	_, err = client.Get(context.Background(), "agents/")
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, ErrNotRecorded)
+}
+
+func TestRecordCassetteReplacesEarlierRecording(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "incident.jsonl")
+	require.NoError(t, os.WriteFile(path, []byte(`{"cluster":"default","path":"/v2.5/agents/`+redactedUUID+`"}`+"\n"), 0600))
+
+	cassette, err := RecordCassette(path, masking.NewRedactor())
+	require.NoError(t, err)
+	require.NoError(t, cassette.Close())
+
+	data, err := os.ReadFile(path) // #nosec G304 -- test temp file
+	require.NoError(t, err)
+	assert.Empty(t, data, "aliases of the earlier recording would collide with the new ones")
+}
@@ -3,13 +3,10 @@ package keylime
 import (
 	"bytes"
 	"context"
-	"crypto/tls"
-	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
-	"os"
 	"strings"
 	"time"
 )
@@ -19,85 +16,64 @@ func newClient(baseURL string, config *Config) (*Client, error) {
 	baseURL = strings.TrimPrefix(baseURL, "https://")
 	baseURL = strings.TrimPrefix(baseURL, "http://")
 
-	if !config.TLSEnabled {
-		return &Client{
-			baseURL:    "http://" + strings.TrimSuffix(baseURL, "/"),
-			APIVersion: config.APIVersion,
-			httpClient: &http.Client{Timeout: 30 * time.Second},
-		}, nil
+	timeout := config.RequestTimeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
 	}
-
-	tlsConfig, err := createTLSConfig(config)
-	if err != nil {
-		return nil, fmt.Errorf("TLS configuration failed: %w", err)
-	}
-
-	return &Client{
-		baseURL:    "https://" + strings.TrimSuffix(baseURL, "/"),
-		APIVersion: config.APIVersion,
-		httpClient: &http.Client{
-			Transport: &http.Transport{TLSClientConfig: tlsConfig},
-			Timeout:   30 * time.Second,
+	client := &Client{
+		baseURL:    "http://" + strings.TrimSuffix(baseURL, "/"),
+		httpClient: &http.Client{Timeout: timeout},
+		retry: retryPolicy{
+			maxRetries: config.MaxRetries,
+			baseDelay:  config.RetryBaseDelay,
+			maxDelay:   config.RetryMaxDelay,
 		},
-	}, nil
-}
-
-// createTLSConfig creates TLS configuration with mTLS support
-func createTLSConfig(config *Config) (*tls.Config, error) {
-	cert, err := tls.LoadX509KeyPair(config.ClientCert, config.ClientKey)
-	if err != nil {
-		return nil, fmt.Errorf("failed to load client certificate (%s, %s): %w", config.ClientCert, config.ClientKey, err)
-	}
-
-	caCertPEM, err := os.ReadFile(config.CAPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to load CA certificate (%s): %w", config.CAPath, err)
+		breaker:       newBreaker(config.BreakerThreshold, config.BreakerCooldown),
+		pinnedVersion: config.APIVersion,
+		apiVersion:    config.APIVersion,
 	}
-
-	caCertPool := x509.NewCertPool()
-	if !caCertPool.AppendCertsFromPEM(caCertPEM) {
-		return nil, fmt.Errorf("failed to parse CA certificate from %s", config.CAPath)
+	if client.apiVersion == "" {
+		client.apiVersion = DefaultAPIVersion
 	}
 
-	tlsConfig := &tls.Config{
-		Certificates: []tls.Certificate{cert},
-		RootCAs:      caCertPool,
+	// a replayed session needs no credentials for the recorded deployment
+	if !config.TLSEnabled || config.Cassette.Replaying() {
+		return client, nil
 	}
 
-	if config.TLSServerName != "" {
-		tlsConfig.ServerName = config.TLSServerName
+	creds, err := newTLSCredentials(config)
+	if err != nil {
+		return nil, fmt.Errorf("TLS configuration failed: %w", err)
 	}
 
-	return tlsConfig, nil
+	client.baseURL = "https://" + strings.TrimSuffix(baseURL, "/")
+	client.tls = creds
+	client.httpClient.Transport = creds
+	return client, nil
 }
 
 func (kc *Client) Get(ctx context.Context, endpoint string) (*http.Response, error) {
-	url := fmt.Sprintf("%s/%s/%s", kc.baseURL, kc.APIVersion, strings.TrimPrefix(endpoint, "/"))
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	url, err := kc.versionedURL(ctx, endpoint)
 	if err != nil {
 		return nil, err
 	}
-	return kc.httpClient.Do(req) // #nosec G704 -- URL is built from trusted config, not user input
+	return kc.do(ctx, http.MethodGet, url, nil)
 }
 
 func (kc *Client) doRequestWithBody(ctx context.Context, method, endpoint string, body any) (*http.Response, error) {
-	url := fmt.Sprintf("%s/%s/%s", kc.baseURL, kc.APIVersion, strings.TrimPrefix(endpoint, "/"))
-	var reqBody io.Reader
+	var reqBody []byte
 	if body != nil {
 		var buf bytes.Buffer
 		if err := json.NewEncoder(&buf).Encode(body); err != nil {
 			return nil, fmt.Errorf("failed to marshal body: %w", err)
 		}
-		reqBody = &buf
+		reqBody = buf.Bytes()
 	}
-	req, err := http.NewRequestWithContext(ctx, method, url, reqBody)
+	url, err := kc.versionedURL(ctx, endpoint)
 	if err != nil {
 		return nil, err
 	}
-	if body != nil {
-		req.Header.Set("Content-Type", "application/json")
-	}
-	return kc.httpClient.Do(req) // #nosec G704 -- URL is built from trusted config, not user input
+	return kc.do(ctx, method, url, reqBody)
 }
 
 func (kc *Client) Post(ctx context.Context, endpoint string, body any) (*http.Response, error) {
@@ -109,20 +85,94 @@ func (kc *Client) Put(ctx context.Context, endpoint string, body any) (*http.Res
 }
 
 func (kc *Client) Delete(ctx context.Context, endpoint string) (*http.Response, error) {
-	url := fmt.Sprintf("%s/%s/%s", kc.baseURL, kc.APIVersion, strings.TrimPrefix(endpoint, "/"))
-	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, url, nil)
+	url, err := kc.versionedURL(ctx, endpoint)
 	if err != nil {
 		return nil, err
 	}
-	return kc.httpClient.Do(req) // #nosec G704 -- URL is built from trusted config, not user input
+	return kc.do(ctx, http.MethodDelete, url, nil)
+}
+
+// GetAtVersion sends a GET under an explicit API version instead of the negotiated one,
+// e.g. "v3.0" for the attestation resources of a push-mode verifier.
+func (kc *Client) GetAtVersion(ctx context.Context, version, endpoint string) (*http.Response, error) {
+	return kc.do(ctx, http.MethodGet, fmt.Sprintf("%s/%s/%s", kc.baseURL, version, strings.TrimPrefix(endpoint, "/")), nil)
 }
 
 // GetRaw sends a GET without the API version prefix. Used for /version endpoint.
 func (kc *Client) GetRaw(ctx context.Context, path string) (*http.Response, error) {
-	url := fmt.Sprintf("%s/%s", kc.baseURL, strings.TrimPrefix(path, "/"))
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	return kc.do(ctx, http.MethodGet, fmt.Sprintf("%s/%s", kc.baseURL, strings.TrimPrefix(path, "/")), nil)
+}
+
+// versionedURL builds the URL of endpoint under the negotiated API version.
+func (kc *Client) versionedURL(ctx context.Context, endpoint string) (string, error) {
+	version, err := kc.ensureAPIVersion(ctx)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
-	return kc.httpClient.Do(req)
+	return fmt.Sprintf("%s/%s/%s", kc.baseURL, version, strings.TrimPrefix(endpoint, "/")), nil
+}
+
+// do sends a request through the circuit breaker, retrying transient failures with backoff.
+// A nil body sends no payload; otherwise it is sent as JSON and replayed on every attempt.
+func (kc *Client) do(ctx context.Context, method, url string, body []byte) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		if err := kc.breaker.allow(); err != nil {
+			return nil, fmt.Errorf("%s %s: %w", method, kc.baseURL, err)
+		}
+
+		var reqBody io.Reader
+		if body != nil {
+			reqBody = bytes.NewReader(body)
+		}
+		req, err := http.NewRequestWithContext(ctx, method, url, reqBody)
+		if err != nil {
+			return nil, err
+		}
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+
+		resp, err := kc.httpClient.Do(req) // #nosec G704 -- URL is built from trusted config, not user input
+		kc.breaker.record(!isBreakerFailure(resp, err))
+		if err != nil && ctx.Err() == nil {
+			kc.resetNegotiation()
+		}
+
+		if attempt >= kc.retry.maxRetries || !kc.retry.shouldRetry(ctx, method, resp, err) {
+			return resp, err
+		}
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			_ = resp.Body.Close()
+		}
+		if err := sleepContext(ctx, kc.retry.backoff(attempt)); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// useCassette records the client's traffic to cassette, or replays it from there.
+func (kc *Client) useCassette(cassette *Cassette, cluster, service string) {
+	if cassette == nil {
+		return
+	}
+	kc.httpClient.Transport = cassette.transport(cluster, service, kc.httpClient.Transport)
+}
+
+// TLSStatus returns the state of the mTLS credentials, or nil when TLS is disabled.
+func (kc *Client) TLSStatus() *TLSStatus {
+	if kc.tls == nil {
+		return nil
+	}
+	return kc.tls.status()
+}
+
+// BreakerStatus returns the circuit breaker state, or nil when the breaker is disabled.
+func (kc *Client) BreakerStatus() *BreakerStatus {
+	return kc.breaker.status()
+}
+
+// BaseURL returns the scheme and host the client sends requests to.
+func (kc *Client) BaseURL() string {
+	return kc.baseURL
 }
@@ -216,6 +216,6 @@ func TestNewClient(t *testing.T) {
 			APIVersion: "v2.4",
 		})
 		require.NoError(t, err)
-		assert.Equal(t, "v2.4", client.APIVersion)
+		assert.Equal(t, "v2.4", client.APIVersion())
 	})
 }
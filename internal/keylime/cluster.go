@@ -0,0 +1,73 @@
+package keylime
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DefaultClusterName is the name given to the only cluster of a single-deployment server.
+const DefaultClusterName = "default"
+
+// Clusters holds one Service per named Keylime verifier/registrar pair
+type Clusters struct {
+	primary  string
+	names    []string
+	services map[string]*Service
+}
+
+// NewClusters creates a Service for every named config. The primary cluster
+// is used by tools that are called without an explicit cluster name.
+func NewClusters(configs map[string]*Config, primary string) (*Clusters, error) {
+	if len(configs) == 0 {
+		return nil, fmt.Errorf("at least one cluster must be configured")
+	}
+	if _, ok := configs[primary]; !ok {
+		return nil, fmt.Errorf("primary cluster %q is not configured", primary)
+	}
+
+	c := &Clusters{primary: primary, services: make(map[string]*Service, len(configs))}
+	for name, config := range configs {
+		service, err := newService(name, config)
+		if err != nil {
+			return nil, fmt.Errorf("cluster %q: %w", name, err)
+		}
+		c.services[name] = service
+		c.names = append(c.names, name)
+	}
+	sort.Strings(c.names)
+	return c, nil
+}
+
+// SingleCluster wraps an existing Service as the only, primary cluster.
+func SingleCluster(service *Service) *Clusters {
+	return &Clusters{
+		primary:  DefaultClusterName,
+		names:    []string{DefaultClusterName},
+		services: map[string]*Service{DefaultClusterName: service},
+	}
+}
+
+// Primary returns the name of the cluster used when none is given.
+func (c *Clusters) Primary() string {
+	return c.primary
+}
+
+// Names returns all cluster names in sorted order.
+func (c *Clusters) Names() []string {
+	names := make([]string, len(c.names))
+	copy(names, c.names)
+	return names
+}
+
+// Get returns the service for the named cluster, or the primary one if name is empty.
+func (c *Clusters) Get(name string) (*Service, error) {
+	if name == "" {
+		name = c.primary
+	}
+	service, ok := c.services[name]
+	if !ok {
+		return nil, fmt.Errorf("%w %q (available: %s)", ErrUnknownCluster, name, strings.Join(c.names, ", "))
+	}
+	return service, nil
+}
@@ -0,0 +1,74 @@
+package keylime
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewClusters(t *testing.T) {
+	t.Run("routes by name and defaults to primary", func(t *testing.T) {
+		clusters, err := NewClusters(map[string]*Config{
+			"dc1": {VerifierURL: "http://dc1-verifier:8881", RegistrarURL: "http://dc1-registrar:8891", APIVersion: testAPIVersion},
+			"dc2": {VerifierURL: "http://dc2-verifier:8881", RegistrarURL: "http://dc2-registrar:8891", APIVersion: testAPIVersion},
+		}, "dc2")
+		require.NoError(t, err)
+
+		assert.Equal(t, "dc2", clusters.Primary())
+		assert.Equal(t, []string{"dc1", "dc2"}, clusters.Names())
+
+		svc, err := clusters.Get("")
+		require.NoError(t, err)
+		assert.Equal(t, "http://dc2-verifier:8881", svc.Verifier.BaseURL())
+
+		svc, err = clusters.Get("dc1")
+		require.NoError(t, err)
+		assert.Equal(t, "http://dc1-registrar:8891", svc.Registrar.BaseURL())
+	})
+
+	t.Run("unknown cluster lists available names", func(t *testing.T) {
+		clusters, err := NewClusters(map[string]*Config{
+			"dc1": {VerifierURL: "http://localhost:8881", RegistrarURL: "http://localhost:8891"},
+		}, "dc1")
+		require.NoError(t, err)
+
+		_, err = clusters.Get("dc9")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `unknown cluster "dc9"`)
+		assert.Contains(t, err.Error(), "dc1")
+	})
+
+	t.Run("primary must be configured", func(t *testing.T) {
+		_, err := NewClusters(map[string]*Config{
+			"dc1": {VerifierURL: "http://localhost:8881", RegistrarURL: "http://localhost:8891"},
+		}, "dc2")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "primary cluster")
+	})
+
+	t.Run("no clusters", func(t *testing.T) {
+		_, err := NewClusters(nil, DefaultClusterName)
+		assert.Error(t, err)
+	})
+
+	t.Run("client errors name the cluster", func(t *testing.T) {
+		_, err := NewClusters(map[string]*Config{
+			"dc1": {VerifierURL: "https://localhost:8881", TLSEnabled: true, ClientCert: "/nonexistent/cert.crt"},
+		}, "dc1")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `cluster "dc1"`)
+	})
+}
+
+func TestSingleCluster(t *testing.T) {
+	svc := &Service{}
+	clusters := SingleCluster(svc)
+
+	assert.Equal(t, DefaultClusterName, clusters.Primary())
+	assert.Equal(t, []string{DefaultClusterName}, clusters.Names())
+
+	got, err := clusters.Get("")
+	require.NoError(t, err)
+	assert.Same(t, svc, got)
+}
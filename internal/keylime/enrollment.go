@@ -0,0 +1,199 @@
+package keylime
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// EnrollmentSnapshot is the verifier enrollment of an agent, captured before it is replaced
+// so that it can be restored.
+type EnrollmentSnapshot struct {
+	IP                      string   `json:"ip"`
+	Port                    int      `json:"port"`
+	TPMPolicy               string   `json:"tpm_policy"`
+	MetaData                string   `json:"meta_data"`
+	AcceptTPMHashAlgs       []string `json:"accept_tpm_hash_algs"`
+	AcceptTPMEncryptionAlgs []string `json:"accept_tpm_encryption_algs"`
+	AcceptTPMSigningAlgs    []string `json:"accept_tpm_signing_algs"`
+	HasRuntimePolicy        bool     `json:"has_runtime_policy"`
+	HasMeasuredBootPolicy   bool     `json:"has_measured_boot_policy"`
+	// Missing lists settings that could not be read back, so that a restore cannot bring them back.
+	Missing []string `json:"missing,omitempty"`
+
+	runtimePolicy string // policy JSON, when it could be read back
+	mbPolicy      string // measured boot policy JSON, when it could be read back
+	imaKeys       string // IMA signature verification keys, when the verifier reports them
+}
+
+// SnapshotEnrollment captures the current verifier enrollment of an agent. Policies given
+// inline at enrollment are stored under the agent's UUID and are captured with it; policies
+// the agent references by another name are not reported by the verifier and end up in Missing.
+// The IMA signature verification keys are captured when the verifier reports them.
+func (s *Service) SnapshotEnrollment(ctx context.Context, agentUUID string) (*EnrollmentSnapshot, error) {
+	details, err := s.FetchAgentDetails(ctx, agentUUID)
+	if err != nil {
+		return nil, err
+	}
+	r := details.Results
+	snapshot := &EnrollmentSnapshot{
+		IP:                      r.IP,
+		Port:                    r.Port,
+		TPMPolicy:               r.TPMPolicy,
+		MetaData:                r.MetaData,
+		AcceptTPMHashAlgs:       r.AcceptTPMHashAlgs,
+		AcceptTPMEncryptionAlgs: r.AcceptTPMEncryptionAlgs,
+		AcceptTPMSigningAlgs:    r.AcceptTPMSigningAlgs,
+		HasRuntimePolicy:        r.HasRuntimePolicy != 0,
+		HasMeasuredBootPolicy:   r.HasMbRefstate != 0,
+		imaKeys:                 r.IMASignVerificationKeys,
+	}
+
+	if snapshot.HasRuntimePolicy {
+		policy, err := s.fetchRuntimePolicy(ctx, agentUUID)
+		switch {
+		case IsNotFound(err):
+			snapshot.Missing = append(snapshot.Missing, "runtime_policy")
+		case err != nil:
+			return nil, fmt.Errorf("runtime policy of agent %s: %w", agentUUID, err)
+		default:
+			snapshot.runtimePolicy = policy
+		}
+	}
+	if snapshot.HasMeasuredBootPolicy {
+		policy, err := s.fetchMBPolicy(ctx, agentUUID)
+		switch {
+		case IsNotFound(err):
+			snapshot.Missing = append(snapshot.Missing, "mb_policy")
+		case err != nil:
+			return nil, fmt.Errorf("measured boot policy of agent %s: %w", agentUUID, err)
+		default:
+			snapshot.mbPolicy = policy
+		}
+	}
+	return snapshot, nil
+}
+
+func (s *Service) fetchMBPolicy(ctx context.Context, name string) (string, error) {
+	resp, err := s.Verifier.Get(ctx, fmt.Sprintf("mbpolicies/%s", name))
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", ExtractAPIError(resp)
+	}
+	var policy GetMBPolicyOutput
+	if err := json.NewDecoder(resp.Body).Decode(&policy); err != nil {
+		return "", fmt.Errorf("failed to decode measured boot policy %q: %w", name, err)
+	}
+	mbPolicy, _ := policy.Results["mb_policy"].(string)
+	return mbPolicy, nil
+}
+
+func (s *Service) fetchRuntimePolicy(ctx context.Context, name string) (string, error) {
+	resp, err := s.Verifier.Get(ctx, fmt.Sprintf("allowlists/%s", name))
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", ExtractAPIError(resp)
+	}
+	var policy GetRuntimePolicyOutput
+	if err := json.NewDecoder(resp.Body).Decode(&policy); err != nil {
+		return "", fmt.Errorf("failed to decode runtime policy %q: %w", name, err)
+	}
+	return policy.Results.RuntimePolicy, nil
+}
+
+// RestoreBody returns an enrollment body that re-creates the snapshot. Agent credentials and
+// the API version are taken from base, a body returned by PrepareEnrollmentBody. The settings
+// in Missing are left empty, so the restored enrollment is weaker unless Missing is empty.
+func (e *EnrollmentSnapshot) RestoreBody(base map[string]any) map[string]any {
+	body := make(map[string]any, len(base))
+	for k, v := range base {
+		body[k] = v
+	}
+	runtimePolicy := ""
+	if e.runtimePolicy != "" {
+		runtimePolicy = base64.StdEncoding.EncodeToString([]byte(e.runtimePolicy))
+	}
+	body["cloudagent_ip"] = e.IP
+	body["cloudagent_port"] = e.Port
+	body["tpm_policy"] = e.TPMPolicy
+	body["metadata"] = orDefaultString(e.MetaData, "{}")
+	body["runtime_policy"] = runtimePolicy
+	body["runtime_policy_name"] = ""
+	body["mb_policy"] = e.mbPolicy
+	body["mb_policy_name"] = ""
+	body["ima_sign_verification_keys"] = e.imaKeys
+	if len(e.AcceptTPMHashAlgs) > 0 {
+		body["accept_tpm_hash_algs"] = e.AcceptTPMHashAlgs
+	}
+	if len(e.AcceptTPMEncryptionAlgs) > 0 {
+		body["accept_tpm_encryption_algs"] = e.AcceptTPMEncryptionAlgs
+	}
+	if len(e.AcceptTPMSigningAlgs) > 0 {
+		body["accept_tpm_signing_algs"] = e.AcceptTPMSigningAlgs
+	}
+	return body
+}
+
+func orDefaultString(value, def string) string {
+	if value == "" {
+		return def
+	}
+	return value
+}
+
+// UnenrollAgent deletes an agent from the verifier and, if the verifier only accepted the
+// request (202) because it is still polling the agent, waits until the agent is gone.
+// It reports whether it had to wait.
+func (s *Service) UnenrollAgent(ctx context.Context, agentUUID string, pollInterval, timeout time.Duration) (bool, error) {
+	resp, err := s.Verifier.Delete(ctx, fmt.Sprintf("agents/%s", agentUUID))
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return false, ExtractAPIError(resp)
+	}
+	if resp.StatusCode != http.StatusAccepted {
+		return false, nil
+	}
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return true, ctx.Err()
+		case <-deadline.C:
+			return true, fmt.Errorf("agent %s is still being removed after %s", agentUUID, timeout)
+		case <-ticker.C:
+		}
+		_, err := s.FetchAgentDetails(ctx, agentUUID)
+		if IsNotFound(err) {
+			return true, nil
+		}
+		if err != nil {
+			return true, err
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package keylime
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const enrolledUUID = "d432fbb3-d2f1-4a97-9ef7-75bd81c00000"
+
+func TestSnapshotEnrollment(t *testing.T) {
+	t.Run("captures inline runtime policy", func(t *testing.T) {
+		statusData := loadTestdata(t, "agent_status.json")
+		policyData := loadTestdata(t, "runtime_policy.json")
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /v2.5/agents/{uuid}", func(w http.ResponseWriter, r *http.Request) {
+			w.Write(statusData)
+		})
+		mux.HandleFunc("GET /v2.5/allowlists/{name}", func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, enrolledUUID, r.PathValue("name"))
+			w.Write(policyData)
+		})
+		svc := newTestService(t, mux)
+
+		snapshot, err := svc.SnapshotEnrollment(context.Background(), enrolledUUID)
+		require.NoError(t, err)
+		assert.Equal(t, `{"mask":"0x400"}`, snapshot.TPMPolicy)
+		assert.Equal(t, "192.168.1.100", snapshot.IP)
+		assert.True(t, snapshot.HasRuntimePolicy)
+		assert.Empty(t, snapshot.Missing)
+
+		body := snapshot.RestoreBody(map[string]any{"ak_tpm": "test-ak", "accept_tpm_hash_algs": []string{"sha512"}})
+		assert.Equal(t, "test-ak", body["ak_tpm"])
+		assert.Equal(t, `{"mask":"0x400"}`, body["tpm_policy"])
+		assert.Equal(t, []string{"sha256"}, body["accept_tpm_hash_algs"])
+		assert.Equal(t, 9002, body["cloudagent_port"])
+		decoded, err := base64.StdEncoding.DecodeString(body["runtime_policy"].(string))
+		require.NoError(t, err)
+		assert.Contains(t, string(decoded), "digests")
+	})
+
+	t.Run("named runtime policy is missing", func(t *testing.T) {
+		statusData := loadTestdata(t, "agent_status.json")
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /v2.5/agents/{uuid}", func(w http.ResponseWriter, r *http.Request) {
+			w.Write(statusData)
+		})
+		mux.HandleFunc("GET /v2.5/allowlists/{name}", func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, `{"code": 404, "status": "not found"}`, http.StatusNotFound)
+		})
+		svc := newTestService(t, mux)
+
+		snapshot, err := svc.SnapshotEnrollment(context.Background(), enrolledUUID)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"runtime_policy"}, snapshot.Missing)
+		assert.Equal(t, "", snapshot.RestoreBody(map[string]any{})["runtime_policy"])
+	})
+
+	t.Run("captures measured boot policy and reported IMA keys", func(t *testing.T) {
+		status := strings.NewReplacer(`"has_mb_refstate": 0`, `"has_mb_refstate": 1`, `"has_runtime_policy": 1`, `"has_runtime_policy": 0`).
+			Replace(string(loadTestdata(t, "agent_status.json")))
+		status = strings.Replace(status, `"has_mb_refstate": 1,`, `"has_mb_refstate": 1, "ima_sign_verification_keys": "[\"key\"]",`, 1)
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /v2.5/agents/{uuid}", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(status))
+		})
+		mux.HandleFunc("GET /v2.5/mbpolicies/{name}", func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, enrolledUUID, r.PathValue("name"))
+			w.Write([]byte(`{"code": 200, "status": "Success", "results": {"name": "x", "mb_policy": "{\"kernels\": []}"}}`))
+		})
+		svc := newTestService(t, mux)
+
+		snapshot, err := svc.SnapshotEnrollment(context.Background(), enrolledUUID)
+		require.NoError(t, err)
+		assert.True(t, snapshot.HasMeasuredBootPolicy)
+		assert.Empty(t, snapshot.Missing)
+		body := snapshot.RestoreBody(map[string]any{})
+		assert.Equal(t, `{"kernels": []}`, body["mb_policy"])
+		assert.Equal(t, "", body["mb_policy_name"])
+		assert.Equal(t, `["key"]`, body["ima_sign_verification_keys"])
+	})
+
+	t.Run("named measured boot policy is missing", func(t *testing.T) {
+		status := strings.Replace(string(loadTestdata(t, "agent_status.json")), `"has_mb_refstate": 0`, `"has_mb_refstate": 1`, 1)
+		policyData := loadTestdata(t, "runtime_policy.json")
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /v2.5/agents/{uuid}", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(status))
+		})
+		mux.HandleFunc("GET /v2.5/allowlists/{name}", func(w http.ResponseWriter, r *http.Request) {
+			w.Write(policyData)
+		})
+		mux.HandleFunc("GET /v2.5/mbpolicies/{name}", func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, `{"code": 404, "status": "not found"}`, http.StatusNotFound)
+		})
+		svc := newTestService(t, mux)
+
+		snapshot, err := svc.SnapshotEnrollment(context.Background(), enrolledUUID)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"mb_policy"}, snapshot.Missing)
+		assert.Equal(t, "", snapshot.RestoreBody(map[string]any{})["mb_policy"])
+	})
+
+	t.Run("agent not enrolled", func(t *testing.T) {
+		svc := newTestService(t, http.NotFoundHandler())
+		_, err := svc.SnapshotEnrollment(context.Background(), enrolledUUID)
+		assert.True(t, IsNotFound(err))
+	})
+}
+
+func TestUnenrollAgent(t *testing.T) {
+	t.Run("removed immediately", func(t *testing.T) {
+		mux := http.NewServeMux()
+		mux.HandleFunc("DELETE /v2.5/agents/{uuid}", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"code": 200, "status": "Success", "results": {}}`))
+		})
+		svc := newTestService(t, mux)
+
+		waited, err := svc.UnenrollAgent(context.Background(), enrolledUUID, time.Millisecond, time.Second)
+		require.NoError(t, err)
+		assert.False(t, waited)
+	})
+
+	t.Run("waits until the agent is gone", func(t *testing.T) {
+		statusData := loadTestdata(t, "agent_status.json")
+		polls := 0
+		mux := http.NewServeMux()
+		mux.HandleFunc("DELETE /v2.5/agents/{uuid}", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusAccepted)
+			w.Write([]byte(`{"code": 202, "status": "Accepted", "results": {}}`))
+		})
+		mux.HandleFunc("GET /v2.5/agents/{uuid}", func(w http.ResponseWriter, r *http.Request) {
+			polls++
+			if polls < 3 {
+				w.Write(statusData)
+				return
+			}
+			http.Error(w, `{"code": 404, "status": "agent id not found"}`, http.StatusNotFound)
+		})
+		svc := newTestService(t, mux)
+
+		waited, err := svc.UnenrollAgent(context.Background(), enrolledUUID, time.Millisecond, time.Second)
+		require.NoError(t, err)
+		assert.True(t, waited)
+		assert.Equal(t, 3, polls)
+	})
+
+	t.Run("delete rejected", func(t *testing.T) {
+		mux := http.NewServeMux()
+		mux.HandleFunc("DELETE /v2.5/agents/{uuid}", func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, `{"code": 404, "status": "agent id not found"}`, http.StatusNotFound)
+		})
+		svc := newTestService(t, mux)
+
+		_, err := svc.UnenrollAgent(context.Background(), enrolledUUID, time.Millisecond, time.Second)
+		assert.True(t, IsNotFound(err))
+	})
+}
@@ -0,0 +1,68 @@
+package keylime
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+)
+
+// ErrUnknownCluster is returned when a tool names a cluster that is not configured.
+var ErrUnknownCluster = errors.New("unknown cluster")
+
+// APIError is a non-2xx response from the Keylime verifier or registrar.
+type APIError struct {
+	StatusCode int
+	Status     string // "status" field of the Keylime JSON body, if any
+	Method     string
+	Endpoint   string // request path without the API version prefix, e.g. "agents/<uuid>"
+	Body       string // sanitized body preview when Status is empty
+}
+
+func (e *APIError) Error() string {
+	if e.Status != "" {
+		return fmt.Sprintf("API error (HTTP %d): %s", e.StatusCode, e.Status)
+	}
+	return fmt.Sprintf("API request failed with HTTP %d: %s", e.StatusCode, e.Body)
+}
+
+// AsAPIError returns the APIError wrapped in err, if any.
+func AsAPIError(err error) (*APIError, bool) {
+	var apiErr *APIError
+	ok := errors.As(err, &apiErr)
+	return apiErr, ok
+}
+
+// IsNotFound reports whether err is a Keylime 404, e.g. an agent not enrolled in the verifier.
+func IsNotFound(err error) bool {
+	return hasStatus(err, http.StatusNotFound)
+}
+
+// IsConflict reports whether err is a Keylime 409, e.g. an agent or policy that already exists.
+func IsConflict(err error) bool {
+	return hasStatus(err, http.StatusConflict)
+}
+
+// IsForbidden reports whether err is a Keylime 401 or 403.
+func IsForbidden(err error) bool {
+	return hasStatus(err, http.StatusForbidden) || hasStatus(err, http.StatusUnauthorized)
+}
+
+func hasStatus(err error, code int) bool {
+	apiErr, ok := AsAPIError(err)
+	return ok && apiErr.StatusCode == code
+}
+
+var versionPrefixRE = regexp.MustCompile(`^/v\d+\.\d+/`)
+
+// requestEndpoint returns method and versionless path of the request that produced resp.
+func requestEndpoint(resp *http.Response) (string, string) {
+	if resp.Request == nil || resp.Request.URL == nil {
+		return "", ""
+	}
+	path := versionPrefixRE.ReplaceAllString(resp.Request.URL.Path, "")
+	if len(path) > 0 && path[0] == '/' {
+		path = path[1:]
+	}
+	return resp.Request.Method, path
+}
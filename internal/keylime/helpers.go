@@ -4,24 +4,34 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
-// ExtractAPIError reads a limited portion of the response body and returns a descriptive error.
+// ExtractAPIError reads a limited portion of the response body and returns it as an *APIError.
 func ExtractAPIError(resp *http.Response) error {
 	const maxErrorBody = 16 * 1024 // 16KB limit to prevent OOM on large error payloads
 	bodyBytes, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
-	var apiErr struct {
+	apiErr := &APIError{StatusCode: resp.StatusCode}
+	apiErr.Method, apiErr.Endpoint = requestEndpoint(resp)
+
+	var body struct {
 		Status string `json:"status"`
 	}
-	if err := json.Unmarshal(bodyBytes, &apiErr); err == nil && apiErr.Status != "" {
-		return fmt.Errorf("API error (HTTP %d): %s", resp.StatusCode, apiErr.Status)
+	if err := json.Unmarshal(bodyBytes, &body); err == nil && body.Status != "" {
+		apiErr.Status = body.Status
+	} else {
+		apiErr.Body = sanitizeErrorBody(bodyBytes)
 	}
-	return fmt.Errorf("API request failed with HTTP %d: %s", resp.StatusCode, sanitizeErrorBody(bodyBytes))
+	return apiErr
 }
 
 // sanitizeErrorBody truncates and strips non-printable characters from raw
@@ -50,10 +60,22 @@ func sanitizeErrorBody(body []byte) string {
 type Service struct {
 	Verifier  *Client
 	Registrar *Client
+
+	tpmCertStore   string        // directory of TPM manufacturer CA certificates
+	verifyIdentity bool          // verify the agent identity before every enrollment
+	agentTimeout   time.Duration // timeout of requests sent to agents
+	configuredMode string        // attestation mode from the config; empty or auto reads it from each agent's record
+
+	versionMu   sync.Mutex
+	pushVersion string // API version of the attestation resources in push mode
 }
 
 // NewService creates a new Keylime service with configured clients
 func NewService(config *Config) (*Service, error) {
+	return newService(DefaultClusterName, config)
+}
+
+func newService(cluster string, config *Config) (*Service, error) {
 	verifier, err := newClient(config.VerifierURL, config)
 	if err != nil {
 		return nil, fmt.Errorf("verifier client: %w", err)
@@ -62,9 +84,15 @@ func NewService(config *Config) (*Service, error) {
 	if err != nil {
 		return nil, fmt.Errorf("registrar client: %w", err)
 	}
+	verifier.useCassette(config.Cassette, cluster, "verifier")
+	registrar.useCassette(config.Cassette, cluster, "registrar")
 	return &Service{
-		Verifier:  verifier,
-		Registrar: registrar,
+		Verifier:       verifier,
+		Registrar:      registrar,
+		tpmCertStore:   config.TPMCertStore,
+		verifyIdentity: config.VerifyAgentIdentity,
+		agentTimeout:   config.RequestTimeout,
+		configuredMode: config.AttestationMode,
 	}, nil
 }
 
@@ -103,23 +131,11 @@ func (s *Service) FetchAllAgentUUIDs(ctx context.Context) ([]string, error) {
 }
 
 // PrepareEnrollmentBody fetches registrar details and returns the enrollment body ready for POST to the verifier.
-func (s *Service) PrepareEnrollmentBody(ctx context.Context, agentUUID, runtimePolicyName, mbPolicyName string) (map[string]any, error) {
-	regResp, err := s.Registrar.Get(ctx, fmt.Sprintf("agents/%s", agentUUID))
+// opts must have been validated by the caller.
+func (s *Service) PrepareEnrollmentBody(ctx context.Context, agentUUID, runtimePolicyName, mbPolicyName string, opts EnrollmentOptions) (map[string]any, error) {
+	regDetails, err := s.fetchRegistrarAgent(ctx, agentUUID)
 	if err != nil {
-		return nil, fmt.Errorf("agent not found in registrar: %w", err)
-	}
-	defer func() {
-		_, _ = io.Copy(io.Discard, regResp.Body)
-		_ = regResp.Body.Close()
-	}()
-
-	if regResp.StatusCode < 200 || regResp.StatusCode >= 300 {
-		return nil, fmt.Errorf("agent %s: %w", agentUUID, ExtractAPIError(regResp))
-	}
-
-	var regDetails RegistrarGetAgentDetailsOutput
-	if err := json.NewDecoder(regResp.Body).Decode(&regDetails); err != nil {
-		return nil, fmt.Errorf("failed to decode registrar response: %w", err)
+		return nil, err
 	}
 
 	runtimePolicyB64 := ""
@@ -146,39 +162,136 @@ func (s *Service) PrepareEnrollmentBody(ctx context.Context, agentUUID, runtimeP
 		}
 	}
 
-	tpmMask := 0
-	if runtimePolicyName != "" {
-		tpmMask |= 1 << 10 // IMA_PCR: runtime policy requires PCR 10 monitoring
+	tpmPolicy, err := EnrollmentTPMPolicy(runtimePolicyName != "", mbPolicyName != "", opts)
+	if err != nil {
+		return nil, err
 	}
-	if mbPolicyName != "" {
-		for _, pcr := range []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 11, 12, 13, 14, 15} {
-			tpmMask |= 1 << pcr // MEASUREDBOOT_PCRS
-		}
+	metadata, imaKeys, err := encodeEnrollmentExtras(opts)
+	if err != nil {
+		return nil, err
+	}
+	cloudagentIP, cloudagentPort := regDetails.Results.IP, regDetails.Results.Port
+	if opts.CloudAgentIP != "" {
+		cloudagentIP = opts.CloudAgentIP
+	}
+	if opts.CloudAgentPort != 0 {
+		cloudagentPort = opts.CloudAgentPort
 	}
-	tpmPolicy := fmt.Sprintf(`{"mask":"%#x"}`, tpmMask)
 
 	return map[string]any{
 		"v":                          nil,
-		"cloudagent_ip":              regDetails.Results.IP,
-		"cloudagent_port":            regDetails.Results.Port,
+		"cloudagent_ip":              cloudagentIP,
+		"cloudagent_port":            cloudagentPort,
 		"tpm_policy":                 tpmPolicy,
 		"runtime_policy":             runtimePolicyB64,
 		"runtime_policy_name":        "",
 		"runtime_policy_key":         "",
 		"mb_policy":                  "",
 		"mb_policy_name":             mbPolicyName,
-		"ima_sign_verification_keys": "",
-		"metadata":                   "{}",
+		"ima_sign_verification_keys": imaKeys,
+		"metadata":                   metadata,
 		"revocation_key":             "",
-		"accept_tpm_hash_algs":       []string{"sha256", "sha384", "sha512"},
-		"accept_tpm_encryption_algs": []string{"rsa"},
-		"accept_tpm_signing_algs":    []string{"rsassa"},
+		"accept_tpm_hash_algs":       orDefault(opts.AcceptTPMHashAlgs, []string{"sha256", "sha384", "sha512"}),
+		"accept_tpm_encryption_algs": orDefault(opts.AcceptTPMEncryptionAlgs, []string{"rsa"}),
+		"accept_tpm_signing_algs":    orDefault(opts.AcceptTPMSigningAlgs, []string{"rsassa"}),
 		"ak_tpm":                     regDetails.Results.AikTpm,
 		"mtls_cert":                  regDetails.Results.MtlsCert,
-		"supported_version":          strings.TrimPrefix(s.Verifier.APIVersion, "v"),
+		"supported_version":          strings.TrimPrefix(s.Verifier.APIVersion(), "v"),
 	}, nil
 }
 
+// fetchRegistrarAgent retrieves the registration of an agent: its keys, EK certificate and address.
+func (s *Service) fetchRegistrarAgent(ctx context.Context, agentUUID string) (RegistrarGetAgentDetailsOutput, error) {
+	var regDetails RegistrarGetAgentDetailsOutput
+	regResp, err := s.Registrar.Get(ctx, fmt.Sprintf("agents/%s", agentUUID))
+	if err != nil {
+		return regDetails, fmt.Errorf("agent not found in registrar: %w", err)
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, regResp.Body)
+		_ = regResp.Body.Close()
+	}()
+
+	if regResp.StatusCode < 200 || regResp.StatusCode >= 300 {
+		return regDetails, fmt.Errorf("agent %s: %w", agentUUID, ExtractAPIError(regResp))
+	}
+	if err := json.NewDecoder(regResp.Body).Decode(&regDetails); err != nil {
+		return regDetails, fmt.Errorf("failed to decode registrar response: %w", err)
+	}
+	return regDetails, nil
+}
+
+const (
+	// IMAPCR is extended by IMA and attested with a runtime policy.
+	IMAPCR = 10
+	// MaxPCR is the highest PCR index of a TPM 2.0 PCR bank.
+	MaxPCR = 23
+)
+
+// MeasuredBootPCRs are attested with a measured boot policy.
+var MeasuredBootPCRs = []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 11, 12, 13, 14, 15}
+
+// EnrollmentTPMPolicy builds the tpm_policy JSON: the mask of PCRs required by the policies,
+// the extra PCRs in opts, and the expected values of opts.ExpectedPCRValues.
+func EnrollmentTPMPolicy(hasRuntimePolicy, hasMBPolicy bool, opts EnrollmentOptions) (string, error) {
+	tpmMask := 0
+	if hasRuntimePolicy {
+		tpmMask |= 1 << IMAPCR // runtime policy requires PCR 10 monitoring
+	}
+	if hasMBPolicy {
+		for _, pcr := range MeasuredBootPCRs {
+			tpmMask |= 1 << pcr
+		}
+	}
+	for _, pcr := range opts.PCRs {
+		tpmMask |= 1 << pcr
+	}
+
+	policy := map[string]any{}
+	for index, values := range opts.ExpectedPCRValues {
+		pcr, err := strconv.Atoi(index)
+		if err != nil || pcr < 0 || pcr > MaxPCR {
+			return "", fmt.Errorf("invalid PCR index %q", index)
+		}
+		tpmMask |= 1 << pcr
+		policy[strconv.Itoa(pcr)] = values
+	}
+	policy["mask"] = fmt.Sprintf("%#x", tpmMask)
+
+	data, err := json.Marshal(policy)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode tpm_policy: %w", err)
+	}
+	return string(data), nil
+}
+
+// encodeEnrollmentExtras returns the metadata and IMA verification keys as the JSON strings the verifier expects.
+func encodeEnrollmentExtras(opts EnrollmentOptions) (metadata, imaKeys string, err error) {
+	metadata = "{}"
+	if len(opts.Metadata) > 0 {
+		data, err := json.Marshal(opts.Metadata)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to encode metadata: %w", err)
+		}
+		metadata = string(data)
+	}
+	if len(opts.IMASignVerificationKeys) > 0 {
+		data, err := json.Marshal(opts.IMASignVerificationKeys)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to encode ima_sign_verification_keys: %w", err)
+		}
+		imaKeys = string(data)
+	}
+	return metadata, imaKeys, nil
+}
+
+func orDefault(values, defaults []string) []string {
+	if len(values) == 0 {
+		return defaults
+	}
+	return values
+}
+
 // FetchAgentDetails retrieves detailed status information for a specific agent
 func (s *Service) FetchAgentDetails(ctx context.Context, agentUUID string) (AgentStatusResponse, error) {
 	resp, err := s.Verifier.Get(ctx, fmt.Sprintf("agents/%s", agentUUID))
@@ -204,3 +317,103 @@ func (s *Service) FetchAgentDetails(ctx context.Context, agentUUID string) (Agen
 
 	return agentStatus, nil
 }
+
+// FetchEnrolledAgentUUIDs lists the UUIDs of all agents enrolled in the verifier, whichever
+// verifier attests them.
+func (s *Service) FetchEnrolledAgentUUIDs(ctx context.Context) ([]string, error) {
+	resp, err := s.Verifier.Get(ctx, "agents/")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, ExtractAPIError(resp)
+	}
+
+	// the verifier lists each UUID as a one-column row, older versions as a plain string
+	var listing struct {
+		Results struct {
+			UUIDs []json.RawMessage `json:"uuids"`
+		} `json:"results"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&listing); err != nil {
+		return nil, fmt.Errorf("failed to decode verifier agent listing: %w", err)
+	}
+	uuids := make([]string, 0, len(listing.Results.UUIDs))
+	for _, raw := range listing.Results.UUIDs {
+		var row []string
+		if json.Unmarshal(raw, &row) == nil && len(row) > 0 {
+			uuids = append(uuids, row[0])
+			continue
+		}
+		var uuid string
+		if err := json.Unmarshal(raw, &uuid); err != nil {
+			return nil, fmt.Errorf("failed to decode verifier agent listing: %w", err)
+		}
+		uuids = append(uuids, uuid)
+	}
+	return uuids, nil
+}
+
+// bulkMinAPIVersion is the first verifier API version that answers agents/?bulk=true
+const bulkMinAPIVersion = "2.1"
+
+// ErrBulkUnsupported is returned by FetchAgentsBulk when the verifier cannot list agent details in bulk.
+var ErrBulkUnsupported = errors.New("verifier does not support bulk agent listing")
+
+// FetchAgentsBulk retrieves the details of every agent enrolled in the verifier with a single
+// request, optionally limited to agents attested by verifierID.
+func (s *Service) FetchAgentsBulk(ctx context.Context, verifierID string) (map[string]AgentDetails, error) {
+	version, err := s.Verifier.ensureAPIVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if compareVersions(strings.TrimPrefix(version, "v"), bulkMinAPIVersion) < 0 {
+		return nil, fmt.Errorf("%w (API %s)", ErrBulkUnsupported, version)
+	}
+
+	query := url.Values{"bulk": {"true"}}
+	if verifierID != "" {
+		query.Set("verifier", verifierID)
+	}
+	resp, err := s.Verifier.Get(ctx, "agents/?"+query.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}()
+
+	switch resp.StatusCode {
+	case http.StatusBadRequest, http.StatusNotFound, http.StatusMethodNotAllowed:
+		return nil, fmt.Errorf("%w: %w", ErrBulkUnsupported, ExtractAPIError(resp))
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, ExtractAPIError(resp)
+	}
+
+	var listing struct {
+		Results map[string]json.RawMessage `json:"results"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&listing); err != nil {
+		return nil, fmt.Errorf("failed to decode bulk agent listing: %w", err)
+	}
+	// verifiers that ignore the bulk parameter answer with the plain UUID listing
+	if _, ok := listing.Results["uuids"]; ok {
+		return nil, ErrBulkUnsupported
+	}
+
+	agents := make(map[string]AgentDetails, len(listing.Results))
+	for agentUUID, raw := range listing.Results {
+		var details AgentDetails
+		if err := json.Unmarshal(raw, &details); err != nil {
+			return nil, fmt.Errorf("failed to decode bulk entry for agent %s: %w", agentUUID, err)
+		}
+		agents[agentUUID] = details
+	}
+	return agents, nil
+}
@@ -2,8 +2,11 @@ package keylime
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 
@@ -46,6 +49,24 @@ func TestFetchAllAgentUUIDs(t *testing.T) {
 	})
 }
 
+func TestFetchEnrolledAgentUUIDs(t *testing.T) {
+	for name, listing := range map[string]string{
+		"rows":    `{"code":200,"status":"Success","results":{"uuids":[["d432fbb3-d2f1-4a97-9ef7-75bd81c00000"],["d432fbb3-d2f1-4a97-9ef7-75bd81c11111"]]}}`,
+		"strings": `{"code":200,"status":"Success","results":{"uuids":["d432fbb3-d2f1-4a97-9ef7-75bd81c00000","d432fbb3-d2f1-4a97-9ef7-75bd81c11111"]}}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			svc := newTestService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "/v2.5/agents/", r.URL.Path)
+				w.Write([]byte(listing))
+			}))
+
+			uuids, err := svc.FetchEnrolledAgentUUIDs(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, []string{"d432fbb3-d2f1-4a97-9ef7-75bd81c00000", "d432fbb3-d2f1-4a97-9ef7-75bd81c11111"}, uuids)
+		})
+	}
+}
+
 func TestFetchAgentDetails(t *testing.T) {
 	t.Run("returns agent status", func(t *testing.T) {
 		data := loadTestdata(t, "agent_status.json")
@@ -103,7 +124,7 @@ func TestPrepareEnrollmentBody(t *testing.T) {
 			w.Write(data)
 		}))
 
-		body, err := svc.PrepareEnrollmentBody(context.Background(), "d432fbb3-d2f1-4a97-9ef7-75bd81c00000", "", "")
+		body, err := svc.PrepareEnrollmentBody(context.Background(), "d432fbb3-d2f1-4a97-9ef7-75bd81c00000", "", "", EnrollmentOptions{})
 		require.NoError(t, err)
 		assert.Equal(t, "192.168.1.100", body["cloudagent_ip"])
 		assert.Equal(t, 9002, body["cloudagent_port"])
@@ -114,6 +135,24 @@ func TestPrepareEnrollmentBody(t *testing.T) {
 		assert.Equal(t, "test-mtls-cert", body["mtls_cert"])
 	})
 
+	t.Run("supported version follows negotiation", func(t *testing.T) {
+		data := loadTestdata(t, "registrar_agent_details.json")
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /version", versionHandler("2.1", "2.3"))
+		mux.HandleFunc("GET /v2.3/agents/{uuid}", func(w http.ResponseWriter, r *http.Request) {
+			w.Write(data)
+		})
+		ts := httptest.NewServer(mux)
+		t.Cleanup(ts.Close)
+		svc, err := NewService(&Config{VerifierURL: ts.URL, RegistrarURL: ts.URL})
+		require.NoError(t, err)
+		require.NoError(t, svc.NegotiateAPIVersions(context.Background()))
+
+		body, err := svc.PrepareEnrollmentBody(context.Background(), "d432fbb3-d2f1-4a97-9ef7-75bd81c00000", "", "", EnrollmentOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "2.3", body["supported_version"])
+	})
+
 	t.Run("with runtime policy", func(t *testing.T) {
 		regData := loadTestdata(t, "registrar_agent_details.json")
 		policyData := loadTestdata(t, "runtime_policy.json")
@@ -126,7 +165,7 @@ func TestPrepareEnrollmentBody(t *testing.T) {
 		})
 		svc := newTestService(t, mux)
 
-		body, err := svc.PrepareEnrollmentBody(context.Background(), "d432fbb3-d2f1-4a97-9ef7-75bd81c00000", "test-policy", "")
+		body, err := svc.PrepareEnrollmentBody(context.Background(), "d432fbb3-d2f1-4a97-9ef7-75bd81c00000", "test-policy", "", EnrollmentOptions{})
 		require.NoError(t, err)
 		assert.NotEmpty(t, body["runtime_policy"]) // base64 encoded
 		assert.Equal(t, `{"mask":"0x400"}`, body["tpm_policy"])
@@ -138,7 +177,7 @@ func TestPrepareEnrollmentBody(t *testing.T) {
 			w.Write(data)
 		}))
 
-		body, err := svc.PrepareEnrollmentBody(context.Background(), "d432fbb3-d2f1-4a97-9ef7-75bd81c00000", "", "mb-policy")
+		body, err := svc.PrepareEnrollmentBody(context.Background(), "d432fbb3-d2f1-4a97-9ef7-75bd81c00000", "", "mb-policy", EnrollmentOptions{})
 		require.NoError(t, err)
 		assert.Equal(t, "mb-policy", body["mb_policy_name"])
 		// PCR mask includes PCRs 0-9, 11-15 = 0xfbff
@@ -157,7 +196,7 @@ func TestPrepareEnrollmentBody(t *testing.T) {
 		})
 		svc := newTestService(t, mux)
 
-		body, err := svc.PrepareEnrollmentBody(context.Background(), "d432fbb3-d2f1-4a97-9ef7-75bd81c00000", "test-policy", "mb-policy")
+		body, err := svc.PrepareEnrollmentBody(context.Background(), "d432fbb3-d2f1-4a97-9ef7-75bd81c00000", "test-policy", "mb-policy", EnrollmentOptions{})
 		require.NoError(t, err)
 		assert.NotEmpty(t, body["runtime_policy"])
 		assert.Equal(t, "mb-policy", body["mb_policy_name"])
@@ -165,13 +204,56 @@ func TestPrepareEnrollmentBody(t *testing.T) {
 		assert.Equal(t, `{"mask":"0xffff"}`, body["tpm_policy"])
 	})
 
+	t.Run("with enrollment options", func(t *testing.T) {
+		data := loadTestdata(t, "registrar_agent_details.json")
+		svc := newTestService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write(data)
+		}))
+
+		body, err := svc.PrepareEnrollmentBody(context.Background(), "d432fbb3-d2f1-4a97-9ef7-75bd81c00000", "", "mb-policy", EnrollmentOptions{
+			PCRs:                    []int{16},
+			ExpectedPCRValues:       map[string][]string{"23": {strings.Repeat("0", 64)}},
+			AcceptTPMHashAlgs:       []string{"sha384"},
+			AcceptTPMEncryptionAlgs: []string{"ecc"},
+			AcceptTPMSigningAlgs:    []string{"ecdsa"},
+			Metadata:                map[string]any{"rack": "r12"},
+			IMASignVerificationKeys: []string{"-----BEGIN PUBLIC KEY-----\nMFk=\n-----END PUBLIC KEY-----"},
+			CloudAgentIP:            "203.0.113.7",
+			CloudAgentPort:          19002,
+		})
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"mask":"0x81fbff","23":["`+strings.Repeat("0", 64)+`"]}`, body["tpm_policy"].(string))
+		assert.Equal(t, []string{"sha384"}, body["accept_tpm_hash_algs"])
+		assert.Equal(t, []string{"ecc"}, body["accept_tpm_encryption_algs"])
+		assert.Equal(t, []string{"ecdsa"}, body["accept_tpm_signing_algs"])
+		assert.Equal(t, `{"rack":"r12"}`, body["metadata"])
+		assert.JSONEq(t, `["-----BEGIN PUBLIC KEY-----\nMFk=\n-----END PUBLIC KEY-----"]`, body["ima_sign_verification_keys"].(string))
+		assert.Equal(t, "203.0.113.7", body["cloudagent_ip"])
+		assert.Equal(t, 19002, body["cloudagent_port"])
+	})
+
+	t.Run("defaults without options", func(t *testing.T) {
+		data := loadTestdata(t, "registrar_agent_details.json")
+		svc := newTestService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write(data)
+		}))
+
+		body, err := svc.PrepareEnrollmentBody(context.Background(), "d432fbb3-d2f1-4a97-9ef7-75bd81c00000", "", "", EnrollmentOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"sha256", "sha384", "sha512"}, body["accept_tpm_hash_algs"])
+		assert.Equal(t, []string{"rsa"}, body["accept_tpm_encryption_algs"])
+		assert.Equal(t, []string{"rsassa"}, body["accept_tpm_signing_algs"])
+		assert.Equal(t, "{}", body["metadata"])
+		assert.Equal(t, "", body["ima_sign_verification_keys"])
+	})
+
 	t.Run("registrar unreachable returns error", func(t *testing.T) {
 		svc := newTestService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			w.WriteHeader(http.StatusNotFound)
 			w.Write([]byte("not found"))
 		}))
 
-		_, err := svc.PrepareEnrollmentBody(context.Background(), "d432fbb3-d2f1-4a97-9ef7-75bd81c00000", "", "")
+		_, err := svc.PrepareEnrollmentBody(context.Background(), "d432fbb3-d2f1-4a97-9ef7-75bd81c00000", "", "", EnrollmentOptions{})
 		assert.Error(t, err)
 	})
 }
@@ -237,6 +319,32 @@ func TestExtractAPIError(t *testing.T) {
 		assert.Contains(t, err.Error(), "API request failed with HTTP 500")
 	})
 
+	t.Run("typed error with request details", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodDelete, "http://verifier/v2.5/agents/abc", nil)
+		resp := &http.Response{
+			StatusCode: 409,
+			Body:       io.NopCloser(strings.NewReader(`{"status":"agent already exists"}`)),
+			Request:    req,
+		}
+		err := ExtractAPIError(resp)
+
+		apiErr, ok := AsAPIError(fmt.Errorf("wrapped: %w", err))
+		require.True(t, ok)
+		assert.Equal(t, 409, apiErr.StatusCode)
+		assert.Equal(t, "agent already exists", apiErr.Status)
+		assert.Equal(t, http.MethodDelete, apiErr.Method)
+		assert.Equal(t, "agents/abc", apiErr.Endpoint)
+		assert.True(t, IsConflict(err))
+		assert.False(t, IsNotFound(err))
+	})
+
+	t.Run("status helpers", func(t *testing.T) {
+		assert.True(t, IsNotFound(&APIError{StatusCode: 404}))
+		assert.True(t, IsForbidden(&APIError{StatusCode: 401}))
+		assert.False(t, IsNotFound(errors.New("404")))
+		assert.False(t, IsConflict(nil))
+	})
+
 	t.Run("large body does not OOM", func(t *testing.T) {
 		resp := &http.Response{
 			StatusCode: 500,
@@ -247,3 +355,48 @@ func TestExtractAPIError(t *testing.T) {
 		assert.Less(t, len(err.Error()), 20*1024)
 	})
 }
+
+func TestFetchAgentsBulk(t *testing.T) {
+	t.Run("decodes agents keyed by uuid", func(t *testing.T) {
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /v2.5/agents/", func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "true", r.URL.Query().Get("bulk"))
+			assert.Empty(t, r.URL.Query().Get("verifier"))
+			w.Write([]byte(`{"code":200,"status":"Success","results":{"a1":{"operational_state":9,"verifier_id":"default"},"a2":{"operational_state":3}}}`))
+		})
+		svc := newTestService(t, mux)
+
+		agents, err := svc.FetchAgentsBulk(context.Background(), "")
+		require.NoError(t, err)
+		require.Len(t, agents, 2)
+		assert.Equal(t, StateInvalidQuote, agents["a1"].OperationalState)
+		assert.Equal(t, "default", agents["a1"].VerifierID)
+	})
+
+	t.Run("old API version unsupported without a request", func(t *testing.T) {
+		svc, err := NewService(&Config{VerifierURL: "http://127.0.0.1:1", RegistrarURL: "http://127.0.0.1:1", APIVersion: "v2.0"})
+		require.NoError(t, err)
+
+		_, err = svc.FetchAgentsBulk(context.Background(), "")
+		assert.ErrorIs(t, err, ErrBulkUnsupported)
+	})
+
+	t.Run("plain uuid listing means unsupported", func(t *testing.T) {
+		svc := newTestService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"code":200,"status":"Success","results":{"uuids":[["a1"]]}}`))
+		}))
+
+		_, err := svc.FetchAgentsBulk(context.Background(), "")
+		assert.ErrorIs(t, err, ErrBulkUnsupported)
+	})
+
+	t.Run("server error is returned", func(t *testing.T) {
+		svc := newTestService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+
+		_, err := svc.FetchAgentsBulk(context.Background(), "")
+		require.Error(t, err)
+		assert.NotErrorIs(t, err, ErrBulkUnsupported)
+	})
+}
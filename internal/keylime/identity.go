@@ -0,0 +1,223 @@
+package keylime
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/keylime/keylime-mcp/internal/tpm"
+)
+
+// ErrIdentityMismatch is returned by VerifyAgentIdentity when the agent's TPM identity does
+// not check out: an untrusted EK certificate, keys that do not match it, or a bad quote.
+var ErrIdentityMismatch = errors.New("agent identity verification failed")
+
+// IdentityVerification describes an agent identity that passed VerifyAgentIdentity.
+type IdentityVerification struct {
+	EKCertIssuer    string `json:"ek_cert_issuer"`
+	AgentAddress    string `json:"agent_address"`
+	AgentAPIVersion string `json:"agent_api_version"`
+	HashAlg         string `json:"hash_alg"`
+	SignAlg         string `json:"sign_alg"`
+
+	client    *http.Client // pinned connection to the verified agent
+	transport string       // PEM public key of the agent, bound to its quote, for key delivery
+}
+
+// agentIdentityQuote is the result of GET /v{version}/quotes/identity on the agent.
+type agentIdentityQuote struct {
+	Quote   string `json:"quote"`
+	HashAlg string `json:"hash_alg"`
+	EncAlg  string `json:"enc_alg"`
+	SignAlg string `json:"sign_alg"`
+	PubKey  string `json:"pubkey"`
+}
+
+// VerifiesAgentIdentity reports whether the service is configured to verify the identity of
+// every agent before enrollment.
+func (s *Service) VerifiesAgentIdentity() bool {
+	return s.verifyIdentity
+}
+
+// VerifyAgentIdentity checks an agent the way the Keylime tenant does before adding it: the
+// registrar's EK certificate must chain to a TPM manufacturer CA of the cert store and match
+// ek_tpm, and the agent must answer a fresh nonce with an identity quote signed by aik_tpm.
+// The agent is contacted at the registrar address unless ip or port override it.
+func (s *Service) VerifyAgentIdentity(ctx context.Context, agentUUID, ip string, port int) (*IdentityVerification, error) {
+	reg, err := s.fetchRegistrarAgent(ctx, agentUUID)
+	if err != nil {
+		return nil, err
+	}
+	r := reg.Results
+	ak, cert, err := s.checkRegistration(r.AikTpm, r.EkTpm, r.Ekcert)
+	if err != nil {
+		return nil, err
+	}
+
+	if ip == "" {
+		ip = r.IP
+	}
+	if port == 0 {
+		port = r.Port
+	}
+	if ip == "" || port == 0 {
+		return nil, fmt.Errorf("%w: registrar has no address for agent %s", ErrIdentityMismatch, agentUUID)
+	}
+	client, scheme, err := s.agentClient(r.MtlsCert)
+	if err != nil {
+		return nil, err
+	}
+	base := scheme + "://" + net.JoinHostPort(ip, strconv.Itoa(port))
+
+	var version struct {
+		SupportedVersion string `json:"supported_version"`
+	}
+	if err := getAgentResults(ctx, client, base+"/version", &version); err != nil {
+		return nil, fmt.Errorf("agent %s: %w", agentUUID, err)
+	}
+	if version.SupportedVersion == "" {
+		return nil, fmt.Errorf("agent %s did not report its API version", agentUUID)
+	}
+
+	nonce := rand.Text()
+	var quote agentIdentityQuote
+	endpoint := fmt.Sprintf("%s/v%s/quotes/identity?nonce=%s", base, strings.TrimPrefix(version.SupportedVersion, "v"), url.QueryEscape(nonce))
+	if err := getAgentResults(ctx, client, endpoint, &quote); err != nil {
+		return nil, fmt.Errorf("agent %s: identity quote: %w", agentUUID, err)
+	}
+	parsed, err := tpm.ParseQuote(quote.Quote)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrIdentityMismatch, err)
+	}
+	// the agent extends PCR 16 with its transport key, which binds the key to the quote
+	if _, err := tpm.VerifyQuote(ak, parsed, []byte(nonce), []byte(quote.PubKey)); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrIdentityMismatch, err)
+	}
+
+	return &IdentityVerification{
+		EKCertIssuer:    cert.Issuer.String(),
+		AgentAddress:    base,
+		AgentAPIVersion: version.SupportedVersion,
+		HashAlg:         quote.HashAlg,
+		SignAlg:         quote.SignAlg,
+		client:          client,
+		transport:       quote.PubKey,
+	}, nil
+}
+
+// checkRegistration verifies the registrar's EK certificate and keys and returns the AK and
+// the EK certificate.
+func (s *Service) checkRegistration(aikTPM, ekTPM, ekCert string) (crypto.PublicKey, *x509.Certificate, error) {
+	if ekCert == "" {
+		return nil, nil, fmt.Errorf("%w: registrar has no EK certificate for the agent", ErrIdentityMismatch)
+	}
+	cert, err := tpm.ParseEKCertificate([]byte(ekCert))
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrIdentityMismatch, err)
+	}
+	store, err := tpm.LoadCertStore(s.tpmCertStore)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := store.Verify(cert); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrIdentityMismatch, err)
+	}
+
+	ek, err := parseRegistrarKey(ekTPM)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: ek_tpm: %v", ErrIdentityMismatch, err)
+	}
+	if !tpm.SamePublicKey(ek, cert.PublicKey) {
+		return nil, nil, fmt.Errorf("%w: ek_tpm does not match the EK certificate", ErrIdentityMismatch)
+	}
+	ak, err := parseRegistrarKey(aikTPM)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: aik_tpm: %v", ErrIdentityMismatch, err)
+	}
+	return ak, cert, nil
+}
+
+// parseRegistrarKey decodes a base64 TPM2B_PUBLIC as stored by the registrar.
+func parseRegistrarKey(b64 string) (crypto.PublicKey, error) {
+	data, err := base64.StdEncoding.DecodeString(b64)
+	if err != nil {
+		return nil, err
+	}
+	return tpm.ParsePublic(data)
+}
+
+// agentClient returns an HTTP client for the agent. With TLS enabled and an agent mTLS
+// certificate in the registrar, the agent must present exactly that certificate and is sent
+// the verifier client certificate, as the tenant does.
+func (s *Service) agentClient(mtlsCert string) (*http.Client, string, error) {
+	client := &http.Client{Timeout: s.agentTimeout}
+	if client.Timeout <= 0 {
+		client.Timeout = 30 * time.Second
+	}
+	creds := s.Registrar.tls
+	if creds == nil || mtlsCert == "" {
+		return client, "http", nil
+	}
+	block, _ := pem.Decode([]byte(mtlsCert))
+	if block == nil {
+		return nil, "", fmt.Errorf("%w: invalid agent mTLS certificate in registrar", ErrIdentityMismatch)
+	}
+	client.Transport = &http.Transport{TLSClientConfig: pinnedTLSConfig(block.Bytes, creds.getClientCertificate)}
+	return client, "https", nil
+}
+
+// pinnedTLSConfig accepts only the server certificate pinned. Agent certificates are
+// self-signed and carry no name to verify, so chain and hostname checks are replaced by the pin.
+func pinnedTLSConfig(pinned []byte, clientCert func(*tls.CertificateRequestInfo) (*tls.Certificate, error)) *tls.Config {
+	return &tls.Config{
+		InsecureSkipVerify: true, // #nosec G402 -- the peer certificate is pinned in VerifyPeerCertificate
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 || !bytes.Equal(rawCerts[0], pinned) {
+				return fmt.Errorf("%w: agent did not present its registered mTLS certificate", ErrIdentityMismatch)
+			}
+			return nil
+		},
+		GetClientCertificate: clientCert,
+	}
+}
+
+// getAgentResults sends a GET to the agent and decodes the results of its JSON envelope.
+func getAgentResults(ctx context.Context, client *http.Client, endpoint string, results any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req) // #nosec G704 -- agent address comes from the registrar
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return ExtractAPIError(resp)
+	}
+	envelope := struct {
+		Results any `json:"results"`
+	}{Results: results}
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return fmt.Errorf("failed to decode agent response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package keylime
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/keylime/keylime-mcp/internal/tpm"
+	"github.com/keylime/keylime-mcp/internal/tpm/tpmtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// identityFixture is a registrar that knows one agent, served by a stub agent endpoint.
+type identityFixture struct {
+	svc      *Service
+	sim      *tpmtest.TPM
+	agent    *tpmtest.Agent
+	register map[string]any // registrar results for the agent; tests may change them
+}
+
+func newIdentityFixture(t *testing.T, keyAlg uint16) *identityFixture {
+	t.Helper()
+	sim, err := tpmtest.New(keyAlg)
+	require.NoError(t, err)
+	agent := &tpmtest.Agent{TPM: sim}
+	agentServer := httptest.NewServer(agent)
+	t.Cleanup(agentServer.Close)
+	host, port, err := net.SplitHostPort(agentServer.Listener.Addr().String())
+	require.NoError(t, err)
+	portNum, err := strconv.Atoi(port)
+	require.NoError(t, err)
+
+	aik, ek, ekcert := sim.Registration()
+	f := &identityFixture{sim: sim, agent: agent, register: map[string]any{
+		"aik_tpm": aik, "ek_tpm": ek, "ekcert": ekcert, "mtls_cert": "", "ip": host, "port": portNum, "regcount": 1,
+	}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v2.5/agents/{uuid}", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{"code": 200, "status": "Success", "results": f.register})
+	})
+	f.svc = newTestService(t, mux)
+
+	store := t.TempDir()
+	require.NoError(t, sim.WriteCA(store))
+	f.svc.tpmCertStore = store
+	return f
+}
+
+func TestVerifyAgentIdentity(t *testing.T) {
+	ctx := context.Background()
+
+	for name, alg := range map[string]uint16{"rsa": tpm.AlgRSA, "ecc": tpm.AlgECC} {
+		t.Run("valid "+name+" agent", func(t *testing.T) {
+			f := newIdentityFixture(t, alg)
+			identity, err := f.svc.VerifyAgentIdentity(ctx, enrolledUUID, "", 0)
+			require.NoError(t, err)
+			assert.Contains(t, identity.EKCertIssuer, "Test EK Root CA")
+			assert.Equal(t, "2.2", identity.AgentAPIVersion)
+			assert.Equal(t, "sha256", identity.HashAlg)
+		})
+	}
+
+	t.Run("EK certificate from an unknown manufacturer", func(t *testing.T) {
+		f := newIdentityFixture(t, tpm.AlgRSA)
+		other, err := tpmtest.New(tpm.AlgRSA)
+		require.NoError(t, err)
+		_, ek, ekcert := other.Registration()
+		f.register["ek_tpm"], f.register["ekcert"] = ek, ekcert
+
+		_, err = f.svc.VerifyAgentIdentity(ctx, enrolledUUID, "", 0)
+		assert.ErrorIs(t, err, ErrIdentityMismatch)
+		assert.ErrorContains(t, err, "trusted TPM manufacturer")
+	})
+
+	t.Run("EK does not match its certificate", func(t *testing.T) {
+		f := newIdentityFixture(t, tpm.AlgRSA)
+		f.register["ek_tpm"] = f.register["aik_tpm"]
+
+		_, err := f.svc.VerifyAgentIdentity(ctx, enrolledUUID, "", 0)
+		assert.ErrorIs(t, err, ErrIdentityMismatch)
+		assert.ErrorContains(t, err, "ek_tpm does not match")
+	})
+
+	t.Run("missing EK certificate", func(t *testing.T) {
+		f := newIdentityFixture(t, tpm.AlgRSA)
+		f.register["ekcert"] = ""
+
+		_, err := f.svc.VerifyAgentIdentity(ctx, enrolledUUID, "", 0)
+		assert.ErrorIs(t, err, ErrIdentityMismatch)
+	})
+
+	t.Run("quote signed by another AK", func(t *testing.T) {
+		f := newIdentityFixture(t, tpm.AlgRSA)
+		other, err := tpmtest.New(tpm.AlgRSA)
+		require.NoError(t, err)
+		f.agent.TPM = &tpmtest.TPM{CA: f.sim.CA, EKCert: f.sim.EKCert, EK: f.sim.EK, AK: other.AK}
+
+		_, err = f.svc.VerifyAgentIdentity(ctx, enrolledUUID, "", 0)
+		assert.ErrorIs(t, err, ErrIdentityMismatch)
+		assert.ErrorContains(t, err, "does not verify")
+	})
+
+	t.Run("replayed quote", func(t *testing.T) {
+		f := newIdentityFixture(t, tpm.AlgECC)
+		f.agent.Nonce = []byte("ABCDEFGHIJKLMNOPQRST")
+
+		_, err := f.svc.VerifyAgentIdentity(ctx, enrolledUUID, "", 0)
+		assert.ErrorIs(t, err, ErrIdentityMismatch)
+		assert.ErrorContains(t, err, "nonce")
+	})
+
+	t.Run("swapped transport key", func(t *testing.T) {
+		f := newIdentityFixture(t, tpm.AlgRSA)
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+		der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+		require.NoError(t, err)
+		f.agent.PubKey = string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+
+		_, err = f.svc.VerifyAgentIdentity(ctx, enrolledUUID, "", 0)
+		assert.ErrorIs(t, err, ErrIdentityMismatch)
+		assert.ErrorContains(t, err, "PCR 16 does not hold the key")
+	})
+
+	t.Run("tampered PCR values", func(t *testing.T) {
+		f := newIdentityFixture(t, tpm.AlgECC)
+		f.agent.PCRs = tpmtest.PCRBlob(tpm.AlgSHA256, []int{tpm.DataPCR}, make([]byte, 32))
+
+		_, err := f.svc.VerifyAgentIdentity(ctx, enrolledUUID, "", 0)
+		assert.ErrorIs(t, err, ErrIdentityMismatch)
+		assert.ErrorContains(t, err, "do not match the PCR digest")
+	})
+
+	t.Run("address override", func(t *testing.T) {
+		f := newIdentityFixture(t, tpm.AlgRSA)
+		host, port := f.register["ip"].(string), f.register["port"].(int)
+		f.register["ip"], f.register["port"] = "192.0.2.1", 9002
+
+		_, err := f.svc.VerifyAgentIdentity(ctx, enrolledUUID, host, port)
+		assert.NoError(t, err)
+	})
+
+	t.Run("agent unreachable", func(t *testing.T) {
+		f := newIdentityFixture(t, tpm.AlgRSA)
+		closed := httptest.NewServer(http.NotFoundHandler())
+		closed.Close()
+		_, port, _ := net.SplitHostPort(closed.Listener.Addr().String())
+		f.register["port"], _ = strconv.Atoi(port)
+
+		_, err := f.svc.VerifyAgentIdentity(ctx, enrolledUUID, "", 0)
+		require.Error(t, err)
+		assert.NotErrorIs(t, err, ErrIdentityMismatch)
+	})
+
+	t.Run("cert store missing", func(t *testing.T) {
+		f := newIdentityFixture(t, tpm.AlgRSA)
+		f.svc.tpmCertStore = t.TempDir() + "/missing"
+
+		_, err := f.svc.VerifyAgentIdentity(ctx, enrolledUUID, "", 0)
+		assert.ErrorContains(t, err, "TPM cert store")
+		assert.NotErrorIs(t, err, ErrIdentityMismatch)
+	})
+}
+
+func TestPinnedTLSConfig(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"code": 200, "status": "Success", "results": {"supported_version": "2.2"}}`))
+	}))
+	t.Cleanup(server.Close)
+	noClientCert := func(*tls.CertificateRequestInfo) (*tls.Certificate, error) { return &tls.Certificate{}, nil }
+
+	t.Run("registered certificate", func(t *testing.T) {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: pinnedTLSConfig(server.Certificate().Raw, noClientCert)}}
+
+		var version struct {
+			SupportedVersion string `json:"supported_version"`
+		}
+		require.NoError(t, getAgentResults(context.Background(), client, server.URL+"/version", &version))
+		assert.Equal(t, "2.2", version.SupportedVersion)
+	})
+
+	t.Run("other certificate", func(t *testing.T) {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: pinnedTLSConfig([]byte("other"), noClientCert)}}
+		err := getAgentResults(context.Background(), client, server.URL+"/version", &struct{}{})
+		assert.ErrorIs(t, err, ErrIdentityMismatch)
+	})
+}
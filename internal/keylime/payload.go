@@ -0,0 +1,232 @@
+package keylime
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1" // #nosec G505 -- Keylime encrypts U with RSA-OAEP SHA-1
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const (
+	bootstrapKeySize = 32 // AES-256
+	payloadIVSize    = 16 // Keylime uses a 16-byte GCM nonce
+
+	// PayloadScriptName is the name the agent runs after extracting a payload zip.
+	PayloadScriptName = "autorun.sh"
+)
+
+// BootstrapKey is the key that encrypts an enrollment payload, split as Keylime does: U is
+// sent to the agent, V to the verifier, and the agent only learns K = U xor V once the
+// verifier has attested it and released V.
+type BootstrapKey struct {
+	K []byte
+	U []byte
+	V []byte
+}
+
+// NewBootstrapKey generates a random K and splits it into U and V.
+func NewBootstrapKey() (*BootstrapKey, error) {
+	k := &BootstrapKey{K: make([]byte, bootstrapKeySize), U: make([]byte, bootstrapKeySize), V: make([]byte, bootstrapKeySize)}
+	if _, err := rand.Read(k.K); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(k.U); err != nil {
+		return nil, err
+	}
+	for i := range k.K {
+		k.V[i] = k.K[i] ^ k.U[i]
+	}
+	return k, nil
+}
+
+// AuthTag is the HMAC the agent uses to check that U and V combine to the key for agentUUID.
+func (k *BootstrapKey) AuthTag(agentUUID string) string {
+	mac := hmac.New(sha512.New384, k.K)
+	mac.Write([]byte(agentUUID))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// BuildPayload reads the payload at path. A single file without script is delivered as is;
+// a directory, or a file with a script, is zipped, with the script stored as autorun.sh so
+// that the agent runs it after extraction. The payload may not exceed maxSize bytes.
+func BuildPayload(path, script string, maxSize int64) ([]byte, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() && script == "" {
+		if info.Size() > maxSize {
+			return nil, fmt.Errorf("payload is too large (%d bytes, max %d)", info.Size(), maxSize)
+		}
+		return os.ReadFile(path) // #nosec G304 -- path is validated by the caller
+	}
+
+	files := map[string]string{} // name in the zip -> file on disk
+	if info.IsDir() {
+		err = filepath.WalkDir(path, func(file string, d fs.DirEntry, err error) error {
+			if err != nil || !d.Type().IsRegular() {
+				return err
+			}
+			rel, err := filepath.Rel(path, file)
+			if err != nil {
+				return err
+			}
+			files[filepath.ToSlash(rel)] = file
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		files[info.Name()] = path
+	}
+	if script != "" {
+		if _, ok := files[PayloadScriptName]; ok {
+			return nil, fmt.Errorf("payload already contains %s", PayloadScriptName)
+		}
+		files[PayloadScriptName] = script
+	}
+	return zipFiles(files, maxSize)
+}
+
+func zipFiles(files map[string]string, maxSize int64) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	var total int64
+	for _, name := range slices.Sorted(maps.Keys(files)) {
+		data, err := os.ReadFile(files[name]) // #nosec G304 -- files of the payload directory chosen by the caller
+		if err != nil {
+			return nil, err
+		}
+		if total += int64(len(data)); total > maxSize {
+			return nil, fmt.Errorf("payload is too large (more than %d bytes)", maxSize)
+		}
+		header := &zip.FileHeader{Name: name, Method: zip.Deflate}
+		header.SetMode(0600)
+		if name == PayloadScriptName {
+			header.SetMode(0700)
+		}
+		w, err := zw.CreateHeader(header)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// EncryptPayload encrypts plaintext with AES-GCM under key in Keylime's format:
+// base64 of the IV, the ciphertext and the tag.
+func EncryptPayload(key, plaintext []byte) (string, error) {
+	gcm, err := payloadCipher(key)
+	if err != nil {
+		return "", err
+	}
+	iv := make([]byte, payloadIVSize)
+	if _, err := rand.Read(iv); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(gcm.Seal(iv, iv, plaintext, nil)), nil
+}
+
+// DecryptPayload reverses EncryptPayload, as the agent does once it has K.
+func DecryptPayload(key []byte, payload string) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < payloadIVSize {
+		return nil, errors.New("encrypted payload is too short")
+	}
+	gcm, err := payloadCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return gcm.Open(nil, data[:payloadIVSize], data[payloadIVSize:], nil)
+}
+
+func payloadCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCMWithNonceSize(block, payloadIVSize)
+}
+
+// DeliverKey sends U and the encrypted payload to an agent that passed VerifyAgentIdentity,
+// encrypted for the transport key bound to its identity quote. Call it only after the
+// verifier has accepted the enrollment with V.
+func (s *Service) DeliverKey(ctx context.Context, identity *IdentityVerification, agentUUID string, key *BootstrapKey, encryptedPayload string) error {
+	if identity == nil || identity.client == nil {
+		return errors.New("key delivery requires a verified agent identity")
+	}
+	block, _ := pem.Decode([]byte(identity.transport))
+	if block == nil {
+		return fmt.Errorf("%w: agent sent no transport key with its identity quote", ErrIdentityMismatch)
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("%w: invalid agent transport key: %v", ErrIdentityMismatch, err)
+	}
+	rsaPub, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("%w: agent transport key is not RSA", ErrIdentityMismatch)
+	}
+	encryptedU, err := rsa.EncryptOAEP(sha1.New(), rand.Reader, rsaPub, key.U, nil) // #nosec G401 -- the agent decrypts U with RSA-OAEP SHA-1
+	if err != nil {
+		return fmt.Errorf("failed to encrypt U: %w", err)
+	}
+
+	body, err := json.Marshal(map[string]string{
+		"auth_tag":      key.AuthTag(agentUUID),
+		"encrypted_key": base64.StdEncoding.EncodeToString(encryptedU),
+		"payload":       encryptedPayload,
+	})
+	if err != nil {
+		return err
+	}
+	endpoint := fmt.Sprintf("%s/v%s/keys/ukey", identity.AgentAddress, strings.TrimPrefix(identity.AgentAPIVersion, "v"))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := identity.client.Do(req) // #nosec G704 -- agent address comes from the registrar
+	if err != nil {
+		return fmt.Errorf("agent %s: key delivery: %w", agentUUID, err)
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("agent %s: key delivery: %w", agentUUID, ExtractAPIError(resp))
+	}
+	return nil
+}
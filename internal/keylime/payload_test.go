@@ -0,0 +1,123 @@
+package keylime
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/keylime/keylime-mcp/internal/tpm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBootstrapKey(t *testing.T) {
+	key, err := NewBootstrapKey()
+	require.NoError(t, err)
+	require.Len(t, key.K, 32)
+	for i := range key.K {
+		assert.Equal(t, key.K[i], key.U[i]^key.V[i])
+	}
+	assert.NotEqual(t, key.K, key.U)
+	assert.Len(t, key.AuthTag(enrolledUUID), 96, "hex HMAC-SHA384")
+	assert.NotEqual(t, key.AuthTag(enrolledUUID), key.AuthTag("other"))
+}
+
+func TestEncryptPayload(t *testing.T) {
+	key, err := NewBootstrapKey()
+	require.NoError(t, err)
+
+	encrypted, err := EncryptPayload(key.K, []byte("secret"))
+	require.NoError(t, err)
+	decrypted, err := DecryptPayload(key.K, encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, "secret", string(decrypted))
+
+	_, err = DecryptPayload(key.U, encrypted)
+	assert.Error(t, err, "U alone does not decrypt the payload")
+}
+
+func unzipPayload(t *testing.T, data []byte) map[string]string {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+	files := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		require.NoError(t, err)
+		var buf bytes.Buffer
+		_, err = buf.ReadFrom(rc)
+		require.NoError(t, err)
+		require.NoError(t, rc.Close())
+		files[f.Name] = buf.String()
+	}
+	return files
+}
+
+func TestBuildPayload(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "payload", "certs"), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "payload", "key.pem"), []byte("key"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "payload", "certs", "ca.pem"), []byte("ca"), 0600))
+	script := filepath.Join(dir, "install.sh")
+	require.NoError(t, os.WriteFile(script, []byte("#!/bin/sh\n"), 0600))
+
+	t.Run("single file is sent as is", func(t *testing.T) {
+		data, err := BuildPayload(filepath.Join(dir, "payload", "key.pem"), "", 1024)
+		require.NoError(t, err)
+		assert.Equal(t, "key", string(data))
+	})
+
+	t.Run("directory is zipped", func(t *testing.T) {
+		data, err := BuildPayload(filepath.Join(dir, "payload"), "", 1024)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"key.pem": "key", "certs/ca.pem": "ca"}, unzipPayload(t, data))
+	})
+
+	t.Run("script becomes autorun.sh", func(t *testing.T) {
+		data, err := BuildPayload(filepath.Join(dir, "payload", "key.pem"), script, 1024)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"key.pem": "key", "autorun.sh": "#!/bin/sh\n"}, unzipPayload(t, data))
+	})
+
+	t.Run("script conflicts with autorun.sh", func(t *testing.T) {
+		withAutorun := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(withAutorun, PayloadScriptName), []byte("x"), 0600))
+		_, err := BuildPayload(withAutorun, script, 1024)
+		assert.ErrorContains(t, err, "already contains autorun.sh")
+	})
+
+	t.Run("too large", func(t *testing.T) {
+		_, err := BuildPayload(filepath.Join(dir, "payload"), "", 4)
+		assert.ErrorContains(t, err, "too large")
+		_, err = BuildPayload(filepath.Join(dir, "payload", "key.pem"), "", 2)
+		assert.ErrorContains(t, err, "too large")
+	})
+}
+
+func TestDeliverKey(t *testing.T) {
+	ctx := context.Background()
+	f := newIdentityFixture(t, tpm.AlgRSA)
+	identity, err := f.svc.VerifyAgentIdentity(ctx, enrolledUUID, "", 0)
+	require.NoError(t, err)
+	key, err := NewBootstrapKey()
+	require.NoError(t, err)
+	encrypted, err := EncryptPayload(key.K, []byte("secret"))
+	require.NoError(t, err)
+
+	t.Run("agent receives U", func(t *testing.T) {
+		require.NoError(t, f.svc.DeliverKey(ctx, identity, enrolledUUID, key, encrypted))
+		delivery := f.agent.Delivery()
+		require.NotNil(t, delivery)
+		assert.Equal(t, key.U, delivery.U)
+		assert.Equal(t, key.AuthTag(enrolledUUID), delivery.AuthTag)
+		assert.Equal(t, encrypted, delivery.Payload)
+	})
+
+	t.Run("requires a verified agent", func(t *testing.T) {
+		err := f.svc.DeliverKey(ctx, &IdentityVerification{}, enrolledUUID, key, encrypted)
+		assert.ErrorContains(t, err, "verified agent identity")
+	})
+}
@@ -0,0 +1,276 @@
+package keylime
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des" // #nosec G502 -- DES-EDE3 is needed to read keys encrypted by older OpenSSL defaults
+	"crypto/pbkdf2"
+	"crypto/sha1" // #nosec G505 -- hmacWithSHA1 is the PKCS#5 default PRF, used only for key derivation
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// errWrongPassphrase hides the cause of a failed decryption, which is almost always a wrong passphrase.
+var errWrongPassphrase = errors.New("decryption failed, wrong passphrase or corrupt key")
+
+// keyPassphrase locates the passphrase of an encrypted client key. Sources are tried in
+// order: file, environment variable, systemd credential. The passphrase is read only when
+// the key turns out to be encrypted and is never included in errors.
+type keyPassphrase struct {
+	file       string
+	env        string
+	credential string
+}
+
+func newKeyPassphrase(config *Config) keyPassphrase {
+	return keyPassphrase{
+		file:       config.KeyPassphraseFile,
+		env:        config.KeyPassphraseEnv,
+		credential: config.KeyPassphraseCredential,
+	}
+}
+
+func (p keyPassphrase) read() ([]byte, error) {
+	if p.file != "" {
+		data, err := os.ReadFile(p.file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read passphrase file %s: %w", p.file, err)
+		}
+		return trimNewline(data), nil
+	}
+	if p.env != "" {
+		if value, ok := os.LookupEnv(p.env); ok && value != "" {
+			return []byte(value), nil
+		}
+	}
+	if p.credential != "" {
+		dir := os.Getenv("CREDENTIALS_DIRECTORY")
+		if dir == "" {
+			return nil, fmt.Errorf("systemd credential %q configured but $CREDENTIALS_DIRECTORY is not set", p.credential)
+		}
+		data, err := os.ReadFile(filepath.Join(dir, filepath.Base(p.credential)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read systemd credential %q: %w", p.credential, err)
+		}
+		return trimNewline(data), nil
+	}
+	return nil, errors.New("key is encrypted but no passphrase is configured (set a passphrase file, environment variable or systemd credential)")
+}
+
+func trimNewline(data []byte) []byte {
+	return bytes.TrimRight(data, "\r\n")
+}
+
+// loadClientKeyPair loads the client certificate and its private key, decrypting
+// encrypted PKCS#8 and legacy OpenSSL PEM keys with the configured passphrase.
+func loadClientKeyPair(certPath, keyPath string, passphrase keyPassphrase) (tls.Certificate, error) {
+	certPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	keyPEM, err = decryptKeyPEM(keyPEM, passphrase)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("private key %s: %w", keyPath, err)
+	}
+	return tls.X509KeyPair(certPEM, keyPEM)
+}
+
+// decryptKeyPEM returns keyPEM unchanged unless it holds an encrypted private key,
+// in which case the decrypted key is returned PEM-encoded.
+func decryptKeyPEM(keyPEM []byte, passphrase keyPassphrase) ([]byte, error) {
+	rest := keyPEM
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			return keyPEM, nil
+		}
+		switch {
+		case block.Type == "ENCRYPTED PRIVATE KEY":
+			pass, err := passphrase.read()
+			if err != nil {
+				return nil, err
+			}
+			der, err := decryptPKCS8(block.Bytes, pass)
+			if err != nil {
+				return nil, err
+			}
+			return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+		case strings.HasSuffix(block.Type, "PRIVATE KEY") && x509.IsEncryptedPEMBlock(block): //nolint:staticcheck // legacy format is insecure but still produced by openssl -des3/-aes256
+			pass, err := passphrase.read()
+			if err != nil {
+				return nil, err
+			}
+			der, err := x509.DecryptPEMBlock(block, pass) //nolint:staticcheck // see above
+			if err != nil || !parsesAsPrivateKey(der) {
+				return nil, errWrongPassphrase
+			}
+			return pem.EncodeToMemory(&pem.Block{Type: block.Type, Bytes: der}), nil
+		case strings.HasSuffix(block.Type, "PRIVATE KEY"):
+			return keyPEM, nil
+		}
+	}
+}
+
+var (
+	oidPBES2          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHMACWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidHMACWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 10}
+	oidHMACWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 11}
+	oidAES128CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+	oidDESEDE3CBC     = asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 7}
+)
+
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// decryptPKCS8 decrypts a PKCS#8 EncryptedPrivateKeyInfo protected with PBES2
+// (PBKDF2 and AES-CBC or 3DES-CBC), the format written by "openssl pkcs8 -topk8".
+func decryptPKCS8(der, passphrase []byte) ([]byte, error) {
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, fmt.Errorf("invalid encrypted PKCS#8 structure: %w", err)
+	}
+	if !info.Algorithm.Algorithm.Equal(oidPBES2) {
+		return nil, fmt.Errorf("unsupported key encryption %s (only PBES2 is supported)", info.Algorithm.Algorithm)
+	}
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, fmt.Errorf("invalid PBES2 parameters: %w", err)
+	}
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, fmt.Errorf("unsupported key derivation %s (only PBKDF2 is supported)", params.KeyDerivationFunc.Algorithm)
+	}
+	var kdf pbkdf2Params
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdf); err != nil {
+		return nil, fmt.Errorf("invalid PBKDF2 parameters: %w", err)
+	}
+
+	newCipher, keyLen, err := pbes2Cipher(params.EncryptionScheme.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	prf, err := pbkdf2PRF(kdf.PRF.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, fmt.Errorf("invalid cipher IV: %w", err)
+	}
+
+	key, err := pbkdf2.Key(prf, string(passphrase), kdf.Salt, kdf.IterationCount, keyLen)
+	if err != nil {
+		return nil, fmt.Errorf("key derivation failed: %w", err)
+	}
+	block, err := newCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != block.BlockSize() || len(info.EncryptedData)%block.BlockSize() != 0 {
+		return nil, errors.New("invalid encrypted key length")
+	}
+	plain := make([]byte, len(info.EncryptedData))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, info.EncryptedData)
+
+	plain, ok := unpad(plain, block.BlockSize())
+	if !ok {
+		return nil, errWrongPassphrase
+	}
+	if _, err := x509.ParsePKCS8PrivateKey(plain); err != nil {
+		return nil, errWrongPassphrase
+	}
+	return plain, nil
+}
+
+func pbes2Cipher(oid asn1.ObjectIdentifier) (func([]byte) (cipher.Block, error), int, error) {
+	switch {
+	case oid.Equal(oidAES128CBC):
+		return aes.NewCipher, 16, nil
+	case oid.Equal(oidAES192CBC):
+		return aes.NewCipher, 24, nil
+	case oid.Equal(oidAES256CBC):
+		return aes.NewCipher, 32, nil
+	case oid.Equal(oidDESEDE3CBC):
+		return des.NewTripleDESCipher, 24, nil
+	}
+	return nil, 0, fmt.Errorf("unsupported key cipher %s", oid)
+}
+
+func pbkdf2PRF(oid asn1.ObjectIdentifier) (func() hash.Hash, error) {
+	switch {
+	case len(oid) == 0 || oid.Equal(oidHMACWithSHA1):
+		return sha1.New, nil
+	case oid.Equal(oidHMACWithSHA256):
+		return sha256.New, nil
+	case oid.Equal(oidHMACWithSHA384):
+		return sha512.New384, nil
+	case oid.Equal(oidHMACWithSHA512):
+		return sha512.New, nil
+	}
+	return nil, fmt.Errorf("unsupported PBKDF2 PRF %s", oid)
+}
+
+// parsesAsPrivateKey reports whether der is a PKCS#1, SEC 1 or PKCS#8 private key. The
+// legacy PEM format has no integrity check, so a wrong passphrase can yield valid padding.
+func parsesAsPrivateKey(der []byte) bool {
+	if _, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return true
+	}
+	if _, err := x509.ParseECPrivateKey(der); err == nil {
+		return true
+	}
+	_, err := x509.ParsePKCS8PrivateKey(der)
+	return err == nil
+}
+
+// unpad strips PKCS#7 padding, reporting false when it is malformed.
+func unpad(data []byte, blockSize int) ([]byte, bool) {
+	if len(data) == 0 {
+		return nil, false
+	}
+	n := int(data[len(data)-1])
+	if n == 0 || n > blockSize || n > len(data) {
+		return nil, false
+	}
+	for _, b := range data[len(data)-n:] {
+		if int(b) != n {
+			return nil, false
+		}
+	}
+	return data[:len(data)-n], true
+}
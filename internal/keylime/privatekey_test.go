@@ -0,0 +1,127 @@
+package keylime
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testPassphrase = "keylime-test"
+
+func testdataPath(name string) string {
+	return filepath.Join("testdata", name)
+}
+
+func writePassphrase(t *testing.T, value string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "passphrase")
+	require.NoError(t, os.WriteFile(path, []byte(value+"\n"), 0600))
+	return path
+}
+
+// encryptLegacy encrypts keyPEM the way "openssl ec -aes256" does.
+func encryptLegacy(t *testing.T, keyPEM []byte, passphrase string) []byte {
+	t.Helper()
+	block, _ := pem.Decode(keyPEM)
+	require.NotNil(t, block)
+	encrypted, err := x509.EncryptPEMBlock(rand.Reader, block.Type, block.Bytes, []byte(passphrase), x509.PEMCipherAES256) //nolint:staticcheck // legacy format under test
+	require.NoError(t, err)
+	return pem.EncodeToMemory(encrypted)
+}
+
+func TestLoadClientKeyPair(t *testing.T) {
+	cert := testdataPath("client-encrypted.crt")
+
+	for _, name := range []string{"client-encrypted-aes256.pem", "client-encrypted-des3.pem", "client-encrypted-legacy.pem"} {
+		t.Run("decrypts "+name, func(t *testing.T) {
+			pair, err := loadClientKeyPair(cert, testdataPath(name), keyPassphrase{file: writePassphrase(t, testPassphrase)})
+			require.NoError(t, err)
+			assert.Equal(t, "encrypted-client", pair.Leaf.Subject.CommonName)
+		})
+	}
+
+	t.Run("wrong passphrase names the key but not the secret", func(t *testing.T) {
+		for _, name := range []string{"client-encrypted-aes256.pem", "client-encrypted-legacy.pem"} {
+			secret := "not-the-passphrase"
+			_, err := loadClientKeyPair(cert, testdataPath(name), keyPassphrase{file: writePassphrase(t, secret)})
+			require.Error(t, err)
+			assert.ErrorIs(t, err, errWrongPassphrase)
+			assert.Contains(t, err.Error(), testdataPath(name))
+			assert.NotContains(t, err.Error(), secret)
+		}
+	})
+
+	t.Run("encrypted key without passphrase", func(t *testing.T) {
+		t.Setenv("KEYLIME_CLIENT_KEY_PASSPHRASE", "")
+		_, err := loadClientKeyPair(cert, testdataPath("client-encrypted-aes256.pem"), keyPassphrase{env: "KEYLIME_CLIENT_KEY_PASSPHRASE"})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "no passphrase is configured")
+	})
+
+	t.Run("plain key needs no passphrase", func(t *testing.T) {
+		pki := newTestPKI(t, "client-1")
+		config := pki.writeFiles(t, t.TempDir())
+		_, err := loadClientKeyPair(config.ClientCert, config.ClientKey, keyPassphrase{file: "/nonexistent"})
+		assert.NoError(t, err, "passphrase is only read for encrypted keys")
+	})
+}
+
+func TestKeyPassphraseSources(t *testing.T) {
+	t.Run("file takes precedence", func(t *testing.T) {
+		t.Setenv("TEST_KEY_PASSPHRASE", "from-env")
+		pass, err := keyPassphrase{file: writePassphrase(t, "from-file"), env: "TEST_KEY_PASSPHRASE"}.read()
+		require.NoError(t, err)
+		assert.Equal(t, "from-file", string(pass))
+	})
+
+	t.Run("environment variable", func(t *testing.T) {
+		t.Setenv("TEST_KEY_PASSPHRASE", "from-env")
+		pass, err := keyPassphrase{env: "TEST_KEY_PASSPHRASE", credential: "keylime-key"}.read()
+		require.NoError(t, err)
+		assert.Equal(t, "from-env", string(pass))
+	})
+
+	t.Run("systemd credential", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "keylime-key"), []byte("from-credential\n"), 0600))
+		t.Setenv("CREDENTIALS_DIRECTORY", dir)
+		t.Setenv("TEST_KEY_PASSPHRASE", "")
+		pass, err := keyPassphrase{env: "TEST_KEY_PASSPHRASE", credential: "keylime-key"}.read()
+		require.NoError(t, err)
+		assert.Equal(t, "from-credential", string(pass))
+	})
+
+	t.Run("credential without credentials directory", func(t *testing.T) {
+		t.Setenv("CREDENTIALS_DIRECTORY", "")
+		_, err := keyPassphrase{credential: "keylime-key"}.read()
+		assert.ErrorContains(t, err, "$CREDENTIALS_DIRECTORY is not set")
+	})
+
+	t.Run("missing passphrase file", func(t *testing.T) {
+		_, err := keyPassphrase{file: filepath.Join(t.TempDir(), "missing")}.read()
+		assert.ErrorContains(t, err, "failed to read passphrase file")
+	})
+}
+
+func TestEncryptedClientKeyMTLS(t *testing.T) {
+	pki := newTestPKI(t, "client-1")
+	ts := newMTLSServer(t, pki.server, clientCNHandler, pki)
+	config := pki.writeFiles(t, t.TempDir())
+	require.NoError(t, os.WriteFile(config.ClientKey, encryptLegacy(t, pki.keyPEM, testPassphrase), 0600))
+
+	_, err := newClient(ts.URL, config)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), config.ClientKey)
+
+	t.Setenv("TEST_KEY_PASSPHRASE", testPassphrase)
+	config.KeyPassphraseEnv = "TEST_KEY_PASSPHRASE"
+	client, err := newClient(ts.URL, config)
+	require.NoError(t, err)
+	assert.Equal(t, "client-1", getBody(t, client))
+}
@@ -0,0 +1,80 @@
+package keylime
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"time"
+)
+
+// retryPolicy controls how often and how long a Client waits between attempts.
+// MaxRetries of zero disables retrying.
+type retryPolicy struct {
+	maxRetries int
+	baseDelay  time.Duration
+	maxDelay   time.Duration
+}
+
+// shouldRetry decides whether a failed attempt is worth repeating. Idempotent
+// requests (GET, DELETE) are retried on any transport error and on transient
+// HTTP statuses; POST and PUT only when the connection could not be established,
+// because then the request never reached the server.
+func (p retryPolicy) shouldRetry(ctx context.Context, method string, resp *http.Response, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	idempotent := method == http.MethodGet || method == http.MethodDelete
+	if err != nil {
+		return idempotent || isConnectError(err)
+	}
+	if !idempotent {
+		return false
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// backoff returns the delay before retry number attempt (starting at 0): exponential
+// growth capped at maxDelay, with jitter so clients recovering together spread out.
+func (p retryPolicy) backoff(attempt int) time.Duration {
+	delay := p.baseDelay << attempt
+	if delay <= 0 || delay > p.maxDelay {
+		delay = p.maxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	half := delay / 2
+	return half + rand.N(half+1) // #nosec G404 -- jitter does not need a cryptographic source
+}
+
+// isConnectError reports whether err happened while dialing, before any bytes were sent.
+func isConnectError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// isBreakerFailure reports whether an attempt counts against the endpoint's health.
+// Client errors (4xx) mean the endpoint is up and answering.
+func isBreakerFailure(resp *http.Response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, context.Canceled)
+	}
+	return resp.StatusCode >= 500
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
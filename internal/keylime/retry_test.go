@@ -0,0 +1,161 @@
+package keylime
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRetryTestClient(t *testing.T, handler http.Handler, config Config) *Client {
+	t.Helper()
+	ts := httptest.NewServer(handler)
+	t.Cleanup(ts.Close)
+
+	config.APIVersion = testAPIVersion
+	client, err := newClient(ts.URL, &config)
+	require.NoError(t, err)
+	return client
+}
+
+func TestClientRetry(t *testing.T) {
+	retries := Config{MaxRetries: 3, RetryBaseDelay: time.Millisecond, RetryMaxDelay: time.Millisecond}
+
+	t.Run("GET retried on 503 until success", func(t *testing.T) {
+		var calls atomic.Int32
+		client := newRetryTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}), retries)
+
+		resp, err := client.Get(context.Background(), "agents/")
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, int32(3), calls.Load())
+	})
+
+	t.Run("GET gives up after max retries", func(t *testing.T) {
+		var calls atomic.Int32
+		client := newRetryTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			w.WriteHeader(http.StatusBadGateway)
+		}), retries)
+
+		resp, err := client.Get(context.Background(), "agents/")
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+		assert.Equal(t, int32(4), calls.Load())
+	})
+
+	t.Run("4xx not retried", func(t *testing.T) {
+		var calls atomic.Int32
+		client := newRetryTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			w.WriteHeader(http.StatusNotFound)
+		}), retries)
+
+		resp, err := client.Get(context.Background(), "agents/x")
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		assert.Equal(t, int32(1), calls.Load())
+	})
+
+	t.Run("POST not retried on 503", func(t *testing.T) {
+		var calls atomic.Int32
+		client := newRetryTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}), retries)
+
+		resp, err := client.Post(context.Background(), "agents/x", map[string]string{"a": "b"})
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		assert.Equal(t, int32(1), calls.Load())
+	})
+
+	t.Run("body replayed on every attempt", func(t *testing.T) {
+		var bodies []int64
+		client := newRetryTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			bodies = append(bodies, r.ContentLength)
+			if len(bodies) == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}), retries)
+
+		resp, err := client.doRequestWithBody(context.Background(), http.MethodDelete, "agents/x", map[string]string{"a": "b"})
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		require.Len(t, bodies, 2)
+		assert.Equal(t, bodies[0], bodies[1])
+		assert.Positive(t, bodies[1])
+	})
+
+	t.Run("no retries by default", func(t *testing.T) {
+		var calls atomic.Int32
+		client := newRetryTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}), Config{})
+
+		resp, err := client.Get(context.Background(), "agents/")
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		assert.Equal(t, int32(1), calls.Load())
+	})
+
+	t.Run("cancelled context stops retrying", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		var calls atomic.Int32
+		client := newRetryTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			cancel()
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}), Config{MaxRetries: 3, RetryBaseDelay: time.Hour, RetryMaxDelay: time.Hour})
+
+		_, err := client.Get(ctx, "agents/")
+		assert.Error(t, err)
+		assert.Equal(t, int32(1), calls.Load())
+	})
+}
+
+func TestClientBreaker(t *testing.T) {
+	var calls atomic.Int32
+	client := newRetryTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}), Config{BreakerThreshold: 2, BreakerCooldown: time.Hour})
+
+	for range 2 {
+		resp, err := client.Get(context.Background(), "agents/")
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+	}
+	assert.Equal(t, BreakerOpen, client.BreakerStatus().State)
+
+	_, err := client.Get(context.Background(), "agents/")
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Equal(t, int32(2), calls.Load(), "open breaker must not contact the endpoint")
+}
+
+func TestBackoff(t *testing.T) {
+	p := retryPolicy{baseDelay: 100 * time.Millisecond, maxDelay: time.Second}
+	for attempt, limit := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		limit *= time.Millisecond
+		d := p.backoff(attempt)
+		assert.GreaterOrEqual(t, d, limit/2, "attempt %d", attempt)
+		assert.LessOrEqual(t, d, limit, "attempt %d", attempt)
+	}
+	assert.Equal(t, time.Duration(0), retryPolicy{}.backoff(0))
+}
@@ -1,10 +1,23 @@
 package keylime
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -31,3 +44,102 @@ func newTestService(t *testing.T, handler http.Handler) *Service {
 	require.NoError(t, err)
 	return svc
 }
+
+// testPKI is a throwaway CA with server and client certificates for mTLS tests.
+type testPKI struct {
+	caCert    *x509.Certificate
+	caKey     *ecdsa.PrivateKey
+	caPEM     []byte
+	server    tls.Certificate
+	clientPEM []byte
+	keyPEM    []byte
+	clientCN  string
+}
+
+func newTestPKI(t *testing.T, clientCN string) *testPKI {
+	t.Helper()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	caCert, err := x509.ParseCertificate(caDER)
+	require.NoError(t, err)
+
+	p := &testPKI{caCert: caCert, caKey: caKey, clientCN: clientCN}
+	p.caPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER})
+
+	serverCertPEM, serverKeyPEM := p.issue(t, "localhost", x509.ExtKeyUsageServerAuth)
+	p.server, err = tls.X509KeyPair(serverCertPEM, serverKeyPEM)
+	require.NoError(t, err)
+	p.clientPEM, p.keyPEM = p.issue(t, clientCN, x509.ExtKeyUsageClientAuth)
+	return p
+}
+
+func (p *testPKI) issue(t *testing.T, cn string, usage x509.ExtKeyUsage) ([]byte, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     []string{cn},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, p.caCert, &key.PublicKey, p.caKey)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+}
+
+// writeFiles stores the client credentials in dir under the standard Keylime file names.
+func (p *testPKI) writeFiles(t *testing.T, dir string) *Config {
+	t.Helper()
+	config := &Config{
+		TLSEnabled:    true,
+		TLSServerName: "localhost",
+		ClientCert:    filepath.Join(dir, "client-cert.crt"),
+		ClientKey:     filepath.Join(dir, "client-private.pem"),
+		CAPath:        filepath.Join(dir, "cacert.crt"),
+		APIVersion:    testAPIVersion,
+	}
+	require.NoError(t, os.WriteFile(config.ClientCert, p.clientPEM, 0600))
+	require.NoError(t, os.WriteFile(config.ClientKey, p.keyPEM, 0600))
+	require.NoError(t, os.WriteFile(config.CAPath, p.caPEM, 0600))
+	return config
+}
+
+// newMTLSServer starts a server that requires client certificates signed by one of the CAs.
+func newMTLSServer(t *testing.T, server tls.Certificate, handler http.Handler, cas ...*testPKI) *httptest.Server {
+	t.Helper()
+	pool := x509.NewCertPool()
+	for _, ca := range cas {
+		pool.AddCert(ca.caCert)
+	}
+	ts := httptest.NewUnstartedServer(handler)
+	ts.Config.ErrorLog = log.New(io.Discard, "", 0) // handshake failures are expected in some tests
+	ts.TLS = &tls.Config{
+		Certificates: []tls.Certificate{server},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+	ts.StartTLS()
+	t.Cleanup(ts.Close)
+	return ts
+}
@@ -0,0 +1,189 @@
+package keylime
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// tlsCredentials holds the mTLS client certificate and CA bundle of a Client and
+// re-reads them when the files change, so certificate rotation needs no restart.
+type tlsCredentials struct {
+	certPath   string
+	keyPath    string
+	caPath     string
+	serverName string
+	passphrase keyPassphrase
+	interval   time.Duration // minimum time between file checks; zero disables reloading
+	now        func() time.Time
+
+	mu         sync.Mutex
+	cert       *tls.Certificate
+	roots      *x509.CertPool
+	stamps     [3]fileStamp
+	transport  *http.Transport
+	lastCheck  time.Time
+	lastReload time.Time
+	lastErr    error
+	lastErrAt  time.Time
+}
+
+// fileStamp identifies one version of a file on disk.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+func newTLSCredentials(config *Config) (*tlsCredentials, error) {
+	c := &tlsCredentials{
+		certPath:   config.ClientCert,
+		keyPath:    config.ClientKey,
+		caPath:     config.CAPath,
+		serverName: config.TLSServerName,
+		passphrase: newKeyPassphrase(config),
+		interval:   config.TLSReloadInterval,
+		now:        time.Now,
+	}
+	stamps, _ := c.statFiles()
+	cert, roots, err := c.load()
+	if err != nil {
+		return nil, err
+	}
+	c.install(cert, roots, stamps)
+	return c, nil
+}
+
+// load reads the client key pair and CA bundle from disk.
+func (c *tlsCredentials) load() (*tls.Certificate, *x509.CertPool, error) {
+	cert, err := loadClientKeyPair(c.certPath, c.keyPath, c.passphrase)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load client certificate (%s, %s): %w", c.certPath, c.keyPath, err)
+	}
+
+	caCertPEM, err := os.ReadFile(c.caPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load CA certificate (%s): %w", c.caPath, err)
+	}
+
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(caCertPEM) {
+		return nil, nil, fmt.Errorf("failed to parse CA certificate from %s", c.caPath)
+	}
+	return &cert, roots, nil
+}
+
+// install swaps in new credentials and a fresh transport; idle connections of the
+// previous transport are closed so new handshakes use the new material.
+func (c *tlsCredentials) install(cert *tls.Certificate, roots *x509.CertPool, stamps [3]fileStamp) {
+	tlsConfig := &tls.Config{
+		RootCAs:              roots,
+		GetClientCertificate: c.getClientCertificate,
+		ServerName:           c.serverName,
+	}
+	c.mu.Lock()
+	old := c.transport
+	c.cert, c.roots, c.stamps = cert, roots, stamps
+	c.transport = &http.Transport{TLSClientConfig: tlsConfig}
+	c.lastReload = c.now()
+	c.lastErr = nil
+	c.mu.Unlock()
+	if old != nil {
+		old.CloseIdleConnections()
+	}
+}
+
+func (c *tlsCredentials) getClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.cert, nil
+}
+
+func (c *tlsCredentials) statFiles() ([3]fileStamp, error) {
+	var stamps [3]fileStamp
+	for i, path := range []string{c.certPath, c.keyPath, c.caPath} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return stamps, err
+		}
+		stamps[i] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+	}
+	return stamps, nil
+}
+
+// refresh reloads the credentials if any file changed since the last load. Unless force
+// is set, the files are checked at most once per interval. A failed reload keeps the
+// previous credentials and is reported by status.
+func (c *tlsCredentials) refresh(force bool) {
+	if c.interval <= 0 {
+		return
+	}
+	c.mu.Lock()
+	now := c.now()
+	if !force && now.Sub(c.lastCheck) < c.interval {
+		c.mu.Unlock()
+		return
+	}
+	c.lastCheck = now
+	current := c.stamps
+	c.mu.Unlock()
+
+	stamps, err := c.statFiles()
+	if err == nil && stamps == current {
+		return
+	}
+	if err == nil {
+		var cert *tls.Certificate
+		var roots *x509.CertPool
+		if cert, roots, err = c.load(); err == nil {
+			c.install(cert, roots, stamps)
+			return
+		}
+	}
+	c.mu.Lock()
+	c.lastErr = err
+	c.lastErrAt = now
+	c.mu.Unlock()
+}
+
+// RoundTrip sends the request through the transport built from the current credentials.
+func (c *tlsCredentials) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.refresh(false)
+	c.mu.Lock()
+	transport := c.transport
+	c.mu.Unlock()
+
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		// a rotated certificate may be the cause; look at the files before the next attempt
+		c.refresh(true)
+	}
+	return resp, err
+}
+
+func (c *tlsCredentials) status() *TLSStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	status := &TLSStatus{ClientCert: c.certPath, CACert: c.caPath}
+	if c.interval > 0 {
+		status.ReloadInterval = c.interval.String()
+	}
+	if !c.lastReload.IsZero() {
+		loaded := c.lastReload.UTC()
+		status.LoadedAt = &loaded
+	}
+	if c.cert != nil && c.cert.Leaf != nil {
+		notAfter := c.cert.Leaf.NotAfter.UTC()
+		status.CertNotAfter = &notAfter
+	}
+	if c.lastErr != nil {
+		failedAt := c.lastErrAt.UTC()
+		status.ReloadError = c.lastErr.Error()
+		status.ReloadFailedAt = &failedAt
+	}
+	return status
+}
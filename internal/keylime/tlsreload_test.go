@@ -0,0 +1,116 @@
+package keylime
+
+import (
+	"context"
+	"crypto/x509"
+	"io"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// clientCNHandler answers with the common name of the client certificate.
+var clientCNHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+})
+
+// replaceFile writes data and bumps the modification time so the change is seen
+// even on filesystems with coarse timestamps.
+func replaceFile(t *testing.T, path string, data []byte, stamp time.Time) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, data, 0600))
+	require.NoError(t, os.Chtimes(path, stamp, stamp))
+}
+
+func getBody(t *testing.T, client *Client) string {
+	t.Helper()
+	resp, err := client.GetRaw(context.Background(), "version")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return string(body)
+}
+
+func newReloadingClient(t *testing.T, url string, config *Config) (*Client, *time.Time) {
+	t.Helper()
+	config.TLSReloadInterval = time.Minute
+	client, err := newClient(url, config)
+	require.NoError(t, err)
+	now := time.Now()
+	client.tls.now = func() time.Time { return now }
+	return client, &now
+}
+
+func TestTLSReload(t *testing.T) {
+	t.Run("rotated client certificate picked up", func(t *testing.T) {
+		pki := newTestPKI(t, "client-1")
+		ts := newMTLSServer(t, pki.server, clientCNHandler, pki)
+		config := pki.writeFiles(t, t.TempDir())
+		client, now := newReloadingClient(t, ts.URL, config)
+
+		assert.Equal(t, "client-1", getBody(t, client))
+
+		certPEM, keyPEM := pki.issue(t, "client-2", x509.ExtKeyUsageClientAuth)
+		stamp := time.Now().Add(time.Hour)
+		replaceFile(t, config.ClientCert, certPEM, stamp)
+		replaceFile(t, config.ClientKey, keyPEM, stamp)
+		assert.Equal(t, "client-1", getBody(t, client), "files are not checked before the interval passes")
+
+		*now = now.Add(2 * time.Minute)
+		assert.Equal(t, "client-2", getBody(t, client))
+		status := client.TLSStatus()
+		assert.Empty(t, status.ReloadError)
+		assert.NotNil(t, status.CertNotAfter)
+	})
+
+	t.Run("rotated CA bundle picked up after handshake failure", func(t *testing.T) {
+		oldCA := newTestPKI(t, "client-1")
+		newCA := newTestPKI(t, "client-1")
+		ts := newMTLSServer(t, newCA.server, clientCNHandler, oldCA, newCA)
+		config := oldCA.writeFiles(t, t.TempDir())
+		client, _ := newReloadingClient(t, ts.URL, config)
+
+		_, err := client.GetRaw(context.Background(), "version")
+		require.Error(t, err, "server certificate is signed by a CA the client does not trust yet")
+
+		bundle := append(append([]byte{}, oldCA.caPEM...), newCA.caPEM...)
+		replaceFile(t, config.CAPath, bundle, time.Now().Add(time.Hour))
+
+		_, err = client.GetRaw(context.Background(), "version")
+		assert.Error(t, err, "reload interval has not passed yet")
+		assert.Equal(t, "client-1", getBody(t, client), "the handshake failure forced a check of the files")
+	})
+
+	t.Run("failed reload keeps previous credentials and is reported", func(t *testing.T) {
+		pki := newTestPKI(t, "client-1")
+		ts := newMTLSServer(t, pki.server, clientCNHandler, pki)
+		config := pki.writeFiles(t, t.TempDir())
+		client, now := newReloadingClient(t, ts.URL, config)
+		assert.Equal(t, "client-1", getBody(t, client))
+
+		replaceFile(t, config.ClientKey, []byte("not a key"), time.Now().Add(time.Hour))
+		*now = now.Add(2 * time.Minute)
+
+		assert.Equal(t, "client-1", getBody(t, client))
+		status := client.TLSStatus()
+		assert.Contains(t, status.ReloadError, "failed to load client certificate")
+		assert.NotNil(t, status.ReloadFailedAt)
+	})
+
+	t.Run("reloading disabled by zero interval", func(t *testing.T) {
+		pki := newTestPKI(t, "client-1")
+		config := pki.writeFiles(t, t.TempDir())
+		client, err := newClient("localhost:8881", config)
+		require.NoError(t, err)
+
+		require.NoError(t, os.Remove(config.ClientKey))
+		client.tls.refresh(true)
+		assert.Empty(t, client.TLSStatus().ReloadError)
+		assert.Empty(t, client.TLSStatus().ReloadInterval)
+	})
+}
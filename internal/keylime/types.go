@@ -1,6 +1,10 @@
 package keylime
 
-import "net/http"
+import (
+	"net/http"
+	"sync"
+	"time"
+)
 
 // Agent operational states
 const (
@@ -45,21 +49,72 @@ type Config struct {
 	TLSEnabled    bool
 	TLSServerName string
 
-	APIVersion     string
-	ClientCert     string
-	ClientKey      string // #nosec G117 -- field name for cert key path, value is not hardcoded
-	CAPath         string
-	Port           string
-	MaskingEnabled bool
+	APIVersion string
+	ClientCert string
+	ClientKey  string // #nosec G117 -- field name for cert key path, value is not hardcoded
+	CAPath     string
+
+	// Passphrase sources for an encrypted ClientKey, tried in this order
+	KeyPassphraseFile       string // file holding the passphrase
+	KeyPassphraseEnv        string // name of an environment variable holding the passphrase
+	KeyPassphraseCredential string // systemd credential name, read from $CREDENTIALS_DIRECTORY
+	Port                    string
+	MaskingEnabled          bool
+
+	// Resilience settings. Zero values keep the plain single-attempt behavior.
+	RequestTimeout   time.Duration
+	MaxRetries       int
+	RetryBaseDelay   time.Duration
+	RetryMaxDelay    time.Duration
+	BreakerThreshold int // consecutive failures that open the circuit breaker
+	BreakerCooldown  time.Duration
+
+	TLSReloadInterval time.Duration // how often certificate files are checked for changes; zero disables reloading
+
+	Cassette *Cassette // records or replays all traffic; nil talks to Keylime directly
+
+	TPMCertStore        string // directory of TPM manufacturer CA certificates that EK certificates must chain to
+	VerifyAgentIdentity bool   // verify the EK certificate and an identity quote before every enrollment
+
+	AttestationMode string // AttestationModePull, AttestationModePush, or per-agent detection when empty or AttestationModeAuto
 }
 
 type Client struct {
 	baseURL    string
-	APIVersion string
 	httpClient *http.Client
+	retry      retryPolicy
+	breaker    *breaker
+	tls        *tlsCredentials
+
+	pinnedVersion string // configured API version; empty means negotiate
+	negotiateMu   sync.Mutex
+	versionMu     sync.Mutex
+	apiVersion    string
+	negotiated    bool
+	versionErr    error
+}
+
+// TLSStatus describes the mTLS credentials of one Keylime endpoint
+type TLSStatus struct {
+	ClientCert     string     `json:"client_cert"`
+	CACert         string     `json:"ca_cert"`
+	ReloadInterval string     `json:"reload_interval,omitempty"`
+	LoadedAt       *time.Time `json:"loaded_at,omitempty"`
+	CertNotAfter   *time.Time `json:"cert_not_after,omitempty"`
+	ReloadError    string     `json:"reload_error,omitempty"`
+	ReloadFailedAt *time.Time `json:"reload_failed_at,omitempty"`
 }
 
-type GetAllAgentsInput struct{}
+// BreakerStatus describes the circuit breaker of one Keylime endpoint
+type BreakerStatus struct {
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	OpenedAt            *time.Time `json:"opened_at,omitempty"`
+}
+
+type GetAllAgentsInput struct {
+	Cluster string `json:"cluster,omitempty" jsonschema:"Keylime cluster name; defaults to the primary cluster"`
+}
 
 type GetAllAgentsOutput struct {
 	Agents []string `json:"agents"`
@@ -74,46 +129,70 @@ type AgentListResponse struct {
 }
 
 type AgentStatusResponse struct {
-	Code    int    `json:"code"`
-	Status  string `json:"status"`
-	Results struct {
-		OperationalState          int      `json:"operational_state"`
-		V                         string   `json:"v"`
-		IP                        string   `json:"ip"`
-		Port                      int      `json:"port"`
-		TPMPolicy                 string   `json:"tpm_policy"`
-		VTPMPolicy                string   `json:"vtpm_policy"`
-		MetaData                  string   `json:"meta_data"`
-		HasMbRefstate             int      `json:"has_mb_refstate"`
-		HasRuntimePolicy          int      `json:"has_runtime_policy"`
-		AcceptTPMHashAlgs         []string `json:"accept_tpm_hash_algs"`
-		AcceptTPMEncryptionAlgs   []string `json:"accept_tpm_encryption_algs"`
-		AcceptTPMSigningAlgs      []string `json:"accept_tpm_signing_algs"`
-		HashAlg                   string   `json:"hash_alg"`
-		EncAlg                    string   `json:"enc_alg"`
-		SignAlg                   string   `json:"sign_alg"`
-		VerifierID                string   `json:"verifier_id"`
-		VerifierIP                string   `json:"verifier_ip"`
-		VerifierPort              int      `json:"verifier_port"`
-		SeverityLevel             *int     `json:"severity_level"`
-		LastEventID               *string  `json:"last_event_id"`
-		AttestationCount          int      `json:"attestation_count"`
-		LastReceivedQuote         *int     `json:"last_received_quote"`
-		LastSuccessfulAttestation *int     `json:"last_successful_attestation"`
-	} `json:"results"`
+	Code    int          `json:"code"`
+	Status  string       `json:"status"`
+	Results AgentDetails `json:"results"`
+}
+
+// AgentDetails is the verifier's view of one agent, as returned by agents/{uuid} and the bulk listing
+type AgentDetails struct {
+	OperationalState          int      `json:"operational_state"`
+	V                         string   `json:"v"`
+	IP                        string   `json:"ip"`
+	Port                      int      `json:"port"`
+	TPMPolicy                 string   `json:"tpm_policy"`
+	VTPMPolicy                string   `json:"vtpm_policy"`
+	MetaData                  string   `json:"meta_data"`
+	HasMbRefstate             int      `json:"has_mb_refstate"`
+	HasRuntimePolicy          int      `json:"has_runtime_policy"`
+	AcceptTPMHashAlgs         []string `json:"accept_tpm_hash_algs"`
+	AcceptTPMEncryptionAlgs   []string `json:"accept_tpm_encryption_algs"`
+	AcceptTPMSigningAlgs      []string `json:"accept_tpm_signing_algs"`
+	HashAlg                   string   `json:"hash_alg"`
+	EncAlg                    string   `json:"enc_alg"`
+	SignAlg                   string   `json:"sign_alg"`
+	VerifierID                string   `json:"verifier_id"`
+	VerifierIP                string   `json:"verifier_ip"`
+	VerifierPort              int      `json:"verifier_port"`
+	SeverityLevel             *int     `json:"severity_level"`
+	LastEventID               *string  `json:"last_event_id"`
+	AttestationCount          int      `json:"attestation_count"`
+	LastReceivedQuote         *int     `json:"last_received_quote"`
+	LastSuccessfulAttestation *int     `json:"last_successful_attestation"`
+	// AcceptAttestations is only kept by push-mode verifiers, for agents that push evidence.
+	AcceptAttestations *bool `json:"accept_attestations,omitempty"`
+	// IMASignVerificationKeys is only reported by some verifiers.
+	IMASignVerificationKeys string `json:"ima_sign_verification_keys,omitempty"`
+}
+
+type GetFailedAgentsInput struct {
+	VerifierID string `json:"verifier_id,omitempty" jsonschema:"Only include agents attested by this verifier ID"`
+	Cluster    string `json:"cluster,omitempty" jsonschema:"Keylime cluster name; leave empty to query all clusters"`
 }
 
-type GetFailedAgentsInput struct{}
-
 type GetFailedAgentsOutput struct {
-	FailedAgents []GetAgentStatusOutput `json:"failed_agents"`
+	FailedAgents     []GetAgentStatusOutput   `json:"failed_agents"`
+	FailedPushAgents []AgentAttestationStatus `json:"failed_push_agents,omitempty"` // from push-mode clusters
+	ScannedAgents    int                      `json:"scanned_agents"`
+	SkippedAgents    []AgentIssue             `json:"skipped_agents,omitempty"`
+	ErroredAgents    []AgentIssue             `json:"errored_agents,omitempty"`
+	ClusterErrors    map[string]string        `json:"cluster_errors,omitempty"`
+}
+
+// AgentIssue names an agent whose status could not be determined during a fleet-wide query
+type AgentIssue struct {
+	Cluster   string `json:"cluster,omitempty"`
+	AgentUUID string `json:"agent_uuid"`
+	Reason    string `json:"reason"`
 }
 
 type GetAgentStatusInput struct {
 	AgentUUID string `json:"agent_uuid"`
+	Cluster   string `json:"cluster,omitempty" jsonschema:"Keylime cluster name; defaults to the primary cluster"`
 }
 
 type GetAgentStatusOutput struct {
+	Cluster                     string  `json:"cluster,omitempty"`
 	AgentUUID                   string  `json:"agent_uuid"`
 	OperationalState            int     `json:"operational_state"`
 	OperationalStateDescription string  `json:"operational_state_description"`
@@ -131,8 +210,27 @@ type GetAgentStatusOutput struct {
 	HasRuntimePolicy            bool    `json:"has_runtime_policy"`
 }
 
+// AgentAttestationStatus is the status of a push-model agent, derived from its attestations
+// instead of the verifier's operational_state.
+type AgentAttestationStatus struct {
+	Cluster         string `json:"cluster,omitempty"`
+	AgentUUID       string `json:"agent_uuid"`
+	AttestationMode string `json:"attestation_mode"`
+	// Status is the evaluation of the latest completed attestation: pass or fail; pending
+	// while none has completed, and no_attestations before the agent pushed any evidence.
+	Status                string        `json:"status"`
+	AttestationCount      int           `json:"attestation_count"`
+	LatestAttestation     *Attestation  `json:"latest_attestation,omitempty"`
+	LastPassedAttestation *Attestation  `json:"last_passed_attestation,omitempty"`
+	RecentAttestations    []Attestation `json:"recent_attestations"` // newest first
+}
+
+// StatusNoAttestations is the AgentAttestationStatus of an agent that has not pushed evidence yet.
+const StatusNoAttestations = "no_attestations"
+
 type ReactivateAgentInput struct {
 	AgentUUID string `json:"agent_uuid"`
+	Cluster   string `json:"cluster,omitempty" jsonschema:"Keylime cluster name; defaults to the primary cluster"`
 }
 
 type ReactivateAgentOutput struct {
@@ -141,8 +239,17 @@ type ReactivateAgentOutput struct {
 	Results struct{} `json:"results"`
 }
 
+// ReactivatePushAgentOutput answers Reactivate_agent for a push-model agent, which the
+// verifier re-evaluates on its next attestation instead of being reactivated.
+type ReactivatePushAgentOutput struct {
+	AgentAttestationStatus
+	Reactivated bool   `json:"reactivated"`
+	Message     string `json:"message"`
+}
+
 type GetAgentPoliciesInput struct {
 	AgentUUID string `json:"agent_uuid"`
+	Cluster   string `json:"cluster,omitempty" jsonschema:"Keylime cluster name; defaults to the primary cluster"`
 }
 
 type GetAgentPoliciesOutput struct {
@@ -159,6 +266,7 @@ type GetAgentPoliciesOutput struct {
 
 type RegistrarGetAgentDetailsInput struct {
 	AgentUUID string `json:"agent_uuid"`
+	Cluster   string `json:"cluster,omitempty" jsonschema:"Keylime cluster name; defaults to the primary cluster"`
 }
 
 type RegistrarGetAgentDetailsOutput struct {
@@ -175,7 +283,9 @@ type RegistrarGetAgentDetailsOutput struct {
 	} `json:"results"`
 }
 
-type GetVersionAndHealthInput struct{}
+type GetVersionAndHealthInput struct {
+	Cluster string `json:"cluster,omitempty" jsonschema:"Keylime cluster name; leave empty to query all clusters"`
+}
 
 type GetVersionOutput struct {
 	Code    int    `json:"code"`
@@ -187,19 +297,37 @@ type GetVersionOutput struct {
 }
 
 type ServiceStatus struct {
-	Service           string   `json:"service"`
-	Reachable         bool     `json:"reachable"`
-	CurrentVersion    string   `json:"current_version"`
-	SupportedVersions []string `json:"supported_versions"`
-	Error             string   `json:"error,omitempty"`
+	Cluster           string         `json:"cluster,omitempty"`
+	Service           string         `json:"service"`
+	Reachable         bool           `json:"reachable"`
+	CurrentVersion    string         `json:"current_version"`
+	SupportedVersions []string       `json:"supported_versions"`
+	APIVersion        string         `json:"negotiated_version,omitempty"`
+	CircuitBreaker    *BreakerStatus `json:"circuit_breaker,omitempty"`
+	TLS               *TLSStatus     `json:"tls,omitempty"`
+	Error             string         `json:"error,omitempty"`
 }
 
 type GetVersionAndHealthOutput struct {
 	Services []ServiceStatus `json:"services"`
 }
 
+type ListClustersInput struct{}
+
+type ClusterInfo struct {
+	Name         string `json:"name"`
+	Primary      bool   `json:"primary"`
+	VerifierURL  string `json:"verifier_url"`
+	RegistrarURL string `json:"registrar_url"`
+}
+
+type ListClustersOutput struct {
+	Clusters []ClusterInfo `json:"clusters"`
+}
+
 type RegistrarRemoveAgentInput struct {
 	AgentUUID string `json:"agent_uuid"`
+	Cluster   string `json:"cluster,omitempty" jsonschema:"Keylime cluster name; defaults to the primary cluster"`
 }
 
 type RegistrarRemoveAgentOutput struct {
@@ -208,20 +336,41 @@ type RegistrarRemoveAgentOutput struct {
 	Results struct{} `json:"results"`
 }
 
+// EnrollmentOptions are optional enrollment settings. Zero values keep the verifier defaults.
+type EnrollmentOptions struct {
+	PCRs                    []int               `json:"pcrs,omitempty" jsonschema:"Extra PCRs (0-23) to attest, on top of those required by the given policies"`
+	ExpectedPCRValues       map[string][]string `json:"expected_pcr_values,omitempty" jsonschema:"Accepted hex digests per PCR index, e.g. {\"15\": [\"0000...\"]}; these PCRs are attested too"`
+	AcceptTPMHashAlgs       []string            `json:"accept_tpm_hash_algs,omitempty" jsonschema:"Accepted TPM hash algorithms (default sha256, sha384, sha512)"`
+	AcceptTPMEncryptionAlgs []string            `json:"accept_tpm_encryption_algs,omitempty" jsonschema:"Accepted TPM encryption algorithms: rsa, ecc (default rsa)"`
+	AcceptTPMSigningAlgs    []string            `json:"accept_tpm_signing_algs,omitempty" jsonschema:"Accepted TPM signing algorithms, e.g. rsassa, rsapss, ecdsa (default rsassa)"`
+	Metadata                map[string]any      `json:"metadata,omitempty" jsonschema:"Metadata object stored with the agent on the verifier"`
+	IMASignVerificationKeys []string            `json:"ima_sign_verification_keys,omitempty" jsonschema:"PEM public keys or certificates used to verify IMA file signatures"`
+	CloudAgentIP            string              `json:"cloudagent_ip,omitempty" jsonschema:"Agent address the verifier contacts, instead of the one in the registrar (e.g. behind NAT)"`
+	CloudAgentPort          int                 `json:"cloudagent_port,omitempty" jsonschema:"Agent port the verifier contacts, instead of the one in the registrar"`
+	VerifyIdentity          bool                `json:"verify_identity,omitempty" jsonschema:"Check the EK certificate against the TPM manufacturer CAs and the agent's identity quote before enrolling; always on when the server enforces it"`
+}
+
 type EnrollAgentToVerifierInput struct {
 	AgentUUID         string `json:"agent_uuid"`
 	RuntimePolicyName string `json:"runtime_policy_name"`
 	MbPolicyName      string `json:"mb_policy_name"`
+	EnrollmentOptions
+	Payload       string `json:"payload,omitempty" jsonschema:"Absolute path of a file or directory on the server host, delivered encrypted to the agent and released after its first successful attestation"`
+	PayloadScript string `json:"payload_script,omitempty" jsonschema:"Absolute path of a script added to the payload as autorun.sh, which the agent runs after extracting it"`
+	Cluster       string `json:"cluster,omitempty" jsonschema:"Keylime cluster name; defaults to the primary cluster"`
 }
 
 type EnrollAgentToVerifierOutput struct {
-	Code    int      `json:"code"`
-	Status  string   `json:"status"`
-	Results struct{} `json:"results"`
+	Code             int                   `json:"code"`
+	Status           string                `json:"status"`
+	Results          struct{}              `json:"results"`
+	Identity         *IdentityVerification `json:"identity_verification,omitempty"`
+	PayloadDelivered bool                  `json:"payload_delivered,omitempty"` // U and the encrypted payload were sent to the agent
 }
 
 type UnenrollAgentFromVerifierInput struct {
 	AgentUUID string `json:"agent_uuid"`
+	Cluster   string `json:"cluster,omitempty" jsonschema:"Keylime cluster name; defaults to the primary cluster"`
 }
 
 type UnenrollAgentFromVerifierOutput struct {
@@ -234,15 +383,30 @@ type UpdateAgentInput struct {
 	AgentUUID         string `json:"agent_uuid"`
 	RuntimePolicyName string `json:"runtime_policy_name"`
 	MbPolicyName      string `json:"mb_policy_name"`
+	EnrollmentOptions
+	Cluster string `json:"cluster,omitempty" jsonschema:"Keylime cluster name; defaults to the primary cluster"`
 }
 
+// Update_agent outcomes
+const (
+	UpdateStatusUpdated    = "updated"     // the agent runs with the new enrollment
+	UpdateStatusRolledBack = "rolled_back" // the new enrollment failed; the previous one was fully restored
+	// the new enrollment failed; the previous one was restored without previous_enrollment.missing
+	UpdateStatusPartiallyRestored = "partially_restored"
+)
+
 type UpdateAgentOutput struct {
-	AgentUUID string `json:"agent_uuid"`
-	Status    string `json:"status"`
+	AgentUUID          string                `json:"agent_uuid"`
+	Status             string                `json:"status"`
+	WaitedForRemoval   bool                  `json:"waited_for_removal"`
+	EnrollmentError    string                `json:"enrollment_error,omitempty"`
+	PreviousEnrollment *EnrollmentSnapshot   `json:"previous_enrollment"`
+	Identity           *IdentityVerification `json:"identity_verification,omitempty"`
 }
 
 type StopAgentInput struct {
 	AgentUUID string `json:"agent_uuid"`
+	Cluster   string `json:"cluster,omitempty" jsonschema:"Keylime cluster name; defaults to the primary cluster"`
 }
 
 type StopAgentOutput struct {
@@ -251,7 +415,9 @@ type StopAgentOutput struct {
 	Results struct{} `json:"results"`
 }
 
-type GetVerifierEnrolledAgentsInput struct{}
+type GetVerifierEnrolledAgentsInput struct {
+	Cluster string `json:"cluster,omitempty" jsonschema:"Keylime cluster name; defaults to the primary cluster"`
+}
 
 type GetVerifierEnrolledAgentsOutput struct {
 	Agents []string `json:"agents"`
@@ -265,7 +431,9 @@ type VerifierEnrolledAgentsResponse struct {
 	} `json:"results"`
 }
 
-type ListRuntimePoliciesInput struct{}
+type ListRuntimePoliciesInput struct {
+	Cluster string `json:"cluster,omitempty" jsonschema:"Keylime cluster name; defaults to the primary cluster"`
+}
 
 type ListRuntimePoliciesOutput struct {
 	Code    int    `json:"code"`
@@ -276,17 +444,159 @@ type ListRuntimePoliciesOutput struct {
 }
 
 type ImportRuntimePolicyInput struct {
-	Name     string `json:"name"`
-	FilePath string `json:"file_path"`
+	Name             string `json:"name"`
+	FilePath         string `json:"file_path,omitempty" jsonschema:"absolute path on the server host of a runtime policy .json file or a legacy allowlist"`
+	Content          string `json:"content,omitempty" jsonschema:"the policy itself instead of file_path: runtime policy JSON or a legacy allowlist, as text or base64"`
+	ExcludeListPath  string `json:"exclude_list_path,omitempty" jsonschema:"absolute path of a legacy exclude list, one regex per line, added to the excludes"`
+	ExcludeList      string `json:"exclude_list,omitempty" jsonschema:"a legacy exclude list instead of exclude_list_path, as text or base64"`
+	IgnoreLintErrors bool   `json:"ignore_lint_errors,omitempty" jsonschema:"import the policy even if the linter finds errors; they are returned as warnings"`
+	Reason           string `json:"reason,omitempty" jsonschema:"why the policy is changed; kept with the version in the policy history"`
+	Cluster          string `json:"cluster,omitempty" jsonschema:"Keylime cluster name; defaults to the primary cluster"`
 }
 
 type ImportRuntimePolicyOutput struct {
-	Name   string `json:"name"`
-	Status string `json:"status"`
+	Name           string              `json:"name"`
+	Status         string              `json:"status"`
+	Conversion     *PolicyConversion   `json:"conversion,omitempty" jsonschema:"how a legacy allowlist or exclude list was converted"`
+	Warnings       []PolicyLintFinding `json:"warnings,omitempty" jsonschema:"lint findings; the policy was imported anyway"`
+	HistoryWarning string              `json:"history_warning,omitempty" jsonschema:"set when the policy was uploaded but not recorded in the policy history"`
+}
+
+type PolicyConversion struct {
+	From         string   `json:"from" jsonschema:"flat_allowlist, json_allowlist, or runtime_policy if only an exclude list was added"`
+	DigestCount  int      `json:"digest_count"`
+	KeyringCount int      `json:"keyring_count"`
+	ExcludeCount int      `json:"exclude_count" jsonschema:"regexes taken from the exclude list"`
+	SkippedLines []string `json:"skipped_lines,omitempty" jsonschema:"allowlist lines that are not <digest> <path>; check them before attesting"`
+}
+
+type CreateRuntimePolicyInput struct {
+	RootPath    string   `json:"root_path" jsonschema:"absolute path of the directory that is / on the attested system: / itself or a mounted image"`
+	OutputPath  string   `json:"output_path" jsonschema:"absolute path of the .json file the policy is written to"`
+	HashAlg     string   `json:"hash_alg,omitempty" jsonschema:"file hash algorithm: sha1, sha256 (default), sha384 or sha512"`
+	Excludes    []string `json:"excludes,omitempty" jsonschema:"regular expressions of paths to leave out; the verifier ignores them too, e.g. /opt/cache(/.*)?"`
+	Incremental bool     `json:"incremental,omitempty" jsonschema:"only hash files changed since the last run with this output_path"`
+	PolicyName  string   `json:"policy_name,omitempty" jsonschema:"also upload the policy to the verifier under this name"`
+	Reason      string   `json:"reason,omitempty" jsonschema:"why the policy is changed; kept with the version in the policy history"`
+	Cluster     string   `json:"cluster,omitempty" jsonschema:"Keylime cluster name; defaults to the primary cluster"`
+}
+
+type CreateRuntimePolicyOutput struct {
+	OutputPath      string   `json:"output_path"`
+	PolicyName      string   `json:"policy_name,omitempty"`
+	Status          string   `json:"status"`
+	HashAlg         string   `json:"hash_alg"`
+	DigestCount     int      `json:"digest_count"`
+	FilesHashed     int      `json:"files_hashed"`
+	FilesReused     int      `json:"files_reused"` // unchanged since the previous run
+	FilesExcluded   int      `json:"files_excluded"`
+	UnreadableCount int      `json:"unreadable_count"`
+	Unreadable      []string `json:"unreadable,omitempty"`
+	HistoryWarning  string   `json:"history_warning,omitempty" jsonschema:"set when the policy was uploaded but not recorded in the policy history"`
+}
+
+type CreateRuntimePolicyFromIMALogInput struct {
+	LogPath    string   `json:"log_path" jsonschema:"absolute path of a saved copy of /sys/kernel/security/ima/ascii_runtime_measurements from a known-good machine"`
+	OutputPath string   `json:"output_path,omitempty" jsonschema:"absolute path of the .json file the policy is written to"`
+	PolicyName string   `json:"policy_name,omitempty" jsonschema:"upload the policy to the verifier under this name"`
+	Excludes   []string `json:"excludes,omitempty" jsonschema:"regular expressions of paths to leave out; the verifier ignores them too, e.g. /tmp(/.*)?"`
+	Reason     string   `json:"reason,omitempty" jsonschema:"why the policy is changed; kept with the version in the policy history"`
+	Cluster    string   `json:"cluster,omitempty" jsonschema:"Keylime cluster name; defaults to the primary cluster"`
+}
+
+type CreateRuntimePolicyFromIMALogOutput struct {
+	OutputPath     string `json:"output_path,omitempty"`
+	PolicyName     string `json:"policy_name,omitempty"`
+	Status         string `json:"status"`
+	EntryCount     int    `json:"entry_count"`
+	DigestCount    int    `json:"digest_count"`
+	KeyringCount   int    `json:"keyring_count"`
+	IMABufCount    int    `json:"ima_buf_count"`
+	LogHashAlg     string `json:"log_hash_alg"`
+	HistoryWarning string `json:"history_warning,omitempty" jsonschema:"set when the policy was uploaded but not recorded in the policy history"`
+}
+
+type EvaluateIMALogInput struct {
+	LogPath      string `json:"log_path" jsonschema:"absolute path of a saved copy of /sys/kernel/security/ima/ascii_runtime_measurements from the agent"`
+	PolicyName   string `json:"policy_name,omitempty" jsonschema:"runtime policy stored on the verifier; use List_runtime_policies for names"`
+	PolicyPath   string `json:"policy_path,omitempty" jsonschema:"absolute path of a local runtime policy .json file, instead of policy_name"`
+	FailuresOnly bool   `json:"failures_only,omitempty" jsonschema:"list only the failing entries; the counts still cover the whole log"`
+	Cluster      string `json:"cluster,omitempty" jsonschema:"Keylime cluster name; defaults to the primary cluster"`
+}
+
+type EvaluateIMALogOutput struct {
+	PolicyName    string               `json:"policy_name,omitempty"`
+	PolicyPath    string               `json:"policy_path,omitempty"`
+	EntryCount    int                  `json:"entry_count"`
+	AllowedCount  int                  `json:"allowed_count"`
+	ExcludedCount int                  `json:"excluded_count"`
+	FailingCount  int                  `json:"failing_count"`
+	Entries       []IMAEntryEvaluation `json:"entries"`
+}
+
+type IMAEntryEvaluation struct {
+	Line        int      `json:"line"`
+	Path        string   `json:"path"`
+	Template    string   `json:"template"`
+	Digest      string   `json:"digest"`
+	Status      string   `json:"status"`
+	FailureType string   `json:"failure_type,omitempty"`
+	Reason      string   `json:"reason"`
+	Expected    []string `json:"expected,omitempty"`
+}
+
+type DiffRuntimePoliciesInput struct {
+	From       string `json:"from" jsonschema:"old policy: a name stored on the verifier, or an absolute path of a local .json file"`
+	To         string `json:"to" jsonschema:"new policy: a name stored on the verifier, or an absolute path of a local .json file"`
+	MaxEntries int    `json:"max_entries,omitempty" jsonschema:"maximum entries listed per section (default 50); the counts always cover the whole diff"`
+	Cluster    string `json:"cluster,omitempty" jsonschema:"Keylime cluster name; defaults to the primary cluster"`
+}
+
+type DiffRuntimePoliciesOutput struct {
+	From                 string              `json:"from"`
+	To                   string              `json:"to"`
+	Identical            bool                `json:"identical"`
+	Truncated            bool                `json:"truncated"`
+	Digests              PolicyMapDiff       `json:"digests"`
+	Keyrings             PolicyMapDiff       `json:"keyrings"`
+	IMABuf               PolicyMapDiff       `json:"ima_buf"`
+	ExcludesAddedCount   int                 `json:"excludes_added_count"`
+	ExcludesRemovedCount int                 `json:"excludes_removed_count"`
+	ExcludesAdded        []string            `json:"excludes_added,omitempty"`
+	ExcludesRemoved      []string            `json:"excludes_removed,omitempty"`
+	Fields               []PolicyFieldChange `json:"fields"`
+}
+
+type PolicyMapDiff struct {
+	AddedCount   int                 `json:"added_count"`
+	RemovedCount int                 `json:"removed_count"`
+	ChangedCount int                 `json:"changed_count"`
+	Truncated    bool                `json:"truncated,omitempty"`
+	Added        []PolicyPathDigests `json:"added,omitempty"`
+	Removed      []PolicyPathDigests `json:"removed,omitempty"`
+	Changed      []PolicyPathChange  `json:"changed,omitempty"`
+}
+
+type PolicyPathDigests struct {
+	Path    string   `json:"path"`
+	Digests []string `json:"digests"`
+}
+
+type PolicyPathChange struct {
+	Path           string   `json:"path"`
+	AddedDigests   []string `json:"added_digests,omitempty"`
+	RemovedDigests []string `json:"removed_digests,omitempty"`
+}
+
+type PolicyFieldChange struct {
+	Field string `json:"field"`
+	From  string `json:"from"`
+	To    string `json:"to"`
 }
 
 type GetRuntimePolicyInput struct {
 	PolicyName string `json:"policy_name"`
+	Cluster    string `json:"cluster,omitempty" jsonschema:"Keylime cluster name; defaults to the primary cluster"`
 }
 
 type GetRuntimePolicyOutput struct {
@@ -297,23 +607,41 @@ type GetRuntimePolicyOutput struct {
 		TPMPolicy     string `json:"tpm_policy"`
 		RuntimePolicy string `json:"runtime_policy"`
 	} `json:"results"`
+	Revision string `json:"revision,omitempty" jsonschema:"fingerprint of the stored policy, to pass as expected_revision to Update_runtime_policy"`
 }
 
 type UpdateRuntimePolicyInput struct {
-	PolicyName     string            `json:"policy_name"`
-	AddExcludes    []string          `json:"add_excludes"`
-	RemoveExcludes []string          `json:"remove_excludes"`
-	AddDigests     map[string]string `json:"add_digests"`
-	RemoveDigests  []string          `json:"remove_digests"`
+	PolicyName            string              `json:"policy_name"`
+	AddExcludes           []string            `json:"add_excludes"`
+	RemoveExcludes        []string            `json:"remove_excludes"`
+	AddDigests            map[string][]string `json:"add_digests" jsonschema:"path to digests to accept for it, appended to the digests already accepted"`
+	RemoveDigests         []string            `json:"remove_digests" jsonschema:"paths to remove with all their digests"`
+	RemoveDigestValues    map[string][]string `json:"remove_digest_values,omitempty" jsonschema:"path to digests to stop accepting; the path is removed when none remain"`
+	AddKeyrings           map[string][]string `json:"add_keyrings,omitempty" jsonschema:"keyring name, e.g. .ima, to digests of keys to accept"`
+	RemoveKeyrings        map[string][]string `json:"remove_keyrings,omitempty" jsonschema:"keyring name to digests to remove; an empty list removes the keyring"`
+	AddIMABuf             map[string][]string `json:"add_ima_buf,omitempty" jsonschema:"ima-buf entry name, e.g. kernel_version, to digests to accept"`
+	RemoveIMABuf          map[string][]string `json:"remove_ima_buf,omitempty" jsonschema:"ima-buf entry name to digests to remove; an empty list removes the entry"`
+	AddIgnoredKeyrings    []string            `json:"add_ignored_keyrings,omitempty" jsonschema:"keyrings whose keys the verifier accepts without checking, or * for all"`
+	RemoveIgnoredKeyrings []string            `json:"remove_ignored_keyrings,omitempty"`
+	LogHashAlg            string              `json:"log_hash_alg,omitempty" jsonschema:"hash algorithm of the IMA template hashes: sha1, sha256, sha384 or sha512"`
+	VerificationKeys      *string             `json:"verification_keys,omitempty" jsonschema:"replaces verification-keys, the keys IMA file signatures are checked with; an empty string removes them"`
+	ExpectedRevision      string              `json:"expected_revision,omitempty" jsonschema:"revision from Get_runtime_policy; the update fails with a conflict if the policy changed since"`
+	Reason                string              `json:"reason,omitempty" jsonschema:"why the policy is changed; kept with the version in the policy history"`
+	Cluster               string              `json:"cluster,omitempty" jsonschema:"Keylime cluster name; defaults to the primary cluster"`
 }
 
 type UpdateRuntimePolicyOutput struct {
-	PolicyName string `json:"policy_name"`
-	Status     string `json:"status"`
+	PolicyName     string `json:"policy_name"`
+	Status         string `json:"status"`
+	Revision       string `json:"revision" jsonschema:"fingerprint of the uploaded policy"`
+	Retries        int    `json:"retries" jsonschema:"times the edit was re-applied because the policy changed concurrently"`
+	HistoryWarning string `json:"history_warning,omitempty" jsonschema:"set when the policy was uploaded but not recorded in the policy history"`
 }
 
 type DeleteRuntimePolicyInput struct {
 	PolicyName string `json:"policy_name"`
+	Reason     string `json:"reason,omitempty" jsonschema:"why the policy is changed; kept with the version in the policy history"`
+	Cluster    string `json:"cluster,omitempty" jsonschema:"Keylime cluster name; defaults to the primary cluster"`
 }
 
 type DeletePolicyOutput struct {
@@ -321,7 +649,9 @@ type DeletePolicyOutput struct {
 	Status     string `json:"status"`
 }
 
-type ListMBPoliciesInput struct{}
+type ListMBPoliciesInput struct {
+	Cluster string `json:"cluster,omitempty" jsonschema:"Keylime cluster name; defaults to the primary cluster"`
+}
 
 type ListMBPoliciesOutput struct {
 	Code    int    `json:"code"`
@@ -333,6 +663,7 @@ type ListMBPoliciesOutput struct {
 
 type GetMBPolicyInput struct {
 	PolicyName string `json:"policy_name"`
+	Cluster    string `json:"cluster,omitempty" jsonschema:"Keylime cluster name; defaults to the primary cluster"`
 }
 
 type GetMBPolicyOutput struct {
@@ -342,17 +673,114 @@ type GetMBPolicyOutput struct {
 }
 
 type ImportMBPolicyInput struct {
-	Name     string `json:"name"`
-	FilePath string `json:"file_path"`
+	Name             string `json:"name"`
+	FilePath         string `json:"file_path,omitempty" jsonschema:"absolute path on the server host of a measured boot policy .json file"`
+	Content          string `json:"content,omitempty" jsonschema:"the policy JSON itself instead of file_path, as text or base64"`
+	IgnoreLintErrors bool   `json:"ignore_lint_errors,omitempty" jsonschema:"import the policy even if the linter finds errors; they are returned as warnings"`
+	Reason           string `json:"reason,omitempty" jsonschema:"why the policy is changed; kept with the version in the policy history"`
+	Cluster          string `json:"cluster,omitempty" jsonschema:"Keylime cluster name; defaults to the primary cluster"`
 }
 
 type ImportMBPolicyOutput struct {
-	Name   string `json:"name"`
-	Status string `json:"status"`
+	Name           string              `json:"name"`
+	Status         string              `json:"status"`
+	Warnings       []PolicyLintFinding `json:"warnings,omitempty" jsonschema:"lint findings; the policy was imported anyway"`
+	HistoryWarning string              `json:"history_warning,omitempty" jsonschema:"set when the policy was uploaded but not recorded in the policy history"`
+}
+
+type CreateMBPolicyInput struct {
+	EventLogPath   string `json:"event_log_path" jsonschema:"absolute path of a saved copy of /sys/kernel/security/tpm0/binary_bios_measurements from a known-good boot"`
+	OutputPath     string `json:"output_path,omitempty" jsonschema:"absolute path of the .json file the policy is written to"`
+	PolicyName     string `json:"policy_name,omitempty" jsonschema:"upload the policy to the verifier under this name"`
+	SkipSecureBoot bool   `json:"skip_secureboot,omitempty" jsonschema:"generate the policy for a machine that boots without SecureBoot; the SecureBoot databases are not checked"`
+	Reason         string `json:"reason,omitempty" jsonschema:"why the policy is changed; kept with the version in the policy history"`
+	Cluster        string `json:"cluster,omitempty" jsonschema:"Keylime cluster name; defaults to the primary cluster"`
+}
+
+type CreateMBPolicyOutput struct {
+	OutputPath           string `json:"output_path,omitempty"`
+	PolicyName           string `json:"policy_name,omitempty"`
+	Status               string `json:"status"`
+	EventCount           int    `json:"event_count"`
+	HasSecureBoot        bool   `json:"has_secureboot"`
+	PKCount              int    `json:"pk_count"`
+	KEKCount             int    `json:"kek_count"`
+	DBCount              int    `json:"db_count"`
+	DBXCount             int    `json:"dbx_count"`
+	ShimAuthcodeSHA256   string `json:"shim_authcode_sha256,omitempty"`
+	GrubAuthcodeSHA256   string `json:"grub_authcode_sha256,omitempty"`
+	KernelAuthcodeSHA256 string `json:"kernel_authcode_sha256,omitempty"`
+	InitrdPlainSHA256    string `json:"initrd_plain_sha256,omitempty"`
+	HistoryWarning       string `json:"history_warning,omitempty" jsonschema:"set when the policy was uploaded but not recorded in the policy history"`
 }
 
 type DeleteMBPolicyInput struct {
 	PolicyName string `json:"policy_name"`
+	Reason     string `json:"reason,omitempty" jsonschema:"why the policy is changed; kept with the version in the policy history"`
+	Cluster    string `json:"cluster,omitempty" jsonschema:"Keylime cluster name; defaults to the primary cluster"`
+}
+
+type LintPolicyInput struct {
+	FilePath   string `json:"file_path,omitempty" jsonschema:"absolute path of a local policy .json file"`
+	PolicyName string `json:"policy_name,omitempty" jsonschema:"policy stored on the verifier, instead of file_path"`
+	Kind       string `json:"kind,omitempty" jsonschema:"runtime or mb; detected from the file when empty, runtime for policy_name"`
+	Cluster    string `json:"cluster,omitempty" jsonschema:"Keylime cluster name; defaults to the primary cluster"`
+}
+
+type LintPolicyOutput struct {
+	Kind         string              `json:"kind"`
+	Valid        bool                `json:"valid" jsonschema:"no errors were found; import tools reject policies with errors unless ignore_lint_errors is set"`
+	ErrorCount   int                 `json:"error_count"`
+	WarningCount int                 `json:"warning_count"`
+	Findings     []PolicyLintFinding `json:"findings"`
+}
+
+type PolicyLintFinding struct {
+	Severity string `json:"severity" jsonschema:"error or warning"`
+	Check    string `json:"check"`
+	Location string `json:"location,omitempty" jsonschema:"where in the policy, e.g. excludes[2]"`
+	Message  string `json:"message"`
+}
+
+type ListPolicyHistoryInput struct {
+	PolicyName string `json:"policy_name,omitempty" jsonschema:"only versions of this policy"`
+	Kind       string `json:"kind,omitempty" jsonschema:"runtime or mb; both when empty"`
+	Cluster    string `json:"cluster,omitempty" jsonschema:"only versions from this Keylime cluster"`
+	Limit      int    `json:"limit,omitempty" jsonschema:"maximum number of versions listed, newest first (default 50)"`
+}
+
+type ListPolicyHistoryOutput struct {
+	Versions []PolicyVersion `json:"versions"`
+	Total    int             `json:"total"`
+}
+
+type PolicyVersion struct {
+	Version      int    `json:"version"`
+	Time         string `json:"time"`
+	Cluster      string `json:"cluster"`
+	Kind         string `json:"kind"`
+	PolicyName   string `json:"policy_name"`
+	Action       string `json:"action" jsonschema:"uploaded, replaced (overwritten by a later upload) or deleted"`
+	Tool         string `json:"tool"`
+	Reason       string `json:"reason,omitempty"`
+	Digest       string `json:"digest" jsonschema:"SHA-256 of the policy document"`
+	Size         int    `json:"size"`
+	RestoredFrom int    `json:"restored_from,omitempty" jsonschema:"version a rollback restored"`
+}
+
+type RollbackPolicyInput struct {
+	Version int    `json:"version" jsonschema:"version to restore, from List_policy_history"`
+	Reason  string `json:"reason,omitempty" jsonschema:"why the policy is rolled back; kept in the policy history"`
+}
+
+type RollbackPolicyOutput struct {
+	PolicyName      string `json:"policy_name"`
+	Kind            string `json:"kind"`
+	Cluster         string `json:"cluster"`
+	RestoredVersion int    `json:"restored_version"`
+	Version         int    `json:"version,omitempty" jsonschema:"history version of the restored policy"`
+	Status          string `json:"status" jsonschema:"rolled_back, recreated for a deleted policy, or unchanged"`
+	HistoryWarning  string `json:"history_warning,omitempty" jsonschema:"set when the policy was uploaded but not recorded in the policy history"`
 }
 
 type InvestigateVerifierLogsInput struct {
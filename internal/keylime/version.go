@@ -0,0 +1,181 @@
+package keylime
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// SupportedAPIVersions lists the Keylime REST API versions this server can talk, oldest first
+var SupportedAPIVersions = []string{"2.0", "2.1", "2.2", "2.3", "2.4", "2.5"}
+
+// DefaultAPIVersion is used until negotiation succeeds, and for services without a /version endpoint
+const DefaultAPIVersion = "v2.5"
+
+// ErrAPIVersionMismatch is returned when a service and keylime-mcp share no API version.
+var ErrAPIVersionMismatch = errors.New("API version mismatch")
+
+// APIVersion returns the API version used in request URLs, e.g. "v2.5".
+func (kc *Client) APIVersion() string {
+	kc.versionMu.Lock()
+	defer kc.versionMu.Unlock()
+	return kc.apiVersion
+}
+
+// NegotiateAPIVersion queries the service's /version endpoint and selects the highest
+// version supported by both sides. A configured version is checked instead of chosen.
+// Transport errors and version mismatches are returned as-is and negotiation is attempted
+// again on the next request.
+func (kc *Client) NegotiateAPIVersion(ctx context.Context) (string, error) {
+	kc.negotiateMu.Lock()
+	defer kc.negotiateMu.Unlock()
+	return kc.negotiateLocked(ctx)
+}
+
+func (kc *Client) negotiateLocked(ctx context.Context) (string, error) {
+	resp, err := kc.GetRaw(ctx, "version")
+	if err != nil {
+		return kc.APIVersion(), fmt.Errorf("negotiating API version with %s: %w", kc.baseURL, err)
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}()
+
+	var theirs []string
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		// Keylime before 6.0 has no /version endpoint; keep the configured or default version
+		kc.setNegotiated(kc.APIVersion(), nil)
+		return kc.APIVersion(), nil
+	case resp.StatusCode < 200 || resp.StatusCode >= 300:
+		return kc.APIVersion(), fmt.Errorf("negotiating API version with %s: %w", kc.baseURL, ExtractAPIError(resp))
+	default:
+		var out GetVersionOutput
+		if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+			return kc.APIVersion(), fmt.Errorf("negotiating API version with %s: failed to decode response: %w", kc.baseURL, err)
+		}
+		theirs = out.Results.SupportedVersions
+		if len(theirs) == 0 && out.Results.CurrentVersion != "" {
+			theirs = []string{out.Results.CurrentVersion}
+		}
+	}
+
+	if kc.pinnedVersion != "" {
+		pinned := strings.TrimPrefix(kc.pinnedVersion, "v")
+		for _, v := range theirs {
+			if strings.TrimPrefix(v, "v") == pinned {
+				kc.setNegotiated(kc.pinnedVersion, nil)
+				return kc.pinnedVersion, nil
+			}
+		}
+		err := fmt.Errorf("%w: %s supports %s, but the configured API version is %s",
+			ErrAPIVersionMismatch, kc.baseURL, strings.Join(theirs, ", "), kc.pinnedVersion)
+		kc.setNegotiated(kc.pinnedVersion, err)
+		return kc.pinnedVersion, err
+	}
+
+	best := highestCommonVersion(SupportedAPIVersions, theirs)
+	if best == "" {
+		err := fmt.Errorf("%w: %s supports %s, keylime-mcp supports %s",
+			ErrAPIVersionMismatch, kc.baseURL, strings.Join(theirs, ", "), strings.Join(SupportedAPIVersions, ", "))
+		kc.setNegotiated(kc.APIVersion(), err)
+		return kc.APIVersion(), err
+	}
+	kc.setNegotiated("v"+best, nil)
+	return "v" + best, nil
+}
+
+func (kc *Client) setNegotiated(version string, err error) {
+	kc.versionMu.Lock()
+	defer kc.versionMu.Unlock()
+	kc.apiVersion = version
+	kc.versionErr = err
+	kc.negotiated = true
+}
+
+// resetNegotiation makes the next versioned request negotiate again, e.g. after the
+// service was unreachable and may have been upgraded in the meantime.
+func (kc *Client) resetNegotiation() {
+	if kc.pinnedVersion != "" {
+		return
+	}
+	kc.versionMu.Lock()
+	defer kc.versionMu.Unlock()
+	kc.negotiated = false
+}
+
+// ensureAPIVersion returns the version to use for the next request, negotiating first when needed.
+func (kc *Client) ensureAPIVersion(ctx context.Context) (string, error) {
+	if version, ok, err := kc.cachedAPIVersion(); ok {
+		return version, err
+	}
+
+	kc.negotiateMu.Lock()
+	defer kc.negotiateMu.Unlock()
+	if version, ok, err := kc.cachedAPIVersion(); ok {
+		return version, err
+	}
+	return kc.negotiateLocked(ctx)
+}
+
+// cachedAPIVersion returns the negotiated or pinned version and whether it can be used without
+// negotiating. A version mismatch is not kept: the service may have been upgraded since, so the
+// next request checks /version again instead of failing until restart.
+func (kc *Client) cachedAPIVersion() (string, bool, error) {
+	kc.versionMu.Lock()
+	defer kc.versionMu.Unlock()
+	ok := (kc.negotiated || kc.pinnedVersion != "") && !errors.Is(kc.versionErr, ErrAPIVersionMismatch)
+	return kc.apiVersion, ok, kc.versionErr
+}
+
+// NegotiateAPIVersions negotiates the API version of the verifier and the registrar.
+func (s *Service) NegotiateAPIVersions(ctx context.Context) error {
+	_, verr := s.Verifier.NegotiateAPIVersion(ctx)
+	_, rerr := s.Registrar.NegotiateAPIVersion(ctx)
+	if verr != nil {
+		verr = fmt.Errorf("verifier: %w", verr)
+	}
+	if rerr != nil {
+		rerr = fmt.Errorf("registrar: %w", rerr)
+	}
+	return errors.Join(verr, rerr)
+}
+
+// highestCommonVersion returns the highest "major.minor" version present in both lists.
+func highestCommonVersion(ours, theirs []string) string {
+	supported := make(map[string]bool, len(ours))
+	for _, v := range ours {
+		supported[v] = true
+	}
+	best := ""
+	for _, v := range theirs {
+		v = strings.TrimPrefix(v, "v")
+		if supported[v] && (best == "" || compareVersions(v, best) > 0) {
+			best = v
+		}
+	}
+	return best
+}
+
+// compareVersions compares two "major.minor" version strings numerically.
+func compareVersions(a, b string) int {
+	amaj, amin := splitVersion(a)
+	bmaj, bmin := splitVersion(b)
+	if amaj != bmaj {
+		return amaj - bmaj
+	}
+	return amin - bmin
+}
+
+func splitVersion(v string) (int, int) {
+	major, minor, _ := strings.Cut(v, ".")
+	maj, _ := strconv.Atoi(major)
+	mnr, _ := strconv.Atoi(minor)
+	return maj, mnr
+}
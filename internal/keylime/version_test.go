@@ -0,0 +1,194 @@
+package keylime
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func versionHandler(supported ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		quoted := make([]string, len(supported))
+		for i, v := range supported {
+			quoted[i] = fmt.Sprintf("%q", v)
+		}
+		fmt.Fprintf(w, `{"code":200,"status":"Success","results":{"current_version":%q,"supported_versions":[%s]}}`,
+			supported[len(supported)-1], strings.Join(quoted, ","))
+	}
+}
+
+func newNegotiatingClient(t *testing.T, handler http.Handler, pinned string) *Client {
+	t.Helper()
+	ts := httptest.NewServer(handler)
+	t.Cleanup(ts.Close)
+	client, err := newClient(ts.URL, &Config{TLSEnabled: false, APIVersion: pinned})
+	require.NoError(t, err)
+	return client
+}
+
+func TestNegotiateAPIVersion(t *testing.T) {
+	t.Run("picks highest common version", func(t *testing.T) {
+		client := newNegotiatingClient(t, versionHandler("2.1", "2.3", "3.0"), "")
+
+		version, err := client.NegotiateAPIVersion(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "v2.3", version)
+		assert.Equal(t, "v2.3", client.APIVersion())
+	})
+
+	t.Run("uses real version.json", func(t *testing.T) {
+		data := loadTestdata(t, "version.json")
+		client := newNegotiatingClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write(data)
+		}), "")
+
+		version, err := client.NegotiateAPIVersion(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "v2.5", version)
+	})
+
+	t.Run("no common version", func(t *testing.T) {
+		client := newNegotiatingClient(t, versionHandler("3.0", "3.1"), "")
+
+		_, err := client.NegotiateAPIVersion(context.Background())
+		require.ErrorIs(t, err, ErrAPIVersionMismatch)
+		assert.Contains(t, err.Error(), "supports 3.0, 3.1")
+
+		_, err = client.Get(context.Background(), "agents/")
+		assert.ErrorIs(t, err, ErrAPIVersionMismatch, "requests fail with the mismatch instead of a 404")
+	})
+
+	t.Run("pinned version checked against service", func(t *testing.T) {
+		client := newNegotiatingClient(t, versionHandler("2.4", "2.5"), "v2.4")
+		version, err := client.NegotiateAPIVersion(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "v2.4", version)
+
+		client = newNegotiatingClient(t, versionHandler("2.4", "2.5"), "v2.2")
+		_, err = client.NegotiateAPIVersion(context.Background())
+		require.ErrorIs(t, err, ErrAPIVersionMismatch)
+		assert.Contains(t, err.Error(), "configured API version is v2.2")
+	})
+
+	t.Run("rejected pinned version is checked again", func(t *testing.T) {
+		var supported atomic.Value
+		supported.Store("2.4")
+		var agentPath string
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /version", func(w http.ResponseWriter, r *http.Request) {
+			versionHandler(supported.Load().(string))(w, r)
+		})
+		mux.HandleFunc("GET /{version}/agents/", func(w http.ResponseWriter, r *http.Request) {
+			agentPath = r.URL.Path
+		})
+		client := newNegotiatingClient(t, mux, "v2.5")
+
+		_, err := client.NegotiateAPIVersion(context.Background())
+		require.ErrorIs(t, err, ErrAPIVersionMismatch)
+		_, err = client.Get(context.Background(), "agents/")
+		require.ErrorIs(t, err, ErrAPIVersionMismatch)
+
+		// Service upgraded without a restart of keylime-mcp
+		supported.Store("2.5")
+		resp, err := client.Get(context.Background(), "agents/")
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		assert.Equal(t, "/v2.5/agents/", agentPath)
+	})
+
+	t.Run("missing version endpoint keeps default", func(t *testing.T) {
+		client := newNegotiatingClient(t, http.NotFoundHandler(), "")
+
+		version, err := client.NegotiateAPIVersion(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, DefaultAPIVersion, version)
+	})
+
+	t.Run("first request negotiates lazily", func(t *testing.T) {
+		var versionCalls atomic.Int32
+		var agentPath string
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /version", func(w http.ResponseWriter, r *http.Request) {
+			versionCalls.Add(1)
+			versionHandler("2.2")(w, r)
+		})
+		mux.HandleFunc("GET /{version}/agents/", func(w http.ResponseWriter, r *http.Request) {
+			agentPath = r.URL.Path
+		})
+		client := newNegotiatingClient(t, mux, "")
+
+		for range 2 {
+			resp, err := client.Get(context.Background(), "agents/")
+			require.NoError(t, err)
+			_ = resp.Body.Close()
+		}
+		assert.Equal(t, "/v2.2/agents/", agentPath)
+		assert.Equal(t, int32(1), versionCalls.Load())
+	})
+
+	t.Run("renegotiates after reconnect", func(t *testing.T) {
+		var supported atomic.Value
+		supported.Store("2.4")
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /version", func(w http.ResponseWriter, r *http.Request) {
+			versionHandler(supported.Load().(string))(w, r)
+		})
+		mux.HandleFunc("GET /{version}/agents/", func(w http.ResponseWriter, r *http.Request) {})
+		ts := httptest.NewServer(mux)
+		client, err := newClient(ts.URL, &Config{TLSEnabled: false})
+		require.NoError(t, err)
+
+		_, err = client.NegotiateAPIVersion(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "v2.4", client.APIVersion())
+
+		// Service goes away and comes back upgraded on the same address
+		addr := ts.Listener.Addr().String()
+		ts.Close()
+		_, err = client.Get(context.Background(), "agents/")
+		require.Error(t, err)
+
+		supported.Store("2.5")
+		restarted := httptest.NewUnstartedServer(mux)
+		listener, err := (&net.ListenConfig{}).Listen(context.Background(), "tcp", addr)
+		if err != nil {
+			t.Skipf("cannot rebind %s: %v", addr, err)
+		}
+		restarted.Listener = listener
+		restarted.Start()
+		t.Cleanup(restarted.Close)
+
+		resp, err := client.Get(context.Background(), "agents/")
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		assert.Equal(t, "v2.5", client.APIVersion())
+	})
+}
+
+func TestServiceNegotiateAPIVersions(t *testing.T) {
+	verifier := httptest.NewServer(versionHandler("2.4", "2.5"))
+	t.Cleanup(verifier.Close)
+	registrar := httptest.NewServer(versionHandler("2.2"))
+	t.Cleanup(registrar.Close)
+
+	svc, err := NewService(&Config{VerifierURL: verifier.URL, RegistrarURL: registrar.URL})
+	require.NoError(t, err)
+
+	require.NoError(t, svc.NegotiateAPIVersions(context.Background()))
+	assert.Equal(t, "v2.5", svc.Verifier.APIVersion())
+	assert.Equal(t, "v2.2", svc.Registrar.APIVersion())
+}
+
+func TestHighestCommonVersion(t *testing.T) {
+	assert.Equal(t, "2.10", highestCommonVersion([]string{"2.9", "2.10"}, []string{"2.9", "2.10"}))
+	assert.Equal(t, "2.5", highestCommonVersion(SupportedAPIVersions, []string{"v2.5", "3.0"}))
+	assert.Empty(t, highestCommonVersion(SupportedAPIVersions, nil))
+}
@@ -0,0 +1,217 @@
+package keylimetest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/keylime/keylime-mcp/internal/keylime"
+)
+
+// Scenario describes agents, policies and faults to load into a Fake.
+type Scenario struct {
+	Agents          []ScenarioAgent            `json:"agents,omitempty"`
+	RuntimePolicies map[string]json.RawMessage `json:"runtime_policies,omitempty"`
+	MBPolicies      map[string]json.RawMessage `json:"mb_policies,omitempty"`
+	Faults          []Fault                    `json:"faults,omitempty"`
+}
+
+// ScenarioAgent is a registered agent, optionally enrolled in the verifier.
+type ScenarioAgent struct {
+	Agent
+	Enroll        bool     `json:"enroll,omitempty"`
+	RuntimePolicy string   `json:"runtime_policy,omitempty"`
+	MBPolicy      string   `json:"mb_policy,omitempty"`
+	Failure       *Failure `json:"failure,omitempty"`
+}
+
+// ReadScenario reads a Scenario from a JSON file.
+func ReadScenario(path string) (Scenario, error) {
+	var scenario Scenario
+	data, err := os.ReadFile(path) // #nosec G304 -- path comes from the operator's command line
+	if err != nil {
+		return scenario, err
+	}
+	if err := json.Unmarshal(data, &scenario); err != nil {
+		return scenario, fmt.Errorf("invalid scenario %s: %w", path, err)
+	}
+	return scenario, nil
+}
+
+// Load adds the policies, agents and faults of a scenario, in that order.
+func (f *Fake) Load(scenario Scenario) error {
+	for name, policy := range scenario.RuntimePolicies {
+		f.AddRuntimePolicy(name, string(policy))
+	}
+	for name, policy := range scenario.MBPolicies {
+		f.AddMBPolicy(name, string(policy))
+	}
+	for _, agent := range scenario.Agents {
+		if agent.UUID == "" {
+			return errors.New("scenario agent without uuid")
+		}
+		f.RegisterAgent(agent.Agent)
+		if !agent.Enroll {
+			continue
+		}
+		if err := f.checkPolicies(agent.RuntimePolicy, agent.MBPolicy); err != nil {
+			return fmt.Errorf("agent %s: %w", agent.UUID, err)
+		}
+		if !f.EnrollAgent(agent.UUID, agent.RuntimePolicy, agent.MBPolicy) {
+			return fmt.Errorf("agent %s: already enrolled", agent.UUID)
+		}
+		if agent.Failure != nil {
+			f.FailAgent(agent.UUID, *agent.Failure)
+		}
+	}
+	for _, fault := range scenario.Faults {
+		f.InjectFault(fault)
+	}
+	return nil
+}
+
+func (f *Fake) checkPolicies(runtimePolicyName, mbPolicyName string) error {
+	if _, ok := f.RuntimePolicy(runtimePolicyName); runtimePolicyName != "" && !ok {
+		return fmt.Errorf("unknown runtime policy %q", runtimePolicyName)
+	}
+	if _, ok := f.MBPolicy(mbPolicyName); mbPolicyName != "" && !ok {
+		return fmt.Errorf("unknown measured boot policy %q", mbPolicyName)
+	}
+	return nil
+}
+
+// AgentSnapshot is the combined registrar and verifier view of one agent.
+type AgentSnapshot struct {
+	Registered       bool   `json:"registered"`
+	Enrolled         bool   `json:"enrolled"`
+	OperationalState *int   `json:"operational_state,omitempty"`
+	StateDescription string `json:"operational_state_description,omitempty"`
+	AttestationCount int    `json:"attestation_count"`
+	RuntimePolicy    string `json:"runtime_policy,omitempty"`
+	MBPolicy         string `json:"mb_policy,omitempty"`
+}
+
+// Snapshot is the state of a Fake, as returned by GET /state on the control API.
+type Snapshot struct {
+	Agents          map[string]AgentSnapshot `json:"agents"`
+	RuntimePolicies []string                 `json:"runtime_policies"`
+	MBPolicies      []string                 `json:"mb_policies"`
+	Faults          []Fault                  `json:"faults"`
+}
+
+// Snapshot returns a copy of the current state.
+func (f *Fake) Snapshot() Snapshot {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	snapshot := Snapshot{
+		Agents:          map[string]AgentSnapshot{},
+		RuntimePolicies: sortedKeys(f.runtimePolicies),
+		MBPolicies:      sortedKeys(f.mbPolicies),
+		Faults:          make([]Fault, 0, len(f.faults)),
+	}
+	for uuid := range f.registered {
+		snapshot.Agents[uuid] = AgentSnapshot{Registered: true}
+	}
+	for uuid, agent := range f.enrolled {
+		entry := snapshot.Agents[uuid]
+		state := agent.details.OperationalState
+		entry.Enrolled = true
+		entry.OperationalState = &state
+		entry.StateDescription = keylime.StateToString(state)
+		entry.AttestationCount = agent.details.AttestationCount
+		entry.RuntimePolicy, entry.MBPolicy = agent.runtimePolicy, agent.mbPolicy
+		snapshot.Agents[uuid] = entry
+	}
+	for _, fault := range f.faults {
+		snapshot.Faults = append(snapshot.Faults, *fault)
+	}
+	return snapshot
+}
+
+// ControlHandler serves an API for changing the fake while it runs:
+//
+//	GET    /state                  current Snapshot
+//	POST   /scenario               load a Scenario
+//	POST   /agents                 register an Agent
+//	POST   /agents/{uuid}/enroll   enroll with {"runtime_policy": ..., "mb_policy": ...}
+//	POST   /agents/{uuid}/fail     apply a Failure
+//	POST   /faults                 inject a Fault
+//	DELETE /faults                 clear all faults
+//	POST   /tick                   advance all agents by one polling round
+func (f *Fake) ControlHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /state", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, f.Snapshot())
+	})
+	mux.HandleFunc("POST /scenario", decodeThen(func(w http.ResponseWriter, _ *http.Request, scenario Scenario) {
+		if err := f.Load(scenario); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, f.Snapshot())
+	}))
+	mux.HandleFunc("POST /agents", decodeThen(func(w http.ResponseWriter, _ *http.Request, agent Agent) {
+		if agent.UUID == "" {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "uuid is required"})
+			return
+		}
+		f.RegisterAgent(agent)
+		writeJSON(w, http.StatusCreated, agent)
+	}))
+	mux.HandleFunc("POST /agents/{uuid}/enroll", decodeThen(func(w http.ResponseWriter, r *http.Request, req ScenarioAgent) {
+		uuid := r.PathValue("uuid")
+		if err := f.checkPolicies(req.RuntimePolicy, req.MBPolicy); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		if !f.EnrollAgent(uuid, req.RuntimePolicy, req.MBPolicy) {
+			writeJSON(w, http.StatusConflict, map[string]string{"error": "agent not registered or already enrolled"})
+			return
+		}
+		writeJSON(w, http.StatusOK, f.Snapshot().Agents[uuid])
+	}))
+	mux.HandleFunc("POST /agents/{uuid}/fail", decodeThen(func(w http.ResponseWriter, r *http.Request, failure Failure) {
+		uuid := r.PathValue("uuid")
+		if !f.FailAgent(uuid, failure) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "agent not enrolled"})
+			return
+		}
+		writeJSON(w, http.StatusOK, f.Snapshot().Agents[uuid])
+	}))
+	mux.HandleFunc("POST /faults", decodeThen(func(w http.ResponseWriter, _ *http.Request, fault Fault) {
+		f.InjectFault(fault)
+		writeJSON(w, http.StatusCreated, fault)
+	}))
+	mux.HandleFunc("DELETE /faults", func(w http.ResponseWriter, r *http.Request) {
+		f.ClearFaults()
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("POST /tick", func(w http.ResponseWriter, r *http.Request) {
+		f.Tick()
+		writeJSON(w, http.StatusOK, f.Snapshot())
+	})
+	return mux
+}
+
+// decodeThen decodes the JSON request body into T before calling handle.
+func decodeThen[T any](handle func(http.ResponseWriter, *http.Request, T)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body T
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON: " + err.Error()})
+				return
+			}
+		}
+		handle(w, r, body)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,128 @@
+package keylimetest
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	serviceVerifier  = "verifier"
+	serviceRegistrar = "registrar"
+)
+
+// Fault makes matching requests fail or slow down.
+type Fault struct {
+	// Service is "verifier" or "registrar"; empty matches both.
+	Service string `json:"service,omitempty"`
+	// Method is an HTTP method; empty matches any.
+	Method string `json:"method,omitempty"`
+	// Path is a prefix of the endpoint without the API version, e.g. "agents/" or "allowlists/prod".
+	// Empty matches any.
+	Path string `json:"path,omitempty"`
+	// Status is returned instead of the real response; zero passes the request on after Delay.
+	Status  int      `json:"status,omitempty"`
+	Message string   `json:"message,omitempty"`
+	Delay   Duration `json:"delay,omitempty"`
+	// Drop closes the connection without answering, like a crashed service.
+	Drop bool `json:"drop,omitempty"`
+	// Times limits how many requests the fault applies to; zero means until cleared.
+	Times int `json:"times,omitempty"`
+}
+
+// Duration is a time.Duration written as a string such as "500ms" in JSON.
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// InjectFault adds a fault. Faults are checked in the order they were added.
+func (f *Fake) InjectFault(fault Fault) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.faults = append(f.faults, &fault)
+}
+
+// ClearFaults removes all faults.
+func (f *Fake) ClearFaults() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.faults = nil
+}
+
+var versionPrefix = regexp.MustCompile(`^v\d+\.\d+/`)
+
+// takeFault returns the first fault matching the request and uses up one of its Times.
+func (f *Fake) takeFault(service string, r *http.Request) *Fault {
+	endpoint := versionPrefix.ReplaceAllString(strings.TrimPrefix(r.URL.Path, "/"), "")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, fault := range f.faults {
+		if fault.Service != "" && fault.Service != service ||
+			fault.Method != "" && !strings.EqualFold(fault.Method, r.Method) ||
+			!strings.HasPrefix(endpoint, fault.Path) {
+			continue
+		}
+		matched := *fault
+		if fault.Times > 0 {
+			fault.Times--
+			if fault.Times == 0 {
+				f.faults = append(f.faults[:i], f.faults[i+1:]...)
+			}
+		}
+		return &matched
+	}
+	return nil
+}
+
+func (f *Fake) withFaults(service string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fault := f.takeFault(service, r)
+		if fault == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if fault.Delay > 0 {
+			select {
+			case <-time.After(time.Duration(fault.Delay)):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		switch {
+		case fault.Drop:
+			if hj, ok := w.(http.Hijacker); ok {
+				if conn, _, err := hj.Hijack(); err == nil {
+					_ = conn.Close()
+					return
+				}
+			}
+			panic(http.ErrAbortHandler)
+		case fault.Status != 0:
+			message := fault.Message
+			if message == "" {
+				message = http.StatusText(fault.Status)
+			}
+			respondError(w, fault.Status, message)
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
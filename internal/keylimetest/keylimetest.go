@@ -0,0 +1,347 @@
+// Package keylimetest provides an in-memory Keylime verifier and registrar that speak
+// enough of the REST API for the MCP tools to run without a real Keylime installation.
+//
+// Agents move through the verifier's operational states as Tick is called: an enrolled
+// agent starts in StateStart, enters StateGetQuote on the next tick and is attested on
+// every tick after that until it fails, is stopped or is removed. Failures and HTTP
+// faults can be scripted up front or injected while the fake is running.
+//
+// In push mode the verifier also serves API version 3.0, keeps accept_attestations in the
+// agent records, and every tick records one attestation per enrolled agent, as if the agent
+// had pushed evidence.
+package keylimetest
+
+import (
+	"net/http/httptest"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/keylime/keylime-mcp/internal/keylime"
+)
+
+// DefaultVerifierID is reported as verifier_id of every enrolled agent unless Config overrides it.
+const DefaultVerifierID = "default"
+
+// Config adjusts the behavior of a Fake. The zero value is usable.
+type Config struct {
+	// APIVersions lists the API versions answered on /version, oldest first.
+	// Defaults to keylime.SupportedAPIVersions.
+	APIVersions []string
+	VerifierID  string
+	// Now replaces time.Now, e.g. to get stable attestation timestamps in tests.
+	Now func() time.Time
+	// PushMode simulates a verifier in the push model. Unless APIVersions is set,
+	// "3.0" is added to the default versions.
+	PushMode bool
+}
+
+// Agent is an agent known to the registrar.
+type Agent struct {
+	UUID     string `json:"uuid"`
+	IP       string `json:"ip,omitempty"`
+	Port     int    `json:"port,omitempty"`
+	AIK      string `json:"aik_tpm,omitempty"`
+	EK       string `json:"ek_tpm,omitempty"`
+	EKCert   string `json:"ekcert,omitempty"`
+	MTLSCert string `json:"mtls_cert,omitempty"`
+}
+
+// Failure makes an enrolled agent fail attestation.
+type Failure struct {
+	// State is the operational state the agent ends up in; defaults to keylime.StateFailed.
+	State         int    `json:"state,omitempty"`
+	SeverityLevel *int   `json:"severity_level,omitempty"`
+	EventID       string `json:"event_id,omitempty"`
+	// AfterTicks delays the failure by this many ticks; zero fails the agent immediately.
+	AfterTicks int `json:"after_ticks,omitempty"`
+}
+
+// verifierAgent is the verifier's record of an enrolled agent.
+type verifierAgent struct {
+	details       keylime.AgentDetails
+	runtimePolicy string // name of the runtime policy the agent is bound to
+	mbPolicy      string
+	pending       *Failure
+	removing      bool                  // deleted while being polled; removed on the next tick
+	attestations  []keylime.Attestation // pushed attestations, oldest first
+}
+
+type runtimePolicy struct {
+	policy    string // JSON document
+	tpmPolicy string
+}
+
+// Fake holds the state of one simulated Keylime cluster. It is safe for concurrent use.
+type Fake struct {
+	versions   []string
+	verifierID string
+	now        func() time.Time
+	pushMode   bool
+
+	mu              sync.Mutex
+	registered      map[string]*registrarAgent
+	enrolled        map[string]*verifierAgent
+	runtimePolicies map[string]runtimePolicy
+	mbPolicies      map[string]string
+	faults          []*Fault
+}
+
+// New returns an empty fake cluster.
+func New(config Config) *Fake {
+	f := &Fake{
+		versions:        config.APIVersions,
+		verifierID:      config.VerifierID,
+		now:             config.Now,
+		pushMode:        config.PushMode,
+		registered:      map[string]*registrarAgent{},
+		enrolled:        map[string]*verifierAgent{},
+		runtimePolicies: map[string]runtimePolicy{},
+		mbPolicies:      map[string]string{},
+	}
+	if len(f.versions) == 0 {
+		f.versions = keylime.SupportedAPIVersions
+		if f.pushMode {
+			f.versions = append(slices.Clone(f.versions), pushAPIVersion)
+		}
+	}
+	if f.verifierID == "" {
+		f.verifierID = DefaultVerifierID
+	}
+	if f.now == nil {
+		f.now = time.Now
+	}
+	return f
+}
+
+// Tick advances every enrolled agent by one polling round.
+func (f *Fake) Tick() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := int(f.now().Unix())
+	for uuid, agent := range f.enrolled {
+		if agent.removing {
+			delete(f.enrolled, uuid)
+			continue
+		}
+		if f.pushMode {
+			f.pushAttestation(agent)
+			continue
+		}
+		d := &agent.details
+		switch d.OperationalState {
+		case keylime.StateStart, keylime.StateSaved, keylime.StateGetQuoteRetry:
+			d.OperationalState = keylime.StateGetQuote
+		case keylime.StateGetQuote:
+			if agent.pending != nil && agent.pending.AfterTicks <= 0 {
+				applyFailure(d, *agent.pending, now)
+				agent.pending = nil
+				continue
+			}
+			if agent.pending != nil {
+				agent.pending.AfterTicks--
+			}
+			d.AttestationCount++
+			received := now
+			d.LastReceivedQuote = &received
+			d.LastSuccessfulAttestation = &received
+		}
+	}
+}
+
+// FailAgent makes an enrolled agent fail attestation, immediately or after failure.AfterTicks
+// successful attestations. It reports false if the agent is not enrolled.
+func (f *Fake) FailAgent(uuid string, failure Failure) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	agent, ok := f.enrolled[uuid]
+	if !ok {
+		return false
+	}
+	if failure.AfterTicks > 0 {
+		agent.pending = &failure
+		return true
+	}
+	if f.pushMode {
+		agent.pending = &failure
+		f.pushAttestation(agent)
+		return true
+	}
+	applyFailure(&agent.details, failure, int(f.now().Unix()))
+	agent.pending = nil
+	return true
+}
+
+func applyFailure(d *keylime.AgentDetails, failure Failure, now int) {
+	d.OperationalState = failure.State
+	if d.OperationalState == 0 {
+		d.OperationalState = keylime.StateFailed
+	}
+	d.SeverityLevel = failure.SeverityLevel
+	if failure.EventID != "" {
+		eventID := failure.EventID
+		d.LastEventID = &eventID
+	}
+	d.LastReceivedQuote = &now
+}
+
+// pushAttestation records an attestation of a push-mode agent. It fails when a failure is due.
+func (f *Fake) pushAttestation(agent *verifierAgent) {
+	now := f.now().UTC().Format(time.RFC3339)
+	attestation := keylime.Attestation{
+		Index:                   len(agent.attestations),
+		Stage:                   "verification_complete",
+		Evaluation:              keylime.EvaluationPass,
+		CapabilitiesReceivedAt:  now,
+		EvidenceReceivedAt:      now,
+		VerificationCompletedAt: now,
+	}
+	switch {
+	case agent.pending != nil && agent.pending.AfterTicks <= 0:
+		attestation.Evaluation = keylime.EvaluationFail
+		attestation.FailureReason = orDefault(agent.pending.EventID, "policy_violation")
+		agent.pending = nil
+	case agent.pending != nil:
+		agent.pending.AfterTicks--
+	}
+	agent.attestations = append(agent.attestations, attestation)
+	agent.details.AttestationCount++
+}
+
+// AgentState returns the operational state of an enrolled agent.
+func (f *Fake) AgentState(uuid string) (int, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	agent, ok := f.enrolled[uuid]
+	if !ok {
+		return 0, false
+	}
+	return agent.details.OperationalState, true
+}
+
+// RuntimePolicy returns a stored runtime policy document.
+func (f *Fake) RuntimePolicy(name string) (string, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	policy, ok := f.runtimePolicies[name]
+	return policy.policy, ok
+}
+
+// MBPolicy returns a stored measured boot policy document.
+func (f *Fake) MBPolicy(name string) (string, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	policy, ok := f.mbPolicies[name]
+	return policy, ok
+}
+
+// AddRuntimePolicy stores a runtime policy as if it had been uploaded to allowlists/{name}.
+func (f *Fake) AddRuntimePolicy(name, policy string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.runtimePolicies[name] = runtimePolicy{policy: policy}
+}
+
+// AddMBPolicy stores a measured boot policy as if it had been uploaded to mbpolicies/{name}.
+func (f *Fake) AddMBPolicy(name, policy string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.mbPolicies[name] = policy
+}
+
+// EnrollAgent enrolls a registered agent in the verifier with the named policies, as the
+// tenant would. It reports false if the agent is not registered or already enrolled.
+func (f *Fake) EnrollAgent(uuid, runtimePolicyName, mbPolicyName string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	reg, ok := f.registered[uuid]
+	if _, enrolled := f.enrolled[uuid]; !ok || enrolled {
+		return false
+	}
+	agent := f.newVerifierAgent(reg.IP, reg.Port)
+	agent.runtimePolicy, agent.mbPolicy = runtimePolicyName, mbPolicyName
+	if runtimePolicyName != "" {
+		agent.details.HasRuntimePolicy = 1
+	}
+	if mbPolicyName != "" {
+		agent.details.HasMbRefstate = 1
+	}
+	f.enrolled[uuid] = agent
+	return true
+}
+
+func (f *Fake) newVerifierAgent(ip string, port int) *verifierAgent {
+	agent := &verifierAgent{details: keylime.AgentDetails{
+		OperationalState:        keylime.StateStart,
+		IP:                      ip,
+		Port:                    port,
+		TPMPolicy:               "{}",
+		VTPMPolicy:              "{}",
+		MetaData:                "{}",
+		AcceptTPMHashAlgs:       []string{"sha256"},
+		AcceptTPMEncryptionAlgs: []string{"rsa"},
+		AcceptTPMSigningAlgs:    []string{"rsassa"},
+		HashAlg:                 "sha256",
+		EncAlg:                  "rsa",
+		SignAlg:                 "rsassa",
+		VerifierID:              f.verifierID,
+		VerifierIP:              "127.0.0.1",
+		VerifierPort:            8881,
+	}}
+	if f.pushMode {
+		accept := true
+		agent.details.AcceptAttestations = &accept
+	}
+	return agent
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Server runs a Fake on two local HTTP listeners, one for the verifier and one for the registrar.
+type Server struct {
+	*Fake
+	VerifierURL  string
+	RegistrarURL string
+
+	verifier  *httptest.Server
+	registrar *httptest.Server
+}
+
+// NewServer starts a verifier and a registrar backed by a new Fake. Call Close when done.
+func NewServer(config Config) *Server {
+	fake := New(config)
+	verifier := httptest.NewServer(fake.VerifierHandler())
+	registrar := httptest.NewServer(fake.RegistrarHandler())
+	return &Server{
+		Fake:         fake,
+		VerifierURL:  verifier.URL,
+		RegistrarURL: registrar.URL,
+		verifier:     verifier,
+		registrar:    registrar,
+	}
+}
+
+// Close shuts down both listeners.
+func (s *Server) Close() {
+	s.verifier.Close()
+	s.registrar.Close()
+}
+
+// KeylimeConfig returns a client configuration pointing at the server.
+func (s *Server) KeylimeConfig() *keylime.Config {
+	return &keylime.Config{
+		VerifierURL:  s.VerifierURL,
+		RegistrarURL: s.RegistrarURL,
+		TLSEnabled:   false,
+	}
+}
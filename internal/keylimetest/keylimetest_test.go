@@ -0,0 +1,311 @@
+package keylimetest
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/keylime/keylime-mcp/internal/keylime"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	agentA = "d432fbb3-d2f1-4a97-9ef7-75bd81c00000"
+	agentB = "d432fbb3-d2f1-4a97-9ef7-75bd81c11111"
+)
+
+func newTestServer(t *testing.T) (*Server, *keylime.Service) {
+	t.Helper()
+	server := NewServer(Config{Now: func() time.Time { return time.Unix(1700000000, 0) }})
+	t.Cleanup(server.Close)
+	svc, err := keylime.NewService(server.KeylimeConfig())
+	require.NoError(t, err)
+	return server, svc
+}
+
+// caller returns a function that reads the status and results of a response.
+func caller(t *testing.T) func(*http.Response, error) (int, map[string]any) {
+	return func(resp *http.Response, err error) (int, map[string]any) {
+		t.Helper()
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var body struct {
+			Results map[string]any `json:"results"`
+		}
+		data, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		if len(data) > 0 {
+			require.NoError(t, json.Unmarshal(data, &body))
+		}
+		return resp.StatusCode, body.Results
+	}
+}
+
+func TestAgentLifecycle(t *testing.T) {
+	server, svc := newTestServer(t)
+	call := caller(t)
+	ctx := context.Background()
+	server.RegisterAgent(Agent{UUID: agentA, IP: "10.0.0.5", AIK: "aik"})
+
+	body, err := svc.PrepareEnrollmentBody(ctx, agentA, "", "", keylime.EnrollmentOptions{})
+	require.NoError(t, err)
+	status, _ := call(svc.Verifier.Post(ctx, "agents/"+agentA, body))
+	require.Equal(t, http.StatusOK, status)
+	status, _ = call(svc.Verifier.Post(ctx, "agents/"+agentA, body))
+	assert.Equal(t, http.StatusConflict, status, "enrolling twice")
+
+	details, err := svc.FetchAgentDetails(ctx, agentA)
+	require.NoError(t, err)
+	assert.Equal(t, keylime.StateStart, details.Results.OperationalState)
+	assert.Equal(t, "10.0.0.5", details.Results.IP)
+
+	server.Tick()
+	server.Tick()
+	details, err = svc.FetchAgentDetails(ctx, agentA)
+	require.NoError(t, err)
+	assert.Equal(t, keylime.StateGetQuote, details.Results.OperationalState)
+	assert.Equal(t, 1, details.Results.AttestationCount)
+	assert.Equal(t, 1700000000, *details.Results.LastSuccessfulAttestation)
+
+	severity := 5
+	require.True(t, server.FailAgent(agentA, Failure{SeverityLevel: &severity, EventID: "ima.validation.ima-ng.not_in_allowlist"}))
+	details, err = svc.FetchAgentDetails(ctx, agentA)
+	require.NoError(t, err)
+	assert.Equal(t, keylime.StateFailed, details.Results.OperationalState)
+	assert.Equal(t, "ima.validation.ima-ng.not_in_allowlist", *details.Results.LastEventID)
+
+	status, _ = call(svc.Verifier.Put(ctx, "agents/"+agentA+"/reactivate", struct{}{}))
+	require.Equal(t, http.StatusOK, status)
+	server.Tick()
+	state, _ := server.AgentState(agentA)
+	assert.Equal(t, keylime.StateGetQuote, state)
+
+	status, _ = call(svc.Verifier.Delete(ctx, "agents/"+agentA))
+	assert.Equal(t, http.StatusAccepted, status, "polled agents are removed asynchronously")
+	state, _ = server.AgentState(agentA)
+	assert.Equal(t, keylime.StateTerminated, state)
+	server.Tick()
+	_, err = svc.FetchAgentDetails(ctx, agentA)
+	assert.True(t, keylime.IsNotFound(err))
+}
+
+func TestScheduledFailure(t *testing.T) {
+	server, _ := newTestServer(t)
+	server.RegisterAgent(Agent{UUID: agentA})
+	require.True(t, server.EnrollAgent(agentA, "", ""))
+	require.True(t, server.FailAgent(agentA, Failure{State: keylime.StateInvalidQuote, AfterTicks: 2}))
+
+	for range 3 {
+		server.Tick()
+		state, _ := server.AgentState(agentA)
+		assert.Equal(t, keylime.StateGetQuote, state)
+	}
+	server.Tick()
+	state, _ := server.AgentState(agentA)
+	assert.Equal(t, keylime.StateInvalidQuote, state)
+	assert.Equal(t, 2, server.Snapshot().Agents[agentA].AttestationCount)
+}
+
+func TestListings(t *testing.T) {
+	server, svc := newTestServer(t)
+	ctx := context.Background()
+	for _, uuid := range []string{agentB, agentA} {
+		server.RegisterAgent(Agent{UUID: uuid})
+		require.True(t, server.EnrollAgent(uuid, "", ""))
+	}
+
+	registered, err := svc.FetchAllAgentUUIDs(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{agentA, agentB}, registered)
+
+	bulk, err := svc.FetchAgentsBulk(ctx, DefaultVerifierID)
+	require.NoError(t, err)
+	assert.Len(t, bulk, 2)
+	bulk, err = svc.FetchAgentsBulk(ctx, "other")
+	require.NoError(t, err)
+	assert.Empty(t, bulk)
+}
+
+func TestPolicies(t *testing.T) {
+	server, svc := newTestServer(t)
+	call := caller(t)
+	ctx := context.Background()
+	policy := base64.StdEncoding.EncodeToString([]byte(`{"digests":{}}`))
+
+	status, _ := call(svc.Verifier.Post(ctx, "allowlists/prod", map[string]any{"runtime_policy": policy}))
+	require.Equal(t, http.StatusCreated, status)
+	status, _ = call(svc.Verifier.Post(ctx, "allowlists/prod", map[string]any{"runtime_policy": policy}))
+	assert.Equal(t, http.StatusConflict, status)
+	status, _ = call(svc.Verifier.Post(ctx, "allowlists/bad", map[string]any{"runtime_policy": "not base64"}))
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	status, results := call(svc.Verifier.Get(ctx, "allowlists/prod"))
+	require.Equal(t, http.StatusOK, status)
+	assert.JSONEq(t, `{"digests":{}}`, results["runtime_policy"].(string))
+	_, results = call(svc.Verifier.Get(ctx, "allowlists/"))
+	assert.Equal(t, []any{"prod"}, results["runtimepolicy names"])
+
+	status, _ = call(svc.Verifier.Post(ctx, "mbpolicies/boot", map[string]any{"mb_policy": `{"scrtm_and_bios":[]}`}))
+	require.Equal(t, http.StatusCreated, status)
+	_, results = call(svc.Verifier.Get(ctx, "mbpolicies/"))
+	assert.Equal(t, []any{"boot"}, results["mbpolicy names"])
+
+	server.RegisterAgent(Agent{UUID: agentA})
+	require.True(t, server.EnrollAgent(agentA, "prod", "boot"))
+	status, _ = call(svc.Verifier.Delete(ctx, "allowlists/prod"))
+	assert.Equal(t, http.StatusConflict, status, "policy in use")
+	status, _ = call(svc.Verifier.Delete(ctx, "mbpolicies/boot"))
+	assert.Equal(t, http.StatusConflict, status, "policy in use")
+
+	status, _ = call(svc.Verifier.Delete(ctx, "agents/"+agentA))
+	require.Equal(t, http.StatusOK, status, "agents not yet polled are removed at once")
+	status, _ = call(svc.Verifier.Delete(ctx, "allowlists/prod"))
+	assert.Equal(t, http.StatusNoContent, status)
+	status, _ = call(svc.Verifier.Get(ctx, "allowlists/prod"))
+	assert.Equal(t, http.StatusNotFound, status)
+}
+
+func TestInlineRuntimePolicyRemovedWithAgent(t *testing.T) {
+	server, svc := newTestServer(t)
+	call := caller(t)
+	ctx := context.Background()
+	server.AddRuntimePolicy("prod", `{"digests":{}}`)
+	server.RegisterAgent(Agent{UUID: agentA})
+
+	body, err := svc.PrepareEnrollmentBody(ctx, agentA, "prod", "", keylime.EnrollmentOptions{})
+	require.NoError(t, err)
+	status, _ := call(svc.Verifier.Post(ctx, "agents/"+agentA, body))
+	require.Equal(t, http.StatusOK, status)
+	_, ok := server.RuntimePolicy(agentA)
+	assert.True(t, ok, "inline policy stored under the agent UUID")
+
+	status, _ = call(svc.Verifier.Delete(ctx, "agents/"+agentA))
+	require.Equal(t, http.StatusOK, status)
+	_, ok = server.RuntimePolicy(agentA)
+	assert.False(t, ok)
+}
+
+func TestFaults(t *testing.T) {
+	t.Run("status limited by times", func(t *testing.T) {
+		server, svc := newTestServer(t)
+		server.InjectFault(Fault{Service: "registrar", Method: "GET", Path: "agents", Status: http.StatusServiceUnavailable, Times: 1})
+
+		_, err := svc.FetchAllAgentUUIDs(context.Background())
+		apiErr, ok := keylime.AsAPIError(err)
+		require.True(t, ok)
+		assert.Equal(t, http.StatusServiceUnavailable, apiErr.StatusCode)
+
+		_, err = svc.FetchAllAgentUUIDs(context.Background())
+		assert.NoError(t, err)
+	})
+
+	t.Run("service and path must match", func(t *testing.T) {
+		server, svc := newTestServer(t)
+		call := caller(t)
+		server.InjectFault(Fault{Service: "verifier", Path: "allowlists/", Status: http.StatusInternalServerError})
+
+		_, err := svc.FetchAllAgentUUIDs(context.Background())
+		assert.NoError(t, err)
+		status, _ := call(svc.Verifier.Get(context.Background(), "allowlists/"))
+		assert.Equal(t, http.StatusInternalServerError, status)
+
+		server.ClearFaults()
+		status, _ = call(svc.Verifier.Get(context.Background(), "allowlists/"))
+		assert.Equal(t, http.StatusOK, status)
+	})
+
+	t.Run("dropped connection", func(t *testing.T) {
+		server, svc := newTestServer(t)
+		server.InjectFault(Fault{Drop: true})
+
+		_, err := svc.Verifier.Get(context.Background(), "agents/")
+		require.Error(t, err)
+		_, ok := keylime.AsAPIError(err)
+		assert.False(t, ok, "a transport error, not an HTTP status")
+	})
+}
+
+func TestVersionNegotiation(t *testing.T) {
+	server := NewServer(Config{APIVersions: []string{"2.1", "2.2"}})
+	t.Cleanup(server.Close)
+	svc, err := keylime.NewService(server.KeylimeConfig())
+	require.NoError(t, err)
+
+	require.NoError(t, svc.NegotiateAPIVersions(context.Background()))
+	assert.Equal(t, "v2.2", svc.Verifier.APIVersion())
+
+	config := server.KeylimeConfig()
+	config.APIVersion = "v2.5"
+	pinned, err := keylime.NewService(config)
+	require.NoError(t, err)
+	_, err = pinned.FetchAllAgentUUIDs(context.Background())
+	assert.True(t, keylime.IsNotFound(err), "unsupported version in the URL")
+}
+
+func TestPushMode(t *testing.T) {
+	server := NewServer(Config{PushMode: true, Now: func() time.Time { return time.Unix(1700000000, 0) }})
+	t.Cleanup(server.Close)
+	svc, err := keylime.NewService(server.KeylimeConfig())
+	require.NoError(t, err)
+	ctx := context.Background()
+	server.RegisterAgent(Agent{UUID: agentA})
+	require.True(t, server.EnrollAgent(agentA, "", ""))
+
+	details, err := svc.FetchAgentDetails(ctx, agentA)
+	require.NoError(t, err)
+	assert.Equal(t, keylime.AttestationModePush, svc.AgentAttestationMode(details.Results))
+	server.Tick()
+	require.True(t, server.FailAgent(agentA, Failure{EventID: "ima_hash_mismatch"}))
+	server.Tick()
+
+	attestations, err := svc.FetchAttestations(ctx, agentA)
+	require.NoError(t, err)
+	require.Len(t, attestations, 3)
+	assert.Equal(t, keylime.EvaluationPass, attestations[0].Evaluation, "the agent recovers on its next attestation")
+	assert.Equal(t, keylime.EvaluationFail, attestations[1].Evaluation)
+	assert.Equal(t, "ima_hash_mismatch", attestations[1].FailureReason)
+	assert.Equal(t, "2023-11-14T22:13:20Z", attestations[1].VerificationCompletedAt)
+	state, _ := server.AgentState(agentA)
+	assert.Equal(t, keylime.StateStart, state, "push-mode agents are not polled")
+
+	_, err = svc.FetchAttestations(ctx, agentB)
+	assert.True(t, keylime.IsNotFound(err))
+}
+
+func TestControlHandler(t *testing.T) {
+	fake := New(Config{})
+	ts := httptest.NewServer(fake.ControlHandler())
+	t.Cleanup(ts.Close)
+
+	post := func(path, body string) int {
+		resp, err := http.Post(ts.URL+path, "application/json", bytes.NewBufferString(body))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, http.StatusOK, post("/scenario", `{
+		"runtime_policies": {"prod": {"digests": {}}},
+		"agents": [{"uuid": "`+agentA+`", "enroll": true, "runtime_policy": "prod"}, {"uuid": "`+agentB+`"}],
+		"faults": [{"service": "verifier", "path": "agents/", "delay": "10ms", "times": 1}]
+	}`))
+	assert.Equal(t, http.StatusBadRequest, post("/agents/"+agentB+"/enroll", `{"runtime_policy": "missing"}`))
+	assert.Equal(t, http.StatusOK, post("/agents/"+agentB+"/enroll", `{}`))
+	assert.Equal(t, http.StatusOK, post("/tick", ""))
+	assert.Equal(t, http.StatusOK, post("/agents/"+agentA+"/fail", `{"event_id": "pcr_validation"}`))
+	assert.Equal(t, http.StatusNotFound, post("/agents/00000000-0000-4000-8000-000000000009/fail", `{}`))
+
+	snapshot := fake.Snapshot()
+	assert.Equal(t, keylime.StateFailed, *snapshot.Agents[agentA].OperationalState)
+	assert.Equal(t, "prod", snapshot.Agents[agentA].RuntimePolicy)
+	assert.Equal(t, keylime.StateGetQuote, *snapshot.Agents[agentB].OperationalState)
+	require.Len(t, snapshot.Faults, 1)
+	assert.Equal(t, Duration(10*time.Millisecond), snapshot.Faults[0].Delay)
+}
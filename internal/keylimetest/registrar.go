@@ -0,0 +1,82 @@
+package keylimetest
+
+import (
+	"net/http"
+)
+
+// registrarAgent is the registrar's record of an agent.
+type registrarAgent struct {
+	Agent
+	regcount int
+}
+
+// RegisterAgent adds an agent to the registrar, as the agent does on startup. Registering
+// a known UUID again replaces its data and increments regcount.
+func (f *Fake) RegisterAgent(agent Agent) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if agent.IP == "" {
+		agent.IP = "127.0.0.1"
+	}
+	if agent.Port == 0 {
+		agent.Port = 9002
+	}
+	regcount := 1
+	if old, ok := f.registered[agent.UUID]; ok {
+		regcount = old.regcount + 1
+	}
+	f.registered[agent.UUID] = &registrarAgent{Agent: agent, regcount: regcount}
+}
+
+// RegistrarHandler serves the registrar REST API.
+func (f *Fake) RegistrarHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /version", f.handleVersion)
+	mux.HandleFunc("GET /{version}/agents", f.versioned(f.registrarListAgents))
+	mux.HandleFunc("GET /{version}/agents/{$}", f.versioned(f.registrarListAgents))
+	mux.HandleFunc("GET /{version}/agents/{uuid}", f.versioned(f.registrarGetAgent))
+	mux.HandleFunc("DELETE /{version}/agents/{uuid}", f.versioned(f.registrarDeleteAgent))
+	return f.withFaults(serviceRegistrar, mux)
+}
+
+func (f *Fake) registrarListAgents(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	uuids := sortedKeys(f.registered)
+	f.mu.Unlock()
+	respond(w, http.StatusOK, "Success", map[string]any{"uuids": uuids})
+}
+
+func (f *Fake) registrarGetAgent(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	agent, ok := f.registered[r.PathValue("uuid")]
+	var results map[string]any
+	if ok {
+		results = map[string]any{
+			"aik_tpm":   agent.AIK,
+			"ek_tpm":    agent.EK,
+			"ekcert":    agent.EKCert,
+			"mtls_cert": agent.MTLSCert,
+			"ip":        agent.IP,
+			"port":      agent.Port,
+			"regcount":  agent.regcount,
+		}
+	}
+	f.mu.Unlock()
+	if !ok {
+		respondError(w, http.StatusNotFound, "agent id not found")
+		return
+	}
+	respond(w, http.StatusOK, "Success", results)
+}
+
+func (f *Fake) registrarDeleteAgent(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	_, ok := f.registered[r.PathValue("uuid")]
+	delete(f.registered, r.PathValue("uuid"))
+	f.mu.Unlock()
+	if !ok {
+		respondError(w, http.StatusNotFound, "agent id not found")
+		return
+	}
+	respond(w, http.StatusOK, "Success", map[string]any{})
+}
@@ -0,0 +1,470 @@
+package keylimetest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/keylime/keylime-mcp/internal/keylime"
+)
+
+// enrollmentRequest is the body of POST agents/{uuid}, as sent by the tenant.
+type enrollmentRequest struct {
+	V                       string   `json:"v"` // base64 V half of the payload bootstrap key
+	CloudagentIP            string   `json:"cloudagent_ip"`
+	CloudagentPort          any      `json:"cloudagent_port"`
+	TPMPolicy               string   `json:"tpm_policy"`
+	RuntimePolicy           string   `json:"runtime_policy"` // base64
+	RuntimePolicyName       string   `json:"runtime_policy_name"`
+	MBPolicy                string   `json:"mb_policy"`
+	MBPolicyName            string   `json:"mb_policy_name"`
+	Metadata                string   `json:"metadata"`
+	AcceptTPMHashAlgs       []string `json:"accept_tpm_hash_algs"`
+	AcceptTPMEncryptionAlgs []string `json:"accept_tpm_encryption_algs"`
+	AcceptTPMSigningAlgs    []string `json:"accept_tpm_signing_algs"`
+}
+
+// VerifierHandler serves the verifier REST API.
+func (f *Fake) VerifierHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /version", f.handleVersion)
+	mux.HandleFunc("GET /{version}/agents/{$}", f.versioned(f.verifierListAgents))
+	mux.HandleFunc("GET /{version}/agents/{uuid}", f.versioned(f.verifierGetAgent))
+	mux.HandleFunc("POST /{version}/agents/{uuid}", f.versioned(f.verifierEnrollAgent))
+	mux.HandleFunc("DELETE /{version}/agents/{uuid}", f.versioned(f.verifierDeleteAgent))
+	mux.HandleFunc("PUT /{version}/agents/{uuid}/reactivate", f.versioned(f.verifierReactivateAgent))
+	mux.HandleFunc("PUT /{version}/agents/{uuid}/stop", f.versioned(f.verifierStopAgent))
+	mux.HandleFunc("GET /{version}/agents/{uuid}/attestations", f.versioned(f.listAttestations))
+
+	mux.HandleFunc("GET /{version}/allowlists/{$}", f.versioned(f.listRuntimePolicies))
+	mux.HandleFunc("GET /{version}/allowlists/{name}", f.versioned(f.getRuntimePolicy))
+	mux.HandleFunc("POST /{version}/allowlists/{name}", f.versioned(f.putRuntimePolicy(false)))
+	mux.HandleFunc("PUT /{version}/allowlists/{name}", f.versioned(f.putRuntimePolicy(true)))
+	mux.HandleFunc("DELETE /{version}/allowlists/{name}", f.versioned(f.deleteRuntimePolicy))
+
+	mux.HandleFunc("GET /{version}/mbpolicies/{$}", f.versioned(f.listMBPolicies))
+	mux.HandleFunc("GET /{version}/mbpolicies/{name}", f.versioned(f.getMBPolicy))
+	mux.HandleFunc("POST /{version}/mbpolicies/{name}", f.versioned(f.putMBPolicy(false)))
+	mux.HandleFunc("PUT /{version}/mbpolicies/{name}", f.versioned(f.putMBPolicy(true)))
+	mux.HandleFunc("DELETE /{version}/mbpolicies/{name}", f.versioned(f.deleteMBPolicy))
+	return f.withFaults(serviceVerifier, mux)
+}
+
+func (f *Fake) verifierListAgents(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.URL.Query().Get("bulk") == "" {
+		uuids := make([][]string, 0, len(f.enrolled))
+		for _, uuid := range sortedKeys(f.enrolled) {
+			uuids = append(uuids, []string{uuid})
+		}
+		respond(w, http.StatusOK, "Success", map[string]any{"uuids": uuids})
+		return
+	}
+	verifierID := r.URL.Query().Get("verifier")
+	results := map[string]keylime.AgentDetails{}
+	for uuid, agent := range f.enrolled {
+		if verifierID == "" || agent.details.VerifierID == verifierID {
+			results[uuid] = agent.details
+		}
+	}
+	respond(w, http.StatusOK, "Success", results)
+}
+
+func (f *Fake) verifierGetAgent(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	agent, ok := f.enrolled[r.PathValue("uuid")]
+	if !ok {
+		respondError(w, http.StatusNotFound, "agent id not found")
+		return
+	}
+	respond(w, http.StatusOK, "Success", agent.details)
+}
+
+//nolint:gocyclo // one check per enrollment field, in the order the verifier applies them
+func (f *Fake) verifierEnrollAgent(w http.ResponseWriter, r *http.Request) {
+	uuid := r.PathValue("uuid")
+	var req enrollmentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid JSON in request body")
+		return
+	}
+	port, ok := parsePort(req.CloudagentPort)
+	if req.CloudagentIP == "" || !ok {
+		respondError(w, http.StatusBadRequest, "cloudagent_ip and cloudagent_port are required")
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.enrolled[uuid]; ok {
+		respondError(w, http.StatusConflict, fmt.Sprintf("Agent of uuid %s already exists", uuid))
+		return
+	}
+
+	if v, err := base64.StdEncoding.DecodeString(req.V); err != nil || (req.V != "" && len(v) != 32) {
+		respondError(w, http.StatusBadRequest, "v must be a base64-encoded 32-byte key")
+		return
+	}
+
+	agent := f.newVerifierAgent(req.CloudagentIP, port)
+	switch {
+	case req.RuntimePolicy != "":
+		decoded, err := base64.StdEncoding.DecodeString(req.RuntimePolicy)
+		if err != nil || !json.Valid(decoded) {
+			respondError(w, http.StatusBadRequest, "runtime_policy is not valid base64-encoded JSON")
+			return
+		}
+		// an inline policy is stored under the agent's UUID unless it is named
+		name := req.RuntimePolicyName
+		if name == "" {
+			name = uuid
+		}
+		if _, exists := f.runtimePolicies[name]; exists {
+			respondError(w, http.StatusConflict, fmt.Sprintf("IMA policy with name %s already exists", name))
+			return
+		}
+		f.runtimePolicies[name] = runtimePolicy{policy: string(decoded), tpmPolicy: req.TPMPolicy}
+		agent.runtimePolicy = name
+	case req.RuntimePolicyName != "":
+		if _, exists := f.runtimePolicies[req.RuntimePolicyName]; !exists {
+			respondError(w, http.StatusNotFound, fmt.Sprintf("IMA policy %s not found", req.RuntimePolicyName))
+			return
+		}
+		agent.runtimePolicy = req.RuntimePolicyName
+	}
+	switch {
+	case req.MBPolicy != "":
+		if !json.Valid([]byte(req.MBPolicy)) {
+			respondError(w, http.StatusBadRequest, "mb_policy is not valid JSON")
+			return
+		}
+		// like the runtime policy, an inline policy is stored under the agent's UUID unless it is named
+		name := req.MBPolicyName
+		if name == "" {
+			name = uuid
+		}
+		if _, exists := f.mbPolicies[name]; exists {
+			respondError(w, http.StatusConflict, fmt.Sprintf("mb_policy with name %s already exists", name))
+			return
+		}
+		f.mbPolicies[name] = req.MBPolicy
+		agent.mbPolicy = name
+	case req.MBPolicyName != "":
+		if _, exists := f.mbPolicies[req.MBPolicyName]; !exists {
+			respondError(w, http.StatusNotFound, fmt.Sprintf("mb_policy %s not found", req.MBPolicyName))
+			return
+		}
+		agent.mbPolicy = req.MBPolicyName
+	}
+
+	d := &agent.details
+	if agent.runtimePolicy != "" {
+		d.HasRuntimePolicy = 1
+	}
+	if agent.mbPolicy != "" {
+		d.HasMbRefstate = 1
+	}
+	d.V = req.V
+	d.TPMPolicy = orDefault(req.TPMPolicy, d.TPMPolicy)
+	d.MetaData = orDefault(req.Metadata, d.MetaData)
+	if len(req.AcceptTPMHashAlgs) > 0 {
+		d.AcceptTPMHashAlgs = req.AcceptTPMHashAlgs
+		d.HashAlg = req.AcceptTPMHashAlgs[0]
+	}
+	if len(req.AcceptTPMEncryptionAlgs) > 0 {
+		d.AcceptTPMEncryptionAlgs = req.AcceptTPMEncryptionAlgs
+		d.EncAlg = req.AcceptTPMEncryptionAlgs[0]
+	}
+	if len(req.AcceptTPMSigningAlgs) > 0 {
+		d.AcceptTPMSigningAlgs = req.AcceptTPMSigningAlgs
+		d.SignAlg = req.AcceptTPMSigningAlgs[0]
+	}
+	f.enrolled[uuid] = agent
+	respond(w, http.StatusOK, "Success", map[string]any{})
+}
+
+// verifierDeleteAgent removes an agent. Like the real verifier, an agent that is being
+// polled is only marked as terminated and answered with 202; it disappears on the next tick.
+func (f *Fake) verifierDeleteAgent(w http.ResponseWriter, r *http.Request) {
+	uuid := r.PathValue("uuid")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	agent, ok := f.enrolled[uuid]
+	if !ok || agent.removing {
+		respondError(w, http.StatusNotFound, "agent id not found")
+		return
+	}
+	if agent.runtimePolicy == uuid {
+		delete(f.runtimePolicies, uuid)
+	}
+	if agent.mbPolicy == uuid {
+		delete(f.mbPolicies, uuid)
+	}
+	switch agent.details.OperationalState {
+	case keylime.StateGetQuote, keylime.StateGetQuoteRetry, keylime.StateProvideV, keylime.StateProvideVRetry:
+		agent.removing = true
+		agent.details.OperationalState = keylime.StateTerminated
+		respond(w, http.StatusAccepted, "Accepted", map[string]any{})
+	default:
+		delete(f.enrolled, uuid)
+		respond(w, http.StatusOK, "Success", map[string]any{})
+	}
+}
+
+func (f *Fake) verifierReactivateAgent(w http.ResponseWriter, r *http.Request) {
+	f.setAgentState(w, r.PathValue("uuid"), keylime.StateStart)
+}
+
+func (f *Fake) verifierStopAgent(w http.ResponseWriter, r *http.Request) {
+	f.setAgentState(w, r.PathValue("uuid"), keylime.StateTenantFailed)
+}
+
+// pushAPIVersion is the API version that serves attestation resources in push mode.
+const pushAPIVersion = "3.0"
+
+// listAttestations serves the JSON:API attestation list of a push-mode agent.
+func (f *Fake) listAttestations(w http.ResponseWriter, r *http.Request) {
+	if !f.pushMode || r.PathValue("version") != "v"+pushAPIVersion {
+		respondError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	f.mu.Lock()
+	agent, ok := f.enrolled[r.PathValue("uuid")]
+	data := []map[string]any{}
+	if ok {
+		for _, attestation := range agent.attestations {
+			data = append(data, map[string]any{
+				"type":       "attestation",
+				"id":         fmt.Sprint(attestation.Index),
+				"attributes": attestation,
+			})
+		}
+	}
+	f.mu.Unlock()
+	if !ok {
+		respondError(w, http.StatusNotFound, "agent id not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": data})
+}
+
+func (f *Fake) setAgentState(w http.ResponseWriter, uuid string, state int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	agent, ok := f.enrolled[uuid]
+	if !ok || agent.removing {
+		respondError(w, http.StatusNotFound, "agent id not found")
+		return
+	}
+	agent.details.OperationalState = state
+	agent.pending = nil
+	respond(w, http.StatusOK, "Success", map[string]any{})
+}
+
+func (f *Fake) listRuntimePolicies(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	names := sortedKeys(f.runtimePolicies)
+	f.mu.Unlock()
+	respond(w, http.StatusOK, "Success", map[string]any{"runtimepolicy names": names})
+}
+
+func (f *Fake) getRuntimePolicy(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	f.mu.Lock()
+	policy, ok := f.runtimePolicies[name]
+	f.mu.Unlock()
+	if !ok {
+		respondError(w, http.StatusNotFound, fmt.Sprintf("Runtime policy %s not found", name))
+		return
+	}
+	respond(w, http.StatusOK, "Success", map[string]any{
+		"name":           name,
+		"tpm_policy":     policy.tpmPolicy,
+		"runtime_policy": policy.policy,
+	})
+}
+
+func (f *Fake) putRuntimePolicy(update bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		var req struct {
+			RuntimePolicy string `json:"runtime_policy"`
+			TPMPolicy     string `json:"tpm_policy"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid JSON in request body")
+			return
+		}
+		decoded, err := base64.StdEncoding.DecodeString(req.RuntimePolicy)
+		if err != nil || (len(decoded) > 0 && !json.Valid(decoded)) {
+			respondError(w, http.StatusBadRequest, "runtime_policy is not valid base64-encoded JSON")
+			return
+		}
+
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		_, exists := f.runtimePolicies[name]
+		if status, msg := checkExists(update, exists, "Runtime policy", name); status != 0 {
+			respondError(w, status, msg)
+			return
+		}
+		f.runtimePolicies[name] = runtimePolicy{policy: string(decoded), tpmPolicy: req.TPMPolicy}
+		respond(w, http.StatusCreated, "Created", map[string]any{})
+	}
+}
+
+func (f *Fake) deleteRuntimePolicy(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.runtimePolicies[name]; !ok {
+		respondError(w, http.StatusNotFound, fmt.Sprintf("Runtime policy %s not found", name))
+		return
+	}
+	if user := f.policyUser(func(a *verifierAgent) bool { return a.runtimePolicy == name }); user != "" {
+		respondError(w, http.StatusConflict, fmt.Sprintf("Can't delete runtime policy as it's currently in use by agent %s", user))
+		return
+	}
+	delete(f.runtimePolicies, name)
+	respond(w, http.StatusNoContent, "Deleted", map[string]any{})
+}
+
+func (f *Fake) listMBPolicies(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	names := sortedKeys(f.mbPolicies)
+	f.mu.Unlock()
+	respond(w, http.StatusOK, "Success", map[string]any{"mbpolicy names": names})
+}
+
+func (f *Fake) getMBPolicy(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	f.mu.Lock()
+	policy, ok := f.mbPolicies[name]
+	f.mu.Unlock()
+	if !ok {
+		respondError(w, http.StatusNotFound, fmt.Sprintf("Measured boot policy %s not found", name))
+		return
+	}
+	respond(w, http.StatusOK, "Success", map[string]any{"name": name, "mb_policy": policy})
+}
+
+func (f *Fake) putMBPolicy(update bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		var req struct {
+			MBPolicy string `json:"mb_policy"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid JSON in request body")
+			return
+		}
+		if req.MBPolicy != "" && !json.Valid([]byte(req.MBPolicy)) {
+			respondError(w, http.StatusBadRequest, "mb_policy is not valid JSON")
+			return
+		}
+
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		_, exists := f.mbPolicies[name]
+		if status, msg := checkExists(update, exists, "Measured boot policy", name); status != 0 {
+			respondError(w, status, msg)
+			return
+		}
+		f.mbPolicies[name] = req.MBPolicy
+		respond(w, http.StatusCreated, "Created", map[string]any{})
+	}
+}
+
+func (f *Fake) deleteMBPolicy(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.mbPolicies[name]; !ok {
+		respondError(w, http.StatusNotFound, fmt.Sprintf("Measured boot policy %s not found", name))
+		return
+	}
+	if user := f.policyUser(func(a *verifierAgent) bool { return a.mbPolicy == name }); user != "" {
+		respondError(w, http.StatusConflict, fmt.Sprintf("Can't delete mb_policy as it's currently in use by agent %s", user))
+		return
+	}
+	delete(f.mbPolicies, name)
+	respond(w, http.StatusNoContent, "Deleted", map[string]any{})
+}
+
+// policyUser returns the first enrolled agent matching uses. f.mu must be held.
+func (f *Fake) policyUser(uses func(*verifierAgent) bool) string {
+	for _, uuid := range sortedKeys(f.enrolled) {
+		if uses(f.enrolled[uuid]) {
+			return uuid
+		}
+	}
+	return ""
+}
+
+// checkExists returns the error status for creating an existing or updating a missing policy.
+func checkExists(update, exists bool, kind, name string) (int, string) {
+	switch {
+	case update && !exists:
+		return http.StatusNotFound, fmt.Sprintf("%s %s not found", kind, name)
+	case !update && exists:
+		return http.StatusConflict, fmt.Sprintf("%s with name %s already exists", kind, name)
+	}
+	return 0, ""
+}
+
+func (f *Fake) handleVersion(w http.ResponseWriter, r *http.Request) {
+	respond(w, http.StatusOK, "Success", map[string]any{
+		"current_version":    f.versions[len(f.versions)-1],
+		"supported_versions": f.versions,
+	})
+}
+
+// versioned rejects requests for API versions the fake does not serve.
+func (f *Fake) versioned(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		version := r.PathValue("version")
+		if !slices.Contains(f.versions, strings.TrimPrefix(version, "v")) {
+			respondError(w, http.StatusNotFound, fmt.Sprintf("API version %s not supported", version))
+			return
+		}
+		next(w, r)
+	}
+}
+
+func respond(w http.ResponseWriter, code int, status string, results any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if code == http.StatusNoContent {
+		return
+	}
+	_ = json.NewEncoder(w).Encode(map[string]any{"code": code, "status": status, "results": results})
+}
+
+func respondError(w http.ResponseWriter, code int, status string) {
+	respond(w, code, status, map[string]any{})
+}
+
+func parsePort(v any) (int, bool) {
+	switch port := v.(type) {
+	case float64:
+		return int(port), port > 0
+	case string:
+		var n int
+		_, err := fmt.Sscanf(port, "%d", &n)
+		return n, err == nil && n > 0
+	}
+	return 0, false
+}
+
+func orDefault(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
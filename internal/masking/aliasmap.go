@@ -8,6 +8,7 @@ import (
 type AliasMap struct {
 	mu      sync.RWMutex
 	prefix  string
+	format  func(real string, n int) string // builds the n-th alias; nil means "PREFIX-n"
 	counter int
 	forward map[string]string
 	inverse map[string]string
@@ -21,6 +22,13 @@ func NewAliasMap(prefix string) *AliasMap {
 	}
 }
 
+// newFormatAliasMap returns an AliasMap whose aliases are built by format.
+func newFormatAliasMap(format func(real string, n int) string) *AliasMap {
+	m := NewAliasMap("")
+	m.format = format
+	return m
+}
+
 func (m *AliasMap) GetOrCreate(real string) string {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -29,6 +37,9 @@ func (m *AliasMap) GetOrCreate(real string) string {
 	}
 	m.counter++
 	alias := fmt.Sprintf("%s-%d", m.prefix, m.counter)
+	if m.format != nil {
+		alias = m.format(real, m.counter)
+	}
 	m.forward[real] = alias
 	m.inverse[alias] = real
 	return alias
@@ -1,8 +1,12 @@
 package masking
 
 import (
+	"encoding/base64"
+	"fmt"
 	"net"
+	"net/http"
 	"regexp"
+	"strings"
 )
 
 var (
@@ -12,10 +16,22 @@ var (
 	hashRE   = regexp.MustCompile(`\b[0-9a-fA-F]{128}\b|\b[0-9a-fA-F]{96}\b|\b[0-9a-fA-F]{64}\b|\b[0-9a-fA-F]{40}\b`)
 	tpmKeyRE = regexp.MustCompile(`("(?:aik_tpm|ek_tpm|ekcert|mtls_cert)"\s*:\s*")([^"]*)"`)
 	aliasRE  = regexp.MustCompile(`\b(AGENT|HOST|HASH|TPM)-\d+\b`)
+
+	// secretKeyRE also covers the key material sent to the verifier on enrollment
+	secretKeyRE = regexp.MustCompile(`("(?:aik_tpm|ak_tpm|ek_tpm|ekcert|mtls_cert|revocation_key|runtime_policy_key|ima_sign_verification_keys)"\s*:\s*")([^"]+)"`)
+
+	// bootstrapKeyRE matches the V, U and K key shares. The field names are too short to
+	// redact everywhere, so they are only redacted in bodies of keyPathRE requests.
+	bootstrapKeyRE = regexp.MustCompile(`("(?:v|u|k)"\s*:\s*")([^"]+)"`)
+	keyPathRE      = regexp.MustCompile(`^/v[0-9.]+/(?:agents/[^/?]+|keys/[uv]key)(?:\?|$)`)
+
+	// runtimePolicyRE matches the base64 runtime policy uploaded to allowlists/ or sent on enrollment
+	runtimePolicyRE = regexp.MustCompile(`("runtime_policy"\s*:\s*")([A-Za-z0-9+/=]+)"`)
 )
 
 type Engine struct {
 	enabled bool
+	keyRE   *regexp.Regexp
 	agents  *AliasMap
 	hosts   *AliasMap
 	hashes  *AliasMap
@@ -25,6 +41,7 @@ type Engine struct {
 func NewEngine(enabled bool) *Engine {
 	return &Engine{
 		enabled: enabled,
+		keyRE:   tpmKeyRE,
 		agents:  NewAliasMap("AGENT"),
 		hosts:   NewAliasMap("HOST"),
 		hashes:  NewAliasMap("HASH"),
@@ -32,6 +49,32 @@ func NewEngine(enabled bool) *Engine {
 	}
 }
 
+// NewRedactor returns an engine for data written to disk, such as recorded Keylime traffic.
+// Its aliases keep the shape of the original values (UUIDs stay UUIDs, IPs stay IPs, hashes
+// keep their length) so redacted requests are still accepted by the tools, and it also
+// redacts enrollment key material. Redactor aliases cannot be unmasked.
+func NewRedactor() *Engine {
+	return &Engine{
+		enabled: true,
+		keyRE:   secretKeyRE,
+		agents: newFormatAliasMap(func(_ string, n int) string {
+			return fmt.Sprintf("00000000-0000-4000-8000-%012x", n)
+		}),
+		hosts: newFormatAliasMap(func(real string, n int) string {
+			if strings.Contains(real, ":") {
+				return fmt.Sprintf("2001:db8::%x", n)
+			}
+			return fmt.Sprintf("198.18.%d.%d", n/256%256, n%256) // benchmarking range, RFC 2544
+		}),
+		hashes: newFormatAliasMap(func(real string, n int) string {
+			return fmt.Sprintf("%0*x", len(real), n)
+		}),
+		tpmKeys: newFormatAliasMap(func(_ string, n int) string {
+			return fmt.Sprintf("REDACTED-%d", n)
+		}),
+	}
+}
+
 func (e *Engine) Enabled() bool {
 	return e.enabled
 }
@@ -41,8 +84,8 @@ func (e *Engine) Mask(text string) string {
 		return text
 	}
 
-	text = tpmKeyRE.ReplaceAllStringFunc(text, func(match string) string {
-		parts := tpmKeyRE.FindStringSubmatch(match)
+	text = e.keyRE.ReplaceAllStringFunc(text, func(match string) string {
+		parts := e.keyRE.FindStringSubmatch(match)
 		if len(parts) == 3 {
 			return parts[1] + e.tpmKeys.GetOrCreate(parts[2]) + `"`
 		}
@@ -69,6 +112,34 @@ func (e *Engine) Mask(text string) string {
 	return text
 }
 
+// MaskRequest masks the body of a request to method and path, e.g. "/v2.5/agents/{uuid}".
+// Besides everything Mask covers, it redacts the key shares of an enrollment or key delivery,
+// and masks a base64 runtime policy after decoding it: encoded, its digests and paths would
+// be written as they are.
+func (e *Engine) MaskRequest(method, path, body string) string {
+	if !e.enabled {
+		return body
+	}
+
+	if method == http.MethodPost && keyPathRE.MatchString(path) {
+		body = bootstrapKeyRE.ReplaceAllStringFunc(body, func(match string) string {
+			parts := bootstrapKeyRE.FindStringSubmatch(match)
+			return parts[1] + e.tpmKeys.GetOrCreate(parts[2]) + `"`
+		})
+	}
+
+	body = runtimePolicyRE.ReplaceAllStringFunc(body, func(match string) string {
+		parts := runtimePolicyRE.FindStringSubmatch(match)
+		policy, err := base64.StdEncoding.DecodeString(parts[2])
+		if err != nil {
+			return match // not base64; masked as text below
+		}
+		return parts[1] + base64.StdEncoding.EncodeToString([]byte(e.Mask(string(policy)))) + `"`
+	})
+
+	return e.Mask(body)
+}
+
 func (e *Engine) Unmask(text string) string {
 	if !e.enabled {
 		return text
@@ -1,6 +1,7 @@
 package masking
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"strings"
 	"testing"
@@ -357,3 +358,67 @@ func TestMaskIMALogLine(t *testing.T) {
 	assert.Contains(t, masked, "ima-ng")
 	assert.Contains(t, masked, "sha256:")
 }
+
+func TestRedactorKeepsFormat(t *testing.T) {
+	e := NewRedactor()
+
+	text := `{"uuid":"` + testUUID + `","ip":"192.168.1.100","ip6":"fe80::1","digest":"` + testSHA256 + `"}`
+	redacted := e.Mask(text)
+
+	assert.NotContains(t, redacted, testUUID)
+	assert.NotContains(t, redacted, "192.168.1.100")
+	assert.NotContains(t, redacted, "fe80::1")
+	assert.NotContains(t, redacted, testSHA256)
+	assert.Contains(t, redacted, `"uuid":"00000000-0000-4000-8000-000000000001"`)
+	assert.Contains(t, redacted, `"ip":"198.18.0.1"`)
+	assert.Contains(t, redacted, `"ip6":"2001:db8::2"`, "hosts share one counter")
+	assert.Contains(t, redacted, `"digest":"`+strings.Repeat("0", 63)+`1"`)
+	assert.Equal(t, redacted, e.Mask(text), "redaction is deterministic")
+}
+
+func TestRedactorEnrollmentSecrets(t *testing.T) {
+	e := NewRedactor()
+
+	text := `{"v":"c2VjcmV0LXYta2V5","ak_tpm":"test-ak","mtls_cert":"-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----","revocation_key":"","metadata":"{}"}`
+	redacted := e.MaskRequest("POST", "/v2.5/agents/"+testUUID, text)
+
+	assert.NotContains(t, redacted, "c2VjcmV0LXYta2V5")
+	assert.NotContains(t, redacted, "test-ak")
+	assert.NotContains(t, redacted, "BEGIN CERTIFICATE")
+	assert.Contains(t, redacted, `"v":"REDACTED-1"`)
+	assert.Contains(t, redacted, `"revocation_key":""`, "empty values stay empty")
+	assert.Contains(t, redacted, `"metadata":"{}"`)
+}
+
+func TestRedactorKeySharesOnlyInKeyRequests(t *testing.T) {
+	e := NewRedactor()
+
+	assert.Equal(t, `{"u":"REDACTED-1","k":"REDACTED-2"}`, e.MaskRequest("POST", "/v2.5/keys/ukey", `{"u":"dS1rZXk=","k":"ay1rZXk="}`))
+	assert.Equal(t, `{"v":"REDACTED-3"}`, e.MaskRequest("POST", "/v2.5/keys/vkey?x=1", `{"v":"di1rZXk="}`))
+
+	other := `{"v":"1.0","u":"user","k":"kind"}`
+	assert.Equal(t, other, e.Mask(other), "responses keep short field names")
+	assert.Equal(t, other, e.MaskRequest("PUT", "/v2.5/agents/"+testUUID+"/reactivate", other))
+	assert.Equal(t, other, e.MaskRequest("POST", "/v2.5/allowlists/"+testUUID, other))
+}
+
+func TestRedactorRuntimePolicy(t *testing.T) {
+	e := NewRedactor()
+
+	policy := `{"digests":{"/usr/bin/test":["` + testSHA256 + `"]},"excludes":["/tmp/` + testUUID + `"]}`
+	body := `{"runtime_policy":"` + base64.StdEncoding.EncodeToString([]byte(policy)) + `","runtime_policy_key":""}`
+	redacted := e.MaskRequest("POST", "/v2.5/allowlists/prod", body)
+
+	var out struct {
+		RuntimePolicy string `json:"runtime_policy"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(redacted), &out))
+	decoded, err := base64.StdEncoding.DecodeString(out.RuntimePolicy)
+	require.NoError(t, err)
+	assert.NotContains(t, string(decoded), testSHA256)
+	assert.NotContains(t, string(decoded), testUUID)
+	assert.Contains(t, string(decoded), `"/usr/bin/test":["`+strings.Repeat("0", 63)+`1"]`)
+
+	plain := `{"runtime_policy":"not base64!"}`
+	assert.Equal(t, plain, e.MaskRequest("POST", "/v2.5/allowlists/prod", plain))
+}
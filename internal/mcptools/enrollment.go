@@ -0,0 +1,263 @@
+package mcptools
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/keylime/keylime-mcp/internal/keylime"
+)
+
+const (
+	maxMetadataSize = 16 * 1024
+	maxPayloadSize  = 50 * 1024 * 1024 // 50 MB
+)
+
+var (
+	tpmHashAlgs = []string{"sha1", "sha256", "sha384", "sha512", "sm3_256"}
+	tpmEncAlgs  = []string{"rsa", "ecc"}
+	// tpmSignAlgs maps each signing algorithm to the encryption algorithm of its key.
+	tpmSignAlgs = map[string]string{
+		"rsassa": "rsa", "rsapss": "rsa",
+		"ecdsa": "ecc", "ecdaa": "ecc", "ecschnorr": "ecc", "sm2": "ecc",
+	}
+	// pcrDigestLengths are the hex lengths of PCR values for the supported hash algorithms.
+	pcrDigestLengths = []int{40, 64, 96, 128}
+
+	hexRE      = regexp.MustCompile(`^[0-9a-fA-F]+$`)
+	hostnameRE = regexp.MustCompile(`^([a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?\.)*[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?$`)
+)
+
+// validateEnrollment checks all enrollment input before anything is sent to Keylime.
+func validateEnrollment(agentUUID, runtimePolicyName, mbPolicyName string, opts keylime.EnrollmentOptions) error {
+	if err := validateAgentUUID(agentUUID); err != nil {
+		return err
+	}
+	if runtimePolicyName != "" {
+		if err := validatePolicyName(runtimePolicyName); err != nil {
+			return fmt.Errorf("runtime_policy_name: %w", err)
+		}
+	}
+	if mbPolicyName != "" {
+		if err := validatePolicyName(mbPolicyName); err != nil {
+			return fmt.Errorf("mb_policy_name: %w", err)
+		}
+	}
+	if err := validatePCRs(opts.PCRs); err != nil {
+		return err
+	}
+	if err := validateExpectedPCRValues(opts.ExpectedPCRValues, runtimePolicyName != "", mbPolicyName != ""); err != nil {
+		return err
+	}
+	if err := validateTPMAlgorithms(opts); err != nil {
+		return err
+	}
+	if err := validateMetadata(opts.Metadata); err != nil {
+		return err
+	}
+	if err := validateIMAKeys(opts.IMASignVerificationKeys); err != nil {
+		return err
+	}
+	return validateCloudAgentAddress(opts.CloudAgentIP, opts.CloudAgentPort)
+}
+
+func validatePCRs(pcrs []int) error {
+	for _, pcr := range pcrs {
+		if pcr < 0 || pcr > keylime.MaxPCR {
+			return invalidf("pcrs: %d is not a PCR index (0-%d)", pcr, keylime.MaxPCR)
+		}
+	}
+	return nil
+}
+
+// validateExpectedPCRValues rejects malformed values and values for PCRs that a given policy
+// already attests: Keylime computes those itself and static values would never match.
+func validateExpectedPCRValues(values map[string][]string, hasRuntimePolicy, hasMBPolicy bool) error {
+	for index, digests := range values {
+		pcr, err := strconv.Atoi(index)
+		if err != nil || pcr < 0 || pcr > keylime.MaxPCR {
+			return invalidf("expected_pcr_values: %q is not a PCR index (0-%d)", index, keylime.MaxPCR)
+		}
+		if pcr == keylime.IMAPCR && hasRuntimePolicy {
+			return invalidf("expected_pcr_values: PCR %d is attested by the runtime policy", pcr)
+		}
+		if hasMBPolicy && slices.Contains(keylime.MeasuredBootPCRs, pcr) {
+			return invalidf("expected_pcr_values: PCR %d is attested by the measured boot policy", pcr)
+		}
+		if len(digests) == 0 {
+			return invalidf("expected_pcr_values: PCR %d has no values", pcr)
+		}
+		for _, digest := range digests {
+			if !hexRE.MatchString(digest) || !slices.Contains(pcrDigestLengths, len(digest)) {
+				return invalidf("expected_pcr_values: PCR %d value %q must be a hex SHA-1/256/384/512 digest", pcr, digest)
+			}
+		}
+	}
+	return nil
+}
+
+func validateTPMAlgorithms(opts keylime.EnrollmentOptions) error {
+	for _, alg := range opts.AcceptTPMHashAlgs {
+		if !slices.Contains(tpmHashAlgs, alg) {
+			return invalidf("accept_tpm_hash_algs: unknown algorithm %q (use %s)", alg, strings.Join(tpmHashAlgs, ", "))
+		}
+	}
+	for _, alg := range opts.AcceptTPMEncryptionAlgs {
+		if !slices.Contains(tpmEncAlgs, alg) {
+			return invalidf("accept_tpm_encryption_algs: unknown algorithm %q (use %s)", alg, strings.Join(tpmEncAlgs, ", "))
+		}
+	}
+	encAlgs := opts.AcceptTPMEncryptionAlgs
+	if len(encAlgs) == 0 {
+		encAlgs = []string{"rsa"}
+	}
+	for _, alg := range opts.AcceptTPMSigningAlgs {
+		keyAlg, ok := tpmSignAlgs[alg]
+		if !ok {
+			return invalidf("accept_tpm_signing_algs: unknown algorithm %q", alg)
+		}
+		if !slices.Contains(encAlgs, keyAlg) {
+			return invalidf("accept_tpm_signing_algs: %s needs %s in accept_tpm_encryption_algs", alg, keyAlg)
+		}
+	}
+	return nil
+}
+
+func validateMetadata(metadata map[string]any) error {
+	if len(metadata) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return invalidf("metadata: %v", err)
+	}
+	if len(data) > maxMetadataSize {
+		return invalidf("metadata exceeds %d bytes", maxMetadataSize)
+	}
+	return nil
+}
+
+// validateIMAKeys requires every key to be a PEM public key or certificate.
+func validateIMAKeys(keys []string) error {
+	for i, key := range keys {
+		block, _ := pem.Decode([]byte(strings.TrimSpace(key)))
+		if block == nil {
+			return invalidf("ima_sign_verification_keys[%d]: not PEM encoded", i)
+		}
+		var err error
+		switch block.Type {
+		case "PUBLIC KEY":
+			_, err = x509.ParsePKIXPublicKey(block.Bytes)
+		case "CERTIFICATE":
+			_, err = x509.ParseCertificate(block.Bytes)
+		default:
+			return invalidf("ima_sign_verification_keys[%d]: expected a PUBLIC KEY or CERTIFICATE, got %s", i, block.Type)
+		}
+		if err != nil {
+			return invalidf("ima_sign_verification_keys[%d]: %v", i, err)
+		}
+	}
+	return nil
+}
+
+func validateCloudAgentAddress(ip string, port int) error {
+	if ip != "" && net.ParseIP(ip) == nil && (len(ip) > 253 || !hostnameRE.MatchString(ip)) {
+		return invalidf("cloudagent_ip must be an IP address or hostname")
+	}
+	if port < 0 || port > 65535 {
+		return invalidf("cloudagent_port must be between 1 and 65535")
+	}
+	return nil
+}
+
+// verifyIdentity checks the agent's EK certificate and identity quote when opts asks for it
+// or the cluster enforces it. It returns nil when no verification was done.
+func verifyIdentity(ctx context.Context, svc *keylime.Service, agentUUID string, opts keylime.EnrollmentOptions) (*keylime.IdentityVerification, error) {
+	if !opts.VerifyIdentity && !svc.VerifiesAgentIdentity() {
+		return nil, nil
+	}
+	identity, err := svc.VerifyAgentIdentity(ctx, agentUUID, opts.CloudAgentIP, opts.CloudAgentPort)
+	if err != nil {
+		return nil, fmt.Errorf("enrollment rejected: %w", err)
+	}
+	return identity, nil
+}
+
+// validatePayload checks the payload and script paths given to Enroll_agent_to_verifier.
+func validatePayload(payload, script string) error {
+	if payload == "" {
+		if script != "" {
+			return invalidf("payload_script requires payload")
+		}
+		return nil
+	}
+	for _, f := range []struct{ field, path string }{{"payload", payload}, {"payload_script", script}} {
+		field, path := f.field, f.path
+		if path == "" {
+			continue
+		}
+		if !filepath.IsAbs(path) || strings.Contains(path, "..") {
+			return invalidf("%s must be an absolute path without path traversal", field)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return invalidf("%s not found: %s", field, path)
+		}
+		if field == "payload_script" && !info.Mode().IsRegular() {
+			return invalidf("payload_script must be a file")
+		}
+	}
+	return nil
+}
+
+// payloadDelivery is a payload encrypted under a new bootstrap key, waiting for key delivery.
+type payloadDelivery struct {
+	key       *keylime.BootstrapKey
+	encrypted string
+}
+
+// v returns the verifier's half of the bootstrap key, for the enrollment body.
+func (d *payloadDelivery) v() string {
+	return base64.StdEncoding.EncodeToString(d.key.V)
+}
+
+// preparePayload builds the payload and encrypts it under a new bootstrap key.
+func preparePayload(payload, script string) (*payloadDelivery, error) {
+	plaintext, err := keylime.BuildPayload(payload, script, maxPayloadSize)
+	if err != nil {
+		return nil, invalidf("payload: %v", err)
+	}
+	key, err := keylime.NewBootstrapKey()
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := keylime.EncryptPayload(key.K, plaintext)
+	if err != nil {
+		return nil, err
+	}
+	return &payloadDelivery{key: key, encrypted: encrypted}, nil
+}
+
+// deliverPayload sends U and the encrypted payload to the verified agent once the verifier
+// has accepted the enrollment with V, in the order the tenant uses. If the agent does not
+// take them, the enrollment is removed again.
+func (h *ToolHandler) deliverPayload(ctx context.Context, svc *keylime.Service, identity *keylime.IdentityVerification, agentUUID string, d *payloadDelivery) error {
+	err := svc.DeliverKey(ctx, identity, agentUUID, d.key, d.encrypted)
+	if err == nil {
+		return nil
+	}
+	if _, rmErr := svc.UnenrollAgent(ctx, agentUUID, h.removalPollInterval, h.removalTimeout); rmErr != nil {
+		return fmt.Errorf("%w; removing the enrollment without payload failed (%v) — remove agent %s from the verifier manually", err, rmErr, agentUUID)
+	}
+	return fmt.Errorf("%w; the enrollment was removed again", err)
+}
@@ -0,0 +1,131 @@
+package mcptools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/keylime/keylime-mcp/internal/history"
+	"github.com/keylime/keylime-mcp/internal/keylime"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// ErrorCode is a stable, machine-readable classification of a tool failure.
+// Tool errors are prefixed with it as "[code] message".
+type ErrorCode string
+
+const (
+	CodeInvalidInput       ErrorCode = "invalid_input"
+	CodeUnknownCluster     ErrorCode = "unknown_cluster"
+	CodeNotFound           ErrorCode = "not_found"
+	CodeConflict           ErrorCode = "conflict"
+	CodeForbidden          ErrorCode = "forbidden"
+	CodeRejected           ErrorCode = "rejected" // any other 4xx from Keylime
+	CodeKeylimeError       ErrorCode = "keylime_error"
+	CodeUnavailable        ErrorCode = "unavailable"
+	CodeTimeout            ErrorCode = "timeout"
+	CodeAPIVersionMismatch ErrorCode = "api_version_mismatch"
+	CodeIdentityMismatch   ErrorCode = "identity_mismatch"
+	CodeInternal           ErrorCode = "internal"
+)
+
+// ToolError carries the error code of a failed tool call.
+type ToolError struct {
+	Code ErrorCode
+	Err  error
+}
+
+func (e *ToolError) Error() string {
+	return fmt.Sprintf("[%s] %v", e.Code, e.Err)
+}
+
+func (e *ToolError) Unwrap() error {
+	return e.Err
+}
+
+// ErrRevisionConflict is returned when a policy changed on the verifier while it was being edited.
+var ErrRevisionConflict = errors.New("policy revision conflict")
+
+// inputError marks a failure caused by invalid tool arguments.
+type inputError struct {
+	msg string
+}
+
+func (e *inputError) Error() string {
+	return e.msg
+}
+
+// invalidf formats an input validation error, classified as CodeInvalidInput.
+func invalidf(format string, args ...any) error {
+	return &inputError{msg: fmt.Sprintf(format, args...)}
+}
+
+// ClassifyError maps an error returned by a tool handler to its error code.
+func ClassifyError(err error) ErrorCode {
+	var toolErr *ToolError
+	var inErr *inputError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &toolErr):
+		return toolErr.Code
+	case errors.As(err, &inErr):
+		return CodeInvalidInput
+	case errors.Is(err, ErrRevisionConflict):
+		return CodeConflict
+	case errors.Is(err, history.ErrNotFound):
+		return CodeNotFound
+	case errors.Is(err, keylime.ErrUnknownCluster):
+		return CodeUnknownCluster
+	case errors.Is(err, keylime.ErrAPIVersionMismatch):
+		return CodeAPIVersionMismatch
+	case errors.Is(err, keylime.ErrIdentityMismatch):
+		return CodeIdentityMismatch
+	case errors.Is(err, keylime.ErrCircuitOpen):
+		return CodeUnavailable
+	case errors.Is(err, context.DeadlineExceeded):
+		return CodeTimeout
+	}
+	if apiErr, ok := keylime.AsAPIError(err); ok {
+		return classifyStatus(apiErr.StatusCode)
+	}
+	if errors.As(err, &netErr) {
+		if netErr.Timeout() {
+			return CodeTimeout
+		}
+		return CodeUnavailable
+	}
+	return CodeInternal
+}
+
+func classifyStatus(status int) ErrorCode {
+	switch {
+	case status == http.StatusNotFound:
+		return CodeNotFound
+	case status == http.StatusConflict:
+		return CodeConflict
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return CodeForbidden
+	case status == http.StatusTooManyRequests || status == http.StatusBadGateway ||
+		status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout:
+		return CodeUnavailable
+	case status >= 400 && status < 500:
+		return CodeRejected
+	}
+	return CodeKeylimeError
+}
+
+// WithErrorCodes wraps a tool handler so every error it returns carries its error code.
+func WithErrorCodes[In, Out any](handler mcp.ToolHandlerFor[In, Out]) mcp.ToolHandlerFor[In, Out] {
+	return func(ctx context.Context, req *mcp.CallToolRequest, input In) (*mcp.CallToolResult, Out, error) {
+		result, output, err := handler(ctx, req, input)
+		if err != nil {
+			var toolErr *ToolError
+			if !errors.As(err, &toolErr) {
+				err = &ToolError{Code: ClassifyError(err), Err: err}
+			}
+		}
+		return result, output, err
+	}
+}
@@ -0,0 +1,88 @@
+package mcptools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/keylime/keylime-mcp/internal/keylime"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassifyError(t *testing.T) {
+	downServer := httptest.NewServer(http.NotFoundHandler())
+	downServer.Close()
+	_, dialErr := http.Get(downServer.URL)
+	require.Error(t, dialErr)
+
+	tests := []struct {
+		name string
+		err  error
+		want ErrorCode
+	}{
+		{"validation", validateAgentUUID("bad"), CodeInvalidInput},
+		{"wrapped validation", fmt.Errorf("runtime_policy_name: %w", validatePolicyName("")), CodeInvalidInput},
+		{"not found", &keylime.APIError{StatusCode: 404}, CodeNotFound},
+		{"conflict", fmt.Errorf("enrollment failed: %w", &keylime.APIError{StatusCode: 409}), CodeConflict},
+		{"forbidden", &keylime.APIError{StatusCode: 403}, CodeForbidden},
+		{"unauthorized", &keylime.APIError{StatusCode: 401}, CodeForbidden},
+		{"bad request", &keylime.APIError{StatusCode: 400}, CodeRejected},
+		{"server error", &keylime.APIError{StatusCode: 500}, CodeKeylimeError},
+		{"service unavailable", &keylime.APIError{StatusCode: 503}, CodeUnavailable},
+		{"connection refused", dialErr, CodeUnavailable},
+		{"circuit open", fmt.Errorf("GET: %w", keylime.ErrCircuitOpen), CodeUnavailable},
+		{"deadline", context.DeadlineExceeded, CodeTimeout},
+		{"version mismatch", keylime.ErrAPIVersionMismatch, CodeAPIVersionMismatch},
+		{"identity mismatch", fmt.Errorf("enrollment rejected: %w", keylime.ErrIdentityMismatch), CodeIdentityMismatch},
+		{"unknown cluster", fmt.Errorf("%w %q", keylime.ErrUnknownCluster, "dc9"), CodeUnknownCluster},
+		{"other", errors.New("boom"), CodeInternal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ClassifyError(tt.err))
+		})
+	}
+}
+
+func TestWithErrorCodes(t *testing.T) {
+	t.Run("prefixes error with code", func(t *testing.T) {
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /v2.5/agents/{uuid}", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"code":404,"status":"agent not found"}`))
+		})
+		h := newTestHandler(t, mux)
+		handler := WithErrorCodes(h.GetAgentStatus)
+
+		_, _, err := handler(context.Background(), nil, keylime.GetAgentStatusInput{AgentUUID: uuid1})
+		require.Error(t, err)
+		assert.Equal(t, "[not_found] agent "+uuid1+": API error (HTTP 404): agent not found", err.Error())
+
+		var toolErr *ToolError
+		require.ErrorAs(t, err, &toolErr)
+		assert.Equal(t, CodeNotFound, toolErr.Code)
+		assert.True(t, keylime.IsNotFound(err))
+	})
+
+	t.Run("validation error", func(t *testing.T) {
+		h := newTestHandler(t, http.NotFoundHandler())
+		handler := WithErrorCodes(h.GetAgentStatus)
+
+		_, _, err := handler(context.Background(), nil, keylime.GetAgentStatusInput{AgentUUID: badUUID})
+		assert.EqualError(t, err, "[invalid_input] "+errInvalidUUID)
+	})
+
+	t.Run("success untouched", func(t *testing.T) {
+		handler := WithErrorCodes(func(ctx context.Context, req *mcp.CallToolRequest, input struct{}) (*mcp.CallToolResult, any, error) {
+			return nil, "ok", nil
+		})
+		_, out, err := handler(context.Background(), nil, struct{}{})
+		require.NoError(t, err)
+		assert.Equal(t, "ok", out)
+	})
+}
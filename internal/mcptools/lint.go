@@ -0,0 +1,74 @@
+package mcptools
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/keylime/keylime-mcp/internal/history"
+	"github.com/keylime/keylime-mcp/internal/keylime"
+	"github.com/keylime/keylime-mcp/internal/policy"
+)
+
+func validatePolicyKind(kind string) error {
+	if kind != "" && kind != history.KindRuntime && kind != history.KindMB {
+		return invalidf("kind must be %q or %q, got %q", history.KindRuntime, history.KindMB, kind)
+	}
+	return nil
+}
+
+// detectPolicyKind tells a measured boot reference state from a runtime policy by its sections.
+func detectPolicyKind(data []byte) string {
+	var doc map[string]any
+	if json.Unmarshal(data, &doc) == nil {
+		for _, section := range []string{"has_secureboot", "scrtm_and_bios", "kernels"} {
+			if _, ok := doc[section]; ok {
+				return history.KindMB
+			}
+		}
+	}
+	return history.KindRuntime
+}
+
+func lintPolicy(kind string, data []byte) []policy.Finding {
+	if kind == history.KindMB {
+		return policy.LintMBReferenceState(data)
+	}
+	return policy.LintRuntimePolicy(data)
+}
+
+// lintForImport rejects a policy with lint errors and returns its warnings. With ignoreErrors,
+// the errors are returned along with the warnings instead.
+func lintForImport(kind string, data []byte, ignoreErrors bool) ([]keylime.PolicyLintFinding, error) {
+	findings := lintPolicy(kind, data)
+	if ignoreErrors {
+		return mapFindings(findings, ""), nil
+	}
+	if policy.HasErrors(findings) {
+		var msgs []string
+		for _, f := range mapFindings(findings, policy.SeverityError) {
+			msg := f.Message
+			if f.Location != "" {
+				msg = f.Location + ": " + msg
+			}
+			msgs = append(msgs, msg)
+		}
+		return nil, invalidf("policy was not imported: %s (set ignore_lint_errors to import it anyway)", strings.Join(msgs, "; "))
+	}
+	return mapFindings(findings, policy.SeverityWarning), nil
+}
+
+// mapFindings converts the findings of a severity, or all of them if severity is empty.
+func mapFindings(findings []policy.Finding, severity string) []keylime.PolicyLintFinding {
+	mapped := []keylime.PolicyLintFinding{}
+	for _, f := range findings {
+		if severity == "" || f.Severity == severity {
+			mapped = append(mapped, keylime.PolicyLintFinding{
+				Severity: f.Severity,
+				Check:    f.Check,
+				Location: f.Location,
+				Message:  f.Message,
+			})
+		}
+	}
+	return mapped
+}
@@ -0,0 +1,107 @@
+package mcptools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/keylime/keylime-mcp/internal/keylime"
+	"github.com/keylime/keylime-mcp/internal/policy"
+	"github.com/keylime/keylime-mcp/internal/tpm/eventlog"
+)
+
+// maxEventLogSize bounds the binary event logs read from disk; real logs are well below 1 MB.
+const maxEventLogSize = 16 * 1024 * 1024 // 16 MB
+
+// readEventLog parses a saved binary TPM event log.
+func readEventLog(path string) (*eventlog.Log, error) {
+	if err := validateLocalPath("event_log_path", path); err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return nil, invalidf("event_log_path is not a file: %s", path)
+	}
+	if info.Size() > maxEventLogSize {
+		return nil, invalidf("event log too large (%d bytes, max %d)", info.Size(), maxEventLogSize)
+	}
+	data, err := os.ReadFile(path) // #nosec G304 -- path is validated by validateLocalPath above
+	if err != nil {
+		return nil, fmt.Errorf("failed to read event log: %w", err)
+	}
+	log, err := eventlog.Parse(data)
+	if err != nil {
+		return nil, invalidf("invalid TPM event log: %v", err)
+	}
+	return log, nil
+}
+
+// validateCreateMBPolicy checks the input of Create_mb_policy.
+func validateCreateMBPolicy(input keylime.CreateMBPolicyInput) error {
+	if input.OutputPath == "" && input.PolicyName == "" {
+		return invalidf("output_path or policy_name is required")
+	}
+	if input.OutputPath != "" {
+		if err := validateFilePath(input.OutputPath); err != nil {
+			return err
+		}
+	}
+	if input.PolicyName != "" {
+		if err := validatePolicyName(input.PolicyName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mapReferenceStateToOutput summarizes a generated measured boot policy.
+func mapReferenceStateToOutput(log *eventlog.Log, state *policy.MBReferenceState) keylime.CreateMBPolicyOutput {
+	output := keylime.CreateMBPolicyOutput{
+		Status:        "created",
+		EventCount:    len(log.Events),
+		HasSecureBoot: state.HasSecureBoot,
+		PKCount:       len(state.PK),
+		KEKCount:      len(state.KEK),
+		DBCount:       len(state.DB),
+		DBXCount:      len(state.DBX),
+	}
+	if len(state.Kernels) > 0 {
+		kernel := state.Kernels[0]
+		output.ShimAuthcodeSHA256 = kernel.ShimAuthcode
+		output.GrubAuthcodeSHA256 = kernel.GrubAuthcode
+		output.KernelAuthcodeSHA256 = kernel.KernelAuthcode
+		output.InitrdPlainSHA256 = kernel.InitrdPlain
+	}
+	return output
+}
+
+// uploadMBPolicy creates a measured boot policy on the verifier.
+func uploadMBPolicy(ctx context.Context, svc *keylime.Service, name string, data []byte) error {
+	body := map[string]any{
+		"mb_policy": string(data),
+	}
+	return checkResponse(svc.Verifier.Post(ctx, fmt.Sprintf("mbpolicies/%s", name), body))
+}
+
+// fetchStoredMBPolicy returns the measured boot policy document stored on the verifier.
+func fetchStoredMBPolicy(ctx context.Context, svc *keylime.Service, name string) (string, error) {
+	stored, err := fetchAndDecode[keylime.GetMBPolicyOutput](
+		svc.Verifier.Get(ctx, fmt.Sprintf("mbpolicies/%s", name)),
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch measured boot policy %q: %w", name, err)
+	}
+	switch doc := stored.Results["mb_policy"].(type) {
+	case string:
+		return doc, nil
+	case nil:
+		return "", fmt.Errorf("measured boot policy %q has no mb_policy", name)
+	default:
+		data, err := json.Marshal(doc)
+		if err != nil {
+			return "", fmt.Errorf("measured boot policy %q: %w", name, err)
+		}
+		return string(data), nil
+	}
+}
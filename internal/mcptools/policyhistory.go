@@ -0,0 +1,188 @@
+package mcptools
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/keylime/keylime-mcp/internal/history"
+	"github.com/keylime/keylime-mcp/internal/keylime"
+)
+
+// defaultHistoryEntries is how many versions List_policy_history returns by default.
+const defaultHistoryEntries = 50
+
+var errHistoryDisabled = errors.New("policy history is disabled on this server")
+
+// SetPolicyHistory makes the handler keep every policy version it uploads or deletes in store.
+func (h *ToolHandler) SetPolicyHistory(store *history.Store) {
+	h.history = store
+}
+
+// policyRef names a stored policy for the history.
+type policyRef struct {
+	cluster string
+	kind    string // history.KindRuntime or history.KindMB
+	name    string
+}
+
+func (h *ToolHandler) policyRef(cluster, kind, name string) policyRef {
+	if cluster == "" {
+		cluster = h.clusters.Primary()
+	}
+	return policyRef{cluster: cluster, kind: kind, name: name}
+}
+
+// recordUpload records a version a tool has uploaded. The upload has already happened, so
+// the error says so.
+func (h *ToolHandler) recordUpload(ref policyRef, tool, reason string, content []byte, restoredFrom int) (history.Entry, error) {
+	if h.history == nil {
+		return history.Entry{}, nil
+	}
+	entry, err := h.history.Record(history.Entry{
+		Cluster:      ref.cluster,
+		Kind:         ref.kind,
+		Name:         ref.name,
+		Action:       history.ActionUploaded,
+		Tool:         tool,
+		Reason:       reason,
+		RestoredFrom: restoredFrom,
+	}, content)
+	if err != nil {
+		return history.Entry{}, fmt.Errorf("policy %q was uploaded but not recorded in the policy history: %w", ref.name, err)
+	}
+	return entry, nil
+}
+
+// historyWarning reports a failed recordUpload. The upload itself succeeded, so the tool
+// returns its normal output with the warning rather than an error.
+func historyWarning(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// recordReplaced records the version on the verifier before a tool overwrites it, unless the
+// history already ends with it.
+func (h *ToolHandler) recordReplaced(ref policyRef, tool, reason string, current []byte) error {
+	if h.history == nil {
+		return nil
+	}
+	latest, ok, err := h.history.Latest(ref.cluster, ref.kind, ref.name)
+	if err != nil {
+		return err
+	}
+	if ok && latest.Action != history.ActionDeleted && latest.Digest == history.Digest(current) {
+		return nil
+	}
+	_, err = h.history.Record(history.Entry{
+		Cluster: ref.cluster, Kind: ref.kind, Name: ref.name,
+		Action: history.ActionReplaced, Tool: tool, Reason: reason,
+	}, current)
+	return err
+}
+
+// recordDeleted keeps the version on the verifier before a tool deletes it. Nothing is deleted
+// if the version cannot be kept.
+func (h *ToolHandler) recordDeleted(ctx context.Context, svc *keylime.Service, ref policyRef, tool, reason string) error {
+	if h.history == nil {
+		return nil
+	}
+	current, err := fetchStoredPolicy(ctx, svc, ref.kind, ref.name)
+	if err != nil {
+		return err
+	}
+	if _, err := h.history.Record(history.Entry{
+		Cluster: ref.cluster, Kind: ref.kind, Name: ref.name,
+		Action: history.ActionDeleted, Tool: tool, Reason: reason,
+	}, []byte(current)); err != nil {
+		return fmt.Errorf("policy %q not deleted, it could not be recorded in the policy history: %w", ref.name, err)
+	}
+	return nil
+}
+
+// fetchStoredPolicy returns the policy document of either kind stored on the verifier.
+func fetchStoredPolicy(ctx context.Context, svc *keylime.Service, kind, name string) (string, error) {
+	if kind == history.KindMB {
+		return fetchStoredMBPolicy(ctx, svc, name)
+	}
+	return fetchStoredRuntimePolicy(ctx, svc, name)
+}
+
+// replacePolicy overwrites a policy of either kind stored on the verifier.
+func replacePolicy(ctx context.Context, svc *keylime.Service, kind, name string, data []byte) error {
+	if kind == history.KindMB {
+		body := map[string]any{"mb_policy": string(data)}
+		return checkResponse(svc.Verifier.Put(ctx, fmt.Sprintf("mbpolicies/%s", name), body))
+	}
+	body := map[string]any{"runtime_policy": base64.StdEncoding.EncodeToString(data)}
+	return checkResponse(svc.Verifier.Put(ctx, fmt.Sprintf("allowlists/%s", name), body))
+}
+
+// restoreVersion uploads a version from the history again, recreating the policy if it was deleted.
+func (h *ToolHandler) restoreVersion(ctx context.Context, svc *keylime.Service, entry history.Entry, reason string) (keylime.RollbackPolicyOutput, error) {
+	const tool = "Rollback_policy"
+	output := keylime.RollbackPolicyOutput{
+		PolicyName:      entry.Name,
+		Kind:            entry.Kind,
+		Cluster:         entry.Cluster,
+		RestoredVersion: entry.ID,
+	}
+	content, err := h.history.Content(entry)
+	if err != nil {
+		return output, err
+	}
+	ref := policyRef{cluster: entry.Cluster, kind: entry.Kind, name: entry.Name}
+
+	current, err := fetchStoredPolicy(ctx, svc, entry.Kind, entry.Name)
+	switch {
+	case keylime.IsNotFound(err):
+		if entry.Kind == history.KindMB {
+			err = uploadMBPolicy(ctx, svc, entry.Name, content)
+		} else {
+			err = uploadRuntimePolicy(ctx, svc, entry.Name, content)
+		}
+		output.Status = "recreated"
+	case err != nil:
+		return output, err
+	case history.Digest([]byte(current)) == entry.Digest:
+		output.Status = "unchanged"
+		return output, nil
+	default:
+		if err := h.recordReplaced(ref, tool, reason, []byte(current)); err != nil {
+			return output, fmt.Errorf("policy %q not rolled back, the current version could not be recorded in the policy history: %w", entry.Name, err)
+		}
+		err = replacePolicy(ctx, svc, entry.Kind, entry.Name, content)
+		output.Status = "rolled_back"
+	}
+	if err != nil {
+		return output, fmt.Errorf("failed to restore policy %q: %w", entry.Name, err)
+	}
+
+	recorded, err := h.recordUpload(ref, tool, reason, content, entry.ID)
+	output.Version, output.HistoryWarning = recorded.ID, historyWarning(err)
+	return output, nil
+}
+
+func mapHistoryToOutput(entries []history.Entry, limit int) keylime.ListPolicyHistoryOutput {
+	output := keylime.ListPolicyHistoryOutput{Versions: []keylime.PolicyVersion{}, Total: len(entries)}
+	for _, e := range entries[:min(limit, len(entries))] {
+		output.Versions = append(output.Versions, keylime.PolicyVersion{
+			Version:      e.ID,
+			Time:         e.Time.Format(time.RFC3339),
+			Cluster:      e.Cluster,
+			Kind:         e.Kind,
+			PolicyName:   e.Name,
+			Action:       e.Action,
+			Tool:         e.Tool,
+			Reason:       e.Reason,
+			Digest:       e.Digest,
+			Size:         e.Size,
+			RestoredFrom: e.RestoredFrom,
+		})
+	}
+	return output
+}
@@ -0,0 +1,165 @@
+package mcptools
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/keylime/keylime-mcp/internal/keylime"
+	"github.com/keylime/keylime-mcp/internal/policy"
+)
+
+// convertedFromPolicy is PolicyConversion.From when only an exclude list was merged into a
+// current runtime policy.
+const convertedFromPolicy = "runtime_policy"
+
+// readImportSource returns the policy given by exactly one of a file path and inline content.
+// With allowText, files without a .json extension are read as text, for legacy allowlists.
+func readImportSource(path, content string, allowText bool) ([]byte, error) {
+	switch {
+	case (path == "") == (content == ""):
+		return nil, invalidf("exactly one of file_path and content is required")
+	case content != "":
+		return decodeContent("content", content)
+	case allowText && filepath.Ext(path) != ".json":
+		return readTextFile("file_path", path)
+	}
+	return readPolicyFile(path)
+}
+
+// readTextFile reads a text file on the server host given in field, such as a legacy allowlist.
+func readTextFile(field, path string) ([]byte, error) {
+	if err := validateLocalPath(field, path); err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return nil, invalidf("%s is not a file: %s", field, path)
+	}
+	if info.Size() > maxPolicyFileSize {
+		return nil, invalidf("file too large (%d bytes, max %d)", info.Size(), maxPolicyFileSize)
+	}
+	data, err := os.ReadFile(path) // #nosec G304 -- path is validated by validateLocalPath above
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	if len(strings.TrimSpace(string(data))) == 0 {
+		return nil, invalidf("file is empty: %s", path)
+	}
+	return data, nil
+}
+
+// decodeContent returns the inline content given in field, decoded if it is base64 of text.
+// JSON and other text are returned as they are.
+func decodeContent(field, content string) ([]byte, error) {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return nil, invalidf("%s is empty", field)
+	}
+	if len(content) > maxPolicyFileSize {
+		return nil, invalidf("%s too large (%d bytes, max %d)", field, len(content), maxPolicyFileSize)
+	}
+	if json.Valid([]byte(content)) {
+		return []byte(content), nil
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.NewReplacer("\n", "", "\r", "").Replace(content))
+	if err == nil && isText(decoded) {
+		return decoded, nil
+	}
+	return []byte(content), nil
+}
+
+// isText tells decoded base64 from text that happens to be valid base64, such as "/tmp".
+func isText(data []byte) bool {
+	return len(data) > 0 && utf8.Valid(data) && !strings.ContainsFunc(string(data), func(r rune) bool {
+		return unicode.IsControl(r) && r != '\n' && r != '\r' && r != '\t'
+	})
+}
+
+// readJSONImportSource is readImportSource for policies that can only be JSON.
+func readJSONImportSource(path, content string) ([]byte, error) {
+	data, err := readImportSource(path, content, false)
+	if err != nil {
+		return nil, err
+	}
+	if !json.Valid(data) {
+		return nil, invalidf("content is not valid JSON or base64-encoded JSON")
+	}
+	return data, nil
+}
+
+// prepareRuntimePolicyImport reads the policy of Import_runtime_policy, converting a legacy
+// allowlist and merging a legacy exclude list. The conversion is nil if neither was given.
+func prepareRuntimePolicyImport(input keylime.ImportRuntimePolicyInput) ([]byte, *keylime.PolicyConversion, error) {
+	data, err := readImportSource(input.FilePath, input.Content, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	excludes, err := readExcludeList(input.ExcludeListPath, input.ExcludeList)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var p *policy.RuntimePolicy
+	conversion := &keylime.PolicyConversion{From: convertedFromPolicy}
+	switch {
+	case !json.Valid(data) || policy.IsJSONAllowlist(data):
+		converted, c, err := policy.ConvertAllowlist(data, time.Now())
+		if err != nil {
+			return nil, nil, invalidf("policy is neither runtime policy JSON nor a legacy allowlist: %v", err)
+		}
+		p = converted
+		conversion = &keylime.PolicyConversion{
+			From:         c.Format,
+			DigestCount:  c.Digests,
+			KeyringCount: c.Keyrings,
+			SkippedLines: c.Skipped,
+		}
+	case excludes != nil:
+		if p, err = policy.ParseRuntimePolicy(data); err != nil {
+			return nil, nil, invalidf("%v", err)
+		}
+	default:
+		return data, nil, nil
+	}
+
+	for _, exclude := range excludes {
+		if !slices.Contains(p.Excludes, exclude) {
+			p.Excludes = append(p.Excludes, exclude)
+		}
+	}
+	conversion.ExcludeCount = len(excludes)
+	data, err = writePolicy("", p)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, conversion, nil
+}
+
+// readExcludeList returns the regexes of the legacy exclude list given by at most one of
+// path and content, or nil if neither is given.
+func readExcludeList(path, content string) ([]string, error) {
+	var data []byte
+	var err error
+	switch {
+	case path != "" && content != "":
+		return nil, invalidf("give exclude_list_path or exclude_list, not both")
+	case path != "":
+		data, err = readTextFile("exclude_list_path", path)
+	case content != "":
+		data, err = decodeContent("exclude_list", content)
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return policy.ParseExcludeList(data), nil
+}
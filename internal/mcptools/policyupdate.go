@@ -0,0 +1,178 @@
+package mcptools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/keylime/keylime-mcp/internal/history"
+	"github.com/keylime/keylime-mcp/internal/keylime"
+	"github.com/keylime/keylime-mcp/internal/policy"
+)
+
+// maxUpdateAttempts bounds how often an edit is re-applied when the policy keeps changing.
+const maxUpdateAttempts = 3
+
+// maxSummaryNames caps the paths named per section of a change summary.
+const maxSummaryNames = 5
+
+// policyUpdate is the result of updateRuntimePolicy.
+type policyUpdate struct {
+	revision       string
+	retries        int
+	historyWarning string
+}
+
+// updateRuntimePolicy applies the edits of input to the stored policy and uploads it. The
+// policy is fetched again right before the upload: if it changed in between, the edits are
+// re-applied to the new version, unless the caller pinned expected_revision, which makes
+// any change a conflict. Keylime has no conditional PUT, so a change in the last moment
+// before the upload is still not detected. The replaced and the uploaded version are kept in
+// the policy history; failing to record the uploaded one only adds a warning.
+func (h *ToolHandler) updateRuntimePolicy(ctx context.Context, svc *keylime.Service, input keylime.UpdateRuntimePolicyInput) (policyUpdate, error) {
+	const tool = "Update_runtime_policy"
+	stored, err := fetchStoredRuntimePolicy(ctx, svc, input.PolicyName)
+	if err != nil {
+		return policyUpdate{}, err
+	}
+	revision := policyRevision(stored)
+	if input.ExpectedRevision != "" && input.ExpectedRevision != revision {
+		return policyUpdate{}, fmt.Errorf("%w: policy %q is at revision %s, not the expected %s; fetch it again with Get_runtime_policy and redo the edit",
+			ErrRevisionConflict, input.PolicyName, revision, input.ExpectedRevision)
+	}
+
+	for attempt := 1; ; attempt++ {
+		edited, data, err := editStoredPolicy(input, stored)
+		if err != nil {
+			return policyUpdate{}, err
+		}
+		current, err := fetchStoredRuntimePolicy(ctx, svc, input.PolicyName)
+		if err != nil {
+			return policyUpdate{}, err
+		}
+		if policyRevision(current) != revision {
+			if input.ExpectedRevision != "" || attempt == maxUpdateAttempts {
+				return policyUpdate{}, revisionConflict(input.PolicyName, stored, current, edited)
+			}
+			stored, revision = current, policyRevision(current)
+			continue
+		}
+
+		ref := h.policyRef(input.Cluster, history.KindRuntime, input.PolicyName)
+		if err := h.recordReplaced(ref, tool, input.Reason, []byte(current)); err != nil {
+			return policyUpdate{}, fmt.Errorf("policy not updated, the current version could not be recorded in the policy history: %w", err)
+		}
+		if err := replacePolicy(ctx, svc, history.KindRuntime, input.PolicyName, data); err != nil {
+			return policyUpdate{}, fmt.Errorf("failed to update policy: %w", err)
+		}
+		update := policyUpdate{revision: policyRevision(string(data)), retries: attempt - 1}
+		_, err = h.recordUpload(ref, tool, input.Reason, data, 0)
+		update.historyWarning = historyWarning(err)
+		return update, nil
+	}
+}
+
+// editStoredPolicy applies the edits to a stored policy and checks the result against the schema.
+func editStoredPolicy(input keylime.UpdateRuntimePolicyInput, stored string) (*policy.RuntimePolicy, []byte, error) {
+	p, err := parseStoredRuntimePolicy(input.PolicyName, stored)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := applyRuntimePolicyEdits(p, input); err != nil {
+		return nil, nil, err
+	}
+	p.Meta.Timestamp = time.Now().UTC().Format(time.RFC3339)
+	data, err := json.Marshal(p)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal policy: %w", err)
+	}
+	if err := policy.ValidateRuntimePolicy(data); err != nil {
+		return nil, nil, invalidf("edited policy was not uploaded: %v", err)
+	}
+	return p, data, nil
+}
+
+// revisionConflict describes the concurrent change and the edit that was not uploaded.
+func revisionConflict(name, base, current string, edited *policy.RuntimePolicy) error {
+	theirs, ours := "unreadable", summarizePolicyDiff(nil)
+	basePolicy, err := parseStoredRuntimePolicy(name, base)
+	if err == nil {
+		ours = summarizePolicyDiff(policy.Diff(basePolicy, edited))
+		if currentPolicy, err := parseStoredRuntimePolicy(name, current); err == nil {
+			theirs = summarizePolicyDiff(policy.Diff(basePolicy, currentPolicy))
+		}
+	}
+	return fmt.Errorf("%w: policy %q changed from revision %s to %s while it was edited. Concurrent change: %s. This edit, not uploaded: %s",
+		ErrRevisionConflict, name, policyRevision(base), policyRevision(current), theirs, ours)
+}
+
+// summarizePolicyDiff describes a diff in one line, naming a few paths per section.
+// The timestamp is left out, since every edit changes it.
+func summarizePolicyDiff(d *policy.RuntimePolicyDiff) string {
+	if d == nil {
+		return "none"
+	}
+	var parts []string
+	sections := []struct {
+		name string
+		diff policy.MapDiff
+	}{{"digests", d.Digests}, {"keyrings", d.Keyrings}, {"ima-buf", d.IMABuf}}
+	for _, section := range sections {
+		var changes []string
+		for _, c := range []struct {
+			verb  string
+			paths []string
+		}{
+			{"added", pathNames(section.diff.Added)},
+			{"removed", pathNames(section.diff.Removed)},
+			{"changed", changedNames(section.diff.Changed)},
+		} {
+			if len(c.paths) > 0 {
+				changes = append(changes, c.verb+" "+nameList(c.paths))
+			}
+		}
+		if len(changes) > 0 {
+			parts = append(parts, section.name+" "+strings.Join(changes, ", "))
+		}
+	}
+	if len(d.ExcludesAdded) > 0 {
+		parts = append(parts, "excludes added "+nameList(d.ExcludesAdded))
+	}
+	if len(d.ExcludesRemoved) > 0 {
+		parts = append(parts, "excludes removed "+nameList(d.ExcludesRemoved))
+	}
+	for _, f := range d.Fields {
+		if f.Field != "meta.timestamp" {
+			parts = append(parts, fmt.Sprintf("%s %s -> %s", f.Field, f.From, f.To))
+		}
+	}
+	if len(parts) == 0 {
+		return "none"
+	}
+	return strings.Join(parts, "; ")
+}
+
+func pathNames(paths []policy.PathDigests) []string {
+	names := make([]string, len(paths))
+	for i, p := range paths {
+		names[i] = p.Path
+	}
+	return names
+}
+
+func changedNames(changes []policy.PathChange) []string {
+	names := make([]string, len(changes))
+	for i, c := range changes {
+		names[i] = c.Path
+	}
+	return names
+}
+
+func nameList(names []string) string {
+	if len(names) <= maxSummaryNames {
+		return strings.Join(names, " ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(names[:maxSummaryNames], " "), len(names)-maxSummaryNames)
+}
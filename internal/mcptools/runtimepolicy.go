@@ -0,0 +1,383 @@
+package mcptools
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/keylime/keylime-mcp/internal/ima"
+	"github.com/keylime/keylime-mcp/internal/keylime"
+	"github.com/keylime/keylime-mcp/internal/policy"
+)
+
+// stateSuffix names the incremental state file written next to a generated policy.
+const stateSuffix = ".state"
+
+// validateCreateRuntimePolicy checks the input of Create_runtime_policy before the tree is walked.
+func validateCreateRuntimePolicy(input keylime.CreateRuntimePolicyInput) error {
+	if err := validateLocalPath("root_path", input.RootPath); err != nil {
+		return err
+	}
+	if info, err := os.Stat(input.RootPath); err != nil || !info.IsDir() {
+		return invalidf("root_path is not a directory: %s", input.RootPath)
+	}
+	if err := validateFilePath(input.OutputPath); err != nil {
+		return err
+	}
+	if input.PolicyName != "" {
+		if err := validatePolicyName(input.PolicyName); err != nil {
+			return err
+		}
+	}
+	if input.HashAlg != "" {
+		if _, err := policy.HashByName(input.HashAlg); err != nil {
+			return invalidf("hash_alg: %v", err)
+		}
+	}
+	if _, err := policy.CompileExcludes(input.Excludes); err != nil {
+		return invalidf("excludes: %v", err)
+	}
+	return nil
+}
+
+// generateRuntimePolicy builds the policy and writes it and the incremental state next to each other.
+func generateRuntimePolicy(ctx context.Context, input keylime.CreateRuntimePolicyInput) (*policy.GenerateResult, []byte, error) {
+	opts := policy.GenerateOptions{Root: input.RootPath, HashAlg: input.HashAlg, Excludes: input.Excludes}
+	statePath := input.OutputPath + stateSuffix
+	if input.Incremental {
+		state, err := policy.LoadState(statePath)
+		if err != nil {
+			return nil, nil, err
+		}
+		opts.State = state
+	}
+	result, err := policy.Generate(ctx, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := writePolicy(input.OutputPath, result.Policy)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := result.State.Save(statePath); err != nil {
+		return nil, nil, fmt.Errorf("failed to write generation state: %w", err)
+	}
+	return result, data, nil
+}
+
+// writePolicy marshals a policy and, unless path is empty, writes it there.
+func writePolicy(path string, p any) ([]byte, error) {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal policy: %w", err)
+	}
+	if path == "" {
+		return data, nil
+	}
+	if err := policy.WriteFileAtomic(path, data); err != nil {
+		return nil, fmt.Errorf("failed to write policy: %w", err)
+	}
+	return data, nil
+}
+
+// maxIMALogSize bounds the measurement lists read from disk.
+const maxIMALogSize = 256 * 1024 * 1024 // 256 MB
+
+// readIMALog parses a saved ASCII measurement list.
+func readIMALog(path string) ([]ima.Entry, error) {
+	if err := validateLocalPath("log_path", path); err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return nil, invalidf("log_path is not a file: %s", path)
+	}
+	if info.Size() > maxIMALogSize {
+		return nil, invalidf("log file too large (%d bytes, max %d)", info.Size(), maxIMALogSize)
+	}
+	f, err := os.Open(path) // #nosec G304 -- path is validated by validateLocalPath above
+	if err != nil {
+		return nil, fmt.Errorf("failed to read IMA log: %w", err)
+	}
+	defer f.Close()
+	entries, err := ima.Parse(f)
+	if err != nil {
+		return nil, invalidf("invalid IMA measurement list: %v", err)
+	}
+	if len(entries) == 0 {
+		return nil, invalidf("IMA measurement list is empty: %s", path)
+	}
+	return entries, nil
+}
+
+// validateIMALogPolicy checks the input of Create_runtime_policy_from_ima_log.
+func validateIMALogPolicy(input keylime.CreateRuntimePolicyFromIMALogInput) error {
+	if input.OutputPath == "" && input.PolicyName == "" {
+		return invalidf("output_path or policy_name is required")
+	}
+	if input.OutputPath != "" {
+		if err := validateFilePath(input.OutputPath); err != nil {
+			return err
+		}
+	}
+	if input.PolicyName != "" {
+		if err := validatePolicyName(input.PolicyName); err != nil {
+			return err
+		}
+	}
+	if _, err := policy.CompileExcludes(input.Excludes); err != nil {
+		return invalidf("excludes: %v", err)
+	}
+	return nil
+}
+
+// uploadRuntimePolicy creates a runtime policy on the verifier.
+func uploadRuntimePolicy(ctx context.Context, svc *keylime.Service, name string, data []byte) error {
+	body := map[string]any{
+		"runtime_policy": base64.StdEncoding.EncodeToString(data),
+	}
+	return checkResponse(svc.Verifier.Post(ctx, fmt.Sprintf("allowlists/%s", name), body))
+}
+
+// fetchRuntimePolicy downloads and decodes a runtime policy stored on the verifier.
+func fetchRuntimePolicy(ctx context.Context, svc *keylime.Service, name string) (*policy.RuntimePolicy, error) {
+	stored, err := fetchStoredRuntimePolicy(ctx, svc, name)
+	if err != nil {
+		return nil, err
+	}
+	return parseStoredRuntimePolicy(name, stored)
+}
+
+// fetchStoredRuntimePolicy returns the runtime policy document stored on the verifier as is.
+func fetchStoredRuntimePolicy(ctx context.Context, svc *keylime.Service, name string) (string, error) {
+	stored, err := fetchAndDecode[keylime.GetRuntimePolicyOutput](
+		svc.Verifier.Get(ctx, fmt.Sprintf("allowlists/%s", name)),
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch policy %q: %w", name, err)
+	}
+	return stored.Results.RuntimePolicy, nil
+}
+
+func parseStoredRuntimePolicy(name, stored string) (*policy.RuntimePolicy, error) {
+	// a policy uploaded without content is stored empty and edited like a new one
+	if stored == "" {
+		return policy.NewRuntimePolicy(time.Now()), nil
+	}
+	p, err := policy.ParseRuntimePolicy([]byte(stored))
+	if err != nil {
+		return nil, fmt.Errorf("policy %q: %w", name, err)
+	}
+	return p, nil
+}
+
+// policyRevision fingerprints a stored policy document for optimistic concurrency.
+func policyRevision(stored string) string {
+	sum := sha256.Sum256([]byte(stored))
+	return hex.EncodeToString(sum[:8])
+}
+
+// loadRuntimePolicyFile reads and decodes a local runtime policy.
+func loadRuntimePolicyFile(path string) (*policy.RuntimePolicy, error) {
+	data, err := readPolicyFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p, err := policy.ParseRuntimePolicy(data)
+	if err != nil {
+		return nil, invalidf("%s: %v", path, err)
+	}
+	return p, nil
+}
+
+// loadEvaluatedPolicy returns the runtime policy named by exactly one of name and path.
+func (h *ToolHandler) loadEvaluatedPolicy(ctx context.Context, name, path, cluster string) (*policy.RuntimePolicy, error) {
+	switch {
+	case (name == "") == (path == ""):
+		return nil, invalidf("exactly one of policy_name and policy_path is required")
+	case path != "":
+		return loadRuntimePolicyFile(path)
+	}
+	if err := validatePolicyName(name); err != nil {
+		return nil, err
+	}
+	return h.loadPolicySource(ctx, name, cluster)
+}
+
+// loadPolicySource returns the runtime policy at source: the absolute path of a local file,
+// or the name of a policy stored on the verifier.
+func (h *ToolHandler) loadPolicySource(ctx context.Context, source, cluster string) (*policy.RuntimePolicy, error) {
+	if filepath.IsAbs(source) {
+		return loadRuntimePolicyFile(source)
+	}
+	if err := validatePolicyName(source); err != nil {
+		return nil, err
+	}
+	svc, err := h.clusters.Get(cluster)
+	if err != nil {
+		return nil, err
+	}
+	return fetchRuntimePolicy(ctx, svc, source)
+}
+
+// mapEvaluationsToOutput counts the verdicts and lists the entries, or only the failing ones.
+func mapEvaluationsToOutput(results []policy.EntryEvaluation, failuresOnly bool) keylime.EvaluateIMALogOutput {
+	output := keylime.EvaluateIMALogOutput{EntryCount: len(results), Entries: []keylime.IMAEntryEvaluation{}}
+	for _, r := range results {
+		switch r.Status {
+		case policy.EvalAllowed:
+			output.AllowedCount++
+		case policy.EvalExcluded:
+			output.ExcludedCount++
+		case policy.EvalFailing:
+			output.FailingCount++
+		}
+		if failuresOnly && r.Status != policy.EvalFailing {
+			continue
+		}
+		output.Entries = append(output.Entries, keylime.IMAEntryEvaluation{
+			Line:        r.Line,
+			Path:        r.Path,
+			Template:    r.Template,
+			Digest:      r.Digest,
+			Status:      r.Status,
+			FailureType: r.FailureType,
+			Reason:      r.Reason,
+			Expected:    r.Expected,
+		})
+	}
+	return output
+}
+
+// defaultDiffEntries caps the entries listed per section of a policy diff.
+const defaultDiffEntries = 50
+
+// mapPolicyDiffToOutput lists at most maxEntries entries per section of a diff; the counts
+// always cover all of it.
+func mapPolicyDiffToOutput(d *policy.RuntimePolicyDiff, maxEntries int) keylime.DiffRuntimePoliciesOutput {
+	output := keylime.DiffRuntimePoliciesOutput{
+		Identical: d.Empty(),
+		Digests:   mapMapDiff(d.Digests, maxEntries),
+		Keyrings:  mapMapDiff(d.Keyrings, maxEntries),
+		IMABuf:    mapMapDiff(d.IMABuf, maxEntries),
+		Fields:    []keylime.PolicyFieldChange{},
+	}
+	output.ExcludesAddedCount, output.ExcludesRemovedCount = len(d.ExcludesAdded), len(d.ExcludesRemoved)
+	output.ExcludesAdded = d.ExcludesAdded[:min(len(d.ExcludesAdded), maxEntries)]
+	output.ExcludesRemoved = d.ExcludesRemoved[:min(len(d.ExcludesRemoved), maxEntries)]
+	for _, f := range d.Fields {
+		output.Fields = append(output.Fields, keylime.PolicyFieldChange{Field: f.Field, From: f.From, To: f.To})
+	}
+	output.Truncated = output.Digests.Truncated || output.Keyrings.Truncated || output.IMABuf.Truncated ||
+		len(output.ExcludesAdded) < len(d.ExcludesAdded) || len(output.ExcludesRemoved) < len(d.ExcludesRemoved)
+	return output
+}
+
+func mapMapDiff(d policy.MapDiff, maxEntries int) keylime.PolicyMapDiff {
+	output := keylime.PolicyMapDiff{
+		AddedCount:   len(d.Added),
+		RemovedCount: len(d.Removed),
+		ChangedCount: len(d.Changed),
+	}
+	for _, p := range d.Added[:min(len(d.Added), maxEntries)] {
+		output.Added = append(output.Added, keylime.PolicyPathDigests{Path: p.Path, Digests: p.Digests})
+	}
+	for _, p := range d.Removed[:min(len(d.Removed), maxEntries)] {
+		output.Removed = append(output.Removed, keylime.PolicyPathDigests{Path: p.Path, Digests: p.Digests})
+	}
+	for _, c := range d.Changed[:min(len(d.Changed), maxEntries)] {
+		output.Changed = append(output.Changed, keylime.PolicyPathChange{Path: c.Path, AddedDigests: c.Added, RemovedDigests: c.Removed})
+	}
+	output.Truncated = len(output.Added) < len(d.Added) || len(output.Removed) < len(d.Removed) || len(output.Changed) < len(d.Changed)
+	return output
+}
+
+// hasRuntimePolicyEdits reports whether Update_runtime_policy was asked to change anything.
+func hasRuntimePolicyEdits(input keylime.UpdateRuntimePolicyInput) bool {
+	return len(input.AddExcludes) > 0 || len(input.RemoveExcludes) > 0 ||
+		len(input.AddDigests) > 0 || len(input.RemoveDigests) > 0 || len(input.RemoveDigestValues) > 0 ||
+		len(input.AddKeyrings) > 0 || len(input.RemoveKeyrings) > 0 ||
+		len(input.AddIMABuf) > 0 || len(input.RemoveIMABuf) > 0 ||
+		len(input.AddIgnoredKeyrings) > 0 || len(input.RemoveIgnoredKeyrings) > 0 ||
+		input.LogHashAlg != "" || input.VerificationKeys != nil
+}
+
+// applyRuntimePolicyEdits applies the changes of Update_runtime_policy to p.
+func applyRuntimePolicyEdits(p *policy.RuntimePolicy, input keylime.UpdateRuntimePolicyInput) error {
+	p.Excludes = slices.DeleteFunc(p.Excludes, func(e string) bool { return slices.Contains(input.RemoveExcludes, e) })
+	for _, exclude := range input.AddExcludes {
+		if !strings.HasSuffix(exclude, ")?") {
+			exclude += "(/.*)?"
+		}
+		if !slices.Contains(p.Excludes, exclude) {
+			p.Excludes = append(p.Excludes, exclude)
+		}
+	}
+
+	for _, path := range input.RemoveDigests {
+		delete(p.Digests, path)
+	}
+	if err := editDigests(p.Digests, input.AddDigests, input.RemoveDigestValues); err != nil {
+		return err
+	}
+	if err := editDigests(p.Keyrings, input.AddKeyrings, input.RemoveKeyrings); err != nil {
+		return err
+	}
+	if err := editDigests(p.IMABuf, input.AddIMABuf, input.RemoveIMABuf); err != nil {
+		return err
+	}
+
+	ignored := slices.DeleteFunc(p.IMA.IgnoredKeyrings, func(k string) bool { return slices.Contains(input.RemoveIgnoredKeyrings, k) })
+	for _, keyring := range input.AddIgnoredKeyrings {
+		if !slices.Contains(ignored, keyring) {
+			ignored = append(ignored, keyring)
+		}
+	}
+	p.IMA.IgnoredKeyrings = ignored
+	if input.LogHashAlg != "" {
+		p.IMA.LogHashAlg = input.LogHashAlg
+	}
+	if input.VerificationKeys != nil {
+		p.VerificationKeys = *input.VerificationKeys
+	}
+	return nil
+}
+
+// editDigests removes and then appends digests per name. Removing an empty list, or the
+// last digest of a name, drops the name.
+func editDigests(m map[string][]string, add, remove map[string][]string) error {
+	for name, digests := range remove {
+		if len(digests) == 0 {
+			delete(m, name)
+			continue
+		}
+		kept := slices.DeleteFunc(m[name], func(d string) bool {
+			return slices.ContainsFunc(digests, func(r string) bool { return strings.EqualFold(trimDigestAlg(r), d) })
+		})
+		if len(kept) == 0 {
+			delete(m, name)
+		} else {
+			m[name] = kept
+		}
+	}
+	for name, digests := range add {
+		for _, digest := range digests {
+			normalized, err := normalizeDigest(strings.ToLower(digest), name)
+			if err != nil {
+				return err
+			}
+			if !slices.Contains(m[name], normalized) {
+				m[name] = append(m[name], normalized)
+			}
+		}
+	}
+	return nil
+}
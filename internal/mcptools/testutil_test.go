@@ -28,7 +28,29 @@ func newTestHandler(t *testing.T, handler http.Handler) *ToolHandler {
 		RegistrarURL: ts.URL,
 		TLSEnabled:   false,
 		APIVersion:   testAPIVersion,
+		// the stub handlers serve pull-mode endpoints only; see newFakeHandler for mode detection
+		AttestationMode: keylime.AttestationModePull,
 	})
 	require.NoError(t, err)
 	return NewToolHandler(svc)
 }
+
+// newTestClusterHandler serves each named cluster (verifier and registrar) from its own handler.
+func newTestClusterHandler(t *testing.T, primary string, handlers map[string]http.Handler) *ToolHandler {
+	t.Helper()
+	configs := make(map[string]*keylime.Config, len(handlers))
+	for name, handler := range handlers {
+		ts := httptest.NewServer(handler)
+		t.Cleanup(ts.Close)
+		configs[name] = &keylime.Config{
+			VerifierURL:     ts.URL,
+			RegistrarURL:    ts.URL,
+			TLSEnabled:      false,
+			APIVersion:      testAPIVersion,
+			AttestationMode: keylime.AttestationModePull,
+		}
+	}
+	clusters, err := keylime.NewClusters(configs, primary)
+	require.NoError(t, err)
+	return NewClusterToolHandler(clusters)
+}
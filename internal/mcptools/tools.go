@@ -2,34 +2,54 @@ package mcptools
 
 import (
 	"context"
-	"encoding/base64"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"os/exec"
-	"strings"
+	"slices"
+	"sort"
 	"sync"
 	"time"
 
+	"github.com/keylime/keylime-mcp/internal/history"
 	"github.com/keylime/keylime-mcp/internal/keylime"
+	"github.com/keylime/keylime-mcp/internal/policy"
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 	"golang.org/x/sync/errgroup"
 )
 
 type ToolHandler struct {
-	service *keylime.Service
+	clusters *keylime.Clusters
+	history  *history.Store // nil when policy versions are not kept
+
+	// how Update_agent waits for the verifier to finish removing a polled agent
+	removalPollInterval time.Duration
+	removalTimeout      time.Duration
 }
 
+// NewToolHandler creates a handler for a single Keylime deployment.
 func NewToolHandler(service *keylime.Service) *ToolHandler {
-	return &ToolHandler{service: service}
+	return NewClusterToolHandler(keylime.SingleCluster(service))
+}
+
+// NewClusterToolHandler creates a handler that routes each tool call to a named cluster.
+func NewClusterToolHandler(clusters *keylime.Clusters) *ToolHandler {
+	return &ToolHandler{
+		clusters:            clusters,
+		removalPollInterval: 500 * time.Millisecond,
+		removalTimeout:      30 * time.Second,
+	}
 }
 
-func (h *ToolHandler) GetAllAgents(ctx context.Context, req *mcp.CallToolRequest, _ keylime.GetAllAgentsInput) (
+func (h *ToolHandler) GetAllAgents(ctx context.Context, req *mcp.CallToolRequest, input keylime.GetAllAgentsInput) (
 	*mcp.CallToolResult,
 	any,
 	error,
 ) {
-	uuids, err := h.service.FetchAllAgentUUIDs(ctx)
+	svc, err := h.clusters.Get(input.Cluster)
+	if err != nil {
+		return nil, nil, err
+	}
+	uuids, err := svc.FetchAllAgentUUIDs(ctx)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -37,12 +57,16 @@ func (h *ToolHandler) GetAllAgents(ctx context.Context, req *mcp.CallToolRequest
 	return nil, keylime.GetAllAgentsOutput{Agents: uuids}, nil
 }
 
-func (h *ToolHandler) GetVerifierEnrolledAgents(ctx context.Context, req *mcp.CallToolRequest, _ keylime.GetVerifierEnrolledAgentsInput) (
+func (h *ToolHandler) GetVerifierEnrolledAgents(ctx context.Context, req *mcp.CallToolRequest, input keylime.GetVerifierEnrolledAgentsInput) (
 	*mcp.CallToolResult,
 	any,
 	error,
 ) {
-	parsed, err := fetchAndDecode[keylime.VerifierEnrolledAgentsResponse](h.service.Verifier.Get(ctx, "agents/"))
+	svc, err := h.clusters.Get(input.Cluster)
+	if err != nil {
+		return nil, nil, err
+	}
+	parsed, err := fetchAndDecode[keylime.VerifierEnrolledAgentsResponse](svc.Verifier.Get(ctx, "agents/"))
 	if err != nil {
 		return nil, nil, err
 	}
@@ -67,12 +91,24 @@ func (h *ToolHandler) GetAgentStatus(ctx context.Context, req *mcp.CallToolReque
 		return nil, nil, err
 	}
 
-	agentStatus, err := h.service.FetchAgentDetails(ctx, input.AgentUUID)
+	svc, err := h.clusters.Get(input.Cluster)
 	if err != nil {
 		return nil, nil, err
 	}
-
-	return nil, mapAgentToOutput(input.AgentUUID, agentStatus), nil
+	if svc.AttestationMode() != keylime.AttestationModePush {
+		agentStatus, err := svc.FetchAgentDetails(ctx, input.AgentUUID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if svc.AgentAttestationMode(agentStatus.Results) == keylime.AttestationModePull {
+			return nil, mapAgentToOutput(input.AgentUUID, agentStatus), nil
+		}
+	}
+	attestations, err := svc.FetchAttestations(ctx, input.AgentUUID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return nil, mapAttestationsToOutput(input.AgentUUID, attestations), nil
 }
 
 func (h *ToolHandler) GetFailedAgents(ctx context.Context, req *mcp.CallToolRequest, input keylime.GetFailedAgentsInput) (
@@ -80,38 +116,252 @@ func (h *ToolHandler) GetFailedAgents(ctx context.Context, req *mcp.CallToolRequ
 	any,
 	error,
 ) {
-	uuids, err := h.service.FetchAllAgentUUIDs(ctx)
+	names, err := h.targetClusters(input.Cluster)
 	if err != nil {
 		return nil, nil, err
 	}
 
 	var mu sync.Mutex
-	var failed []keylime.GetAgentStatusOutput
+	var output keylime.GetFailedAgentsOutput
+	clusterErrs := map[string]error{}
+	clusterWorkers, _ := errgroup.WithContext(ctx)
+
+	for _, name := range names {
+		clusterWorkers.Go(func() error {
+			svc, err := h.clusters.Get(name)
+			if err != nil {
+				return err
+			}
+			scan, err := scanFleet(ctx, svc, input.VerifierID)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				clusterErrs[name] = err
+				return nil
+			}
+			for i := range scan.failed {
+				scan.failed[i].Cluster = name
+			}
+			for i := range scan.failedPush {
+				scan.failedPush[i].Cluster = name
+			}
+			for i := range scan.skipped {
+				scan.skipped[i].Cluster = name
+			}
+			for i := range scan.errored {
+				scan.errored[i].Cluster = name
+			}
+			output.FailedAgents = append(output.FailedAgents, scan.failed...)
+			output.FailedPushAgents = append(output.FailedPushAgents, scan.failedPush...)
+			output.SkippedAgents = append(output.SkippedAgents, scan.skipped...)
+			output.ErroredAgents = append(output.ErroredAgents, scan.errored...)
+			output.ScannedAgents += scan.scanned
+			return nil
+		})
+	}
+
+	if err := clusterWorkers.Wait(); err != nil {
+		return nil, nil, err
+	}
+	// a single-cluster query has nothing partial to report, so surface the error directly
+	if len(names) == 1 && clusterErrs[names[0]] != nil {
+		return nil, nil, clusterErrs[names[0]]
+	}
+	for name, err := range clusterErrs {
+		if output.ClusterErrors == nil {
+			output.ClusterErrors = map[string]string{}
+		}
+		output.ClusterErrors[name] = err.Error()
+	}
+
+	return nil, output, nil
+}
+
+// fleetScan is the result of checking every agent of one cluster.
+type fleetScan struct {
+	failed     []keylime.GetAgentStatusOutput
+	failedPush []keylime.AgentAttestationStatus
+	skipped    []keylime.AgentIssue
+	errored    []keylime.AgentIssue
+	scanned    int
+}
+
+// scanFleet returns the agents of a cluster that are in a failed state. It uses the verifier's
+// bulk listing and falls back to one request per registered agent on verifiers without it.
+// Push-model agents are checked by the evaluation of their latest attestation.
+func scanFleet(ctx context.Context, svc *keylime.Service, verifierID string) (fleetScan, error) {
+	if svc.AttestationMode() == keylime.AttestationModePush {
+		return scanPushFleet(ctx, svc)
+	}
+	agents, err := svc.FetchAgentsBulk(ctx, verifierID)
+	if errors.Is(err, keylime.ErrBulkUnsupported) {
+		return scanFleetPerAgent(ctx, svc, verifierID)
+	}
+	if err != nil {
+		return fleetScan{}, err
+	}
+
+	skipped, err := unenrolledAgents(ctx, svc, agents, verifierID)
+	if err != nil {
+		return fleetScan{}, err
+	}
+	scan := fleetScan{skipped: skipped}
+	var pushUUIDs []string
+	for agentUUID, details := range agents {
+		if svc.AgentAttestationMode(details) == keylime.AttestationModePush {
+			pushUUIDs = append(pushUUIDs, agentUUID)
+			continue
+		}
+		scan.scanned++
+		if keylime.IsFailedState(details.OperationalState) {
+			scan.failed = append(scan.failed, mapAgentToOutput(agentUUID, keylime.AgentStatusResponse{Results: details}))
+		}
+	}
+	sort.Slice(scan.failed, func(i, j int) bool { return scan.failed[i].AgentUUID < scan.failed[j].AgentUUID })
+	return scan.withPushAgents(ctx, svc, pushUUIDs)
+}
+
+// unenrolledAgents returns the registered agents that are missing from a bulk listing because
+// they are not enrolled in the verifier. Agents left out by the verifier_id filter are enrolled
+// and not reported, as in the per-agent scan.
+func unenrolledAgents(ctx context.Context, svc *keylime.Service, listed map[string]keylime.AgentDetails, verifierID string) ([]keylime.AgentIssue, error) {
+	registered, err := svc.FetchAllAgentUUIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var missing []string
+	for _, agentUUID := range registered {
+		if _, ok := listed[agentUUID]; !ok {
+			missing = append(missing, agentUUID)
+		}
+	}
+	if len(missing) > 0 && verifierID != "" {
+		enrolled, err := svc.FetchEnrolledAgentUUIDs(ctx)
+		if err != nil {
+			return nil, err
+		}
+		missing = slices.DeleteFunc(missing, func(agentUUID string) bool { return slices.Contains(enrolled, agentUUID) })
+	}
+
+	var skipped []keylime.AgentIssue
+	for _, agentUUID := range missing {
+		skipped = append(skipped, keylime.AgentIssue{AgentUUID: agentUUID, Reason: "not enrolled in verifier"})
+	}
+	sortIssues(skipped)
+	return skipped, nil
+}
+
+// scanFleetPerAgent checks every agent known to the cluster's registrar with its own verifier request.
+func scanFleetPerAgent(ctx context.Context, svc *keylime.Service, verifierID string) (fleetScan, error) {
+	uuids, err := svc.FetchAllAgentUUIDs(ctx)
+	if err != nil {
+		return fleetScan{}, err
+	}
+
+	var mu sync.Mutex
+	var scan fleetScan
+	var pushUUIDs []string
 	workers, _ := errgroup.WithContext(ctx)
 	workers.SetLimit(10) // 10 was choosed as compromise between performance and resource usage
 
 	for _, agentUUID := range uuids {
-		agentUUID := agentUUID // capture loop variable for safe use in goroutine
 		workers.Go(func() error {
-			agentStatus, err := h.service.FetchAgentDetails(ctx, agentUUID)
-			if err != nil || agentStatus.Code < 200 || agentStatus.Code >= 300 {
-				return nil // skip agents not enrolled in verifier
+			agentStatus, err := svc.FetchAgentDetails(ctx, agentUUID)
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case keylime.IsNotFound(err):
+				scan.skipped = append(scan.skipped, keylime.AgentIssue{AgentUUID: agentUUID, Reason: "not enrolled in verifier"})
+				return nil
+			case err != nil:
+				scan.errored = append(scan.errored, keylime.AgentIssue{AgentUUID: agentUUID, Reason: err.Error()})
+				return nil
+			case verifierID != "" && agentStatus.Results.VerifierID != verifierID:
+				return nil
+			case svc.AgentAttestationMode(agentStatus.Results) == keylime.AttestationModePush:
+				pushUUIDs = append(pushUUIDs, agentUUID)
+				return nil
 			}
+			scan.scanned++
 			if keylime.IsFailedState(agentStatus.Results.OperationalState) {
-				output := mapAgentToOutput(agentUUID, agentStatus)
-				mu.Lock()
-				failed = append(failed, output)
-				mu.Unlock()
+				scan.failed = append(scan.failed, mapAgentToOutput(agentUUID, agentStatus))
 			}
 			return nil
 		})
 	}
 
 	if err := workers.Wait(); err != nil {
-		return nil, nil, err
+		return fleetScan{}, err
+	}
+	sort.Slice(scan.failed, func(i, j int) bool { return scan.failed[i].AgentUUID < scan.failed[j].AgentUUID })
+	return scan.withPushAgents(ctx, svc, pushUUIDs)
+}
+
+// withPushAgents adds the push-model agents found among the records of a pull-mode scan.
+func (scan fleetScan) withPushAgents(ctx context.Context, svc *keylime.Service, uuids []string) (fleetScan, error) {
+	push, err := scanPushAgents(ctx, svc, uuids)
+	if err != nil {
+		return fleetScan{}, err
+	}
+	scan.failedPush = push.failedPush
+	scan.skipped = append(scan.skipped, push.skipped...)
+	scan.errored = append(scan.errored, push.errored...)
+	scan.scanned += push.scanned
+	sortIssues(scan.skipped)
+	sortIssues(scan.errored)
+	return scan, nil
+}
+
+// scanPushFleet fetches the attestations of every agent known to the cluster's registrar. Push-model
+// attestations do not name a verifier, so the verifier_id filter does not apply.
+func scanPushFleet(ctx context.Context, svc *keylime.Service) (fleetScan, error) {
+	uuids, err := svc.FetchAllAgentUUIDs(ctx)
+	if err != nil {
+		return fleetScan{}, err
 	}
+	return scanPushAgents(ctx, svc, uuids)
+}
+
+// scanPushAgents checks push-model agents by the evaluation of their latest attestation.
+func scanPushAgents(ctx context.Context, svc *keylime.Service, uuids []string) (fleetScan, error) {
+
+	var mu sync.Mutex
+	var scan fleetScan
+	workers, _ := errgroup.WithContext(ctx)
+	workers.SetLimit(10)
+
+	for _, agentUUID := range uuids {
+		workers.Go(func() error {
+			attestations, err := svc.FetchAttestations(ctx, agentUUID)
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case keylime.IsNotFound(err):
+				scan.skipped = append(scan.skipped, keylime.AgentIssue{AgentUUID: agentUUID, Reason: "not enrolled in verifier"})
+				return nil
+			case err != nil:
+				scan.errored = append(scan.errored, keylime.AgentIssue{AgentUUID: agentUUID, Reason: err.Error()})
+				return nil
+			}
+			scan.scanned++
+			if status := mapAttestationsToOutput(agentUUID, attestations); status.Status == keylime.EvaluationFail {
+				scan.failedPush = append(scan.failedPush, status)
+			}
+			return nil
+		})
+	}
+
+	if err := workers.Wait(); err != nil {
+		return fleetScan{}, err
+	}
+	sortIssues(scan.skipped)
+	sortIssues(scan.errored)
+	sort.Slice(scan.failedPush, func(i, j int) bool { return scan.failedPush[i].AgentUUID < scan.failedPush[j].AgentUUID })
+	return scan, nil
+}
 
-	return nil, keylime.GetFailedAgentsOutput{FailedAgents: failed}, nil
+func sortIssues(issues []keylime.AgentIssue) {
+	sort.Slice(issues, func(i, j int) bool { return issues[i].AgentUUID < issues[j].AgentUUID })
 }
 
 func (h *ToolHandler) GetAgentPolicies(ctx context.Context, req *mcp.CallToolRequest, input keylime.GetAgentPoliciesInput) (
@@ -123,7 +373,11 @@ func (h *ToolHandler) GetAgentPolicies(ctx context.Context, req *mcp.CallToolReq
 		return nil, nil, err
 	}
 
-	agentDetails, err := h.service.FetchAgentDetails(ctx, input.AgentUUID)
+	svc, err := h.clusters.Get(input.Cluster)
+	if err != nil {
+		return nil, nil, err
+	}
+	agentDetails, err := svc.FetchAgentDetails(ctx, input.AgentUUID)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -150,8 +404,12 @@ func (h *ToolHandler) RegistrarGetAgentDetails(ctx context.Context, req *mcp.Cal
 	if err := validateAgentUUID(input.AgentUUID); err != nil {
 		return nil, nil, err
 	}
+	svc, err := h.clusters.Get(input.Cluster)
+	if err != nil {
+		return nil, nil, err
+	}
 	result, err := fetchAndDecode[keylime.RegistrarGetAgentDetailsOutput](
-		h.service.Registrar.Get(ctx, fmt.Sprintf("agents/%s", input.AgentUUID)),
+		svc.Registrar.Get(ctx, fmt.Sprintf("agents/%s", input.AgentUUID)),
 	)
 	if err != nil {
 		return nil, nil, err
@@ -164,23 +422,73 @@ func (h *ToolHandler) GetVersionAndHealth(ctx context.Context, req *mcp.CallTool
 	any,
 	error,
 ) {
+	names, err := h.targetClusters(input.Cluster)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	var services []keylime.ServiceStatus
+	for _, name := range names {
+		svc, err := h.clusters.Get(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		services = append(services,
+			fetchServiceStatus(ctx, name, "verifier", svc.Verifier),
+			fetchServiceStatus(ctx, name, "registrar", svc.Registrar),
+		)
+	}
+
+	return nil, keylime.GetVersionAndHealthOutput{Services: services}, nil
+}
 
-	verifierResp, err := fetchAndDecode[keylime.GetVersionOutput](h.service.Verifier.GetRaw(ctx, "version"))
+// fetchServiceStatus queries the unversioned /version endpoint of a single Keylime service.
+func fetchServiceStatus(ctx context.Context, cluster, service string, client *keylime.Client) keylime.ServiceStatus {
+	status := keylime.ServiceStatus{Cluster: cluster, Service: service}
+	resp, err := fetchAndDecode[keylime.GetVersionOutput](client.GetRaw(ctx, "version"))
+	status.CircuitBreaker = client.BreakerStatus()
+	status.APIVersion = client.APIVersion()
+	status.TLS = client.TLSStatus()
 	if err != nil {
-		services = append(services, keylime.ServiceStatus{Service: "verifier", Reachable: false, Error: err.Error()})
-	} else {
-		services = append(services, keylime.ServiceStatus{Service: "verifier", CurrentVersion: verifierResp.Results.CurrentVersion, SupportedVersions: verifierResp.Results.SupportedVersions, Reachable: true})
+		status.Error = err.Error()
+		return status
 	}
+	status.Reachable = true
+	status.CurrentVersion = resp.Results.CurrentVersion
+	status.SupportedVersions = resp.Results.SupportedVersions
+	return status
+}
 
-	registrarResp, err := fetchAndDecode[keylime.GetVersionOutput](h.service.Registrar.GetRaw(ctx, "version"))
-	if err != nil {
-		services = append(services, keylime.ServiceStatus{Service: "registrar", Reachable: false, Error: err.Error()})
-	} else {
-		services = append(services, keylime.ServiceStatus{Service: "registrar", CurrentVersion: registrarResp.Results.CurrentVersion, SupportedVersions: registrarResp.Results.SupportedVersions, Reachable: true})
+func (h *ToolHandler) ListClusters(ctx context.Context, req *mcp.CallToolRequest, input keylime.ListClustersInput) (
+	*mcp.CallToolResult,
+	any,
+	error,
+) {
+	var clusters []keylime.ClusterInfo
+	for _, name := range h.clusters.Names() {
+		svc, err := h.clusters.Get(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		clusters = append(clusters, keylime.ClusterInfo{
+			Name:         name,
+			Primary:      name == h.clusters.Primary(),
+			VerifierURL:  svc.Verifier.BaseURL(),
+			RegistrarURL: svc.Registrar.BaseURL(),
+		})
 	}
+	return nil, keylime.ListClustersOutput{Clusters: clusters}, nil
+}
 
-	return nil, keylime.GetVersionAndHealthOutput{Services: services}, nil
+// targetClusters resolves the clusters a fleet-wide tool should query: the named one, or all of them.
+func (h *ToolHandler) targetClusters(name string) ([]string, error) {
+	if name == "" {
+		return h.clusters.Names(), nil
+	}
+	if _, err := h.clusters.Get(name); err != nil {
+		return nil, err
+	}
+	return []string{name}, nil
 }
 
 func (h *ToolHandler) RegistrarRemoveAgent(ctx context.Context, req *mcp.CallToolRequest, input keylime.RegistrarRemoveAgentInput) (
@@ -191,8 +499,12 @@ func (h *ToolHandler) RegistrarRemoveAgent(ctx context.Context, req *mcp.CallToo
 	if err := validateAgentUUID(input.AgentUUID); err != nil {
 		return nil, nil, err
 	}
+	svc, err := h.clusters.Get(input.Cluster)
+	if err != nil {
+		return nil, nil, err
+	}
 	result, err := fetchAndDecode[keylime.RegistrarRemoveAgentOutput](
-		h.service.Registrar.Delete(ctx, fmt.Sprintf("agents/%s", input.AgentUUID)),
+		svc.Registrar.Delete(ctx, fmt.Sprintf("agents/%s", input.AgentUUID)),
 	)
 	if err != nil {
 		return nil, nil, err
@@ -205,31 +517,49 @@ func (h *ToolHandler) EnrollAgentToVerifier(ctx context.Context, req *mcp.CallTo
 	any,
 	error,
 ) {
-	if err := validateAgentUUID(input.AgentUUID); err != nil {
+	if err := validateEnrollment(input.AgentUUID, input.RuntimePolicyName, input.MbPolicyName, input.EnrollmentOptions); err != nil {
 		return nil, nil, err
 	}
-	if input.RuntimePolicyName != "" {
-		if err := validatePolicyName(input.RuntimePolicyName); err != nil {
-			return nil, nil, fmt.Errorf("runtime_policy_name: %w", err)
-		}
-	}
-	if input.MbPolicyName != "" {
-		if err := validatePolicyName(input.MbPolicyName); err != nil {
-			return nil, nil, fmt.Errorf("mb_policy_name: %w", err)
-		}
+	if err := validatePayload(input.Payload, input.PayloadScript); err != nil {
+		return nil, nil, err
 	}
 
-	body, err := h.service.PrepareEnrollmentBody(ctx, input.AgentUUID, input.RuntimePolicyName, input.MbPolicyName)
+	svc, err := h.clusters.Get(input.Cluster)
+	if err != nil {
+		return nil, nil, err
+	}
+	opts := input.EnrollmentOptions
+	// the payload key is encrypted for the transport key that comes with the identity quote
+	opts.VerifyIdentity = opts.VerifyIdentity || input.Payload != ""
+	identity, err := verifyIdentity(ctx, svc, input.AgentUUID, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	body, err := svc.PrepareEnrollmentBody(ctx, input.AgentUUID, input.RuntimePolicyName, input.MbPolicyName, opts)
 	if err != nil {
 		return nil, nil, err
 	}
+	var delivery *payloadDelivery
+	if input.Payload != "" {
+		if delivery, err = preparePayload(input.Payload, input.PayloadScript); err != nil {
+			return nil, nil, err
+		}
+		body["v"] = delivery.v()
+	}
 
 	result, err := fetchAndDecode[keylime.EnrollAgentToVerifierOutput](
-		h.service.Verifier.Post(ctx, fmt.Sprintf("agents/%s", input.AgentUUID), body),
+		svc.Verifier.Post(ctx, fmt.Sprintf("agents/%s", input.AgentUUID), body),
 	)
 	if err != nil {
 		return nil, nil, fmt.Errorf("enrollment failed: %w", err)
 	}
+	if delivery != nil {
+		if err := h.deliverPayload(ctx, svc, identity, input.AgentUUID, delivery); err != nil {
+			return nil, nil, err
+		}
+	}
+	result.Identity = identity
+	result.PayloadDelivered = input.Payload != ""
 	return nil, result, nil
 }
 
@@ -238,36 +568,53 @@ func (h *ToolHandler) UpdateAgent(ctx context.Context, req *mcp.CallToolRequest,
 	any,
 	error,
 ) {
-	if err := validateAgentUUID(input.AgentUUID); err != nil {
+	if err := validateEnrollment(input.AgentUUID, input.RuntimePolicyName, input.MbPolicyName, input.EnrollmentOptions); err != nil {
 		return nil, nil, err
 	}
-	if input.RuntimePolicyName != "" {
-		if err := validatePolicyName(input.RuntimePolicyName); err != nil {
-			return nil, nil, fmt.Errorf("runtime_policy_name: %w", err)
-		}
+
+	svc, err := h.clusters.Get(input.Cluster)
+	if err != nil {
+		return nil, nil, err
 	}
-	if input.MbPolicyName != "" {
-		if err := validatePolicyName(input.MbPolicyName); err != nil {
-			return nil, nil, fmt.Errorf("mb_policy_name: %w", err)
-		}
+	identity, err := verifyIdentity(ctx, svc, input.AgentUUID, input.EnrollmentOptions)
+	if err != nil {
+		return nil, nil, err
 	}
-
-	body, err := h.service.PrepareEnrollmentBody(ctx, input.AgentUUID, input.RuntimePolicyName, input.MbPolicyName)
+	body, err := svc.PrepareEnrollmentBody(ctx, input.AgentUUID, input.RuntimePolicyName, input.MbPolicyName, input.EnrollmentOptions)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	if err := checkResponse(h.service.Verifier.Delete(ctx, fmt.Sprintf("agents/%s", input.AgentUUID))); err != nil {
-		return nil, nil, fmt.Errorf("failed to unenroll agent: %w", err)
+	previous, err := svc.SnapshotEnrollment(ctx, input.AgentUUID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to snapshot current enrollment: %w", err)
 	}
 
-	if _, err := fetchAndDecode[keylime.EnrollAgentToVerifierOutput](
-		h.service.Verifier.Post(ctx, fmt.Sprintf("agents/%s", input.AgentUUID), body),
-	); err != nil {
-		return nil, nil, fmt.Errorf("CRITICAL: agent was unenrolled but re-enrollment failed: %w — manually re-enroll agent %s", err, input.AgentUUID)
+	waited, err := svc.UnenrollAgent(ctx, input.AgentUUID, h.removalPollInterval, h.removalTimeout)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to unenroll agent: %w", err)
+	}
+	output := keylime.UpdateAgentOutput{
+		AgentUUID:          input.AgentUUID,
+		Status:             keylime.UpdateStatusUpdated,
+		WaitedForRemoval:   waited,
+		PreviousEnrollment: previous,
+		Identity:           identity,
 	}
 
-	return nil, keylime.UpdateAgentOutput{AgentUUID: input.AgentUUID, Status: "updated"}, nil
+	enrollErr := checkResponse(svc.Verifier.Post(ctx, fmt.Sprintf("agents/%s", input.AgentUUID), body))
+	if enrollErr == nil {
+		return nil, output, nil
+	}
+	if err := checkResponse(svc.Verifier.Post(ctx, fmt.Sprintf("agents/%s", input.AgentUUID), previous.RestoreBody(body))); err != nil {
+		return nil, nil, fmt.Errorf("CRITICAL: agent was unenrolled, re-enrollment failed (%w) and restoring the previous enrollment failed (%v) — manually re-enroll agent %s", enrollErr, err, input.AgentUUID)
+	}
+	output.Status = keylime.UpdateStatusRolledBack
+	if len(previous.Missing) > 0 {
+		output.Status = keylime.UpdateStatusPartiallyRestored
+	}
+	output.EnrollmentError = enrollErr.Error()
+	return nil, output, nil
 }
 
 func (h *ToolHandler) UnenrollAgentFromVerifier(ctx context.Context, req *mcp.CallToolRequest, input keylime.UnenrollAgentFromVerifierInput) (
@@ -278,8 +625,12 @@ func (h *ToolHandler) UnenrollAgentFromVerifier(ctx context.Context, req *mcp.Ca
 	if err := validateAgentUUID(input.AgentUUID); err != nil {
 		return nil, nil, err
 	}
+	svc, err := h.clusters.Get(input.Cluster)
+	if err != nil {
+		return nil, nil, err
+	}
 	result, err := fetchAndDecode[keylime.UnenrollAgentFromVerifierOutput](
-		h.service.Verifier.Delete(ctx, fmt.Sprintf("agents/%s", input.AgentUUID)),
+		svc.Verifier.Delete(ctx, fmt.Sprintf("agents/%s", input.AgentUUID)),
 	)
 	if err != nil {
 		return nil, nil, err
@@ -295,8 +646,23 @@ func (h *ToolHandler) ReactivateAgent(ctx context.Context, req *mcp.CallToolRequ
 	if err := validateAgentUUID(input.AgentUUID); err != nil {
 		return nil, nil, err
 	}
+	svc, err := h.clusters.Get(input.Cluster)
+	if err != nil {
+		return nil, nil, err
+	}
+	push := svc.AttestationMode() == keylime.AttestationModePush
+	if svc.AttestationMode() == keylime.AttestationModeAuto {
+		agentStatus, err := svc.FetchAgentDetails(ctx, input.AgentUUID)
+		if err != nil {
+			return nil, nil, err
+		}
+		push = svc.AgentAttestationMode(agentStatus.Results) == keylime.AttestationModePush
+	}
+	if push {
+		return reactivatePushAgent(ctx, svc, input.AgentUUID)
+	}
 	result, err := fetchAndDecode[keylime.ReactivateAgentOutput](
-		h.service.Verifier.Put(ctx, fmt.Sprintf("agents/%s/reactivate", input.AgentUUID), struct{}{}),
+		svc.Verifier.Put(ctx, fmt.Sprintf("agents/%s/reactivate", input.AgentUUID), struct{}{}),
 	)
 	if err != nil {
 		return nil, nil, err
@@ -304,6 +670,26 @@ func (h *ToolHandler) ReactivateAgent(ctx context.Context, req *mcp.CallToolRequ
 	return nil, result, nil
 }
 
+// reactivatePushAgent reports where a push-model agent stands. Such a verifier has no reactivate
+// endpoint: a failed agent is attested again as soon as it pushes new evidence.
+func reactivatePushAgent(ctx context.Context, svc *keylime.Service, agentUUID string) (*mcp.CallToolResult, any, error) {
+	attestations, err := svc.FetchAttestations(ctx, agentUUID)
+	if err != nil {
+		return nil, nil, err
+	}
+	output := keylime.ReactivatePushAgentOutput{AgentAttestationStatus: mapAttestationsToOutput(agentUUID, attestations)}
+	switch output.Status {
+	case keylime.EvaluationFail:
+		output.Message = "push-mode verifiers cannot reactivate agents; the agent recovers when its next pushed attestation passes. " +
+			"Fix the cause in failure_reason (e.g. update the policy) and wait for the agent's next attestation."
+	case keylime.EvaluationPass:
+		output.Message = "agent's latest attestation passed; nothing to reactivate"
+	default:
+		output.Message = "agent has no completed attestation yet; nothing to reactivate"
+	}
+	return nil, output, nil
+}
+
 func (h *ToolHandler) StopAgent(ctx context.Context, req *mcp.CallToolRequest, input keylime.StopAgentInput) (
 	*mcp.CallToolResult,
 	any,
@@ -312,8 +698,12 @@ func (h *ToolHandler) StopAgent(ctx context.Context, req *mcp.CallToolRequest, i
 	if err := validateAgentUUID(input.AgentUUID); err != nil {
 		return nil, nil, err
 	}
+	svc, err := h.clusters.Get(input.Cluster)
+	if err != nil {
+		return nil, nil, err
+	}
 	result, err := fetchAndDecode[keylime.StopAgentOutput](
-		h.service.Verifier.Put(ctx, fmt.Sprintf("agents/%s/stop", input.AgentUUID), struct{}{}),
+		svc.Verifier.Put(ctx, fmt.Sprintf("agents/%s/stop", input.AgentUUID), struct{}{}),
 	)
 	if err != nil {
 		return nil, nil, err
@@ -326,13 +716,121 @@ func (h *ToolHandler) ListRuntimePolicies(ctx context.Context, req *mcp.CallTool
 	any,
 	error,
 ) {
-	result, err := fetchAndDecode[keylime.ListRuntimePoliciesOutput](h.service.Verifier.Get(ctx, "allowlists/"))
+	svc, err := h.clusters.Get(input.Cluster)
+	if err != nil {
+		return nil, nil, err
+	}
+	result, err := fetchAndDecode[keylime.ListRuntimePoliciesOutput](svc.Verifier.Get(ctx, "allowlists/"))
 	if err != nil {
 		return nil, nil, err
 	}
 	return nil, result, nil
 }
 
+func (h *ToolHandler) CreateRuntimePolicyFromIMALog(ctx context.Context, req *mcp.CallToolRequest, input keylime.CreateRuntimePolicyFromIMALogInput) (
+	*mcp.CallToolResult,
+	any,
+	error,
+) {
+	if err := validateIMALogPolicy(input); err != nil {
+		return nil, nil, err
+	}
+	entries, err := readIMALog(input.LogPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	var svc *keylime.Service
+	if input.PolicyName != "" {
+		if svc, err = h.clusters.Get(input.Cluster); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	runtimePolicy, err := policy.FromMeasurements(entries, input.Excludes, time.Now())
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := writePolicy(input.OutputPath, runtimePolicy)
+	if err != nil {
+		return nil, nil, err
+	}
+	output := keylime.CreateRuntimePolicyFromIMALogOutput{
+		OutputPath:   input.OutputPath,
+		Status:       "created",
+		EntryCount:   len(entries),
+		DigestCount:  len(runtimePolicy.Digests),
+		KeyringCount: len(runtimePolicy.Keyrings),
+		IMABufCount:  len(runtimePolicy.IMABuf),
+		LogHashAlg:   runtimePolicy.IMA.LogHashAlg,
+	}
+	if svc != nil {
+		if err := uploadRuntimePolicy(ctx, svc, input.PolicyName, data); err != nil {
+			if input.OutputPath != "" {
+				return nil, nil, fmt.Errorf("policy written to %s but not imported: %w", input.OutputPath, err)
+			}
+			return nil, nil, err
+		}
+		ref := h.policyRef(input.Cluster, history.KindRuntime, input.PolicyName)
+		_, err := h.recordUpload(ref, "Create_runtime_policy_from_ima_log", input.Reason, data, 0)
+		output.HistoryWarning = historyWarning(err)
+		output.PolicyName, output.Status = input.PolicyName, "imported"
+		if input.OutputPath != "" {
+			output.Status = "created_and_imported"
+		}
+	}
+	return nil, output, nil
+}
+
+func (h *ToolHandler) EvaluateIMALog(ctx context.Context, req *mcp.CallToolRequest, input keylime.EvaluateIMALogInput) (
+	*mcp.CallToolResult,
+	any,
+	error,
+) {
+	entries, err := readIMALog(input.LogPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	runtimePolicy, err := h.loadEvaluatedPolicy(ctx, input.PolicyName, input.PolicyPath, input.Cluster)
+	if err != nil {
+		return nil, nil, err
+	}
+	results, err := policy.Evaluate(runtimePolicy, entries)
+	if err != nil {
+		return nil, nil, invalidf("cannot evaluate against the policy: %v", err)
+	}
+	output := mapEvaluationsToOutput(results, input.FailuresOnly)
+	output.PolicyName, output.PolicyPath = input.PolicyName, input.PolicyPath
+	return nil, output, nil
+}
+
+func (h *ToolHandler) DiffRuntimePolicies(ctx context.Context, req *mcp.CallToolRequest, input keylime.DiffRuntimePoliciesInput) (
+	*mcp.CallToolResult,
+	any,
+	error,
+) {
+	if input.From == "" || input.To == "" {
+		return nil, nil, invalidf("from and to are required")
+	}
+	if input.MaxEntries < 0 {
+		return nil, nil, invalidf("max_entries must not be negative")
+	}
+	maxEntries := input.MaxEntries
+	if maxEntries == 0 {
+		maxEntries = defaultDiffEntries
+	}
+	from, err := h.loadPolicySource(ctx, input.From, input.Cluster)
+	if err != nil {
+		return nil, nil, err
+	}
+	to, err := h.loadPolicySource(ctx, input.To, input.Cluster)
+	if err != nil {
+		return nil, nil, err
+	}
+	output := mapPolicyDiffToOutput(policy.Diff(from, to), maxEntries)
+	output.From, output.To = input.From, input.To
+	return nil, output, nil
+}
+
 func (h *ToolHandler) GetRuntimePolicy(ctx context.Context, req *mcp.CallToolRequest, input keylime.GetRuntimePolicyInput) (
 	*mcp.CallToolResult,
 	any,
@@ -341,12 +839,17 @@ func (h *ToolHandler) GetRuntimePolicy(ctx context.Context, req *mcp.CallToolReq
 	if err := validatePolicyName(input.PolicyName); err != nil {
 		return nil, nil, err
 	}
+	svc, err := h.clusters.Get(input.Cluster)
+	if err != nil {
+		return nil, nil, err
+	}
 	result, err := fetchAndDecode[keylime.GetRuntimePolicyOutput](
-		h.service.Verifier.Get(ctx, fmt.Sprintf("allowlists/%s", input.PolicyName)),
+		svc.Verifier.Get(ctx, fmt.Sprintf("allowlists/%s", input.PolicyName)),
 	)
 	if err != nil {
 		return nil, nil, err
 	}
+	result.Revision = policyRevision(result.Results.RuntimePolicy)
 	return nil, result, nil
 }
 
@@ -359,131 +862,111 @@ func (h *ToolHandler) ImportRuntimePolicy(ctx context.Context, req *mcp.CallTool
 		return nil, nil, err
 	}
 
-	data, err := readPolicyFile(input.FilePath)
+	data, conversion, err := prepareRuntimePolicyImport(input)
 	if err != nil {
 		return nil, nil, err
 	}
-
-	body := map[string]any{
-		"runtime_policy": base64.StdEncoding.EncodeToString(data),
+	warnings, err := lintForImport(history.KindRuntime, data, input.IgnoreLintErrors)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	if err := checkResponse(h.service.Verifier.Post(ctx, fmt.Sprintf("allowlists/%s", input.Name), body)); err != nil {
+	svc, err := h.clusters.Get(input.Cluster)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := uploadRuntimePolicy(ctx, svc, input.Name, data); err != nil {
 		return nil, nil, err
 	}
+	ref := h.policyRef(input.Cluster, history.KindRuntime, input.Name)
+	_, err = h.recordUpload(ref, "Import_runtime_policy", input.Reason, data, 0)
 
-	return nil, keylime.ImportRuntimePolicyOutput{Name: input.Name, Status: "imported"}, nil
+	output := keylime.ImportRuntimePolicyOutput{
+		Name:           input.Name,
+		Status:         "imported",
+		Conversion:     conversion,
+		Warnings:       warnings,
+		HistoryWarning: historyWarning(err),
+	}
+	if conversion != nil {
+		output.Status = "converted_and_imported"
+	}
+	return nil, output, nil
 }
 
-//nolint:gocognit,gocyclo // sequential steps of a single read-modify-write operation
-func (h *ToolHandler) UpdateRuntimePolicy(ctx context.Context, req *mcp.CallToolRequest, input keylime.UpdateRuntimePolicyInput) (
+func (h *ToolHandler) CreateRuntimePolicy(ctx context.Context, req *mcp.CallToolRequest, input keylime.CreateRuntimePolicyInput) (
 	*mcp.CallToolResult,
 	any,
 	error,
 ) {
-	if err := validatePolicyName(input.PolicyName); err != nil {
+	if err := validateCreateRuntimePolicy(input); err != nil {
 		return nil, nil, err
 	}
-	if len(input.AddExcludes) == 0 && len(input.AddDigests) == 0 && len(input.RemoveExcludes) == 0 && len(input.RemoveDigests) == 0 {
-		return nil, nil, fmt.Errorf("at least one of add_excludes, add_digests, remove_excludes or remove_digests is required")
-	}
-
-	policyData, err := fetchAndDecode[keylime.GetRuntimePolicyOutput](
-		h.service.Verifier.Get(ctx, fmt.Sprintf("allowlists/%s", input.PolicyName)),
-	)
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to fetch policy %q: %w", input.PolicyName, err)
-	}
-	var policy map[string]any
-	policyStr := policyData.Results.RuntimePolicy
-	if policyStr == "" {
-		policyStr = "{}"
-	}
-	if err := json.Unmarshal([]byte(policyStr), &policy); err != nil {
-		return nil, nil, fmt.Errorf("failed to parse policy JSON: %w", err)
-	}
-	// Remove excludes
-	if len(input.RemoveExcludes) > 0 {
-		oldExcludes, _ := policy["excludes"].([]any)
-		var filtered []any
-		for _, e := range oldExcludes {
-			keep := true
-			for _, r := range input.RemoveExcludes {
-				if e == r {
-					keep = false
-					break
-				}
-			}
-			if keep {
-				filtered = append(filtered, e)
-			}
+	var svc *keylime.Service
+	if input.PolicyName != "" {
+		var err error
+		if svc, err = h.clusters.Get(input.Cluster); err != nil {
+			return nil, nil, err
 		}
-		policy["excludes"] = filtered
 	}
 
-	// Add excludes
-	for _, newExclude := range input.AddExcludes {
-		if !strings.HasSuffix(newExclude, ")?") {
-			newExclude += "(/.*)?"
-		}
-		excludes, _ := policy["excludes"].([]any)
-		var found bool
-		for _, e := range excludes {
-			if e == newExclude {
-				found = true
-				break
-			}
-		}
-		if !found {
-			policy["excludes"] = append(excludes, newExclude)
-		}
+	result, data, err := generateRuntimePolicy(ctx, input)
+	if err != nil {
+		return nil, nil, err
 	}
-
-	// Remove digests
-	if len(input.RemoveDigests) > 0 {
-		digests, _ := policy["digests"].(map[string]any)
-		for _, path := range input.RemoveDigests {
-			delete(digests, path)
+	output := keylime.CreateRuntimePolicyOutput{
+		OutputPath:      input.OutputPath,
+		Status:          "created",
+		HashAlg:         result.State.HashAlg,
+		DigestCount:     len(result.Policy.Digests),
+		FilesHashed:     result.Stats.Hashed,
+		FilesReused:     result.Stats.Reused,
+		FilesExcluded:   result.Stats.Excluded,
+		UnreadableCount: result.Stats.UnreadableCount,
+		Unreadable:      result.Stats.Unreadable,
+	}
+	if svc != nil {
+		if err := uploadRuntimePolicy(ctx, svc, input.PolicyName, data); err != nil {
+			return nil, nil, fmt.Errorf("policy written to %s but not imported: %w", input.OutputPath, err)
 		}
+		ref := h.policyRef(input.Cluster, history.KindRuntime, input.PolicyName)
+		_, err := h.recordUpload(ref, "Create_runtime_policy", input.Reason, data, 0)
+		output.HistoryWarning = historyWarning(err)
+		output.PolicyName, output.Status = input.PolicyName, "created_and_imported"
 	}
+	return nil, output, nil
+}
 
-	// Add digests
-	for newPath, newDigest := range input.AddDigests {
-		normalized, err := normalizeDigest(newDigest, newPath)
-		if err != nil {
-			return nil, nil, err
-		}
-		digests, _ := policy["digests"].(map[string]any)
-		if digests == nil {
-			digests = map[string]any{}
-			policy["digests"] = digests
-		}
-		digests[newPath] = []any{normalized}
+func (h *ToolHandler) UpdateRuntimePolicy(ctx context.Context, req *mcp.CallToolRequest, input keylime.UpdateRuntimePolicyInput) (
+	*mcp.CallToolResult,
+	any,
+	error,
+) {
+	if err := validatePolicyName(input.PolicyName); err != nil {
+		return nil, nil, err
 	}
-
-	// Update timestamp
-	meta, _ := policy["meta"].(map[string]any)
-	if meta == nil {
-		meta = map[string]any{}
-		policy["meta"] = meta
+	if !hasRuntimePolicyEdits(input) {
+		return nil, nil, invalidf("at least one of add_excludes, add_digests, remove_excludes, remove_digests, remove_digest_values, " +
+			"add_keyrings, remove_keyrings, add_ima_buf, remove_ima_buf, add_ignored_keyrings, remove_ignored_keyrings, " +
+			"log_hash_alg or verification_keys is required")
 	}
-	meta["timestamp"] = time.Now().UTC().Format(time.RFC3339)
 
-	// Re-upload
-	policyJSON, err := json.Marshal(policy)
+	svc, err := h.clusters.Get(input.Cluster)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to marshal policy: %w", err)
-	}
-
-	body := map[string]any{
-		"runtime_policy": base64.StdEncoding.EncodeToString(policyJSON),
+		return nil, nil, err
 	}
-
-	if err := checkResponse(h.service.Verifier.Put(ctx, fmt.Sprintf("allowlists/%s", input.PolicyName), body)); err != nil {
-		return nil, nil, fmt.Errorf("failed to update policy: %w", err)
+	update, err := h.updateRuntimePolicy(ctx, svc, input)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	return nil, keylime.UpdateRuntimePolicyOutput{PolicyName: input.PolicyName, Status: "updated"}, nil
+	return nil, keylime.UpdateRuntimePolicyOutput{
+		PolicyName:     input.PolicyName,
+		Status:         "updated",
+		Revision:       update.revision,
+		Retries:        update.retries,
+		HistoryWarning: update.historyWarning,
+	}, nil
 }
 
 func (h *ToolHandler) DeleteRuntimePolicy(ctx context.Context, req *mcp.CallToolRequest, input keylime.DeleteRuntimePolicyInput) (
@@ -494,7 +977,15 @@ func (h *ToolHandler) DeleteRuntimePolicy(ctx context.Context, req *mcp.CallTool
 	if err := validatePolicyName(input.PolicyName); err != nil {
 		return nil, nil, err
 	}
-	if err := checkResponse(h.service.Verifier.Delete(ctx, fmt.Sprintf("allowlists/%s", input.PolicyName))); err != nil {
+	svc, err := h.clusters.Get(input.Cluster)
+	if err != nil {
+		return nil, nil, err
+	}
+	ref := h.policyRef(input.Cluster, history.KindRuntime, input.PolicyName)
+	if err := h.recordDeleted(ctx, svc, ref, "Delete_runtime_policy", input.Reason); err != nil {
+		return nil, nil, err
+	}
+	if err := checkResponse(svc.Verifier.Delete(ctx, fmt.Sprintf("allowlists/%s", input.PolicyName))); err != nil {
 		return nil, nil, err
 	}
 	return nil, keylime.DeletePolicyOutput{PolicyName: input.PolicyName, Status: "deleted"}, nil
@@ -505,7 +996,11 @@ func (h *ToolHandler) ListMBPolicies(ctx context.Context, req *mcp.CallToolReque
 	any,
 	error,
 ) {
-	result, err := fetchAndDecode[keylime.ListMBPoliciesOutput](h.service.Verifier.Get(ctx, "mbpolicies/"))
+	svc, err := h.clusters.Get(input.Cluster)
+	if err != nil {
+		return nil, nil, err
+	}
+	result, err := fetchAndDecode[keylime.ListMBPoliciesOutput](svc.Verifier.Get(ctx, "mbpolicies/"))
 	if err != nil {
 		return nil, nil, err
 	}
@@ -520,8 +1015,12 @@ func (h *ToolHandler) GetMBPolicy(ctx context.Context, req *mcp.CallToolRequest,
 	if err := validatePolicyName(input.PolicyName); err != nil {
 		return nil, nil, err
 	}
+	svc, err := h.clusters.Get(input.Cluster)
+	if err != nil {
+		return nil, nil, err
+	}
 	result, err := fetchAndDecode[keylime.GetMBPolicyOutput](
-		h.service.Verifier.Get(ctx, fmt.Sprintf("mbpolicies/%s", input.PolicyName)),
+		svc.Verifier.Get(ctx, fmt.Sprintf("mbpolicies/%s", input.PolicyName)),
 	)
 	if err != nil {
 		return nil, nil, err
@@ -538,20 +1037,76 @@ func (h *ToolHandler) ImportMBPolicy(ctx context.Context, req *mcp.CallToolReque
 		return nil, nil, err
 	}
 
-	data, err := readPolicyFile(input.FilePath)
+	data, err := readJSONImportSource(input.FilePath, input.Content)
+	if err != nil {
+		return nil, nil, err
+	}
+	warnings, err := lintForImport(history.KindMB, data, input.IgnoreLintErrors)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	body := map[string]any{
-		"mb_policy": string(data),
+	svc, err := h.clusters.Get(input.Cluster)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := uploadMBPolicy(ctx, svc, input.Name, data); err != nil {
+		return nil, nil, err
 	}
+	ref := h.policyRef(input.Cluster, history.KindMB, input.Name)
+	_, err = h.recordUpload(ref, "Import_mb_policy", input.Reason, data, 0)
 
-	if err := checkResponse(h.service.Verifier.Post(ctx, fmt.Sprintf("mbpolicies/%s", input.Name), body)); err != nil {
+	return nil, keylime.ImportMBPolicyOutput{Name: input.Name, Status: "imported", Warnings: warnings, HistoryWarning: historyWarning(err)}, nil
+}
+
+func (h *ToolHandler) CreateMBPolicy(ctx context.Context, req *mcp.CallToolRequest, input keylime.CreateMBPolicyInput) (
+	*mcp.CallToolResult,
+	any,
+	error,
+) {
+	if err := validateCreateMBPolicy(input); err != nil {
 		return nil, nil, err
 	}
+	log, err := readEventLog(input.EventLogPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	var svc *keylime.Service
+	if input.PolicyName != "" {
+		if svc, err = h.clusters.Get(input.Cluster); err != nil {
+			return nil, nil, err
+		}
+	}
 
-	return nil, keylime.ImportMBPolicyOutput{Name: input.Name, Status: "imported"}, nil
+	state, err := policy.FromEventLog(log, input.SkipSecureBoot)
+	if errors.Is(err, policy.ErrSecureBootDisabled) {
+		return nil, nil, invalidf("%v; set skip_secureboot to generate a policy without SecureBoot validation", err)
+	}
+	if err != nil {
+		return nil, nil, invalidf("cannot build a measured boot policy from %s: %v", input.EventLogPath, err)
+	}
+	data, err := writePolicy(input.OutputPath, state)
+	if err != nil {
+		return nil, nil, err
+	}
+	output := mapReferenceStateToOutput(log, state)
+	output.OutputPath = input.OutputPath
+	if svc != nil {
+		if err := uploadMBPolicy(ctx, svc, input.PolicyName, data); err != nil {
+			if input.OutputPath != "" {
+				return nil, nil, fmt.Errorf("policy written to %s but not imported: %w", input.OutputPath, err)
+			}
+			return nil, nil, err
+		}
+		ref := h.policyRef(input.Cluster, history.KindMB, input.PolicyName)
+		_, err := h.recordUpload(ref, "Create_mb_policy", input.Reason, data, 0)
+		output.HistoryWarning = historyWarning(err)
+		output.PolicyName, output.Status = input.PolicyName, "imported"
+		if input.OutputPath != "" {
+			output.Status = "created_and_imported"
+		}
+	}
+	return nil, output, nil
 }
 
 func (h *ToolHandler) DeleteMBPolicy(ctx context.Context, req *mcp.CallToolRequest, input keylime.DeleteMBPolicyInput) (
@@ -562,12 +1117,118 @@ func (h *ToolHandler) DeleteMBPolicy(ctx context.Context, req *mcp.CallToolReque
 	if err := validatePolicyName(input.PolicyName); err != nil {
 		return nil, nil, err
 	}
-	if err := checkResponse(h.service.Verifier.Delete(ctx, fmt.Sprintf("mbpolicies/%s", input.PolicyName))); err != nil {
+	svc, err := h.clusters.Get(input.Cluster)
+	if err != nil {
+		return nil, nil, err
+	}
+	ref := h.policyRef(input.Cluster, history.KindMB, input.PolicyName)
+	if err := h.recordDeleted(ctx, svc, ref, "Delete_mb_policy", input.Reason); err != nil {
+		return nil, nil, err
+	}
+	if err := checkResponse(svc.Verifier.Delete(ctx, fmt.Sprintf("mbpolicies/%s", input.PolicyName))); err != nil {
 		return nil, nil, err
 	}
 	return nil, keylime.DeletePolicyOutput{PolicyName: input.PolicyName, Status: "deleted"}, nil
 }
 
+func (h *ToolHandler) LintPolicy(ctx context.Context, req *mcp.CallToolRequest, input keylime.LintPolicyInput) (
+	*mcp.CallToolResult,
+	any,
+	error,
+) {
+	if (input.FilePath == "") == (input.PolicyName == "") {
+		return nil, nil, invalidf("exactly one of file_path or policy_name is required")
+	}
+	if err := validatePolicyKind(input.Kind); err != nil {
+		return nil, nil, err
+	}
+	var data []byte
+	if input.FilePath != "" {
+		var err error
+		if data, err = readPolicyFile(input.FilePath); err != nil {
+			return nil, nil, err
+		}
+		if input.Kind == "" {
+			input.Kind = detectPolicyKind(data)
+		}
+	} else {
+		if err := validatePolicyName(input.PolicyName); err != nil {
+			return nil, nil, err
+		}
+		svc, err := h.clusters.Get(input.Cluster)
+		if err != nil {
+			return nil, nil, err
+		}
+		if input.Kind == "" {
+			input.Kind = history.KindRuntime
+		}
+		stored, err := fetchStoredPolicy(ctx, svc, input.Kind, input.PolicyName)
+		if err != nil {
+			return nil, nil, err
+		}
+		data = []byte(stored)
+	}
+
+	findings := lintPolicy(input.Kind, data)
+	output := keylime.LintPolicyOutput{Kind: input.Kind, Findings: mapFindings(findings, "")}
+	for _, f := range findings {
+		if f.Severity == policy.SeverityError {
+			output.ErrorCount++
+		} else {
+			output.WarningCount++
+		}
+	}
+	output.Valid = output.ErrorCount == 0
+	return nil, output, nil
+}
+
+func (h *ToolHandler) ListPolicyHistory(ctx context.Context, req *mcp.CallToolRequest, input keylime.ListPolicyHistoryInput) (
+	*mcp.CallToolResult,
+	any,
+	error,
+) {
+	if h.history == nil {
+		return nil, nil, errHistoryDisabled
+	}
+	if err := validatePolicyKind(input.Kind); err != nil {
+		return nil, nil, err
+	}
+	if input.Limit < 0 {
+		return nil, nil, invalidf("limit must not be negative")
+	}
+	if input.Limit == 0 {
+		input.Limit = defaultHistoryEntries
+	}
+	entries, err := h.history.List(history.Filter{Cluster: input.Cluster, Kind: input.Kind, Name: input.PolicyName})
+	if err != nil {
+		return nil, nil, err
+	}
+	return nil, mapHistoryToOutput(entries, input.Limit), nil
+}
+
+func (h *ToolHandler) RollbackPolicy(ctx context.Context, req *mcp.CallToolRequest, input keylime.RollbackPolicyInput) (
+	*mcp.CallToolResult,
+	any,
+	error,
+) {
+	if h.history == nil {
+		return nil, nil, errHistoryDisabled
+	}
+	entry, err := h.history.Get(input.Version)
+	if err != nil {
+		return nil, nil, err
+	}
+	svc, err := h.clusters.Get(entry.Cluster)
+	if err != nil {
+		return nil, nil, err
+	}
+	output, err := h.restoreVersion(ctx, svc, entry, input.Reason)
+	if err != nil {
+		return nil, nil, err
+	}
+	return nil, output, nil
+}
+
 func (h *ToolHandler) InvestigateVerifierLogs(ctx context.Context, req *mcp.CallToolRequest, input keylime.InvestigateVerifierLogsInput) (
 	*mcp.CallToolResult,
 	any,
@@ -583,7 +1244,7 @@ func (h *ToolHandler) InvestigateVerifierLogs(ctx context.Context, req *mcp.Call
 	}
 	if filter != "all" {
 		if _, ok := logFilters[filter]; !ok {
-			return nil, nil, fmt.Errorf("invalid filter %q: must be 'all', 'attestation_failures', or 'errors'", filter)
+			return nil, nil, invalidf("invalid filter %q: must be 'all', 'attestation_failures', or 'errors'", filter)
 		}
 	}
 
@@ -230,9 +230,237 @@ func TestGetFailedAgents(t *testing.T) {
 
 		result := output.(keylime.GetFailedAgentsOutput)
 		assert.Len(t, result.FailedAgents, 1)
+		assert.Equal(t, 1, result.ScannedAgents)
+		require.Len(t, result.SkippedAgents, 1)
+		assert.Equal(t, keylime.AgentIssue{Cluster: keylime.DefaultClusterName, AgentUUID: uuid1, Reason: "not enrolled in verifier"}, result.SkippedAgents[0])
+	})
+
+	t.Run("verifier error is not mistaken for not enrolled", func(t *testing.T) {
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /v2.5/agents", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, `{"code":200,"status":"Success","results":{"uuids":["%s"]}}`, uuid1)
+		})
+		mux.HandleFunc("GET /v2.5/agents/{uuid}", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"code":403,"status":"forbidden"}`))
+		})
+		h := newTestHandler(t, mux)
+
+		_, output, err := h.GetFailedAgents(context.Background(), nil, keylime.GetFailedAgentsInput{})
+		require.NoError(t, err)
+
+		result := output.(keylime.GetFailedAgentsOutput)
+		assert.Empty(t, result.FailedAgents)
+		assert.Empty(t, result.SkippedAgents)
+		require.Len(t, result.ErroredAgents, 1)
+		assert.Equal(t, uuid1, result.ErroredAgents[0].AgentUUID)
+		assert.Contains(t, result.ErroredAgents[0].Reason, "forbidden")
 	})
 }
 
+func TestGetFailedAgentsBulk(t *testing.T) {
+	bulkListing := func(t *testing.T) []byte {
+		failed := loadTestdata(t, "agent_status_failed.json")
+		healthy := loadTestdata(t, "agent_status.json")
+		var f, h struct {
+			Results json.RawMessage `json:"results"`
+		}
+		require.NoError(t, json.Unmarshal(failed, &f))
+		require.NoError(t, json.Unmarshal(healthy, &h))
+		return []byte(fmt.Sprintf(`{"code":200,"status":"Success","results":{"%s":%s,"%s":%s}}`,
+			uuid1, f.Results, uuid2, h.Results))
+	}
+
+	t.Run("single request for the whole fleet", func(t *testing.T) {
+		listing := bulkListing(t)
+		var query string
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /v2.5/agents/", func(w http.ResponseWriter, r *http.Request) {
+			query = r.URL.RawQuery
+			w.Write(listing)
+		})
+		mux.HandleFunc("GET /v2.5/agents", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, `{"code":200,"status":"Success","results":{"uuids":["%s","%s"]}}`, uuid1, uuid2)
+		})
+		mux.HandleFunc("GET /v2.5/agents/{uuid}", func(w http.ResponseWriter, r *http.Request) {
+			t.Error("per-agent endpoint should not be called")
+		})
+		h := newTestHandler(t, mux)
+
+		_, output, err := h.GetFailedAgents(context.Background(), nil, keylime.GetFailedAgentsInput{VerifierID: "default"})
+		require.NoError(t, err)
+
+		result := output.(keylime.GetFailedAgentsOutput)
+		require.Len(t, result.FailedAgents, 1)
+		assert.Equal(t, uuid1, result.FailedAgents[0].AgentUUID)
+		assert.Equal(t, 2, result.ScannedAgents)
+		assert.Empty(t, result.SkippedAgents)
+		assert.Equal(t, "bulk=true&verifier=default", query)
+	})
+
+	t.Run("registered agents that are not enrolled are skipped", func(t *testing.T) {
+		listing := bulkListing(t)
+		for name, enrolled := range map[string]string{
+			"not enrolled":                 uuid2,
+			"enrolled in another verifier": uuid3,
+		} {
+			t.Run(name, func(t *testing.T) {
+				mux := http.NewServeMux()
+				mux.HandleFunc("GET /v2.5/agents/", func(w http.ResponseWriter, r *http.Request) {
+					if r.URL.Query().Get("bulk") != "" {
+						w.Write(listing)
+						return
+					}
+					fmt.Fprintf(w, `{"code":200,"status":"Success","results":{"uuids":[["%s"],["%s"],["%s"]]}}`, uuid1, uuid2, enrolled)
+				})
+				mux.HandleFunc("GET /v2.5/agents", func(w http.ResponseWriter, r *http.Request) {
+					fmt.Fprintf(w, `{"code":200,"status":"Success","results":{"uuids":["%s","%s","%s"]}}`, uuid1, uuid2, uuid3)
+				})
+				h := newTestHandler(t, mux)
+
+				_, output, err := h.GetFailedAgents(context.Background(), nil, keylime.GetFailedAgentsInput{VerifierID: "default"})
+				require.NoError(t, err)
+				result := output.(keylime.GetFailedAgentsOutput)
+				assert.Equal(t, 2, result.ScannedAgents)
+				if enrolled == uuid3 {
+					assert.Empty(t, result.SkippedAgents)
+					return
+				}
+				assert.Equal(t, []keylime.AgentIssue{{Cluster: keylime.DefaultClusterName, AgentUUID: uuid3, Reason: "not enrolled in verifier"}}, result.SkippedAgents)
+			})
+		}
+	})
+
+	t.Run("falls back when bulk parameter is ignored", func(t *testing.T) {
+		failedData := loadTestdata(t, "agent_status_failed.json")
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /v2.5/agents/", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, `{"code":200,"status":"Success","results":{"uuids":[["%s"]]}}`, uuid1)
+		})
+		mux.HandleFunc("GET /v2.5/agents", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, `{"code":200,"status":"Success","results":{"uuids":["%s"]}}`, uuid1)
+		})
+		mux.HandleFunc("GET /v2.5/agents/{uuid}", func(w http.ResponseWriter, r *http.Request) {
+			w.Write(failedData)
+		})
+		h := newTestHandler(t, mux)
+
+		_, output, err := h.GetFailedAgents(context.Background(), nil, keylime.GetFailedAgentsInput{})
+		require.NoError(t, err)
+		assert.Len(t, output.(keylime.GetFailedAgentsOutput).FailedAgents, 1)
+	})
+
+	t.Run("verifier error is reported", func(t *testing.T) {
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /v2.5/agents/", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"code":500,"status":"database error"}`))
+		})
+		h := newTestHandler(t, mux)
+
+		_, _, err := h.GetFailedAgents(context.Background(), nil, keylime.GetFailedAgentsInput{})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "database error")
+	})
+}
+
+func TestGetFailedAgentsMultiCluster(t *testing.T) {
+	failedCluster := func(uuid string) http.Handler {
+		statusFailed := loadTestdata(t, "agent_status_failed.json")
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /v2.5/agents", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, `{"code":200,"status":"Success","results":{"uuids":["%s"]}}`, uuid)
+		})
+		mux.HandleFunc("GET /v2.5/agents/{uuid}", func(w http.ResponseWriter, r *http.Request) {
+			w.Write(statusFailed)
+		})
+		return mux
+	}
+	downCluster := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"code":503,"status":"registrar unavailable"}`))
+	})
+
+	t.Run("fans out and tags results with cluster", func(t *testing.T) {
+		h := newTestClusterHandler(t, "dc1", map[string]http.Handler{
+			"dc1": failedCluster(uuid1),
+			"dc2": failedCluster(uuid2),
+		})
+
+		_, output, err := h.GetFailedAgents(context.Background(), nil, keylime.GetFailedAgentsInput{})
+		require.NoError(t, err)
+
+		result := output.(keylime.GetFailedAgentsOutput)
+		require.Len(t, result.FailedAgents, 2)
+		byCluster := map[string]string{}
+		for _, a := range result.FailedAgents {
+			byCluster[a.Cluster] = a.AgentUUID
+		}
+		assert.Equal(t, map[string]string{"dc1": uuid1, "dc2": uuid2}, byCluster)
+		assert.Empty(t, result.ClusterErrors)
+	})
+
+	t.Run("explicit cluster limits the query", func(t *testing.T) {
+		h := newTestClusterHandler(t, "dc1", map[string]http.Handler{
+			"dc1": failedCluster(uuid1),
+			"dc2": failedCluster(uuid2),
+		})
+
+		_, output, err := h.GetFailedAgents(context.Background(), nil, keylime.GetFailedAgentsInput{Cluster: "dc2"})
+		require.NoError(t, err)
+
+		result := output.(keylime.GetFailedAgentsOutput)
+		require.Len(t, result.FailedAgents, 1)
+		assert.Equal(t, uuid2, result.FailedAgents[0].AgentUUID)
+		assert.Equal(t, "dc2", result.FailedAgents[0].Cluster)
+	})
+
+	t.Run("unreachable cluster reported without failing the fleet query", func(t *testing.T) {
+		h := newTestClusterHandler(t, "dc1", map[string]http.Handler{
+			"dc1": failedCluster(uuid1),
+			"dc2": downCluster,
+		})
+
+		_, output, err := h.GetFailedAgents(context.Background(), nil, keylime.GetFailedAgentsInput{})
+		require.NoError(t, err)
+
+		result := output.(keylime.GetFailedAgentsOutput)
+		require.Len(t, result.FailedAgents, 1)
+		assert.Equal(t, "dc1", result.FailedAgents[0].Cluster)
+		assert.Contains(t, result.ClusterErrors["dc2"], "503")
+	})
+
+	t.Run("unknown cluster rejected", func(t *testing.T) {
+		h := newTestClusterHandler(t, "dc1", map[string]http.Handler{"dc1": failedCluster(uuid1)})
+
+		_, _, err := h.GetFailedAgents(context.Background(), nil, keylime.GetFailedAgentsInput{Cluster: "dc9"})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "unknown cluster")
+	})
+}
+
+func TestAgentToolsUseNamedCluster(t *testing.T) {
+	statusData := loadTestdata(t, "agent_status.json")
+	var dc2Calls int
+	h := newTestClusterHandler(t, "dc1", map[string]http.Handler{
+		"dc1": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Error("primary cluster should not be called")
+		}),
+		"dc2": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			dc2Calls++
+			w.Write(statusData)
+		}),
+	})
+
+	_, output, err := h.GetAgentStatus(context.Background(), nil, keylime.GetAgentStatusInput{
+		AgentUUID: uuid1,
+		Cluster:   "dc2",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, uuid1, output.(keylime.GetAgentStatusOutput).AgentUUID)
+	assert.Equal(t, 1, dc2Calls)
+}
+
 func TestReactivateAgent(t *testing.T) {
 	t.Run("success", func(t *testing.T) {
 		data := loadTestdata(t, "success.json")
@@ -381,6 +609,53 @@ func TestEnrollAgentToVerifier(t *testing.T) {
 		assert.Contains(t, enrollBody["tpm_policy"], "0x400") // PCR 10
 	})
 
+	t.Run("enroll with options", func(t *testing.T) {
+		regData := loadTestdata(t, "registrar_agent_details.json")
+		successData := loadTestdata(t, "success.json")
+		var enrollBody map[string]any
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /v2.5/agents/{uuid}", func(w http.ResponseWriter, r *http.Request) {
+			w.Write(regData)
+		})
+		mux.HandleFunc("POST /v2.5/agents/{uuid}", func(w http.ResponseWriter, r *http.Request) {
+			_ = json.NewDecoder(r.Body).Decode(&enrollBody)
+			w.Write(successData)
+		})
+		h := newTestHandler(t, mux)
+
+		_, _, err := h.EnrollAgentToVerifier(context.Background(), nil, keylime.EnrollAgentToVerifierInput{
+			AgentUUID: uuid1,
+			EnrollmentOptions: keylime.EnrollmentOptions{
+				PCRs:                    []int{0, 7},
+				AcceptTPMEncryptionAlgs: []string{"ecc"},
+				AcceptTPMSigningAlgs:    []string{"ecdsa"},
+				Metadata:                map[string]any{"site": "edge-7"},
+				CloudAgentIP:            "203.0.113.7",
+				CloudAgentPort:          19002,
+			},
+		})
+		require.NoError(t, err)
+
+		assert.Equal(t, `{"mask":"0x81"}`, enrollBody["tpm_policy"])
+		assert.Equal(t, []any{"ecc"}, enrollBody["accept_tpm_encryption_algs"])
+		assert.Equal(t, []any{"ecdsa"}, enrollBody["accept_tpm_signing_algs"])
+		assert.Equal(t, `{"site":"edge-7"}`, enrollBody["metadata"])
+		assert.Equal(t, "203.0.113.7", enrollBody["cloudagent_ip"])
+		assert.Equal(t, float64(19002), enrollBody["cloudagent_port"])
+	})
+
+	t.Run("invalid options are rejected before any request", func(t *testing.T) {
+		h := newTestHandler(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}))
+		_, _, err := h.EnrollAgentToVerifier(context.Background(), nil, keylime.EnrollAgentToVerifierInput{
+			AgentUUID:         uuid1,
+			EnrollmentOptions: keylime.EnrollmentOptions{AcceptTPMSigningAlgs: []string{"ecdsa"}},
+		})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "accept_tpm_signing_algs")
+	})
+
 	t.Run("invalid uuid", func(t *testing.T) {
 		h := newTestHandler(t, http.NotFoundHandler())
 		_, _, err := h.EnrollAgentToVerifier(context.Background(), nil, keylime.EnrollAgentToVerifierInput{
@@ -480,6 +755,18 @@ func TestUpdateAgent(t *testing.T) {
 		assert.Contains(t, err.Error(), uuid1)
 	})
 
+	t.Run("invalid options prevent unenroll", func(t *testing.T) {
+		h := newTestHandler(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}))
+		_, _, err := h.UpdateAgent(context.Background(), nil, keylime.UpdateAgentInput{
+			AgentUUID:         uuid1,
+			EnrollmentOptions: keylime.EnrollmentOptions{PCRs: []int{42}},
+		})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "pcrs")
+	})
+
 	t.Run("prep failure prevents unenroll", func(t *testing.T) {
 		successData := loadTestdata(t, "success.json")
 		var deleteCalled bool
@@ -0,0 +1,624 @@
+package mcptools
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/keylime/keylime-mcp/internal/history"
+	"github.com/keylime/keylime-mcp/internal/keylime"
+	"github.com/keylime/keylime-mcp/internal/keylimetest"
+	"github.com/keylime/keylime-mcp/internal/tpm"
+	"github.com/keylime/keylime-mcp/internal/tpm/tpmtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newFakeHandler(t *testing.T) (*ToolHandler, *keylimetest.Server) {
+	t.Helper()
+	server := keylimetest.NewServer(keylimetest.Config{})
+	t.Cleanup(server.Close)
+	svc, err := keylime.NewService(server.KeylimeConfig())
+	require.NoError(t, err)
+	return NewToolHandler(svc), server
+}
+
+// TestFakeKeylimeWorkflow runs an enroll, fail, reactivate cycle against the in-memory Keylime.
+func TestFakeKeylimeWorkflow(t *testing.T) {
+	h, fake := newFakeHandler(t)
+	ctx := context.Background()
+	fake.RegisterAgent(keylimetest.Agent{UUID: uuid1})
+	fake.RegisterAgent(keylimetest.Agent{UUID: uuid2})
+
+	policyPath := filepath.Join(t.TempDir(), "policy.json")
+	require.NoError(t, os.WriteFile(policyPath, loadTestdata(t, "valid_runtime_policy.json"), 0600))
+	_, _, err := h.ImportRuntimePolicy(ctx, nil, keylime.ImportRuntimePolicyInput{Name: testPolicyName, FilePath: policyPath, IgnoreLintErrors: true})
+	require.NoError(t, err)
+
+	for _, uuid := range []string{uuid1, uuid2} {
+		_, _, err = h.EnrollAgentToVerifier(ctx, nil, keylime.EnrollAgentToVerifierInput{AgentUUID: uuid, RuntimePolicyName: testPolicyName})
+		require.NoError(t, err)
+	}
+	fake.Tick()
+	fake.Tick()
+
+	_, output, err := h.GetAgentStatus(ctx, nil, keylime.GetAgentStatusInput{AgentUUID: uuid1})
+	require.NoError(t, err)
+	status := output.(keylime.GetAgentStatusOutput)
+	assert.Equal(t, keylime.StateGetQuote, status.OperationalState)
+	assert.True(t, status.HasRuntimePolicy)
+	assert.Equal(t, 1, status.AttestationCount)
+
+	require.True(t, fake.FailAgent(uuid2, keylimetest.Failure{EventID: "ima.validation.ima-ng.not_in_allowlist"}))
+	_, output, err = h.GetFailedAgents(ctx, nil, keylime.GetFailedAgentsInput{})
+	require.NoError(t, err)
+	failed := output.(keylime.GetFailedAgentsOutput)
+	assert.Equal(t, 2, failed.ScannedAgents)
+	require.Len(t, failed.FailedAgents, 1)
+	assert.Equal(t, uuid2, failed.FailedAgents[0].AgentUUID)
+
+	_, _, err = h.ReactivateAgent(ctx, nil, keylime.ReactivateAgentInput{AgentUUID: uuid2})
+	require.NoError(t, err)
+	fake.Tick()
+	_, output, err = h.GetFailedAgents(ctx, nil, keylime.GetFailedAgentsInput{})
+	require.NoError(t, err)
+	assert.Empty(t, output.(keylime.GetFailedAgentsOutput).FailedAgents)
+}
+
+func TestFakeKeylimeFaults(t *testing.T) {
+	h, fake := newFakeHandler(t)
+	fake.RegisterAgent(keylimetest.Agent{UUID: uuid1})
+	fake.InjectFault(keylimetest.Fault{Service: "registrar", Status: http.StatusServiceUnavailable, Times: 1})
+
+	_, _, err := h.GetAllAgents(context.Background(), nil, keylime.GetAllAgentsInput{})
+	require.Error(t, err)
+	assert.Equal(t, CodeUnavailable, ClassifyError(err))
+
+	_, output, err := h.GetAllAgents(context.Background(), nil, keylime.GetAllAgentsInput{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{uuid1}, output.(keylime.GetAllAgentsOutput).Agents)
+}
+
+// enrollPolled enrolls uuid with the test runtime policy and lets the verifier poll it once.
+func enrollPolled(t *testing.T, h *ToolHandler, fake *keylimetest.Server, uuid string) {
+	t.Helper()
+	ctx := context.Background()
+	fake.RegisterAgent(keylimetest.Agent{UUID: uuid})
+	if _, ok := fake.RuntimePolicy(testPolicyName); !ok {
+		fake.AddRuntimePolicy(testPolicyName, string(loadTestdata(t, "valid_runtime_policy.json")))
+	}
+	_, _, err := h.EnrollAgentToVerifier(ctx, nil, keylime.EnrollAgentToVerifierInput{
+		AgentUUID:         uuid,
+		RuntimePolicyName: testPolicyName,
+		EnrollmentOptions: keylime.EnrollmentOptions{Metadata: map[string]any{"rack": "r1"}},
+	})
+	require.NoError(t, err)
+	fake.Tick()
+}
+
+// keepTicking advances the fake until the test ends, so that deleted agents get removed.
+func keepTicking(t *testing.T, fake *keylimetest.Server) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	t.Cleanup(func() {
+		close(done)
+		<-stopped
+	})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(5 * time.Millisecond):
+				fake.Tick()
+			}
+		}
+	}()
+}
+
+func TestFakeKeylimeUpdateAgent(t *testing.T) {
+	t.Run("waits for removal and re-enrolls", func(t *testing.T) {
+		h, fake := newFakeHandler(t)
+		h.removalPollInterval = 5 * time.Millisecond
+		enrollPolled(t, h, fake, uuid1)
+		keepTicking(t, fake)
+
+		_, output, err := h.UpdateAgent(context.Background(), nil, keylime.UpdateAgentInput{
+			AgentUUID:         uuid1,
+			RuntimePolicyName: testPolicyName,
+			EnrollmentOptions: keylime.EnrollmentOptions{Metadata: map[string]any{"rack": "r2"}},
+		})
+		require.NoError(t, err)
+
+		result := output.(keylime.UpdateAgentOutput)
+		assert.Equal(t, keylime.UpdateStatusUpdated, result.Status)
+		assert.True(t, result.WaitedForRemoval)
+		assert.Equal(t, `{"rack":"r1"}`, result.PreviousEnrollment.MetaData)
+		assert.Empty(t, result.PreviousEnrollment.Missing)
+
+		_, policies, err := h.GetAgentPolicies(context.Background(), nil, keylime.GetAgentPoliciesInput{AgentUUID: uuid1})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]any{"rack": "r2"}, policies.(keylime.GetAgentPoliciesOutput).MetaData)
+	})
+
+	t.Run("agent with runtime and measured boot policies", func(t *testing.T) {
+		h, fake := newFakeHandler(t)
+		h.removalPollInterval = 5 * time.Millisecond
+		fake.AddRuntimePolicy(testPolicyName, string(loadTestdata(t, "valid_runtime_policy.json")))
+		fake.AddMBPolicy(testMBPolicyName, string(loadTestdata(t, "valid_mb_policy.json")))
+		fake.RegisterAgent(keylimetest.Agent{UUID: uuid1})
+		require.True(t, fake.EnrollAgent(uuid1, testPolicyName, testMBPolicyName))
+		fake.Tick()
+		keepTicking(t, fake)
+
+		_, output, err := h.UpdateAgent(context.Background(), nil, keylime.UpdateAgentInput{
+			AgentUUID:         uuid1,
+			RuntimePolicyName: testPolicyName,
+			MbPolicyName:      testMBPolicyName,
+		})
+		require.NoError(t, err)
+		result := output.(keylime.UpdateAgentOutput)
+		assert.Equal(t, keylime.UpdateStatusUpdated, result.Status)
+		assert.True(t, result.PreviousEnrollment.HasRuntimePolicy)
+		assert.True(t, result.PreviousEnrollment.HasMeasuredBootPolicy)
+		assert.Equal(t, []string{"runtime_policy", "mb_policy"}, result.PreviousEnrollment.Missing, "named policies are not reported")
+		assert.Equal(t, testMBPolicyName, fake.Snapshot().Agents[uuid1].MBPolicy)
+	})
+
+	t.Run("inline measured boot policy is restored", func(t *testing.T) {
+		h, fake := newFakeHandler(t)
+		h.removalPollInterval = 5 * time.Millisecond
+		fake.RegisterAgent(keylimetest.Agent{UUID: uuid1})
+		fake.AddRuntimePolicy(testPolicyName, string(loadTestdata(t, "valid_runtime_policy.json")))
+		mbPolicy := string(loadTestdata(t, "valid_mb_policy.json"))
+		svc, err := h.clusters.Get("")
+		require.NoError(t, err)
+		body, err := svc.PrepareEnrollmentBody(context.Background(), uuid1, testPolicyName, "", keylime.EnrollmentOptions{})
+		require.NoError(t, err)
+		body["mb_policy"] = mbPolicy
+		require.NoError(t, checkResponse(svc.Verifier.Post(context.Background(), "agents/"+uuid1, body)))
+		fake.Tick()
+		keepTicking(t, fake)
+		fake.InjectFault(keylimetest.Fault{Service: "verifier", Method: http.MethodPost, Path: "agents/", Status: http.StatusBadRequest, Times: 1})
+
+		_, output, err := h.UpdateAgent(context.Background(), nil, keylime.UpdateAgentInput{AgentUUID: uuid1})
+		require.NoError(t, err)
+
+		result := output.(keylime.UpdateAgentOutput)
+		assert.Equal(t, keylime.UpdateStatusRolledBack, result.Status)
+		assert.Empty(t, result.PreviousEnrollment.Missing)
+		agent := fake.Snapshot().Agents[uuid1]
+		assert.Equal(t, uuid1, agent.RuntimePolicy)
+		assert.Equal(t, uuid1, agent.MBPolicy)
+		restored, ok := fake.MBPolicy(uuid1)
+		require.True(t, ok)
+		assert.Equal(t, mbPolicy, restored)
+	})
+
+	t.Run("restores the previous enrollment when re-enrollment fails", func(t *testing.T) {
+		h, fake := newFakeHandler(t)
+		h.removalPollInterval = 5 * time.Millisecond
+		fake.RegisterAgent(keylimetest.Agent{UUID: uuid1})
+		_, _, err := h.EnrollAgentToVerifier(context.Background(), nil, keylime.EnrollAgentToVerifierInput{
+			AgentUUID:         uuid1,
+			EnrollmentOptions: keylime.EnrollmentOptions{Metadata: map[string]any{"rack": "r1"}},
+		})
+		require.NoError(t, err)
+		fake.Tick()
+		keepTicking(t, fake)
+		fake.InjectFault(keylimetest.Fault{Service: "verifier", Method: http.MethodPost, Path: "agents/", Status: http.StatusBadRequest, Times: 1})
+
+		_, output, err := h.UpdateAgent(context.Background(), nil, keylime.UpdateAgentInput{
+			AgentUUID:         uuid1,
+			EnrollmentOptions: keylime.EnrollmentOptions{Metadata: map[string]any{"rack": "r2"}},
+		})
+		require.NoError(t, err)
+
+		result := output.(keylime.UpdateAgentOutput)
+		assert.Equal(t, keylime.UpdateStatusRolledBack, result.Status)
+		assert.Contains(t, result.EnrollmentError, "400")
+		assert.Empty(t, result.PreviousEnrollment.Missing)
+		_, policies, err := h.GetAgentPolicies(context.Background(), nil, keylime.GetAgentPoliciesInput{AgentUUID: uuid1})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]any{"rack": "r1"}, policies.(keylime.GetAgentPoliciesOutput).MetaData)
+	})
+
+	t.Run("partial restore is reported", func(t *testing.T) {
+		h, fake := newFakeHandler(t)
+		h.removalPollInterval = 5 * time.Millisecond
+		fake.AddMBPolicy(testMBPolicyName, string(loadTestdata(t, "valid_mb_policy.json")))
+		fake.RegisterAgent(keylimetest.Agent{UUID: uuid1})
+		require.True(t, fake.EnrollAgent(uuid1, "", testMBPolicyName))
+		fake.Tick()
+		keepTicking(t, fake)
+		fake.InjectFault(keylimetest.Fault{Service: "verifier", Method: http.MethodPost, Path: "agents/", Status: http.StatusBadRequest, Times: 1})
+
+		_, output, err := h.UpdateAgent(context.Background(), nil, keylime.UpdateAgentInput{
+			AgentUUID:         uuid1,
+			EnrollmentOptions: keylime.EnrollmentOptions{Metadata: map[string]any{"rack": "r2"}},
+		})
+		require.NoError(t, err)
+		result := output.(keylime.UpdateAgentOutput)
+		assert.Equal(t, keylime.UpdateStatusPartiallyRestored, result.Status)
+		assert.Contains(t, result.EnrollmentError, "400")
+		assert.Equal(t, []string{"mb_policy"}, result.PreviousEnrollment.Missing)
+
+		agent := fake.Snapshot().Agents[uuid1]
+		assert.True(t, agent.Enrolled)
+		assert.Empty(t, agent.MBPolicy, "the named measured boot policy could not be restored")
+	})
+
+	t.Run("gives up when the agent is not removed", func(t *testing.T) {
+		h, fake := newFakeHandler(t)
+		h.removalPollInterval = 5 * time.Millisecond
+		h.removalTimeout = 30 * time.Millisecond
+		enrollPolled(t, h, fake, uuid1)
+
+		_, _, err := h.UpdateAgent(context.Background(), nil, keylime.UpdateAgentInput{AgentUUID: uuid1})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "still being removed")
+		assert.Equal(t, keylime.StateTerminated, *fake.Snapshot().Agents[uuid1].OperationalState)
+	})
+}
+
+func TestFakeKeylimeIdentityVerification(t *testing.T) {
+	// newIdentityHandler serves a stub agent for uuid1 with a TPM whose CA is in the cert store.
+	newIdentityHandler := func(t *testing.T, enforce bool) (*ToolHandler, *keylimetest.Server, *tpmtest.Agent) {
+		t.Helper()
+		fake := keylimetest.NewServer(keylimetest.Config{})
+		t.Cleanup(fake.Close)
+		sim, err := tpmtest.New(tpm.AlgRSA)
+		require.NoError(t, err)
+		agent := &tpmtest.Agent{TPM: sim}
+		agentServer := httptest.NewServer(agent)
+		t.Cleanup(agentServer.Close)
+		addr := agentServer.Listener.Addr().(*net.TCPAddr)
+
+		aik, ek, ekcert := sim.Registration()
+		fake.RegisterAgent(keylimetest.Agent{UUID: uuid1, IP: addr.IP.String(), Port: addr.Port, AIK: aik, EK: ek, EKCert: ekcert})
+
+		config := fake.KeylimeConfig()
+		config.TPMCertStore = t.TempDir()
+		config.VerifyAgentIdentity = enforce
+		require.NoError(t, sim.WriteCA(config.TPMCertStore))
+		svc, err := keylime.NewService(config)
+		require.NoError(t, err)
+		return NewToolHandler(svc), fake, agent
+	}
+
+	t.Run("opt-in verification enrolls a genuine agent", func(t *testing.T) {
+		h, fake, _ := newIdentityHandler(t, false)
+		_, output, err := h.EnrollAgentToVerifier(context.Background(), nil, keylime.EnrollAgentToVerifierInput{
+			AgentUUID:         uuid1,
+			EnrollmentOptions: keylime.EnrollmentOptions{VerifyIdentity: true},
+		})
+		require.NoError(t, err)
+		result := output.(keylime.EnrollAgentToVerifierOutput)
+		require.NotNil(t, result.Identity)
+		assert.Contains(t, result.Identity.EKCertIssuer, "Test EK Root CA")
+		assert.True(t, fake.Snapshot().Agents[uuid1].Enrolled)
+	})
+
+	t.Run("enforced verification rejects a mismatched quote", func(t *testing.T) {
+		h, fake, agent := newIdentityHandler(t, true)
+		other, err := tpmtest.New(tpm.AlgRSA)
+		require.NoError(t, err)
+		agent.TPM = other
+
+		_, _, err = WithErrorCodes(h.EnrollAgentToVerifier)(context.Background(), nil, keylime.EnrollAgentToVerifierInput{AgentUUID: uuid1})
+		require.Error(t, err)
+		assert.Equal(t, CodeIdentityMismatch, ClassifyError(err))
+		assert.False(t, fake.Snapshot().Agents[uuid1].Enrolled, "nothing is posted to the verifier")
+	})
+
+	t.Run("not verified unless requested", func(t *testing.T) {
+		h, fake, agent := newIdentityHandler(t, false)
+		other, err := tpmtest.New(tpm.AlgRSA)
+		require.NoError(t, err)
+		agent.TPM = other
+
+		_, output, err := h.EnrollAgentToVerifier(context.Background(), nil, keylime.EnrollAgentToVerifierInput{AgentUUID: uuid1})
+		require.NoError(t, err)
+		assert.Nil(t, output.(keylime.EnrollAgentToVerifierOutput).Identity)
+		assert.True(t, fake.Snapshot().Agents[uuid1].Enrolled)
+	})
+	t.Run("update keeps the current enrollment when verification fails", func(t *testing.T) {
+		h, fake, agent := newIdentityHandler(t, false)
+		_, _, err := h.EnrollAgentToVerifier(context.Background(), nil, keylime.EnrollAgentToVerifierInput{AgentUUID: uuid1})
+		require.NoError(t, err)
+		other, err := tpmtest.New(tpm.AlgRSA)
+		require.NoError(t, err)
+		agent.TPM = other
+
+		_, _, err = h.UpdateAgent(context.Background(), nil, keylime.UpdateAgentInput{
+			AgentUUID:         uuid1,
+			EnrollmentOptions: keylime.EnrollmentOptions{VerifyIdentity: true},
+		})
+		assert.ErrorIs(t, err, keylime.ErrIdentityMismatch)
+		assert.True(t, fake.Snapshot().Agents[uuid1].Enrolled)
+	})
+	t.Run("payload is delivered with the bootstrap key", func(t *testing.T) {
+		h, _, agent := newIdentityHandler(t, false)
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "secret.txt"), []byte("s3cr3t"), 0600))
+		script := filepath.Join(t.TempDir(), "install.sh")
+		require.NoError(t, os.WriteFile(script, []byte("#!/bin/sh\n"), 0600))
+
+		_, output, err := h.EnrollAgentToVerifier(context.Background(), nil, keylime.EnrollAgentToVerifierInput{
+			AgentUUID:     uuid1,
+			Payload:       dir,
+			PayloadScript: script,
+		})
+		require.NoError(t, err)
+		result := output.(keylime.EnrollAgentToVerifierOutput)
+		assert.True(t, result.PayloadDelivered)
+		assert.NotNil(t, result.Identity, "identity is verified to get the agent transport key")
+
+		svc, err := h.clusters.Get("")
+		require.NoError(t, err)
+		details, err := svc.FetchAgentDetails(context.Background(), uuid1)
+		require.NoError(t, err)
+		v, err := base64.StdEncoding.DecodeString(details.Results.V)
+		require.NoError(t, err)
+		delivery := agent.Delivery()
+		require.NotNil(t, delivery)
+		k := make([]byte, len(v))
+		for i := range v {
+			k[i] = v[i] ^ delivery.U[i]
+		}
+		plaintext, err := keylime.DecryptPayload(k, delivery.Payload)
+		require.NoError(t, err)
+		zr, err := zip.NewReader(bytes.NewReader(plaintext), int64(len(plaintext)))
+		require.NoError(t, err)
+		var names []string
+		for _, f := range zr.File {
+			names = append(names, f.Name)
+		}
+		assert.Equal(t, []string{"autorun.sh", "secret.txt"}, names)
+		assert.Equal(t, (&keylime.BootstrapKey{K: k}).AuthTag(uuid1), delivery.AuthTag)
+	})
+
+	t.Run("failed key delivery removes the enrollment", func(t *testing.T) {
+		h, fake, agent := newIdentityHandler(t, false)
+		h.removalPollInterval = 5 * time.Millisecond
+		agent.RejectUKey = true
+		payload := filepath.Join(t.TempDir(), "secret.txt")
+		require.NoError(t, os.WriteFile(payload, []byte("s3cr3t"), 0600))
+
+		_, _, err := h.EnrollAgentToVerifier(context.Background(), nil, keylime.EnrollAgentToVerifierInput{AgentUUID: uuid1, Payload: payload})
+		assert.ErrorContains(t, err, "key delivery")
+		assert.ErrorContains(t, err, "enrollment was removed again")
+		assert.False(t, fake.Snapshot().Agents[uuid1].Enrolled)
+	})
+
+	t.Run("U is not sent when the verifier rejects the enrollment", func(t *testing.T) {
+		h, fake, agent := newIdentityHandler(t, false)
+		fake.InjectFault(keylimetest.Fault{Service: "verifier", Method: http.MethodPost, Path: "agents/", Status: http.StatusBadRequest, Times: 1})
+		payload := filepath.Join(t.TempDir(), "secret.txt")
+		require.NoError(t, os.WriteFile(payload, []byte("s3cr3t"), 0600))
+
+		_, _, err := h.EnrollAgentToVerifier(context.Background(), nil, keylime.EnrollAgentToVerifierInput{AgentUUID: uuid1, Payload: payload})
+		assert.ErrorContains(t, err, "enrollment failed")
+		assert.Nil(t, agent.Delivery())
+	})
+}
+
+func TestFakeKeylimePushMode(t *testing.T) {
+	newPushHandler := func(t *testing.T) (*ToolHandler, *keylimetest.Server) {
+		t.Helper()
+		fake := keylimetest.NewServer(keylimetest.Config{PushMode: true})
+		t.Cleanup(fake.Close)
+		svc, err := keylime.NewService(fake.KeylimeConfig())
+		require.NoError(t, err)
+		for _, uuid := range []string{uuid1, uuid2} {
+			fake.RegisterAgent(keylimetest.Agent{UUID: uuid})
+			require.True(t, fake.EnrollAgent(uuid, "", ""))
+		}
+		fake.RegisterAgent(keylimetest.Agent{UUID: uuid3})
+		fake.Tick()
+		return NewToolHandler(svc), fake
+	}
+
+	t.Run("status comes from attestations", func(t *testing.T) {
+		h, fake := newPushHandler(t)
+		require.True(t, fake.FailAgent(uuid1, keylimetest.Failure{EventID: "ima_hash_mismatch"}))
+
+		_, output, err := h.GetAgentStatus(context.Background(), nil, keylime.GetAgentStatusInput{AgentUUID: uuid1})
+		require.NoError(t, err)
+		status := output.(keylime.AgentAttestationStatus)
+		assert.Equal(t, keylime.AttestationModePush, status.AttestationMode)
+		assert.Equal(t, keylime.EvaluationFail, status.Status)
+		assert.Equal(t, 2, status.AttestationCount)
+		assert.Equal(t, "ima_hash_mismatch", status.LatestAttestation.FailureReason)
+		assert.Equal(t, 0, status.LastPassedAttestation.Index)
+	})
+
+	t.Run("failed agents", func(t *testing.T) {
+		h, fake := newPushHandler(t)
+		require.True(t, fake.FailAgent(uuid2, keylimetest.Failure{}))
+
+		_, output, err := h.GetFailedAgents(context.Background(), nil, keylime.GetFailedAgentsInput{})
+		require.NoError(t, err)
+		result := output.(keylime.GetFailedAgentsOutput)
+		assert.Empty(t, result.FailedAgents)
+		require.Len(t, result.FailedPushAgents, 1)
+		assert.Equal(t, uuid2, result.FailedPushAgents[0].AgentUUID)
+		assert.Equal(t, 2, result.ScannedAgents)
+		require.Len(t, result.SkippedAgents, 1)
+		assert.Equal(t, uuid3, result.SkippedAgents[0].AgentUUID)
+	})
+
+	t.Run("reactivate explains recovery instead of mutating", func(t *testing.T) {
+		h, fake := newPushHandler(t)
+		require.True(t, fake.FailAgent(uuid1, keylimetest.Failure{}))
+
+		_, output, err := h.ReactivateAgent(context.Background(), nil, keylime.ReactivateAgentInput{AgentUUID: uuid1})
+		require.NoError(t, err)
+		result := output.(keylime.ReactivatePushAgentOutput)
+		assert.False(t, result.Reactivated)
+		assert.Equal(t, keylime.EvaluationFail, result.Status)
+		assert.Contains(t, result.Message, "next pushed attestation passes")
+
+		fake.Tick()
+		_, output, err = h.ReactivateAgent(context.Background(), nil, keylime.ReactivateAgentInput{AgentUUID: uuid1})
+		require.NoError(t, err)
+		assert.Equal(t, keylime.EvaluationPass, output.(keylime.ReactivatePushAgentOutput).Status)
+	})
+}
+
+// TestFakeKeylimePolicyHistory edits, deletes and restores policies through the policy history.
+func TestFakeKeylimePolicyHistory(t *testing.T) {
+	h, _ := newFakeHandler(t)
+	store, err := history.Open(t.TempDir())
+	require.NoError(t, err)
+	h.SetPolicyHistory(store)
+	ctx := context.Background()
+
+	const original = `{"meta":{"version":5},"digests":{"/bin/bash":["e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"]},"excludes":[]}`
+	policyPath := filepath.Join(t.TempDir(), "policy.json")
+	require.NoError(t, os.WriteFile(policyPath, []byte(original), 0600))
+	storedPolicy := func(t *testing.T) string {
+		t.Helper()
+		_, output, err := h.GetRuntimePolicy(ctx, nil, keylime.GetRuntimePolicyInput{PolicyName: testPolicyName})
+		require.NoError(t, err)
+		return output.(keylime.GetRuntimePolicyOutput).Results.RuntimePolicy
+	}
+	rollback := func(t *testing.T, version int) keylime.RollbackPolicyOutput {
+		t.Helper()
+		_, output, err := h.RollbackPolicy(ctx, nil, keylime.RollbackPolicyInput{Version: version, Reason: "undo"})
+		require.NoError(t, err)
+		return output.(keylime.RollbackPolicyOutput)
+	}
+
+	_, _, err = h.ImportRuntimePolicy(ctx, nil, keylime.ImportRuntimePolicyInput{Name: testPolicyName, FilePath: policyPath, Reason: "initial", IgnoreLintErrors: true})
+	require.NoError(t, err)
+	_, _, err = h.UpdateRuntimePolicy(ctx, nil, keylime.UpdateRuntimePolicyInput{PolicyName: testPolicyName, AddExcludes: []string{testVarPath}, Reason: "noisy logs"})
+	require.NoError(t, err)
+	edited := storedPolicy(t)
+	_, _, err = h.DeleteRuntimePolicy(ctx, nil, keylime.DeleteRuntimePolicyInput{PolicyName: testPolicyName, Reason: "retired"})
+	require.NoError(t, err)
+
+	_, output, err := h.ListPolicyHistory(ctx, nil, keylime.ListPolicyHistoryInput{PolicyName: testPolicyName})
+	require.NoError(t, err)
+	versions := output.(keylime.ListPolicyHistoryOutput).Versions
+	require.Len(t, versions, 3)
+	assert.Equal(t, keylime.PolicyVersion{
+		Version: 3, Time: versions[0].Time, Cluster: keylime.DefaultClusterName, Kind: history.KindRuntime,
+		PolicyName: testPolicyName, Action: history.ActionDeleted, Tool: "Delete_runtime_policy", Reason: "retired",
+		Digest: history.Digest([]byte(edited)), Size: len(edited),
+	}, versions[0])
+	assert.Equal(t, "Update_runtime_policy", versions[1].Tool)
+	assert.Equal(t, "Import_runtime_policy", versions[2].Tool)
+
+	t.Run("deleted policy is recreated", func(t *testing.T) {
+		result := rollback(t, 1)
+		assert.Equal(t, "recreated", result.Status)
+		assert.Equal(t, 4, result.Version)
+		assert.Equal(t, original, storedPolicy(t))
+	})
+
+	t.Run("earlier version is restored", func(t *testing.T) {
+		result := rollback(t, 2)
+		assert.Equal(t, "rolled_back", result.Status)
+		assert.Equal(t, edited, storedPolicy(t))
+		assert.Equal(t, 5, result.Version, "the overwritten version is already the latest in the history")
+
+		assert.Equal(t, "unchanged", rollback(t, 2).Status)
+	})
+
+	t.Run("versions overwritten outside the server are kept", func(t *testing.T) {
+		svc, err := h.clusters.Get("")
+		require.NoError(t, err)
+		require.NoError(t, replacePolicy(ctx, svc, history.KindRuntime, testPolicyName, []byte(original)))
+		result := rollback(t, 2)
+		assert.Equal(t, "rolled_back", result.Status)
+
+		_, output, err := h.ListPolicyHistory(ctx, nil, keylime.ListPolicyHistoryInput{Limit: 2})
+		require.NoError(t, err)
+		list := output.(keylime.ListPolicyHistoryOutput)
+		assert.Equal(t, 7, list.Total)
+		require.Len(t, list.Versions, 2)
+		assert.Equal(t, history.ActionUploaded, list.Versions[0].Action)
+		assert.Equal(t, 2, list.Versions[0].RestoredFrom)
+		assert.Equal(t, history.ActionReplaced, list.Versions[1].Action)
+		assert.Equal(t, history.Digest([]byte(original)), list.Versions[1].Digest)
+	})
+
+	t.Run("measured boot policy", func(t *testing.T) {
+		mbPath := filepath.Join(t.TempDir(), "mb.json")
+		require.NoError(t, os.WriteFile(mbPath, loadTestdata(t, "valid_mb_policy.json"), 0600))
+		_, _, err := h.ImportMBPolicy(ctx, nil, keylime.ImportMBPolicyInput{Name: testMBPolicyName, FilePath: mbPath, IgnoreLintErrors: true})
+		require.NoError(t, err)
+		_, _, err = h.DeleteMBPolicy(ctx, nil, keylime.DeleteMBPolicyInput{PolicyName: testMBPolicyName})
+		require.NoError(t, err)
+
+		_, output, err := h.ListPolicyHistory(ctx, nil, keylime.ListPolicyHistoryInput{Kind: history.KindMB})
+		require.NoError(t, err)
+		versions := output.(keylime.ListPolicyHistoryOutput).Versions
+		require.Len(t, versions, 2)
+		result := rollback(t, versions[0].Version)
+		assert.Equal(t, "recreated", result.Status)
+		assert.Equal(t, history.KindMB, result.Kind)
+
+		_, stored, err := h.GetMBPolicy(ctx, nil, keylime.GetMBPolicyInput{PolicyName: testMBPolicyName})
+		require.NoError(t, err)
+		assert.Equal(t, string(loadTestdata(t, "valid_mb_policy.json")), stored.(keylime.GetMBPolicyOutput).Results["mb_policy"])
+	})
+
+	t.Run("history failure after the update is a warning", func(t *testing.T) {
+		h, _ := newFakeHandler(t)
+		dir := t.TempDir()
+		store, err := history.Open(dir)
+		require.NoError(t, err)
+		h.SetPolicyHistory(store)
+		_, _, err = h.ImportRuntimePolicy(ctx, nil, keylime.ImportRuntimePolicyInput{Name: testPolicyName, FilePath: policyPath, IgnoreLintErrors: true})
+		require.NoError(t, err)
+		require.NoError(t, os.RemoveAll(filepath.Join(dir, "objects")))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "objects"), nil, 0600))
+
+		_, output, err := h.UpdateRuntimePolicy(ctx, nil, keylime.UpdateRuntimePolicyInput{PolicyName: testPolicyName, AddExcludes: []string{testVarPath}})
+		require.NoError(t, err)
+		result := output.(keylime.UpdateRuntimePolicyOutput)
+		assert.Equal(t, "updated", result.Status)
+		assert.Contains(t, result.HistoryWarning, "was uploaded but not recorded in the policy history")
+	})
+
+	t.Run("history failure after an import is a warning", func(t *testing.T) {
+		h, fake := newFakeHandler(t)
+		dir := t.TempDir()
+		store, err := history.Open(dir)
+		require.NoError(t, err)
+		h.SetPolicyHistory(store)
+		require.NoError(t, os.RemoveAll(filepath.Join(dir, "objects")))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "objects"), nil, 0600))
+
+		_, output, err := h.ImportRuntimePolicy(ctx, nil, keylime.ImportRuntimePolicyInput{Name: testPolicyName, FilePath: policyPath, IgnoreLintErrors: true})
+		require.NoError(t, err)
+		result := output.(keylime.ImportRuntimePolicyOutput)
+		assert.Equal(t, "imported", result.Status)
+		assert.Contains(t, result.HistoryWarning, "was uploaded but not recorded in the policy history")
+		_, ok := fake.RuntimePolicy(testPolicyName)
+		assert.True(t, ok, "the policy is live")
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, _, err := h.RollbackPolicy(ctx, nil, keylime.RollbackPolicyInput{Version: 99})
+		assert.Equal(t, CodeNotFound, ClassifyError(err))
+
+		_, _, err = h.ListPolicyHistory(ctx, nil, keylime.ListPolicyHistoryInput{Kind: "ima"})
+		assert.Equal(t, CodeInvalidInput, ClassifyError(err))
+
+		disabled, _ := newFakeHandler(t)
+		_, _, err = disabled.ListPolicyHistory(ctx, nil, keylime.ListPolicyHistoryInput{})
+		assert.ErrorIs(t, err, errHistoryDisabled)
+	})
+}
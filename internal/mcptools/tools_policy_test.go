@@ -4,13 +4,16 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/keylime/keylime-mcp/internal/keylime"
+	"github.com/keylime/keylime-mcp/internal/tpm/tpmtest"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -49,6 +52,8 @@ func TestGetRuntimePolicy(t *testing.T) {
 		result := output.(keylime.GetRuntimePolicyOutput)
 		assert.Equal(t, testPolicyName, result.Results.Name)
 		assert.NotEmpty(t, result.Results.RuntimePolicy)
+		assert.Len(t, result.Revision, 16)
+		assert.Equal(t, policyRevision(result.Results.RuntimePolicy), result.Revision)
 	})
 
 	t.Run("invalid name rejected", func(t *testing.T) {
@@ -79,14 +84,18 @@ func TestImportRuntimePolicy(t *testing.T) {
 		require.NoError(t, os.WriteFile(policyPath, data, 0600))
 
 		_, output, err := h.ImportRuntimePolicy(context.Background(), nil, keylime.ImportRuntimePolicyInput{
-			Name:     myPolicyName,
-			FilePath: policyPath,
+			Name:             myPolicyName,
+			FilePath:         policyPath,
+			IgnoreLintErrors: true,
 		})
 		require.NoError(t, err)
 
 		result := output.(keylime.ImportRuntimePolicyOutput)
 		assert.Equal(t, myPolicyName, result.Name)
 		assert.Equal(t, "imported", result.Status)
+		require.NotEmpty(t, result.Warnings)
+		assert.Equal(t, "error", result.Warnings[0].Severity)
+		assert.Equal(t, "schema", result.Warnings[0].Check)
 
 		// check base64-encoded policy in body
 		assert.NotNil(t, receivedBody["runtime_policy"])
@@ -140,6 +149,150 @@ func TestImportRuntimePolicy(t *testing.T) {
 		assert.Contains(t, err.Error(), "absolute path")
 	})
 
+	t.Run("lint errors reject the import", func(t *testing.T) {
+		h := newTestHandler(t, http.NotFoundHandler()) // no POST expected
+		var doc map[string]any
+		require.NoError(t, json.Unmarshal(loadTestdata(t, "runtime_policy_v1.json"), &doc))
+		doc["meta"] = map[string]any{}
+		doc["excludes"] = []string{"/opt/(cache"}
+		data, err := json.Marshal(doc)
+		require.NoError(t, err)
+		path := filepath.Join(t.TempDir(), "policy.json")
+		require.NoError(t, os.WriteFile(path, data, 0600))
+
+		_, _, err = h.ImportRuntimePolicy(context.Background(), nil, keylime.ImportRuntimePolicyInput{
+			Name:     myPolicyName,
+			FilePath: path,
+		})
+		require.Error(t, err)
+		assert.Equal(t, CodeInvalidInput, ClassifyError(err))
+		assert.Contains(t, err.Error(), "policy was not imported: excludes[0]: ")
+		assert.NotContains(t, err.Error(), "meta.version", "a missing version is only a warning")
+		assert.Contains(t, err.Error(), "ignore_lint_errors")
+
+		_, _, err = h.ImportRuntimePolicy(context.Background(), nil, keylime.ImportRuntimePolicyInput{
+			Name:    myPolicyName,
+			Content: string(loadTestdata(t, "valid_runtime_policy.json")),
+		})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "does not match the Keylime schema")
+	})
+
+	t.Run("lint warnings returned", func(t *testing.T) {
+		mux := http.NewServeMux()
+		mux.HandleFunc("POST /v2.5/allowlists/{name}", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})
+		h := newTestHandler(t, mux)
+		data := strings.Replace(string(loadTestdata(t, "runtime_policy_v1.json")), `"/tmp(/.*)?"`, `"/.*"`, 1)
+		path := filepath.Join(t.TempDir(), "policy.json")
+		require.NoError(t, os.WriteFile(path, []byte(data), 0600))
+
+		_, output, err := h.ImportRuntimePolicy(context.Background(), nil, keylime.ImportRuntimePolicyInput{
+			Name:     myPolicyName,
+			FilePath: path,
+		})
+		require.NoError(t, err)
+		result := output.(keylime.ImportRuntimePolicyOutput)
+		assert.Equal(t, "imported", result.Status)
+		require.Len(t, result.Warnings, 1)
+		assert.Equal(t, "broad_exclude", result.Warnings[0].Check)
+		assert.Equal(t, "excludes[0]", result.Warnings[0].Location)
+	})
+
+	t.Run("inline content", func(t *testing.T) {
+		data := loadTestdata(t, "runtime_policy_v1.json")
+		for name, content := range map[string]string{
+			"json":   string(data),
+			"base64": base64.StdEncoding.EncodeToString(data),
+		} {
+			t.Run(name, func(t *testing.T) {
+				var uploaded []byte
+				mux := http.NewServeMux()
+				mux.HandleFunc("POST /v2.5/allowlists/{name}", func(w http.ResponseWriter, r *http.Request) {
+					var body map[string]string
+					require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+					uploaded, _ = base64.StdEncoding.DecodeString(body["runtime_policy"])
+				})
+				h := newTestHandler(t, mux)
+
+				_, output, err := h.ImportRuntimePolicy(context.Background(), nil, keylime.ImportRuntimePolicyInput{
+					Name:    myPolicyName,
+					Content: content,
+				})
+				require.NoError(t, err)
+				result := output.(keylime.ImportRuntimePolicyOutput)
+				assert.Equal(t, "imported", result.Status)
+				assert.Nil(t, result.Conversion)
+				assert.JSONEq(t, string(data), string(uploaded))
+			})
+		}
+	})
+
+	t.Run("legacy allowlist converted", func(t *testing.T) {
+		const emptyDigest = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+		var uploaded map[string]any
+		mux := http.NewServeMux()
+		mux.HandleFunc("POST /v2.5/allowlists/{name}", func(w http.ResponseWriter, r *http.Request) {
+			var body map[string]string
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			decoded, _ := base64.StdEncoding.DecodeString(body["runtime_policy"])
+			require.NoError(t, json.Unmarshal(decoded, &uploaded))
+		})
+		h := newTestHandler(t, mux)
+		dir := t.TempDir()
+		allowlist := filepath.Join(dir, "allowlist.txt")
+		require.NoError(t, os.WriteFile(allowlist, []byte(emptyDigest+"  "+testBinBash+"\nbroken line\n"), 0600))
+
+		_, output, err := h.ImportRuntimePolicy(context.Background(), nil, keylime.ImportRuntimePolicyInput{
+			Name:        myPolicyName,
+			FilePath:    allowlist,
+			ExcludeList: base64.StdEncoding.EncodeToString([]byte("# excludes\n/tmp(/.*)?\n/var/log/.*\n")),
+		})
+		require.NoError(t, err)
+		result := output.(keylime.ImportRuntimePolicyOutput)
+		assert.Equal(t, "converted_and_imported", result.Status)
+		assert.Equal(t, &keylime.PolicyConversion{
+			From:         "flat_allowlist",
+			DigestCount:  1,
+			ExcludeCount: 2,
+			SkippedLines: []string{"line 2: broken line"},
+		}, result.Conversion)
+		assert.Equal(t, map[string]any{testBinBash: []any{emptyDigest}}, uploaded["digests"])
+		assert.Equal(t, []any{"/tmp(/.*)?", "/var/log/.*"}, uploaded["excludes"])
+	})
+
+	t.Run("exclude list added to a runtime policy", func(t *testing.T) {
+		mux := http.NewServeMux()
+		mux.HandleFunc("POST /v2.5/allowlists/{name}", func(w http.ResponseWriter, r *http.Request) {})
+		h := newTestHandler(t, mux)
+		excludes := filepath.Join(t.TempDir(), "excludes.txt")
+		require.NoError(t, os.WriteFile(excludes, []byte("/tmp(/.*)?\n/opt/cache(/.*)?\n"), 0600))
+
+		_, output, err := h.ImportRuntimePolicy(context.Background(), nil, keylime.ImportRuntimePolicyInput{
+			Name:            myPolicyName,
+			Content:         string(loadTestdata(t, "runtime_policy_v1.json")),
+			ExcludeListPath: excludes,
+		})
+		require.NoError(t, err)
+		result := output.(keylime.ImportRuntimePolicyOutput)
+		assert.Equal(t, &keylime.PolicyConversion{From: "runtime_policy", ExcludeCount: 2}, result.Conversion)
+	})
+
+	t.Run("source required once", func(t *testing.T) {
+		h := newTestHandler(t, http.NotFoundHandler())
+		for _, input := range []keylime.ImportRuntimePolicyInput{
+			{Name: myPolicyName},
+			{Name: myPolicyName, FilePath: testPolicyPath, Content: "{}"},
+			{Name: myPolicyName, Content: "{}", ExcludeListPath: "/tmp/x.txt", ExcludeList: "/tmp"},
+			{Name: myPolicyName, Content: "neither JSON nor an allowlist"},
+		} {
+			_, _, err := h.ImportRuntimePolicy(context.Background(), nil, input)
+			require.Error(t, err)
+			assert.Equal(t, CodeInvalidInput, ClassifyError(err))
+		}
+	})
+
 	t.Run("server error propagated", func(t *testing.T) {
 		mux := http.NewServeMux()
 		mux.HandleFunc("POST /v2.5/allowlists/{name}", func(w http.ResponseWriter, r *http.Request) {
@@ -153,14 +306,406 @@ func TestImportRuntimePolicy(t *testing.T) {
 		require.NoError(t, os.WriteFile(policyPath, loadTestdata(t, "valid_runtime_policy.json"), 0600))
 
 		_, _, err := h.ImportRuntimePolicy(context.Background(), nil, keylime.ImportRuntimePolicyInput{
-			Name:     myPolicyName,
-			FilePath: policyPath,
+			Name:             myPolicyName,
+			FilePath:         policyPath,
+			IgnoreLintErrors: true,
 		})
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "policy already exists")
 	})
 }
 
+func TestCreateRuntimePolicy(t *testing.T) {
+	newRoot := func(t *testing.T) string {
+		t.Helper()
+		root := t.TempDir()
+		require.NoError(t, os.MkdirAll(filepath.Join(root, "usr/bin"), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(root, "usr/bin/tool"), []byte("#!/bin/sh"), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(root, "usr/bin/README"), []byte("docs"), 0o644))
+		return root
+	}
+
+	t.Run("writes and imports the policy", func(t *testing.T) {
+		var receivedBody map[string]any
+		mux := http.NewServeMux()
+		mux.HandleFunc("POST /v2.5/allowlists/{name}", func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, myPolicyName, r.PathValue("name"))
+			_ = json.NewDecoder(r.Body).Decode(&receivedBody)
+		})
+		h := newTestHandler(t, mux)
+		outputPath := filepath.Join(t.TempDir(), "policy.json")
+
+		_, output, err := h.CreateRuntimePolicy(context.Background(), nil, keylime.CreateRuntimePolicyInput{
+			RootPath:   newRoot(t),
+			OutputPath: outputPath,
+			Excludes:   []string{"/usr/share(/.*)?"},
+			PolicyName: myPolicyName,
+		})
+		require.NoError(t, err)
+		result := output.(keylime.CreateRuntimePolicyOutput)
+		assert.Equal(t, "created_and_imported", result.Status)
+		assert.Equal(t, "sha256", result.HashAlg)
+		assert.Equal(t, 1, result.DigestCount)
+		assert.Equal(t, 1, result.FilesHashed)
+
+		written, err := os.ReadFile(outputPath)
+		require.NoError(t, err)
+		var policy map[string]any
+		require.NoError(t, json.Unmarshal(written, &policy))
+		assert.Contains(t, policy["digests"], "/usr/bin/tool")
+		assert.Equal(t, []any{"/usr/share(/.*)?"}, policy["excludes"])
+		decoded, err := base64.StdEncoding.DecodeString(receivedBody["runtime_policy"].(string))
+		require.NoError(t, err)
+		assert.JSONEq(t, string(written), string(decoded))
+	})
+
+	t.Run("incremental run reuses digests", func(t *testing.T) {
+		h := newTestHandler(t, http.NotFoundHandler())
+		root := newRoot(t)
+		input := keylime.CreateRuntimePolicyInput{RootPath: root, OutputPath: filepath.Join(t.TempDir(), "policy.json"), Incremental: true}
+		_, _, err := h.CreateRuntimePolicy(context.Background(), nil, input)
+		require.NoError(t, err)
+		assert.FileExists(t, input.OutputPath+stateSuffix)
+
+		_, output, err := h.CreateRuntimePolicy(context.Background(), nil, input)
+		require.NoError(t, err)
+		result := output.(keylime.CreateRuntimePolicyOutput)
+		assert.Equal(t, "created", result.Status)
+		assert.Zero(t, result.FilesHashed)
+		assert.Equal(t, 1, result.FilesReused)
+	})
+
+	t.Run("failed import keeps the file", func(t *testing.T) {
+		mux := http.NewServeMux()
+		mux.HandleFunc("POST /v2.5/allowlists/{name}", func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, `{"code": 409, "status": "already exists"}`, http.StatusConflict)
+		})
+		h := newTestHandler(t, mux)
+		outputPath := filepath.Join(t.TempDir(), "policy.json")
+
+		_, _, err := h.CreateRuntimePolicy(context.Background(), nil, keylime.CreateRuntimePolicyInput{
+			RootPath: newRoot(t), OutputPath: outputPath, PolicyName: myPolicyName,
+		})
+		assert.ErrorContains(t, err, "not imported")
+		assert.FileExists(t, outputPath)
+	})
+
+	t.Run("invalid input", func(t *testing.T) {
+		h := newTestHandler(t, http.NotFoundHandler())
+		root := newRoot(t)
+		outputPath := filepath.Join(t.TempDir(), "policy.json")
+		tests := []struct {
+			name    string
+			input   keylime.CreateRuntimePolicyInput
+			wantErr string
+		}{
+			{"missing root", keylime.CreateRuntimePolicyInput{OutputPath: outputPath}, "root_path is required"},
+			{"relative root", keylime.CreateRuntimePolicyInput{RootPath: "usr", OutputPath: outputPath}, "absolute path"},
+			{"root is not a directory", keylime.CreateRuntimePolicyInput{RootPath: filepath.Join(root, "usr/bin/tool"), OutputPath: outputPath}, "not a directory"},
+			{"output without .json", keylime.CreateRuntimePolicyInput{RootPath: root, OutputPath: filepath.Join(root, "policy")}, ".json"},
+			{"hash algorithm", keylime.CreateRuntimePolicyInput{RootPath: root, OutputPath: outputPath, HashAlg: "md5"}, "hash_alg"},
+			{"exclude regex", keylime.CreateRuntimePolicyInput{RootPath: root, OutputPath: outputPath, Excludes: []string{"(x"}}, "excludes"},
+			{"policy name", keylime.CreateRuntimePolicyInput{RootPath: root, OutputPath: outputPath, PolicyName: invalidPolicyName}, "policy_name"},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				_, _, err := h.CreateRuntimePolicy(context.Background(), nil, tt.input)
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				assert.Equal(t, CodeInvalidInput, ClassifyError(err))
+			})
+		}
+		assert.NoFileExists(t, outputPath)
+	})
+}
+
+func TestCreateRuntimePolicyFromIMALog(t *testing.T) {
+	logPath := func(t *testing.T) string {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), "ascii_runtime_measurements")
+		require.NoError(t, os.WriteFile(path, loadTestdata(t, "ascii_runtime_measurements"), 0o600))
+		return path
+	}
+
+	t.Run("writes the policy", func(t *testing.T) {
+		h := newTestHandler(t, http.NotFoundHandler())
+		outputPath := filepath.Join(t.TempDir(), "policy.json")
+
+		_, output, err := h.CreateRuntimePolicyFromIMALog(context.Background(), nil, keylime.CreateRuntimePolicyFromIMALogInput{
+			LogPath:    logPath(t),
+			OutputPath: outputPath,
+			Excludes:   []string{"/tmp(/.*)?"},
+		})
+		require.NoError(t, err)
+		result := output.(keylime.CreateRuntimePolicyFromIMALogOutput)
+		assert.Equal(t, "created", result.Status)
+		assert.Equal(t, 12, result.EntryCount)
+		assert.Equal(t, 7, result.DigestCount)
+		assert.Equal(t, 1, result.KeyringCount)
+		assert.Equal(t, 1, result.IMABufCount)
+		assert.Equal(t, "sha1", result.LogHashAlg)
+
+		// the written file is accepted by Import_runtime_policy
+		data, err := readPolicyFile(outputPath)
+		require.NoError(t, err)
+		var policy map[string]any
+		require.NoError(t, json.Unmarshal(data, &policy))
+		assert.Len(t, policy["digests"].(map[string]any)["/usr/bin/bash"], 2)
+	})
+
+	t.Run("uploads without writing", func(t *testing.T) {
+		var receivedBody map[string]any
+		mux := http.NewServeMux()
+		mux.HandleFunc("POST /v2.5/allowlists/{name}", func(w http.ResponseWriter, r *http.Request) {
+			_ = json.NewDecoder(r.Body).Decode(&receivedBody)
+		})
+		h := newTestHandler(t, mux)
+
+		_, output, err := h.CreateRuntimePolicyFromIMALog(context.Background(), nil, keylime.CreateRuntimePolicyFromIMALogInput{
+			LogPath:    logPath(t),
+			PolicyName: myPolicyName,
+		})
+		require.NoError(t, err)
+		result := output.(keylime.CreateRuntimePolicyFromIMALogOutput)
+		assert.Equal(t, "imported", result.Status)
+		assert.Empty(t, result.OutputPath)
+		decoded, err := base64.StdEncoding.DecodeString(receivedBody["runtime_policy"].(string))
+		require.NoError(t, err)
+		assert.Contains(t, string(decoded), "kernel_version")
+	})
+
+	t.Run("invalid input", func(t *testing.T) {
+		h := newTestHandler(t, http.NotFoundHandler())
+		outputPath := filepath.Join(t.TempDir(), "policy.json")
+		broken := filepath.Join(t.TempDir(), "broken")
+		require.NoError(t, os.WriteFile(broken, []byte("10 not a measurement\n"), 0o600))
+		tests := []struct {
+			name    string
+			input   keylime.CreateRuntimePolicyFromIMALogInput
+			wantErr string
+		}{
+			{"no destination", keylime.CreateRuntimePolicyFromIMALogInput{LogPath: logPath(t)}, "output_path or policy_name"},
+			{"missing log", keylime.CreateRuntimePolicyFromIMALogInput{OutputPath: outputPath}, "log_path is required"},
+			{"relative log", keylime.CreateRuntimePolicyFromIMALogInput{LogPath: "ima.log", OutputPath: outputPath}, "absolute path"},
+			{"log not found", keylime.CreateRuntimePolicyFromIMALogInput{LogPath: "/nonexistent/ima.log", OutputPath: outputPath}, "not a file"},
+			{"malformed log", keylime.CreateRuntimePolicyFromIMALogInput{LogPath: broken, OutputPath: outputPath}, "line 1"},
+			{"exclude regex", keylime.CreateRuntimePolicyFromIMALogInput{LogPath: logPath(t), OutputPath: outputPath, Excludes: []string{"("}}, "excludes"},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				_, _, err := h.CreateRuntimePolicyFromIMALog(context.Background(), nil, tt.input)
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				assert.Equal(t, CodeInvalidInput, ClassifyError(err))
+			})
+		}
+	})
+}
+
+func TestEvaluateIMALog(t *testing.T) {
+	logPath := func(t *testing.T) string {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), "ascii_runtime_measurements")
+		require.NoError(t, os.WriteFile(path, loadTestdata(t, "ascii_runtime_measurements"), 0o600))
+		return path
+	}
+	// accepts bash, the keyring and the first boot entries, excludes /tmp
+	storedPolicy := map[string]any{
+		"meta":     map[string]any{"version": 1},
+		"digests":  map[string][]string{"/usr/bin/bash": {"37d2b12d5d9abc2a364ef9448767ee03938e383c0284193477dc7618f4b7c6c2"}, "/usr/lib64/libc.so.6": {"00"}},
+		"excludes": []string{"/tmp(/.*)?"},
+		"keyrings": map[string][]string{".ima": {"86dc8a96e6b84bfba717635b249fc76c205ed3ff46f6a9c2d452eadad466861a"}},
+	}
+	policyJSON, err := json.Marshal(storedPolicy)
+	require.NoError(t, err)
+
+	t.Run("stored policy", func(t *testing.T) {
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /v2.5/allowlists/{name}", func(w http.ResponseWriter, r *http.Request) {
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"code": 200, "status": "Success",
+				"results": map[string]any{"name": r.PathValue("name"), "runtime_policy": string(policyJSON)},
+			})
+		})
+		h := newTestHandler(t, mux)
+
+		_, output, err := h.EvaluateIMALog(context.Background(), nil, keylime.EvaluateIMALogInput{
+			LogPath:    logPath(t),
+			PolicyName: myPolicyName,
+		})
+		require.NoError(t, err)
+		result := output.(keylime.EvaluateIMALogOutput)
+		assert.Equal(t, 12, result.EntryCount)
+		assert.Equal(t, 3, result.AllowedCount, "two bash entries and the keyring")
+		assert.Equal(t, 1, result.ExcludedCount)
+		assert.Equal(t, 8, result.FailingCount)
+		require.Len(t, result.Entries, 12)
+		assert.Equal(t, "runtime_policy_hash", result.Entries[2].FailureType)
+		assert.Equal(t, []string{"00"}, result.Entries[2].Expected)
+	})
+
+	t.Run("local policy, failures only", func(t *testing.T) {
+		policyPath := filepath.Join(t.TempDir(), "policy.json")
+		require.NoError(t, os.WriteFile(policyPath, policyJSON, 0o600))
+		h := newTestHandler(t, http.NotFoundHandler())
+
+		_, output, err := h.EvaluateIMALog(context.Background(), nil, keylime.EvaluateIMALogInput{
+			LogPath:      logPath(t),
+			PolicyPath:   policyPath,
+			FailuresOnly: true,
+		})
+		require.NoError(t, err)
+		result := output.(keylime.EvaluateIMALogOutput)
+		assert.Equal(t, 8, result.FailingCount)
+		require.Len(t, result.Entries, 8)
+		assert.Equal(t, "boot_aggregate", result.Entries[0].Path)
+		assert.Equal(t, "not_in_allowlist", result.Entries[0].FailureType)
+	})
+
+	t.Run("policy not found", func(t *testing.T) {
+		h := newTestHandler(t, http.NotFoundHandler())
+		_, _, err := h.EvaluateIMALog(context.Background(), nil, keylime.EvaluateIMALogInput{
+			LogPath:    logPath(t),
+			PolicyName: myPolicyName,
+		})
+		require.Error(t, err)
+		assert.Equal(t, CodeNotFound, ClassifyError(err))
+	})
+
+	t.Run("invalid input", func(t *testing.T) {
+		h := newTestHandler(t, http.NotFoundHandler())
+		tests := []struct {
+			name    string
+			input   keylime.EvaluateIMALogInput
+			wantErr string
+		}{
+			{"no policy", keylime.EvaluateIMALogInput{LogPath: logPath(t)}, "exactly one of policy_name and policy_path"},
+			{"both policies", keylime.EvaluateIMALogInput{LogPath: logPath(t), PolicyName: myPolicyName, PolicyPath: testPolicyPath}, "exactly one"},
+			{"missing log", keylime.EvaluateIMALogInput{PolicyName: myPolicyName}, "log_path is required"},
+			{"policy file not found", keylime.EvaluateIMALogInput{LogPath: logPath(t), PolicyPath: "/nonexistent/policy.json"}, "file not found"},
+			{"invalid policy name", keylime.EvaluateIMALogInput{LogPath: logPath(t), PolicyName: invalidPolicyName}, "policy"},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				_, _, err := h.EvaluateIMALog(context.Background(), nil, tt.input)
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				assert.Equal(t, CodeInvalidInput, ClassifyError(err))
+			})
+		}
+	})
+}
+
+func TestDiffRuntimePolicies(t *testing.T) {
+	writePolicyFile := func(t *testing.T, policy map[string]any) string {
+		t.Helper()
+		data, err := json.Marshal(policy)
+		require.NoError(t, err)
+		path := filepath.Join(t.TempDir(), "policy.json")
+		require.NoError(t, os.WriteFile(path, data, 0o600))
+		return path
+	}
+	stored := map[string]any{
+		"meta":     map[string]any{"version": 1},
+		"digests":  map[string][]string{"/usr/bin/bash": {"aa"}, "/usr/bin/ls": {"bb"}},
+		"excludes": []string{"/tmp(/.*)?"},
+	}
+	storedJSON, err := json.Marshal(stored)
+	require.NoError(t, err)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v2.5/allowlists/{name}", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("name") != myPolicyName {
+			http.NotFound(w, r)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"code": 200, "status": "Success",
+			"results": map[string]any{"name": myPolicyName, "runtime_policy": string(storedJSON)},
+		})
+	})
+
+	t.Run("stored policy against a local file", func(t *testing.T) {
+		h := newTestHandler(t, mux)
+		local := writePolicyFile(t, map[string]any{
+			"meta":     map[string]any{"version": 1},
+			"digests":  map[string][]string{"/usr/bin/bash": {"aa", "cc"}, "/usr/bin/cat": {"dd"}},
+			"excludes": []string{"/tmp(/.*)?", "/var(/.*)?"},
+			"keyrings": map[string][]string{".ima": {"ee"}},
+		})
+
+		_, output, err := h.DiffRuntimePolicies(context.Background(), nil, keylime.DiffRuntimePoliciesInput{
+			From: myPolicyName,
+			To:   local,
+		})
+		require.NoError(t, err)
+		result := output.(keylime.DiffRuntimePoliciesOutput)
+		assert.False(t, result.Identical)
+		assert.False(t, result.Truncated)
+		assert.Equal(t, []keylime.PolicyPathDigests{{Path: "/usr/bin/cat", Digests: []string{"dd"}}}, result.Digests.Added)
+		assert.Equal(t, []keylime.PolicyPathDigests{{Path: "/usr/bin/ls", Digests: []string{"bb"}}}, result.Digests.Removed)
+		assert.Equal(t, []keylime.PolicyPathChange{{Path: "/usr/bin/bash", AddedDigests: []string{"cc"}}}, result.Digests.Changed)
+		assert.Equal(t, 1, result.Keyrings.AddedCount)
+		assert.Equal(t, []string{"/var(/.*)?"}, result.ExcludesAdded)
+		assert.Empty(t, result.Fields)
+	})
+
+	t.Run("identical", func(t *testing.T) {
+		h := newTestHandler(t, mux)
+		_, output, err := h.DiffRuntimePolicies(context.Background(), nil, keylime.DiffRuntimePoliciesInput{
+			From: myPolicyName,
+			To:   writePolicyFile(t, stored),
+		})
+		require.NoError(t, err)
+		assert.True(t, output.(keylime.DiffRuntimePoliciesOutput).Identical)
+	})
+
+	t.Run("large diffs are summarised", func(t *testing.T) {
+		h := newTestHandler(t, http.NotFoundHandler())
+		digests := map[string][]string{}
+		for i := range 120 {
+			digests[fmt.Sprintf("/usr/bin/tool%03d", i)] = []string{"aa"}
+		}
+		from := writePolicyFile(t, map[string]any{"digests": map[string][]string{}})
+		to := writePolicyFile(t, map[string]any{"digests": digests})
+
+		_, output, err := h.DiffRuntimePolicies(context.Background(), nil, keylime.DiffRuntimePoliciesInput{From: from, To: to})
+		require.NoError(t, err)
+		result := output.(keylime.DiffRuntimePoliciesOutput)
+		assert.True(t, result.Truncated)
+		assert.True(t, result.Digests.Truncated)
+		assert.Equal(t, 120, result.Digests.AddedCount)
+		assert.Len(t, result.Digests.Added, 50)
+
+		_, output, err = h.DiffRuntimePolicies(context.Background(), nil, keylime.DiffRuntimePoliciesInput{From: from, To: to, MaxEntries: 5})
+		require.NoError(t, err)
+		assert.Len(t, output.(keylime.DiffRuntimePoliciesOutput).Digests.Added, 5)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		h := newTestHandler(t, mux)
+		tests := []struct {
+			name    string
+			input   keylime.DiffRuntimePoliciesInput
+			code    ErrorCode
+			wantErr string
+		}{
+			{"missing to", keylime.DiffRuntimePoliciesInput{From: myPolicyName}, CodeInvalidInput, "from and to are required"},
+			{"negative max", keylime.DiffRuntimePoliciesInput{From: myPolicyName, To: myPolicyName, MaxEntries: -1}, CodeInvalidInput, "max_entries"},
+			{"invalid name", keylime.DiffRuntimePoliciesInput{From: invalidPolicyName, To: myPolicyName}, CodeInvalidInput, "policy"},
+			{"file not found", keylime.DiffRuntimePoliciesInput{From: myPolicyName, To: "/nonexistent/policy.json"}, CodeInvalidInput, "file not found"},
+			{"unknown policy", keylime.DiffRuntimePoliciesInput{From: myPolicyName, To: "other-policy"}, CodeNotFound, "other-policy"},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				_, _, err := h.DiffRuntimePolicies(context.Background(), nil, tt.input)
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				assert.Equal(t, tt.code, ClassifyError(err))
+			})
+		}
+	})
+}
+
 func TestUpdateRuntimePolicy(t *testing.T) {
 	// serves existing policy on GET, captures PUT body
 	setupMux := func(t *testing.T, capturedBody *map[string]any) *ToolHandler {
@@ -245,16 +790,17 @@ func TestUpdateRuntimePolicy(t *testing.T) {
 		h := setupMux(t, &putBody)
 
 		digest := "ab0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b8550"
+		other := strings.Repeat("cd", 32)
 
 		_, _, err := h.UpdateRuntimePolicy(context.Background(), nil, keylime.UpdateRuntimePolicyInput{
 			PolicyName: testPolicyName,
-			AddDigests: map[string]string{"/usr/bin/new": digest},
+			AddDigests: map[string][]string{"/usr/bin/new": {digest, other, strings.ToUpper(digest)}},
 		})
 		require.NoError(t, err)
 
 		policy := decodePutPolicy(t, putBody)
 		digests := policy["digests"].(map[string]any)
-		assert.Contains(t, digests, "/usr/bin/new")
+		assert.Equal(t, []any{digest, other}, digests["/usr/bin/new"], "both versions in one call, without duplicates")
 		assert.Contains(t, digests, testBinBash) // original preserved
 	})
 
@@ -273,6 +819,232 @@ func TestUpdateRuntimePolicy(t *testing.T) {
 		assert.NotContains(t, digests, testBinBash)
 	})
 
+	t.Run("digests are appended and removed individually", func(t *testing.T) {
+		var putBody map[string]any
+		h := setupMux(t, &putBody)
+		const existing = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+		digest := strings.Repeat("ab", 32)
+
+		_, _, err := h.UpdateRuntimePolicy(context.Background(), nil, keylime.UpdateRuntimePolicyInput{
+			PolicyName: testPolicyName,
+			AddDigests: map[string][]string{testBinBash: {"sha256:" + strings.ToUpper(digest)}},
+		})
+		require.NoError(t, err)
+		digests := decodePutPolicy(t, putBody)["digests"].(map[string]any)
+		assert.Equal(t, []any{existing, digest}, digests[testBinBash], "a new package version keeps the old hash")
+
+		_, _, err = h.UpdateRuntimePolicy(context.Background(), nil, keylime.UpdateRuntimePolicyInput{
+			PolicyName:         testPolicyName,
+			RemoveDigestValues: map[string][]string{testBinBash: {existing}},
+		})
+		require.NoError(t, err)
+		assert.NotContains(t, decodePutPolicy(t, putBody)["digests"], testBinBash, "the last digest removes the path")
+	})
+
+	t.Run("digest values removed with any algorithm prefix", func(t *testing.T) {
+		var putBody map[string]any
+		h := setupMux(t, &putBody)
+		digest := strings.Repeat("ab", 20)
+
+		_, _, err := h.UpdateRuntimePolicy(context.Background(), nil, keylime.UpdateRuntimePolicyInput{
+			PolicyName: testPolicyName,
+			AddDigests: map[string][]string{"/usr/bin/old": {"sha1:" + digest}},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []any{digest}, decodePutPolicy(t, putBody)["digests"].(map[string]any)["/usr/bin/old"])
+
+		_, _, err = h.UpdateRuntimePolicy(context.Background(), nil, keylime.UpdateRuntimePolicyInput{
+			PolicyName:         testPolicyName,
+			RemoveDigestValues: map[string][]string{testBinBash: {"SHA256:E3B0C44298FC1C149AFBF4C8996FB92427AE41E4649B934CA495991B7852B855"}},
+		})
+		require.NoError(t, err)
+		assert.NotContains(t, decodePutPolicy(t, putBody)["digests"], testBinBash)
+	})
+
+	t.Run("empty stored policy", func(t *testing.T) {
+		var putBody map[string]any
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /v2.5/allowlists/{name}", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"code": 200, "status": "Success", "results": {"name": "test-policy", "runtime_policy": ""}}`))
+		})
+		mux.HandleFunc("PUT /v2.5/allowlists/{name}", func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			_ = json.Unmarshal(body, &putBody)
+		})
+		h := newTestHandler(t, mux)
+
+		_, output, err := h.UpdateRuntimePolicy(context.Background(), nil, keylime.UpdateRuntimePolicyInput{
+			PolicyName:  testPolicyName,
+			AddExcludes: []string{"/var/log"},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "updated", output.(keylime.UpdateRuntimePolicyOutput).Status)
+		assert.Equal(t, []any{"/var/log(/.*)?"}, decodePutPolicy(t, putBody)["excludes"])
+	})
+
+	t.Run("keyrings, ima-buf and ima settings", func(t *testing.T) {
+		var putBody map[string]any
+		h := setupMux(t, &putBody)
+		keys := "[]"
+
+		_, _, err := h.UpdateRuntimePolicy(context.Background(), nil, keylime.UpdateRuntimePolicyInput{
+			PolicyName:         testPolicyName,
+			AddKeyrings:        map[string][]string{".ima": {strings.Repeat("cd", 32)}},
+			AddIMABuf:          map[string][]string{"kernel_version": {strings.Repeat("ef", 20)}},
+			AddIgnoredKeyrings: []string{".builtin_trusted_keys"},
+			LogHashAlg:         "sha256",
+			VerificationKeys:   &keys,
+		})
+		require.NoError(t, err)
+
+		policy := decodePutPolicy(t, putBody)
+		assert.Equal(t, map[string]any{".ima": []any{strings.Repeat("cd", 32)}}, policy["keyrings"])
+		assert.Equal(t, map[string]any{"kernel_version": []any{strings.Repeat("ef", 20)}}, policy["ima-buf"])
+		assert.Equal(t, map[string]any{
+			"ignored_keyrings": []any{".builtin_trusted_keys"},
+			"log_hash_alg":     "sha256",
+			"dm_policy":        nil,
+		}, policy["ima"])
+		assert.Equal(t, "[]", policy["verification-keys"])
+		assert.Contains(t, policy, "release", "missing sections are filled in")
+	})
+
+	t.Run("remove a keyring", func(t *testing.T) {
+		var putBody map[string]any
+		h := setupMux(t, &putBody)
+		_, _, err := h.UpdateRuntimePolicy(context.Background(), nil, keylime.UpdateRuntimePolicyInput{
+			PolicyName:     testPolicyName,
+			RemoveKeyrings: map[string][]string{".ima": nil},
+		})
+		require.NoError(t, err)
+		assert.Empty(t, decodePutPolicy(t, putBody)["keyrings"])
+	})
+
+	t.Run("schema violations are not uploaded", func(t *testing.T) {
+		tests := []struct {
+			name    string
+			input   keylime.UpdateRuntimePolicyInput
+			wantErr string
+		}{
+			{"log hash algorithm", keylime.UpdateRuntimePolicyInput{LogHashAlg: "md5"}, "log_hash_alg"},
+			{"digest length", keylime.UpdateRuntimePolicyInput{AddKeyrings: map[string][]string{".ima": {strings.Repeat("a", 42)}}}, "pattern"},
+			{"digest format", keylime.UpdateRuntimePolicyInput{AddIMABuf: map[string][]string{"kernel_version": {"xyz"}}}, "hex string"},
+			{"exclude regex", keylime.UpdateRuntimePolicyInput{AddExcludes: []string{"/opt/(unclosed"}}, "invalid exclude"},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				var putBody map[string]any
+				h := setupMux(t, &putBody)
+				tt.input.PolicyName = testPolicyName
+				_, _, err := h.UpdateRuntimePolicy(context.Background(), nil, tt.input)
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				assert.Equal(t, CodeInvalidInput, ClassifyError(err))
+				assert.Nil(t, putBody, "nothing is uploaded")
+			})
+		}
+	})
+
+	t.Run("concurrent changes", func(t *testing.T) {
+		// serves the nth GET with the policy returned by version, captures PUT body
+		setupVersionedMux := func(t *testing.T, version func(n int) string, capturedBody *map[string]any) *ToolHandler {
+			t.Helper()
+			var stored keylime.GetRuntimePolicyOutput
+			require.NoError(t, json.Unmarshal(loadTestdata(t, "runtime_policy.json"), &stored))
+			gets := 0
+			mux := http.NewServeMux()
+			mux.HandleFunc("GET /v2.5/allowlists/{name}", func(w http.ResponseWriter, r *http.Request) {
+				stored.Results.RuntimePolicy = version(gets)
+				gets++
+				_ = json.NewEncoder(w).Encode(stored)
+			})
+			mux.HandleFunc("PUT /v2.5/allowlists/{name}", func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				_ = json.Unmarshal(body, capturedBody)
+				w.WriteHeader(http.StatusOK)
+			})
+			return newTestHandler(t, mux)
+		}
+		const original = `{"meta":{"version":5},"digests":{"/bin/bash":["e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"]},"excludes":[]}`
+		withOther := func(n int) string {
+			return fmt.Sprintf(`{"meta":{"version":5},"digests":{"/bin/bash":["e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"],"/usr/bin/other":["%064x"]},"excludes":[]}`, n)
+		}
+		// the policy changes after the first fetch
+		changedOnce := func(n int) string {
+			if n == 0 {
+				return original
+			}
+			return withOther(0)
+		}
+
+		t.Run("edit is re-applied to the new version", func(t *testing.T) {
+			var putBody map[string]any
+			h := setupVersionedMux(t, changedOnce, &putBody)
+
+			_, output, err := h.UpdateRuntimePolicy(context.Background(), nil, keylime.UpdateRuntimePolicyInput{
+				PolicyName:  testPolicyName,
+				AddExcludes: []string{testVarPath},
+			})
+			require.NoError(t, err)
+
+			result := output.(keylime.UpdateRuntimePolicyOutput)
+			assert.Equal(t, 1, result.Retries)
+			uploaded, err := base64.StdEncoding.DecodeString(putBody["runtime_policy"].(string))
+			require.NoError(t, err)
+			assert.Equal(t, policyRevision(string(uploaded)), result.Revision)
+
+			policy := decodePutPolicy(t, putBody)
+			assert.Contains(t, policy["digests"], "/usr/bin/other", "the concurrent change is kept")
+			assert.Contains(t, policy["excludes"], testVarPath+"(/.*)?")
+		})
+
+		t.Run("stale expected revision", func(t *testing.T) {
+			var putBody map[string]any
+			h := setupVersionedMux(t, changedOnce, &putBody)
+
+			_, _, err := h.UpdateRuntimePolicy(context.Background(), nil, keylime.UpdateRuntimePolicyInput{
+				PolicyName:       testPolicyName,
+				AddExcludes:      []string{testVarPath},
+				ExpectedRevision: "0000000000000000",
+			})
+			require.Error(t, err)
+			assert.Equal(t, CodeConflict, ClassifyError(err))
+			assert.Contains(t, err.Error(), "Get_runtime_policy")
+			assert.Nil(t, putBody, "nothing is uploaded")
+		})
+
+		t.Run("change after expected revision shows both changes", func(t *testing.T) {
+			var putBody map[string]any
+			h := setupVersionedMux(t, changedOnce, &putBody)
+
+			_, _, err := h.UpdateRuntimePolicy(context.Background(), nil, keylime.UpdateRuntimePolicyInput{
+				PolicyName:       testPolicyName,
+				AddExcludes:      []string{testVarPath},
+				ExpectedRevision: policyRevision(original),
+			})
+			require.Error(t, err)
+			assert.Equal(t, CodeConflict, ClassifyError(err))
+			assert.Contains(t, err.Error(), "Concurrent change: digests added /usr/bin/other")
+			assert.Contains(t, err.Error(), "This edit, not uploaded: excludes added "+testVarPath)
+			assert.NotContains(t, err.Error(), "meta.timestamp")
+			assert.Nil(t, putBody, "nothing is uploaded")
+		})
+
+		t.Run("gives up when the policy keeps changing", func(t *testing.T) {
+			var putBody map[string]any
+			h := setupVersionedMux(t, withOther, &putBody)
+
+			_, _, err := h.UpdateRuntimePolicy(context.Background(), nil, keylime.UpdateRuntimePolicyInput{
+				PolicyName:  testPolicyName,
+				AddExcludes: []string{testVarPath},
+			})
+			require.Error(t, err)
+			assert.ErrorIs(t, err, ErrRevisionConflict)
+			assert.Contains(t, err.Error(), "digests changed /usr/bin/other")
+			assert.Nil(t, putBody, "nothing is uploaded")
+		})
+	})
+
 	t.Run("timestamp updated", func(t *testing.T) {
 		var putBody map[string]any
 		h := setupMux(t, &putBody)
@@ -414,14 +1186,20 @@ func TestImportMBPolicy(t *testing.T) {
 		require.NoError(t, os.WriteFile(policyPath, loadTestdata(t, "valid_mb_policy.json"), 0600))
 
 		_, output, err := h.ImportMBPolicy(context.Background(), nil, keylime.ImportMBPolicyInput{
-			Name:     "my-mb-policy",
-			FilePath: policyPath,
+			Name:             "my-mb-policy",
+			FilePath:         policyPath,
+			IgnoreLintErrors: true,
 		})
 		require.NoError(t, err)
 
 		result := output.(keylime.ImportMBPolicyOutput)
 		assert.Equal(t, "my-mb-policy", result.Name)
 		assert.Equal(t, "imported", result.Status)
+		var checks []string
+		for _, w := range result.Warnings {
+			checks = append(checks, w.Check)
+		}
+		assert.Equal(t, []string{"schema", "unknown_field", "unknown_field"}, checks)
 
 		// MB policy sent as raw string, not base64
 		mbPolicy, ok := receivedBody["mb_policy"].(string)
@@ -447,6 +1225,131 @@ func TestImportMBPolicy(t *testing.T) {
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "file not found")
 	})
+
+	t.Run("inline base64 content", func(t *testing.T) {
+		var received map[string]string
+		mux := http.NewServeMux()
+		mux.HandleFunc("POST /v2.5/mbpolicies/{name}", func(w http.ResponseWriter, r *http.Request) {
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		})
+		h := newTestHandler(t, mux)
+		data := loadTestdata(t, "mb_reference_state.json")
+
+		_, _, err := h.ImportMBPolicy(context.Background(), nil, keylime.ImportMBPolicyInput{
+			Name:    "my-mb-policy",
+			Content: base64.StdEncoding.EncodeToString(data),
+		})
+		require.NoError(t, err)
+		assert.JSONEq(t, string(data), received["mb_policy"])
+
+		_, _, err = h.ImportMBPolicy(context.Background(), nil, keylime.ImportMBPolicyInput{
+			Name:    "my-mb-policy",
+			Content: "not json",
+		})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "not valid JSON")
+	})
+
+	t.Run("policy without kernels rejected", func(t *testing.T) {
+		h := newTestHandler(t, http.NotFoundHandler())
+		var doc map[string]any
+		require.NoError(t, json.Unmarshal(loadTestdata(t, "mb_reference_state.json"), &doc))
+		doc["kernels"] = []any{}
+		data, err := json.Marshal(doc)
+		require.NoError(t, err)
+		path := filepath.Join(t.TempDir(), "mb_policy.json")
+		require.NoError(t, os.WriteFile(path, data, 0600))
+
+		_, _, err = h.ImportMBPolicy(context.Background(), nil, keylime.ImportMBPolicyInput{
+			Name:     "my-mb-policy",
+			FilePath: path,
+		})
+		require.Error(t, err)
+		assert.Equal(t, CodeInvalidInput, ClassifyError(err))
+		assert.Contains(t, err.Error(), "kernels is empty")
+	})
+}
+
+func TestCreateMBPolicy(t *testing.T) {
+	logPath := func(t *testing.T, secureBoot bool) string {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), "binary_bios_measurements")
+		require.NoError(t, os.WriteFile(path, tpmtest.BootLog(secureBoot), 0o600))
+		return path
+	}
+
+	t.Run("writes and uploads the policy", func(t *testing.T) {
+		var receivedBody map[string]any
+		mux := http.NewServeMux()
+		mux.HandleFunc("POST /v2.5/mbpolicies/{name}", func(w http.ResponseWriter, r *http.Request) {
+			_ = json.NewDecoder(r.Body).Decode(&receivedBody)
+		})
+		h := newTestHandler(t, mux)
+		outputPath := filepath.Join(t.TempDir(), "mb_policy.json")
+
+		_, output, err := h.CreateMBPolicy(context.Background(), nil, keylime.CreateMBPolicyInput{
+			EventLogPath: logPath(t, true),
+			OutputPath:   outputPath,
+			PolicyName:   "my-mb-policy",
+		})
+		require.NoError(t, err)
+		result := output.(keylime.CreateMBPolicyOutput)
+		assert.Equal(t, "created_and_imported", result.Status)
+		assert.True(t, result.HasSecureBoot)
+		assert.Equal(t, 24, result.EventCount)
+		assert.Equal(t, 1, result.DBCount)
+		assert.NotEmpty(t, result.ShimAuthcodeSHA256)
+
+		// the written file is accepted by Import_mb_policy and matches the upload
+		data, err := readPolicyFile(outputPath)
+		require.NoError(t, err)
+		assert.JSONEq(t, string(data), receivedBody["mb_policy"].(string))
+	})
+
+	t.Run("SecureBoot disabled", func(t *testing.T) {
+		h := newTestHandler(t, http.NotFoundHandler())
+		input := keylime.CreateMBPolicyInput{
+			EventLogPath: logPath(t, false),
+			OutputPath:   filepath.Join(t.TempDir(), "mb_policy.json"),
+		}
+		_, _, err := h.CreateMBPolicy(context.Background(), nil, input)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "skip_secureboot")
+		assert.Equal(t, CodeInvalidInput, ClassifyError(err))
+
+		input.SkipSecureBoot = true
+		_, output, err := h.CreateMBPolicy(context.Background(), nil, input)
+		require.NoError(t, err)
+		result := output.(keylime.CreateMBPolicyOutput)
+		assert.False(t, result.HasSecureBoot)
+		assert.Zero(t, result.PKCount)
+	})
+
+	t.Run("invalid input", func(t *testing.T) {
+		h := newTestHandler(t, http.NotFoundHandler())
+		outputPath := filepath.Join(t.TempDir(), "mb_policy.json")
+		broken := filepath.Join(t.TempDir(), "broken")
+		require.NoError(t, os.WriteFile(broken, []byte("not an event log"), 0o600))
+		tests := []struct {
+			name    string
+			input   keylime.CreateMBPolicyInput
+			wantErr string
+		}{
+			{"no destination", keylime.CreateMBPolicyInput{EventLogPath: logPath(t, true)}, "output_path or policy_name"},
+			{"missing log", keylime.CreateMBPolicyInput{OutputPath: outputPath}, "event_log_path is required"},
+			{"log not found", keylime.CreateMBPolicyInput{EventLogPath: "/nonexistent/log", OutputPath: outputPath}, "not a file"},
+			{"malformed log", keylime.CreateMBPolicyInput{EventLogPath: broken, OutputPath: outputPath}, "invalid TPM event log"},
+			{"policy name", keylime.CreateMBPolicyInput{EventLogPath: logPath(t, true), PolicyName: invalidPolicyName}, "policy"},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				_, _, err := h.CreateMBPolicy(context.Background(), nil, tt.input)
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				assert.Equal(t, CodeInvalidInput, ClassifyError(err))
+			})
+		}
+	})
 }
 
 func TestDeleteMBPolicy(t *testing.T) {
@@ -475,3 +1378,81 @@ func TestDeleteMBPolicy(t *testing.T) {
 		assert.Error(t, err)
 	})
 }
+
+func TestLintPolicy(t *testing.T) {
+	writeFile := func(t *testing.T, data []byte) string {
+		path := filepath.Join(t.TempDir(), "policy.json")
+		require.NoError(t, os.WriteFile(path, data, 0600))
+		return path
+	}
+
+	t.Run("file kind detected", func(t *testing.T) {
+		h := newTestHandler(t, http.NotFoundHandler())
+		tests := []struct {
+			file string
+			kind string
+		}{
+			{"runtime_policy_v1.json", "runtime"},
+			{"mb_reference_state.json", "mb"},
+		}
+		for _, tt := range tests {
+			_, output, err := h.LintPolicy(context.Background(), nil, keylime.LintPolicyInput{
+				FilePath: writeFile(t, loadTestdata(t, tt.file)),
+			})
+			require.NoError(t, err)
+			result := output.(keylime.LintPolicyOutput)
+			assert.Equal(t, tt.kind, result.Kind)
+			assert.True(t, result.Valid)
+			assert.Empty(t, result.Findings)
+		}
+	})
+
+	t.Run("findings counted", func(t *testing.T) {
+		h := newTestHandler(t, http.NotFoundHandler())
+		data := strings.Replace(string(loadTestdata(t, "runtime_policy_v1.json")), `"version": 1,`, "", 1)
+		data = strings.Replace(data, `"/tmp(/.*)?"`, `"/opt/(cache"`, 1)
+
+		_, output, err := h.LintPolicy(context.Background(), nil, keylime.LintPolicyInput{FilePath: writeFile(t, []byte(data))})
+		require.NoError(t, err)
+		result := output.(keylime.LintPolicyOutput)
+		assert.False(t, result.Valid)
+		assert.Equal(t, 1, result.ErrorCount)
+		assert.Equal(t, 1, result.WarningCount)
+		require.Len(t, result.Findings, 2)
+		assert.Equal(t, "missing_version", result.Findings[0].Check)
+		assert.Equal(t, "warning", result.Findings[0].Severity)
+		assert.Equal(t, "invalid_exclude", result.Findings[1].Check)
+		assert.Equal(t, "error", result.Findings[1].Severity)
+	})
+
+	t.Run("stored policy", func(t *testing.T) {
+		data := loadTestdata(t, "runtime_policy.json")
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /v2.5/allowlists/{name}", func(w http.ResponseWriter, r *http.Request) {
+			w.Write(data)
+		})
+		h := newTestHandler(t, mux)
+
+		_, output, err := h.LintPolicy(context.Background(), nil, keylime.LintPolicyInput{PolicyName: testPolicyName})
+		require.NoError(t, err)
+		result := output.(keylime.LintPolicyOutput)
+		assert.Equal(t, "runtime", result.Kind)
+		assert.False(t, result.Valid)
+		require.NotEmpty(t, result.Findings)
+		assert.Equal(t, "schema", result.Findings[0].Check)
+	})
+
+	t.Run("invalid input", func(t *testing.T) {
+		h := newTestHandler(t, http.NotFoundHandler())
+		for _, input := range []keylime.LintPolicyInput{
+			{},
+			{FilePath: testPolicyPath, PolicyName: testPolicyName},
+			{PolicyName: testPolicyName, Kind: "ima"},
+			{PolicyName: pathTraversal},
+		} {
+			_, _, err := h.LintPolicy(context.Background(), nil, input)
+			require.Error(t, err)
+			assert.Equal(t, CodeInvalidInput, ClassifyError(err))
+		}
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"net/http/httptest"
 	"os/exec"
 	"testing"
+	"time"
 
 	"github.com/keylime/keylime-mcp/internal/keylime"
 	"github.com/stretchr/testify/assert"
@@ -89,7 +90,83 @@ func TestGetVersionAndHealth(t *testing.T) {
 		require.Len(t, result.Services, 2)
 		assert.False(t, result.Services[0].Reachable)
 		assert.False(t, result.Services[1].Reachable)
+		assert.Nil(t, result.Services[0].CircuitBreaker)
 	})
+
+	t.Run("reports circuit breaker state", func(t *testing.T) {
+		downServer := httptest.NewServer(http.NotFoundHandler())
+		downServer.Close()
+
+		svc, err := keylime.NewService(&keylime.Config{
+			VerifierURL:      downServer.URL,
+			RegistrarURL:     downServer.URL,
+			TLSEnabled:       false,
+			APIVersion:       testAPIVersion,
+			BreakerThreshold: 1,
+			BreakerCooldown:  time.Hour,
+		})
+		require.NoError(t, err)
+		h := NewToolHandler(svc)
+
+		_, output, err := h.GetVersionAndHealth(context.Background(), nil, keylime.GetVersionAndHealthInput{})
+		require.NoError(t, err)
+		verifier := output.(keylime.GetVersionAndHealthOutput).Services[0]
+		require.NotNil(t, verifier.CircuitBreaker)
+		assert.Equal(t, keylime.BreakerOpen, verifier.CircuitBreaker.State)
+		assert.Equal(t, 1, verifier.CircuitBreaker.ConsecutiveFailures)
+
+		_, output, err = h.GetVersionAndHealth(context.Background(), nil, keylime.GetVersionAndHealthInput{})
+		require.NoError(t, err)
+		verifier = output.(keylime.GetVersionAndHealthOutput).Services[0]
+		assert.Contains(t, verifier.Error, "circuit breaker open")
+	})
+}
+
+func TestGetVersionAndHealthMultiCluster(t *testing.T) {
+	versionData := loadTestdata(t, "version.json")
+	up := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(versionData)
+	})
+	h := newTestClusterHandler(t, "dc1", map[string]http.Handler{"dc1": up, "dc2": up})
+
+	t.Run("all clusters by default", func(t *testing.T) {
+		_, output, err := h.GetVersionAndHealth(context.Background(), nil, keylime.GetVersionAndHealthInput{})
+		require.NoError(t, err)
+
+		result := output.(keylime.GetVersionAndHealthOutput)
+		require.Len(t, result.Services, 4)
+		assert.Equal(t, "dc1", result.Services[0].Cluster)
+		assert.Equal(t, "verifier", result.Services[0].Service)
+		assert.Equal(t, "dc2", result.Services[3].Cluster)
+		assert.Equal(t, "registrar", result.Services[3].Service)
+	})
+
+	t.Run("single cluster", func(t *testing.T) {
+		_, output, err := h.GetVersionAndHealth(context.Background(), nil, keylime.GetVersionAndHealthInput{Cluster: "dc2"})
+		require.NoError(t, err)
+
+		result := output.(keylime.GetVersionAndHealthOutput)
+		require.Len(t, result.Services, 2)
+		assert.Equal(t, "dc2", result.Services[0].Cluster)
+	})
+}
+
+func TestListClusters(t *testing.T) {
+	h := newTestClusterHandler(t, "dc2", map[string]http.Handler{
+		"dc1": http.NotFoundHandler(),
+		"dc2": http.NotFoundHandler(),
+	})
+
+	_, output, err := h.ListClusters(context.Background(), nil, keylime.ListClustersInput{})
+	require.NoError(t, err)
+
+	result := output.(keylime.ListClustersOutput)
+	require.Len(t, result.Clusters, 2)
+	assert.Equal(t, "dc1", result.Clusters[0].Name)
+	assert.False(t, result.Clusters[0].Primary)
+	assert.Equal(t, "dc2", result.Clusters[1].Name)
+	assert.True(t, result.Clusters[1].Primary)
+	assert.NotEmpty(t, result.Clusters[1].VerifierURL)
 }
 
 func TestInvestigateVerifierLogs(t *testing.T) {
@@ -9,9 +9,11 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
 
 	"github.com/keylime/keylime-mcp/internal/keylime"
+	"github.com/keylime/keylime-mcp/internal/policy"
 )
 
 // fetchAndDecode reads an HTTP response body and decodes it into a typed struct.
@@ -58,27 +60,58 @@ var (
 
 func validateAgentUUID(uuid string) error {
 	if uuid == "" {
-		return fmt.Errorf("agent_uuid is required")
+		return invalidf("agent_uuid is required")
 	}
 	if !uuidRE.MatchString(uuid) {
-		return fmt.Errorf("agent_uuid must be a valid UUID")
+		return invalidf("agent_uuid must be a valid UUID")
 	}
 	return nil
 }
 
 func validatePolicyName(name string) error {
 	if name == "" {
-		return fmt.Errorf("policy_name is required")
+		return invalidf("policy_name is required")
 	}
 	if len(name) > 255 {
-		return fmt.Errorf("policy_name exceeds 255 characters")
+		return invalidf("policy_name exceeds 255 characters")
 	}
 	if !safeNameRE.MatchString(name) {
-		return fmt.Errorf("policy_name contains invalid characters (use alphanumeric, hyphens, underscores, dots)")
+		return invalidf("policy_name contains invalid characters (use alphanumeric, hyphens, underscores, dots)")
 	}
 	return nil
 }
 
+// recentAttestations is how many attestations a push-model status lists.
+const recentAttestations = 10
+
+// mapAttestationsToOutput summarizes the attestations of a push-model agent, given newest first.
+func mapAttestationsToOutput(agentUUID string, attestations []keylime.Attestation) keylime.AgentAttestationStatus {
+	output := keylime.AgentAttestationStatus{
+		AgentUUID:          agentUUID,
+		AttestationMode:    keylime.AttestationModePush,
+		Status:             keylime.StatusNoAttestations,
+		AttestationCount:   len(attestations),
+		RecentAttestations: attestations[:min(len(attestations), recentAttestations)],
+	}
+	if len(attestations) == 0 {
+		return output
+	}
+	output.LatestAttestation = &attestations[0]
+	output.Status = keylime.EvaluationPending
+	// an attestation in progress does not override the outcome of the previous one
+	if i := slices.IndexFunc(attestations, func(a keylime.Attestation) bool {
+		return a.Evaluation != keylime.EvaluationPending
+	}); i >= 0 {
+		output.Status = attestations[i].Evaluation
+	}
+	if i := slices.IndexFunc(attestations, func(a keylime.Attestation) bool {
+		return a.Evaluation == keylime.EvaluationPass
+	}); i >= 0 {
+		output.LastPassedAttestation = &attestations[i]
+	}
+	return output
+}
+
 func mapAgentToOutput(agentUUID string, agentStatus keylime.AgentStatusResponse) keylime.GetAgentStatusOutput {
 	return keylime.GetAgentStatusOutput{
 		AgentUUID:                   agentUUID,
@@ -100,27 +133,49 @@ func mapAgentToOutput(agentUUID string, agentStatus keylime.AgentStatusResponse)
 }
 
 func normalizeDigest(digest, path string) (string, error) {
-	digest = strings.TrimPrefix(digest, "sha256:")
+	digest = trimDigestAlg(digest)
 	if !digestRE.MatchString(digest) {
-		return "", fmt.Errorf("digest for %s must be a hex string (40-128 chars)", path)
+		return "", invalidf("digest for %s must be a hex string (40-128 chars)", path)
 	}
 	return digest, nil
 }
 
+// trimDigestAlg strips a hash algorithm prefix such as "sha384:" from digest.
+func trimDigestAlg(digest string) string {
+	if alg, hexDigest, ok := strings.Cut(digest, ":"); ok {
+		if _, known := policy.HashAlgorithms[strings.ToLower(alg)]; known {
+			return hexDigest
+		}
+	}
+	return digest
+}
+
 const maxPolicyFileSize = 50 * 1024 * 1024 // 50 MB
 
+// validateLocalPath checks that a path on the server host given in field is absolute and
+// does not climb out of its directory.
+func validateLocalPath(field, path string) error {
+	if path == "" {
+		return invalidf("%s is required", field)
+	}
+	if !filepath.IsAbs(path) || strings.Contains(path, "..") {
+		return invalidf("%s must be an absolute path without path traversal", field)
+	}
+	return nil
+}
+
 func validateFilePath(path string) error {
 	if path == "" {
-		return fmt.Errorf("file_path is required")
+		return invalidf("file_path is required")
 	}
 	if !filepath.IsAbs(path) {
-		return fmt.Errorf("file_path must be an absolute path")
+		return invalidf("file_path must be an absolute path")
 	}
 	if strings.Contains(path, "..") {
-		return fmt.Errorf("file_path must not contain path traversal")
+		return invalidf("file_path must not contain path traversal")
 	}
 	if filepath.Ext(path) != ".json" {
-		return fmt.Errorf("file_path must have .json extension")
+		return invalidf("file_path must have .json extension")
 	}
 	return nil
 }
@@ -132,13 +187,13 @@ func readPolicyFile(path string) ([]byte, error) {
 
 	info, err := os.Stat(path)
 	if err != nil {
-		return nil, fmt.Errorf("file not found: %s", path)
+		return nil, invalidf("file not found: %s", path)
 	}
 	if info.IsDir() {
-		return nil, fmt.Errorf("file_path is a directory, not a file")
+		return nil, invalidf("file_path is a directory, not a file")
 	}
 	if info.Size() > maxPolicyFileSize {
-		return nil, fmt.Errorf("file too large (%d bytes, max %d)", info.Size(), maxPolicyFileSize)
+		return nil, invalidf("file too large (%d bytes, max %d)", info.Size(), maxPolicyFileSize)
 	}
 
 	data, err := os.ReadFile(path) // #nosec G304 -- path is validated by validateFilePath above
@@ -147,10 +202,10 @@ func readPolicyFile(path string) ([]byte, error) {
 	}
 
 	if len(data) == 0 {
-		return nil, fmt.Errorf("file is empty: %s", path)
+		return nil, invalidf("file is empty: %s", path)
 	}
 	if !json.Valid(data) {
-		return nil, fmt.Errorf("file is not valid JSON: %s", path)
+		return nil, invalidf("file is not valid JSON: %s", path)
 	}
 
 	return data, nil
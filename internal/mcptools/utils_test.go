@@ -1,6 +1,7 @@
 package mcptools
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -301,6 +302,52 @@ func TestMapAgentToOutput(t *testing.T) {
 	})
 }
 
+func TestMapAttestationsToOutput(t *testing.T) {
+	attestation := func(index int, evaluation string) keylime.Attestation {
+		return keylime.Attestation{Index: index, Evaluation: evaluation}
+	}
+	tests := []struct {
+		name         string
+		attestations []keylime.Attestation
+		wantStatus   string
+		wantPassed   int // index of the last passed attestation, -1 for none
+	}{
+		{"no attestations", nil, keylime.StatusNoAttestations, -1},
+		{"first attestation in progress", []keylime.Attestation{attestation(0, keylime.EvaluationPending)}, keylime.EvaluationPending, -1},
+		{"latest passed", []keylime.Attestation{attestation(1, keylime.EvaluationPass), attestation(0, keylime.EvaluationFail)}, keylime.EvaluationPass, 1},
+		{
+			"in-progress attestation keeps the last outcome",
+			[]keylime.Attestation{attestation(2, keylime.EvaluationPending), attestation(1, keylime.EvaluationFail), attestation(0, keylime.EvaluationPass)},
+			keylime.EvaluationFail, 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := mapAttestationsToOutput(uuid1, tt.attestations)
+			assert.Equal(t, keylime.AttestationModePush, output.AttestationMode)
+			assert.Equal(t, tt.wantStatus, output.Status)
+			assert.Equal(t, len(tt.attestations), output.AttestationCount)
+			if tt.wantPassed < 0 {
+				assert.Nil(t, output.LastPassedAttestation)
+			} else {
+				require.NotNil(t, output.LastPassedAttestation)
+				assert.Equal(t, tt.wantPassed, output.LastPassedAttestation.Index)
+			}
+		})
+	}
+
+	t.Run("lists recent attestations only", func(t *testing.T) {
+		attestations := make([]keylime.Attestation, 25)
+		for i := range attestations {
+			attestations[i] = attestation(24-i, keylime.EvaluationPass)
+		}
+		output := mapAttestationsToOutput(uuid1, attestations)
+		assert.Len(t, output.RecentAttestations, recentAttestations)
+		assert.Equal(t, 25, output.AttestationCount)
+		assert.Equal(t, 24, output.LatestAttestation.Index)
+	})
+}
+
 func TestFetchAndDecode(t *testing.T) {
 	type testResult struct {
 		Code   int    `json:"code"`
@@ -433,3 +480,27 @@ func TestReadPolicyFile(t *testing.T) {
 		assert.Contains(t, err.Error(), ".json extension")
 	})
 }
+
+func TestDecodeContent(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"json", ` {"a": 1} `, `{"a": 1}`},
+		{"base64 json", base64.StdEncoding.EncodeToString([]byte(`{"a": 1}`)), `{"a": 1}`},
+		{"wrapped base64 text", "L3RtcCgv\nLiopPwo=", "/tmp(/.*)?\n"},
+		{"text that is valid base64", "/tmp", "/tmp"},
+		{"text", "/tmp(/.*)?\n/var/log/.*", "/tmp(/.*)?\n/var/log/.*"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := decodeContent("content", tt.content)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, string(data))
+		})
+	}
+
+	_, err := decodeContent("content", " \n")
+	assert.ErrorContains(t, err, "content is empty")
+}
@@ -0,0 +1,146 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// RuntimePolicyDiff is the difference between two runtime policies, from one to the other.
+type RuntimePolicyDiff struct {
+	Digests         MapDiff
+	Keyrings        MapDiff
+	IMABuf          MapDiff
+	ExcludesAdded   []string
+	ExcludesRemoved []string
+	Fields          []FieldChange // meta, release, ima settings and verification keys
+}
+
+// MapDiff is the difference between two path to digests maps.
+type MapDiff struct {
+	Added   []PathDigests // paths only in the new policy
+	Removed []PathDigests // paths only in the old policy
+	Changed []PathChange  // paths in both with different digests
+}
+
+// PathDigests is a path and its accepted digests.
+type PathDigests struct {
+	Path    string
+	Digests []string
+}
+
+// PathChange lists the digests added to and removed from a path.
+type PathChange struct {
+	Path    string
+	Added   []string
+	Removed []string
+}
+
+// FieldChange is a scalar setting that differs, JSON-encoded.
+type FieldChange struct {
+	Field string
+	From  string
+	To    string
+}
+
+// Empty reports whether the policies are equivalent.
+func (d *RuntimePolicyDiff) Empty() bool {
+	return d.Digests.Empty() && d.Keyrings.Empty() && d.IMABuf.Empty() &&
+		len(d.ExcludesAdded) == 0 && len(d.ExcludesRemoved) == 0 && len(d.Fields) == 0
+}
+
+// Empty reports whether the maps are equal.
+func (d MapDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// Diff compares two runtime policies. Digests are compared case-insensitively and regardless
+// of order; lists in the result are sorted.
+func Diff(from, to *RuntimePolicy) *RuntimePolicyDiff {
+	d := &RuntimePolicyDiff{
+		Digests:         diffMaps(from.Digests, to.Digests),
+		Keyrings:        diffMaps(from.Keyrings, to.Keyrings),
+		IMABuf:          diffMaps(from.IMABuf, to.IMABuf),
+		ExcludesAdded:   subtract(to.Excludes, from.Excludes),
+		ExcludesRemoved: subtract(from.Excludes, to.Excludes),
+	}
+	fields := []struct {
+		name     string
+		from, to any
+	}{
+		{"meta.version", from.Meta.Version, to.Meta.Version},
+		{"meta.generator", from.Meta.Generator, to.Meta.Generator},
+		{"meta.timestamp", from.Meta.Timestamp, to.Meta.Timestamp},
+		{"release", from.Release, to.Release},
+		{"ima.log_hash_alg", from.IMA.LogHashAlg, to.IMA.LogHashAlg},
+		{"ima.ignored_keyrings", sorted(from.IMA.IgnoredKeyrings), sorted(to.IMA.IgnoredKeyrings)},
+		{"ima.dm_policy", from.IMA.DMPolicy, to.IMA.DMPolicy},
+		{"verification-keys", from.VerificationKeys, to.VerificationKeys},
+	}
+	for _, f := range fields {
+		a, b := jsonString(f.from), jsonString(f.to)
+		if a != b {
+			d.Fields = append(d.Fields, FieldChange{Field: f.name, From: a, To: b})
+		}
+	}
+	return d
+}
+
+func diffMaps(from, to map[string][]string) MapDiff {
+	var d MapDiff
+	for _, path := range slices.Sorted(maps.Keys(to)) {
+		old, ok := from[path]
+		if !ok {
+			d.Added = append(d.Added, PathDigests{Path: path, Digests: sorted(to[path])})
+			continue
+		}
+		added, removed := subtractFold(to[path], old), subtractFold(old, to[path])
+		if len(added) > 0 || len(removed) > 0 {
+			d.Changed = append(d.Changed, PathChange{Path: path, Added: added, Removed: removed})
+		}
+	}
+	for _, path := range slices.Sorted(maps.Keys(from)) {
+		if _, ok := to[path]; !ok {
+			d.Removed = append(d.Removed, PathDigests{Path: path, Digests: sorted(from[path])})
+		}
+	}
+	return d
+}
+
+// subtract returns the sorted values of a that are not in b.
+func subtract(a, b []string) []string {
+	var out []string
+	for _, v := range a {
+		if !slices.Contains(b, v) && !slices.Contains(out, v) {
+			out = append(out, v)
+		}
+	}
+	slices.Sort(out)
+	return out
+}
+
+// subtractFold is subtract for hex digests, ignoring case.
+func subtractFold(a, b []string) []string {
+	lower := func(s []string) []string {
+		out := make([]string, len(s))
+		for i, v := range s {
+			out[i] = strings.ToLower(v)
+		}
+		return out
+	}
+	return subtract(lower(a), lower(b))
+}
+
+func sorted(s []string) []string {
+	return slices.Sorted(slices.Values(s))
+}
+
+func jsonString(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
@@ -0,0 +1,56 @@
+package policy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	from := NewRuntimePolicy(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	from.Digests = map[string][]string{
+		"/usr/bin/bash": {"aa", "bb"},
+		"/usr/bin/ls":   {"cc"},
+		"/usr/bin/old":  {"dd"},
+	}
+	from.Excludes = []string{"/tmp(/.*)?", "/var/log(/.*)?"}
+	from.Keyrings = map[string][]string{".ima": {"k1"}}
+
+	to := NewRuntimePolicy(time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC))
+	to.Digests = map[string][]string{
+		"/usr/bin/bash": {"BB", "ee"},
+		"/usr/bin/ls":   {"cc"},
+		"/usr/bin/new":  {"ff"},
+	}
+	to.Excludes = []string{"/tmp(/.*)?", "/opt(/.*)?"}
+	to.Keyrings = map[string][]string{".ima": {"k1"}}
+	to.IMABuf = map[string][]string{"kernel_version": {"b1"}}
+	to.IMA.LogHashAlg = "sha256"
+
+	d := Diff(from, to)
+	assert.False(t, d.Empty())
+	assert.Equal(t, MapDiff{
+		Added:   []PathDigests{{Path: "/usr/bin/new", Digests: []string{"ff"}}},
+		Removed: []PathDigests{{Path: "/usr/bin/old", Digests: []string{"dd"}}},
+		Changed: []PathChange{{Path: "/usr/bin/bash", Added: []string{"ee"}, Removed: []string{"aa"}}},
+	}, d.Digests, "digests compare case-insensitively")
+	assert.True(t, d.Keyrings.Empty())
+	assert.Equal(t, []PathDigests{{Path: "kernel_version", Digests: []string{"b1"}}}, d.IMABuf.Added)
+	assert.Equal(t, []string{"/opt(/.*)?"}, d.ExcludesAdded)
+	assert.Equal(t, []string{"/var/log(/.*)?"}, d.ExcludesRemoved)
+	assert.Equal(t, []FieldChange{
+		{Field: "meta.timestamp", From: `"2026-01-01T00:00:00Z"`, To: `"2026-02-01T00:00:00Z"`},
+		{Field: "ima.log_hash_alg", From: `"sha1"`, To: `"sha256"`},
+	}, d.Fields)
+
+	t.Run("identical", func(t *testing.T) {
+		assert.True(t, Diff(from, from).Empty())
+		parsed, err := ParseRuntimePolicy([]byte(`{"meta": {"version": 1}, "ima": {"log_hash_alg": "sha1"}}`))
+		require.NoError(t, err)
+		empty := NewRuntimePolicy(time.Time{})
+		empty.Meta.Timestamp = ""
+		assert.True(t, Diff(parsed, empty).Empty(), "missing sections equal empty ones")
+	})
+}
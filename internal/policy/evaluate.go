@@ -0,0 +1,111 @@
+package policy
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/keylime/keylime-mcp/internal/ima"
+)
+
+// Results of Evaluate for one measurement
+const (
+	EvalAllowed  = "allowed"
+	EvalExcluded = "excluded"
+	EvalFailing  = "failing"
+)
+
+// Keylime failure types reported for failing measurements
+const (
+	FailureNotInAllowlist = "not_in_allowlist"
+	FailureHash           = "runtime_policy_hash"
+)
+
+// EntryEvaluation is the verdict on one measurement list entry.
+type EntryEvaluation struct {
+	Line        int      `json:"line"`
+	Path        string   `json:"path"`
+	Template    string   `json:"template"`
+	Digest      string   `json:"digest"` // algorithm-prefixed, e.g. sha256:ab12...
+	Status      string   `json:"status"` // EvalAllowed, EvalExcluded or EvalFailing
+	FailureType string   `json:"failure_type,omitempty"`
+	Reason      string   `json:"reason"`
+	Expected    []string `json:"expected,omitempty"` // digests the policy accepts for a hash mismatch
+}
+
+// Evaluate checks a measurement list against a runtime policy with the rules of the Keylime
+// verifier: excluded paths are ignored, keys measured into ignored keyrings are accepted,
+// other keys must be listed in keyrings, other ima-buf entries in ima-buf, and files in digests.
+// Signatures of ima-sig entries are not verified.
+func Evaluate(p *RuntimePolicy, entries []ima.Entry) ([]EntryEvaluation, error) {
+	excludes, err := compileEach(p.Excludes)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]EntryEvaluation, 0, len(entries))
+	for _, entry := range entries {
+		result := EntryEvaluation{
+			Line:     entry.Line,
+			Path:     entry.Path,
+			Template: entry.Template,
+			Digest:   entry.HashAlg + ":" + entry.Digest,
+		}
+		evaluateEntry(p, excludes, entry, &result)
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func evaluateEntry(p *RuntimePolicy, excludes []*regexp.Regexp, entry ima.Entry, result *EntryEvaluation) {
+	if entry.IsKeyring() && ignoredKeyring(p, entry.Path) {
+		result.Status, result.Reason = EvalAllowed, fmt.Sprintf("keyring %s is in ima.ignored_keyrings", entry.Path)
+		return
+	}
+	for i, re := range excludes {
+		if re.MatchString(entry.Path) {
+			result.Status, result.Reason = EvalExcluded, fmt.Sprintf("matches exclude %s", p.Excludes[i])
+			return
+		}
+	}
+
+	section, accepted := "digests", p.Digests
+	switch {
+	case entry.IsKeyring():
+		section, accepted = "keyrings", p.Keyrings
+	case entry.Template == ima.TemplateIMABuf:
+		section, accepted = "ima-buf", p.IMABuf
+	}
+	expected, ok := accepted[entry.Path]
+	switch {
+	case !ok:
+		result.Status, result.FailureType = EvalFailing, FailureNotInAllowlist
+		result.Reason = fmt.Sprintf("%s is not in the %s of the policy", entry.Path, section)
+	case slices.ContainsFunc(expected, func(d string) bool { return strings.EqualFold(d, entry.Digest) }):
+		result.Status, result.Reason = EvalAllowed, fmt.Sprintf("digest is in the %s of the policy", section)
+	default:
+		result.Status, result.FailureType, result.Expected = EvalFailing, FailureHash, expected
+		result.Reason = fmt.Sprintf("digest of %s is not among the %d in the %s of the policy", entry.Path, len(expected), section)
+	}
+	if result.Status == EvalFailing && entry.Signature != "" && p.VerificationKeys != "" {
+		result.Reason += "; the verifier still accepts it if its signature verifies against verification-keys"
+	}
+}
+
+func ignoredKeyring(p *RuntimePolicy, keyring string) bool {
+	return slices.Contains(p.IMA.IgnoredKeyrings, "*") || slices.Contains(p.IMA.IgnoredKeyrings, keyring)
+}
+
+// compileEach compiles excludes one by one, anchored like CompileExcludes, so that the
+// matching exclude can be reported.
+func compileEach(excludes []string) ([]*regexp.Regexp, error) {
+	res := make([]*regexp.Regexp, 0, len(excludes))
+	for _, exclude := range excludes {
+		re, err := regexp.Compile("^(?:" + exclude + ")")
+		if err != nil {
+			return nil, fmt.Errorf("invalid exclude %q: %w", exclude, err)
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
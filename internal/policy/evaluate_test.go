@@ -0,0 +1,110 @@
+package policy
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvaluate(t *testing.T) {
+	entries := loadMeasurements(t)
+	statusOf := func(results []EntryEvaluation, path string) EntryEvaluation {
+		t.Helper()
+		for _, r := range results {
+			if r.Path == path {
+				return r
+			}
+		}
+		t.Fatalf("no result for %s", path)
+		return EntryEvaluation{}
+	}
+
+	t.Run("policy from the same log", func(t *testing.T) {
+		p, err := FromMeasurements(entries, []string{"/tmp(/.*)?"}, time.Unix(0, 0))
+		require.NoError(t, err)
+		results, err := Evaluate(p, entries)
+		require.NoError(t, err)
+		require.Len(t, results, len(entries))
+		for _, r := range results {
+			assert.NotEqual(t, EvalFailing, r.Status, r.Path)
+		}
+		scratch := statusOf(results, "/tmp/scratch.sh")
+		assert.Equal(t, EvalExcluded, scratch.Status)
+		assert.Equal(t, "matches exclude /tmp(/.*)?", scratch.Reason)
+	})
+
+	t.Run("failures", func(t *testing.T) {
+		p, err := FromMeasurements(entries, nil, time.Unix(0, 0))
+		require.NoError(t, err)
+		delete(p.Digests, "/usr/bin/cat")
+		p.Digests["/usr/lib64/libc.so.6"] = []string{"00ff"}
+		delete(p.Keyrings, ".ima")
+		p.IMABuf["kernel_version"] = []string{"abcd"}
+		p.VerificationKeys = "[]"
+		p.Digests["/usr/bin/ls"] = nil
+
+		results, err := Evaluate(p, entries)
+		require.NoError(t, err)
+
+		cat := statusOf(results, "/usr/bin/cat")
+		assert.Equal(t, EvalFailing, cat.Status)
+		assert.Equal(t, FailureNotInAllowlist, cat.FailureType)
+		assert.Equal(t, 5, cat.Line)
+
+		libc := statusOf(results, "/usr/lib64/libc.so.6")
+		assert.Equal(t, FailureHash, libc.FailureType)
+		assert.Equal(t, []string{"00ff"}, libc.Expected)
+		assert.Equal(t, "sha256:16c8c6eb85e05438f5d6c60ff9869072a3a3b1618aa1481ac7a0cb049f06f51d", libc.Digest)
+
+		assert.Contains(t, statusOf(results, ".ima").Reason, "keyrings")
+		assert.Contains(t, statusOf(results, "kernel_version").Reason, "ima-buf")
+		assert.Contains(t, statusOf(results, "/usr/bin/ls").Reason, "signature", "signed entries may pass on the verifier")
+		assert.Equal(t, EvalAllowed, statusOf(results, "/tmp/scratch.sh").Status, "not excluded")
+	})
+
+	t.Run("ignored keyrings", func(t *testing.T) {
+		p := NewRuntimePolicy(time.Unix(0, 0))
+		p.IMA.IgnoredKeyrings = []string{"*"}
+		results, err := Evaluate(p, entries)
+		require.NoError(t, err)
+		assert.Equal(t, EvalAllowed, statusOf(results, ".ima").Status)
+		assert.Equal(t, EvalFailing, statusOf(results, "kernel_version").Status, "only keys are ignored")
+	})
+
+	t.Run("invalid exclude", func(t *testing.T) {
+		p := NewRuntimePolicy(time.Unix(0, 0))
+		p.Excludes = []string{"("}
+		_, err := Evaluate(p, entries)
+		assert.ErrorContains(t, err, "invalid exclude")
+	})
+}
+
+func TestParseRuntimePolicy(t *testing.T) {
+	p, err := ParseRuntimePolicy([]byte(`{"meta": {"version": 1}, "digests": {"/bin/sh": ["ab"]}, "keyrings": null}`))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ab"}, p.Digests["/bin/sh"])
+	assert.NotNil(t, p.Keyrings)
+	assert.NotNil(t, p.IMABuf)
+
+	_, err = ParseRuntimePolicy([]byte(`{"digests": []}`))
+	assert.ErrorContains(t, err, "invalid runtime policy")
+
+	t.Run("unknown fields are kept", func(t *testing.T) {
+		p, err := ParseRuntimePolicy([]byte(`{"meta": {"version": 1, "note": "x"}, "ima": {"log_hash_alg": "sha256", "extra": [1]}, "custom": {"a": true}}`))
+		require.NoError(t, err)
+		p.AddDigest("/bin/sh", "ab")
+
+		data, err := json.Marshal(p)
+		require.NoError(t, err)
+		var doc map[string]any
+		require.NoError(t, json.Unmarshal(data, &doc))
+		assert.Equal(t, map[string]any{"a": true}, doc["custom"])
+		assert.Equal(t, "x", doc["meta"].(map[string]any)["note"])
+		assert.Equal(t, []any{float64(1)}, doc["ima"].(map[string]any)["extra"])
+		assert.Equal(t, "sha256", doc["ima"].(map[string]any)["log_hash_alg"])
+		assert.Equal(t, map[string]any{"/bin/sh": []any{"ab"}}, doc["digests"])
+	})
+}
@@ -0,0 +1,312 @@
+package policy
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// DefaultSkipPaths are directories Generate does not walk: pseudo filesystems, mount points
+// and volatile data, as skipped by keylime-policy.
+var DefaultSkipPaths = []string{"/dev", "/lost+found", "/media", "/mnt", "/proc", "/run", "/snap", "/sys", "/tmp", "/var"}
+
+// maxReportedErrors caps the unreadable files listed in GenerateStats.
+const maxReportedErrors = 20
+
+var elfMagic = []byte("\x7fELF")
+
+// GenerateOptions configures Generate.
+type GenerateOptions struct {
+	// Root is the directory that is / on the attested system, e.g. a mounted image.
+	Root string
+	// HashAlg is the file hash algorithm, e.g. "sha256" (the default).
+	HashAlg string
+	// Excludes are regular expressions of paths, as seen on the attested system, to leave out.
+	// They are also written to the policy so that the verifier ignores those measurements.
+	Excludes []string
+	// SkipPaths are directories that are not walked; nil means DefaultSkipPaths.
+	SkipPaths []string
+	// State is the result of a previous run over the same root. Files whose size and
+	// modification time did not change keep their digest instead of being hashed again.
+	State *GenerateState
+	// Now replaces time.Now for the policy timestamp.
+	Now func() time.Time
+}
+
+// GenerateState records the files hashed by Generate for incremental regeneration.
+type GenerateState struct {
+	Root    string               `json:"root"`
+	HashAlg string               `json:"hash_alg"`
+	Files   map[string]FileState `json:"files"`
+}
+
+// FileState is the size, modification time and digest of a hashed file.
+type FileState struct {
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"mod_time"` // Unix nanoseconds
+	Digest  string `json:"digest"`
+}
+
+// GenerateStats counts what Generate did with the files under the root.
+type GenerateStats struct {
+	Hashed          int      `json:"hashed"`
+	Reused          int      `json:"reused"`
+	Excluded        int      `json:"excluded"`
+	UnreadableCount int      `json:"unreadable_count"`
+	Unreadable      []string `json:"unreadable,omitempty"` // first few unreadable files
+}
+
+// GenerateResult is the policy built by Generate and the state for the next run.
+type GenerateResult struct {
+	Policy *RuntimePolicy
+	State  *GenerateState
+	Stats  GenerateStats
+}
+
+// CompileExcludes combines exclude regexes the way the Keylime verifier does: a path is
+// excluded when any of them matches at its start.
+func CompileExcludes(excludes []string) (*regexp.Regexp, error) {
+	if len(excludes) == 0 {
+		return nil, nil
+	}
+	for _, exclude := range excludes {
+		if _, err := regexp.Compile(exclude); err != nil {
+			return nil, fmt.Errorf("invalid exclude %q: %w", exclude, err)
+		}
+	}
+	return regexp.MustCompile("^(?:(?:" + strings.Join(excludes, ")|(?:") + "))"), nil
+}
+
+// candidate is a regular file that may need hashing.
+type candidate struct {
+	osPath     string
+	policyPath string
+	info       fs.FileInfo
+}
+
+// Generate walks opts.Root and builds a runtime policy with the digests of its executables,
+// shared libraries and other ELF files.
+func Generate(ctx context.Context, opts GenerateOptions) (*GenerateResult, error) {
+	hashAlg := opts.HashAlg
+	if hashAlg == "" {
+		hashAlg = "sha256"
+	}
+	if _, err := HashByName(hashAlg); err != nil {
+		return nil, err
+	}
+	excludeRE, err := CompileExcludes(opts.Excludes)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(opts.Root)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", opts.Root)
+	}
+	skip := opts.SkipPaths
+	if skip == nil {
+		skip = DefaultSkipPaths
+	}
+	previous := opts.State
+	if previous != nil && (previous.HashAlg != hashAlg || previous.Root != opts.Root) {
+		previous = nil
+	}
+
+	var stats GenerateStats
+	candidates, err := walkRoot(ctx, opts.Root, skip, excludeRE, &stats)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now
+	if opts.Now != nil {
+		now = opts.Now
+	}
+	result := &GenerateResult{
+		Policy: NewRuntimePolicy(now()),
+		State:  &GenerateState{Root: opts.Root, HashAlg: hashAlg, Files: map[string]FileState{}},
+	}
+	result.Policy.Excludes = append(result.Policy.Excludes, opts.Excludes...)
+
+	if err := hashCandidates(ctx, candidates, previous, result, &stats); err != nil {
+		return nil, err
+	}
+	sort.Strings(stats.Unreadable)
+	stats.Unreadable = stats.Unreadable[:min(len(stats.Unreadable), maxReportedErrors)]
+	result.Stats = stats
+	return result, nil
+}
+
+// hashCandidates adds the digests of the executables and ELF files among candidates to result.
+func hashCandidates(ctx context.Context, candidates []candidate, previous *GenerateState, result *GenerateResult, stats *GenerateStats) error {
+	var mu sync.Mutex
+	workers, ctx := errgroup.WithContext(ctx)
+	workers.SetLimit(runtime.GOMAXPROCS(0))
+	for _, c := range candidates {
+		workers.Go(func() error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			state, reused, err := hashCandidate(c, result.State.HashAlg, previous)
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err != nil:
+				stats.UnreadableCount++
+				stats.Unreadable = append(stats.Unreadable, c.policyPath)
+			case state == nil: // not an executable or library
+			case reused:
+				stats.Reused++
+			default:
+				stats.Hashed++
+			}
+			if state != nil {
+				result.State.Files[c.policyPath] = *state
+				result.Policy.AddDigest(c.policyPath, state.Digest)
+			}
+			return nil
+		})
+	}
+	return workers.Wait()
+}
+
+// walkRoot lists the regular files under root that are neither skipped nor excluded.
+func walkRoot(ctx context.Context, root string, skip []string, excludeRE *regexp.Regexp, stats *GenerateStats) ([]candidate, error) {
+	var candidates []candidate
+	err := filepath.WalkDir(root, func(osPath string, entry fs.DirEntry, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		rel, relErr := filepath.Rel(root, osPath)
+		if relErr != nil {
+			return relErr
+		}
+		policyPath := path.Join("/", filepath.ToSlash(rel))
+		if err != nil {
+			if osPath == root {
+				return err
+			}
+			stats.UnreadableCount++
+			stats.Unreadable = append(stats.Unreadable, policyPath)
+			return nil
+		}
+		if entry.IsDir() {
+			if policyPath != "/" && (slices.Contains(skip, policyPath) || (excludeRE != nil && excludeRE.MatchString(policyPath))) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil // symlinks are measured as the file they point to
+		}
+		if excludeRE != nil && excludeRE.MatchString(policyPath) {
+			stats.Excluded++
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			stats.UnreadableCount++
+			stats.Unreadable = append(stats.Unreadable, policyPath)
+			return nil
+		}
+		candidates = append(candidates, candidate{osPath: osPath, policyPath: policyPath, info: info})
+		return nil
+	})
+	return candidates, err
+}
+
+// hashCandidate returns the state of an executable or ELF file, reusing the previous digest
+// when the file is unchanged. It returns nil for other files.
+func hashCandidate(c candidate, hashAlg string, previous *GenerateState) (*FileState, bool, error) {
+	state := FileState{Size: c.info.Size(), ModTime: c.info.ModTime().UnixNano()}
+	if previous != nil {
+		if old, ok := previous.Files[c.policyPath]; ok && old.Size == state.Size && old.ModTime == state.ModTime {
+			return &old, true, nil
+		}
+	}
+
+	f, err := os.Open(c.osPath) // #nosec G304 -- files under the root the operator asked to measure
+	if err != nil {
+		return nil, false, err
+	}
+	defer f.Close()
+	header := make([]byte, len(elfMagic))
+	n, err := io.ReadFull(f, header)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return nil, false, err
+	}
+	header = header[:n]
+	if c.info.Mode().Perm()&0o111 == 0 && !bytes.Equal(header, elfMagic) {
+		return nil, false, nil
+	}
+
+	hash, _ := HashByName(hashAlg)
+	h := hash.New()
+	h.Write(header)
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, false, err
+	}
+	state.Digest = hex.EncodeToString(h.Sum(nil))
+	return &state, false, nil
+}
+
+// LoadState reads the state of a previous Generate run. A missing file returns nil.
+func LoadState(path string) (*GenerateState, error) {
+	data, err := os.ReadFile(path) // #nosec G304 -- state file next to the operator's policy output
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var state GenerateState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("invalid generation state %s: %w", path, err)
+	}
+	return &state, nil
+}
+
+// Save writes the state atomically to path.
+func (s *GenerateState) Save(path string) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(path, data)
+}
+
+// WriteFileAtomic replaces path with data through a temporary file in the same directory.
+func WriteFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,137 @@
+package policy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTree creates files under root; a leading "x:" in the content marks the file executable.
+func writeTree(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0o755))
+		mode := os.FileMode(0o644)
+		if len(content) > 2 && content[:2] == "x:" {
+			mode = 0o755
+		}
+		require.NoError(t, os.WriteFile(p, []byte(content), mode))
+	}
+}
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestGenerate(t *testing.T) {
+	fixedNow := func() time.Time { return time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC) }
+
+	t.Run("hashes executables and ELF files", func(t *testing.T) {
+		root := t.TempDir()
+		writeTree(t, root, map[string]string{
+			"usr/bin/tool":          "x:#!/bin/sh",
+			"usr/lib64/libc.so.6":   "\x7fELF library",
+			"etc/motd":              "hello",
+			"proc/1/exe":            "x:not walked",
+			"opt/app/cache/run.bin": "x:excluded",
+		})
+		require.NoError(t, os.Symlink("tool", filepath.Join(root, "usr/bin/alias")))
+
+		result, err := Generate(context.Background(), GenerateOptions{
+			Root:     root,
+			Excludes: []string{"/opt/app/cache(/.*)?"},
+			Now:      fixedNow,
+		})
+		require.NoError(t, err)
+
+		assert.Equal(t, map[string][]string{
+			"/usr/bin/tool":        {sha256Hex("x:#!/bin/sh")},
+			"/usr/lib64/libc.so.6": {sha256Hex("\x7fELF library")},
+		}, result.Policy.Digests)
+		assert.Equal(t, []string{"/opt/app/cache(/.*)?"}, result.Policy.Excludes)
+		assert.Equal(t, RuntimePolicyMeta{Version: 1, Timestamp: "2026-01-02T03:04:05Z"}, result.Policy.Meta)
+		assert.Equal(t, "sha1", result.Policy.IMA.LogHashAlg)
+		assert.Equal(t, 2, result.Stats.Hashed)
+		assert.Zero(t, result.Stats.Excluded, "the excluded directory is not walked")
+	})
+
+	t.Run("exclude matches files", func(t *testing.T) {
+		root := t.TempDir()
+		writeTree(t, root, map[string]string{"usr/bin/a": "x:a", "usr/bin/b.debug": "x:b"})
+
+		result, err := Generate(context.Background(), GenerateOptions{Root: root, Excludes: []string{`.*\.debug`}})
+		require.NoError(t, err)
+		assert.Contains(t, result.Policy.Digests, "/usr/bin/a")
+		assert.NotContains(t, result.Policy.Digests, "/usr/bin/b.debug")
+		assert.Equal(t, 1, result.Stats.Excluded)
+	})
+
+	t.Run("hash algorithm", func(t *testing.T) {
+		root := t.TempDir()
+		writeTree(t, root, map[string]string{"bin/sh": "x:sh"})
+
+		result, err := Generate(context.Background(), GenerateOptions{Root: root, HashAlg: "sha512"})
+		require.NoError(t, err)
+		assert.Len(t, result.Policy.Digests["/bin/sh"][0], 128)
+	})
+
+	t.Run("invalid options", func(t *testing.T) {
+		root := t.TempDir()
+		_, err := Generate(context.Background(), GenerateOptions{Root: root, HashAlg: "md5"})
+		assert.ErrorContains(t, err, "unsupported hash algorithm")
+		_, err = Generate(context.Background(), GenerateOptions{Root: root, Excludes: []string{"(unclosed"}})
+		assert.ErrorContains(t, err, "invalid exclude")
+		_, err = Generate(context.Background(), GenerateOptions{Root: filepath.Join(root, "missing")})
+		assert.Error(t, err)
+	})
+}
+
+func TestGenerateIncremental(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{"bin/a": "x:a", "bin/b": "x:b", "bin/c": "x:c"})
+	first, err := Generate(context.Background(), GenerateOptions{Root: root})
+	require.NoError(t, err)
+	require.Equal(t, 3, first.Stats.Hashed)
+
+	statePath := filepath.Join(t.TempDir(), "policy.json.state")
+	require.NoError(t, first.State.Save(statePath))
+	state, err := LoadState(statePath)
+	require.NoError(t, err)
+
+	changed := filepath.Join(root, "bin/b")
+	require.NoError(t, os.WriteFile(changed, []byte("x:changed"), 0o755))
+	later := time.Now().Add(time.Hour)
+	require.NoError(t, os.Chtimes(changed, later, later))
+	writeTree(t, root, map[string]string{"bin/d": "x:d"})
+	require.NoError(t, os.Remove(filepath.Join(root, "bin/c")))
+
+	second, err := Generate(context.Background(), GenerateOptions{Root: root, State: state})
+	require.NoError(t, err)
+	assert.Equal(t, 2, second.Stats.Hashed, "changed and new files")
+	assert.Equal(t, 1, second.Stats.Reused)
+	assert.Equal(t, []string{sha256Hex("x:changed")}, second.Policy.Digests["/bin/b"])
+	assert.NotContains(t, second.Policy.Digests, "/bin/c")
+	assert.NotContains(t, second.State.Files, "/bin/c")
+
+	t.Run("state of another algorithm is ignored", func(t *testing.T) {
+		third, err := Generate(context.Background(), GenerateOptions{Root: root, HashAlg: "sha384", State: second.State})
+		require.NoError(t, err)
+		assert.Equal(t, 3, third.Stats.Hashed)
+		assert.Zero(t, third.Stats.Reused)
+	})
+
+	t.Run("missing state file", func(t *testing.T) {
+		state, err := LoadState(filepath.Join(t.TempDir(), "none"))
+		require.NoError(t, err)
+		assert.Nil(t, state)
+	})
+}
@@ -0,0 +1,33 @@
+package policy
+
+import (
+	"time"
+
+	"github.com/keylime/keylime-mcp/internal/ima"
+)
+
+// FromMeasurements builds a runtime policy from the measurement list of a known-good machine.
+// Every digest measured for a path is accepted for it; keys added to kernel keyrings go to
+// keyrings and other ima-buf entries to ima-buf. Entries whose path matches excludes are
+// left out, and excludes are written to the policy.
+func FromMeasurements(entries []ima.Entry, excludes []string, now time.Time) (*RuntimePolicy, error) {
+	excludeRE, err := CompileExcludes(excludes)
+	if err != nil {
+		return nil, err
+	}
+	p := NewRuntimePolicy(now)
+	p.Excludes = append(p.Excludes, excludes...)
+	p.IMA.LogHashAlg = ima.TemplateHashAlg(entries)
+	for _, entry := range entries {
+		switch {
+		case entry.IsKeyring():
+			addUnique(p.Keyrings, entry.Path, entry.Digest)
+		case entry.Template == ima.TemplateIMABuf:
+			addUnique(p.IMABuf, entry.Path, entry.Digest)
+		case excludeRE != nil && excludeRE.MatchString(entry.Path):
+		default:
+			p.AddDigest(entry.Path, entry.Digest)
+		}
+	}
+	return p, nil
+}
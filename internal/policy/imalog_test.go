@@ -0,0 +1,40 @@
+package policy
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/keylime/keylime-mcp/internal/ima"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func loadMeasurements(t *testing.T) []ima.Entry {
+	t.Helper()
+	f, err := os.Open("testdata/ascii_runtime_measurements")
+	require.NoError(t, err)
+	defer f.Close()
+	entries, err := ima.Parse(f)
+	require.NoError(t, err)
+	return entries
+}
+
+func TestFromMeasurements(t *testing.T) {
+	p, err := FromMeasurements(loadMeasurements(t), []string{"/tmp(/.*)?"}, time.Unix(0, 0))
+	require.NoError(t, err)
+
+	assert.Len(t, p.Digests["/usr/bin/bash"], 2, "digests are deduplicated per path")
+	assert.Contains(t, p.Digests, ima.BootAggregate)
+	assert.Contains(t, p.Digests, "/opt/my app/run tool")
+	assert.Contains(t, p.Digests, "/usr/sbin/legacy")
+	assert.NotContains(t, p.Digests, "/tmp/scratch.sh")
+	assert.NotContains(t, p.Digests, ".ima")
+	assert.Equal(t, []string{"86dc8a96e6b84bfba717635b249fc76c205ed3ff46f6a9c2d452eadad466861a"}, p.Keyrings[".ima"])
+	assert.Equal(t, []string{"fea4e26faa4a4353a8527d5f1d8d34d587e0f8168439bbe3caa3c375222d0cd8"}, p.IMABuf["kernel_version"])
+	assert.Equal(t, []string{"/tmp(/.*)?"}, p.Excludes)
+	assert.Equal(t, "sha1", p.IMA.LogHashAlg)
+
+	_, err = FromMeasurements(nil, []string{"("}, time.Unix(0, 0))
+	assert.ErrorContains(t, err, "invalid exclude")
+}
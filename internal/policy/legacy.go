@@ -0,0 +1,148 @@
+package policy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Keylime's RUNTIME_POLICY_GENERATOR values for policies converted from legacy allowlists.
+const (
+	generatorCompatibleAllowlist = 2
+	generatorLegacyAllowlist     = 3
+)
+
+// Legacy allowlist formats ConvertAllowlist reads
+const (
+	AllowlistFlat = "flat_allowlist" // "<digest> <path>" lines, as written by sha256sum
+	AllowlistJSON = "json_allowlist" // JSON with a hashes section instead of digests
+)
+
+// keyringPrefix marks flat allowlist lines that hold the digest of a key in a keyring.
+const keyringPrefix = "%keyring:"
+
+var allowlistDigestRE = regexp.MustCompile(`^[0-9a-f]{40,128}$`)
+
+// AllowlistConversion reports what ConvertAllowlist took from a legacy allowlist.
+type AllowlistConversion struct {
+	Format   string
+	Digests  int      // file digests in the new policy
+	Keyrings int      // keyring digests in the new policy
+	Skipped  []string // flat allowlist lines that are not "<digest> <path>", as "line N: text"
+}
+
+// IsJSONAllowlist reports whether data is a legacy JSON allowlist rather than a runtime policy.
+func IsJSONAllowlist(data []byte) bool {
+	var doc map[string]json.RawMessage
+	if json.Unmarshal(data, &doc) != nil {
+		return false
+	}
+	_, hashes := doc["hashes"]
+	_, digests := doc["digests"]
+	return hashes && !digests
+}
+
+// ConvertAllowlist converts a legacy allowlist, flat or JSON, to a runtime policy stamped with now.
+func ConvertAllowlist(data []byte, now time.Time) (*RuntimePolicy, *AllowlistConversion, error) {
+	p := NewRuntimePolicy(now)
+	var conv *AllowlistConversion
+	if json.Valid(data) {
+		if !IsJSONAllowlist(data) {
+			return nil, nil, errors.New("not a legacy allowlist: a JSON allowlist has a hashes section and no digests")
+		}
+		var err error
+		if conv, err = convertJSONAllowlist(data, p); err != nil {
+			return nil, nil, err
+		}
+	} else {
+		conv = convertFlatAllowlist(data, p)
+		if len(p.Digests)+len(p.Keyrings) == 0 {
+			return nil, nil, errors.New("not a legacy allowlist: no \"<digest> <path>\" lines found")
+		}
+	}
+	for _, digests := range p.Digests {
+		conv.Digests += len(digests)
+	}
+	for _, digests := range p.Keyrings {
+		conv.Keyrings += len(digests)
+	}
+	return p, conv, nil
+}
+
+func convertJSONAllowlist(data []byte, p *RuntimePolicy) (*AllowlistConversion, error) {
+	var legacy struct {
+		Release  int                 `json:"release"`
+		Hashes   map[string][]string `json:"hashes"`
+		Keyrings map[string][]string `json:"keyrings"`
+		IMA      struct {
+			IgnoredKeyrings []string `json:"ignored_keyrings"`
+			LogHashAlg      string   `json:"log_hash_alg"`
+		} `json:"ima"`
+	}
+	if err := json.Unmarshal(data, &legacy); err != nil {
+		return nil, fmt.Errorf("invalid JSON allowlist: %w", err)
+	}
+	p.Meta.Generator = generatorCompatibleAllowlist
+	p.Release = legacy.Release
+	for path, digests := range legacy.Hashes {
+		for _, digest := range digests {
+			p.AddDigest(path, strings.ToLower(digest))
+		}
+	}
+	for keyring, digests := range legacy.Keyrings {
+		for _, digest := range digests {
+			addUnique(p.Keyrings, keyring, strings.ToLower(digest))
+		}
+	}
+	if legacy.IMA.IgnoredKeyrings != nil {
+		p.IMA.IgnoredKeyrings = legacy.IMA.IgnoredKeyrings
+	}
+	if legacy.IMA.LogHashAlg != "" {
+		p.IMA.LogHashAlg = legacy.IMA.LogHashAlg
+	}
+	return &AllowlistConversion{Format: AllowlistJSON}, nil
+}
+
+// convertFlatAllowlist reads "<digest> <path>" lines like Keylime's process_flat_allowlist:
+// paths may contain spaces, and "%keyring:<name>" paths go to the keyrings section.
+func convertFlatAllowlist(data []byte, p *RuntimePolicy) *AllowlistConversion {
+	p.Meta.Generator = generatorLegacyAllowlist
+	conv := &AllowlistConversion{Format: AllowlistFlat}
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		digest, path := line, ""
+		if sep := strings.IndexAny(line, " \t"); sep >= 0 {
+			digest, path = line[:sep], strings.TrimSpace(line[sep+1:])
+		}
+		digest = strings.ToLower(digest)
+		if path == "" || !allowlistDigestRE.MatchString(digest) {
+			conv.Skipped = append(conv.Skipped, fmt.Sprintf("line %d: %s", i+1, line))
+			continue
+		}
+		if keyring, ok := strings.CutPrefix(path, keyringPrefix); ok {
+			addUnique(p.Keyrings, keyring, digest)
+		} else {
+			p.AddDigest(path, digest)
+		}
+	}
+	return conv
+}
+
+// ParseExcludeList reads a legacy exclude list: one regular expression per line, skipping
+// empty lines and # comments.
+func ParseExcludeList(data []byte) []string {
+	excludes := []string{}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			excludes = append(excludes, line)
+		}
+	}
+	return excludes
+}
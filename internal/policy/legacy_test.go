@@ -0,0 +1,89 @@
+package policy
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvertAllowlist(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	bash, key := sha256Hex("bash"), sha256Hex("key")
+
+	t.Run("flat", func(t *testing.T) {
+		data := strings.Join([]string{
+			"# generated by create_allowlist.sh",
+			bash + "  /usr/bin/bash",
+			strings.ToUpper(bash) + " /usr/bin/bash",
+			sha256Hex("space") + "\t/opt/my app/run",
+			key + " %keyring:.ima",
+			"",
+			"not-a-digest /usr/bin/ls",
+			bash,
+		}, "\n")
+
+		p, conv, err := ConvertAllowlist([]byte(data), now)
+		require.NoError(t, err)
+		assert.Equal(t, &AllowlistConversion{
+			Format:   AllowlistFlat,
+			Digests:  2,
+			Keyrings: 1,
+			Skipped:  []string{"line 7: not-a-digest /usr/bin/ls", "line 8: " + bash},
+		}, conv)
+		assert.Equal(t, map[string][]string{"/usr/bin/bash": {bash}, "/opt/my app/run": {sha256Hex("space")}}, p.Digests)
+		assert.Equal(t, map[string][]string{".ima": {key}}, p.Keyrings)
+		assert.Equal(t, generatorLegacyAllowlist, p.Meta.Generator)
+		assert.Equal(t, "2024-01-01T00:00:00Z", p.Meta.Timestamp)
+
+		out, err := json.Marshal(p)
+		require.NoError(t, err)
+		assert.Empty(t, LintRuntimePolicy(out))
+	})
+
+	t.Run("json", func(t *testing.T) {
+		data := `{"meta":{"version":1},"release":2,"hashes":{"/usr/bin/bash":["` + bash + `"]},` +
+			`"keyrings":{".ima":["` + key + `"]},"ima":{"ignored_keyrings":["*"]}}`
+		require.True(t, IsJSONAllowlist([]byte(data)))
+
+		p, conv, err := ConvertAllowlist([]byte(data), now)
+		require.NoError(t, err)
+		assert.Equal(t, &AllowlistConversion{Format: AllowlistJSON, Digests: 1, Keyrings: 1}, conv)
+		assert.Equal(t, map[string][]string{"/usr/bin/bash": {bash}}, p.Digests)
+		assert.Equal(t, []string{"*"}, p.IMA.IgnoredKeyrings)
+		assert.Equal(t, "sha1", p.IMA.LogHashAlg)
+		assert.Equal(t, 2, p.Release)
+		assert.Equal(t, generatorCompatibleAllowlist, p.Meta.Generator)
+	})
+
+	t.Run("json digests are lowercased", func(t *testing.T) {
+		data := `{"hashes":{"/usr/bin/bash":["` + strings.ToUpper(bash) + `","` + bash + `"]},` +
+			`"keyrings":{".ima":["` + strings.ToUpper(key) + `"]}}`
+
+		p, _, err := ConvertAllowlist([]byte(data), now)
+		require.NoError(t, err)
+		assert.Equal(t, map[string][]string{"/usr/bin/bash": {bash}}, p.Digests)
+		assert.Equal(t, map[string][]string{".ima": {key}}, p.Keyrings)
+
+		out, err := json.Marshal(p)
+		require.NoError(t, err)
+		assert.NoError(t, ValidateRuntimePolicy(out))
+	})
+
+	t.Run("not an allowlist", func(t *testing.T) {
+		for _, data := range []string{`{"digests":{},"hashes":{}}`, "hello world", ""} {
+			assert.False(t, IsJSONAllowlist([]byte(data)))
+			_, _, err := ConvertAllowlist([]byte(data), now)
+			assert.ErrorContains(t, err, "not a legacy allowlist", data)
+		}
+	})
+}
+
+func TestParseExcludeList(t *testing.T) {
+	data := "# excludes\n/tmp(/.*)?\n\n  /var/log/.*  \r\n#/opt/.*\n"
+	assert.Equal(t, []string{"/tmp(/.*)?", "/var/log/.*"}, ParseExcludeList([]byte(data)))
+	assert.Equal(t, []string{}, ParseExcludeList(nil))
+}
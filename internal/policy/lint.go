@@ -0,0 +1,303 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Severities of lint findings
+const (
+	SeverityError   = "error"   // the verifier rejects the policy, or it cannot pass any attestation
+	SeverityWarning = "warning" // the policy works but is probably not what was meant
+)
+
+// Lint checks
+const (
+	CheckJSON           = "json"
+	CheckSchema         = "schema"
+	CheckMissingVersion = "missing_version"
+	CheckInvalidExclude = "invalid_exclude"
+	CheckBroadExclude   = "broad_exclude"
+	CheckSHA1Only       = "sha1_only"
+	CheckEmptyDigests   = "empty_digests"
+	CheckEmptyPolicy    = "empty_policy"
+	CheckNoKernels      = "no_kernels"
+	CheckNoFirmware     = "no_firmware"
+	CheckSecureBootDB   = "empty_secureboot_db"
+	CheckUnknownField   = "unknown_field"
+)
+
+// Finding is one problem found by LintRuntimePolicy or LintMBReferenceState.
+type Finding struct {
+	Severity string
+	Check    string
+	Location string // where in the document, e.g. excludes[2] or digests["/usr/bin/bash"]
+	Message  string
+}
+
+// HasErrors reports whether any finding is an error.
+func HasErrors(findings []Finding) bool {
+	return slices.ContainsFunc(findings, func(f Finding) bool { return f.Severity == SeverityError })
+}
+
+// broadExcludeProbes are files every attested Linux system runs. An exclude that matches one
+// of them turns off checking for a large part of the system.
+var broadExcludeProbes = []string{
+	"/usr/bin/bash",
+	"/usr/sbin/sshd",
+	"/usr/lib/systemd/systemd",
+	"/usr/lib64/libc.so.6",
+	"/bin/sh",
+}
+
+// maxLintPaths caps the paths named in a finding that covers many entries.
+const maxLintPaths = 5
+
+// LintRuntimePolicy checks a runtime policy document against the Keylime schema and for
+// settings that make it ineffective: excludes that are invalid or match system binaries,
+// paths without digests and paths only accepted with SHA-1 digests.
+func LintRuntimePolicy(data []byte) []Finding {
+	doc, err := decodeDocument("runtime policy", data)
+	if err != nil {
+		return []Finding{{Severity: SeverityError, Check: CheckJSON, Message: err.Error()}}
+	}
+	var findings []Finding
+	if obj, ok := doc.(map[string]any); ok && missingVersion(obj) {
+		findings = append(findings, Finding{
+			Severity: SeverityWarning,
+			Check:    CheckMissingVersion,
+			Location: "meta.version",
+			Message:  fmt.Sprintf("meta.version is missing; Keylime needs the policy format version, set it to %d", RuntimePolicyVersion),
+		})
+		doc = withVersion(obj) // the schema check reports the remaining problems, not this one again
+	}
+	if err := validateRuntimeSchema(doc); err != nil {
+		findings = append(findings, Finding{Severity: SeverityError, Check: CheckSchema, Message: err.Error()})
+	}
+	p, err := ParseRuntimePolicy(data)
+	if err != nil {
+		return findings // the schema finding says why
+	}
+	findings = append(findings, lintExcludes(p.Excludes)...)
+	for _, section := range []struct {
+		name    string
+		digests map[string][]string
+	}{{"digests", p.Digests}, {"keyrings", p.Keyrings}, {"ima-buf", p.IMABuf}} {
+		for _, path := range slices.Sorted(maps.Keys(section.digests)) {
+			if len(section.digests[path]) == 0 {
+				findings = append(findings, Finding{
+					Severity: SeverityWarning,
+					Check:    CheckEmptyDigests,
+					Location: fmt.Sprintf("%s[%q]", section.name, path),
+					Message:  fmt.Sprintf("%s has no accepted digests, so every measurement of it fails; add its digest or remove the entry", path),
+				})
+			}
+		}
+	}
+	if sha1Only := sha1OnlyPaths(p.Digests); len(sha1Only) > 0 {
+		findings = append(findings, Finding{
+			Severity: SeverityWarning,
+			Check:    CheckSHA1Only,
+			Location: "digests",
+			Message: fmt.Sprintf("%d paths are only accepted with SHA-1 digests (%s); SHA-1 is deprecated, regenerate the policy with sha256",
+				len(sha1Only), pathList(sha1Only)),
+		})
+	}
+	return findings
+}
+
+// missingVersion reports whether meta.version is absent. A meta that is not an object is left
+// to the schema check.
+func missingVersion(doc map[string]any) bool {
+	meta, ok := doc["meta"].(map[string]any)
+	if !ok {
+		_, present := doc["meta"]
+		return !present
+	}
+	_, ok = meta["version"]
+	return !ok
+}
+
+// withVersion returns a copy of doc with meta.version set; doc is not changed.
+func withVersion(doc map[string]any) map[string]any {
+	meta, _ := doc["meta"].(map[string]any)
+	meta = maps.Clone(meta)
+	if meta == nil {
+		meta = map[string]any{}
+	}
+	meta["version"] = RuntimePolicyVersion
+	versioned := maps.Clone(doc)
+	versioned["meta"] = meta
+	return versioned
+}
+
+func lintExcludes(excludes []string) []Finding {
+	var findings []Finding
+	for i, exclude := range excludes {
+		location := fmt.Sprintf("excludes[%d]", i)
+		res, err := compileEach([]string{exclude})
+		if err != nil {
+			findings = append(findings, Finding{Severity: SeverityError, Check: CheckInvalidExclude, Location: location, Message: err.Error()})
+			continue
+		}
+		var matched []string
+		for _, probe := range broadExcludeProbes {
+			if res[0].MatchString(probe) {
+				matched = append(matched, probe)
+			}
+		}
+		if len(matched) > 0 {
+			findings = append(findings, Finding{
+				Severity: SeverityWarning,
+				Check:    CheckBroadExclude,
+				Location: location,
+				Message: fmt.Sprintf("exclude %q matches %s, so the verifier does not check large parts of the system; "+
+					"limit it to the directory that needs it, e.g. /opt/app/cache(/.*)?", exclude, strings.Join(matched, ", ")),
+			})
+		}
+	}
+	return findings
+}
+
+func sha1OnlyPaths(digests map[string][]string) []string {
+	var paths []string
+	for _, path := range slices.Sorted(maps.Keys(digests)) {
+		accepted := digests[path]
+		if len(accepted) > 0 && !slices.ContainsFunc(accepted, func(d string) bool { return len(d) != 40 }) {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+func pathList(paths []string) string {
+	if len(paths) <= maxLintPaths {
+		return strings.Join(paths, ", ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(paths[:maxLintPaths], ", "), len(paths)-maxLintPaths)
+}
+
+// LintMBReferenceState checks a measured boot policy document against the reference state
+// schema and for reference states no boot can match. An empty object is accepted with a
+// warning, as the verifier does not check the boot with it.
+func LintMBReferenceState(data []byte) []Finding {
+	doc, err := decodeDocument("measured boot policy", data)
+	if err != nil {
+		return []Finding{{Severity: SeverityError, Check: CheckJSON, Message: err.Error()}}
+	}
+	obj, isObject := doc.(map[string]any)
+	if isObject && len(obj) == 0 {
+		return []Finding{{
+			Severity: SeverityWarning,
+			Check:    CheckEmptyPolicy,
+			Message:  "the measured boot policy is empty, so the boot is not checked; generate one with Create_mb_policy",
+		}}
+	}
+	var findings []Finding
+	if err := validateMBSchema(doc); err != nil {
+		findings = append(findings, Finding{Severity: SeverityError, Check: CheckSchema, Message: err.Error()})
+	}
+	if isObject {
+		findings = append(findings, lintUnknownMBFields(obj)...)
+	}
+	if HasErrors(findings) {
+		return findings
+	}
+	var state MBReferenceState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return append(findings, Finding{Severity: SeverityError, Check: CheckSchema, Message: err.Error()})
+	}
+
+	if len(state.Kernels) == 0 {
+		findings = append(findings, Finding{
+			Severity: SeverityError,
+			Check:    CheckNoKernels,
+			Location: "kernels",
+			Message:  "kernels is empty, so no boot chain matches and every attestation fails; generate the policy from the event log of a known-good boot",
+		})
+	}
+	if len(state.SCRTMAndBIOS) == 0 {
+		findings = append(findings, Finding{
+			Severity: SeverityWarning,
+			Check:    CheckNoFirmware,
+			Location: "scrtm_and_bios",
+			Message:  "scrtm_and_bios is empty, so the firmware is not checked",
+		})
+	}
+	// without has_secureboot, the verifier assumes SecureBoot is on
+	if _, set := obj["has_secureboot"]; !set || state.HasSecureBoot {
+		for _, db := range []struct {
+			name    string
+			entries []MBSignature
+		}{{"pk", state.PK}, {"kek", state.KEK}, {"db", state.DB}} {
+			if len(db.entries) == 0 {
+				findings = append(findings, Finding{
+					Severity: SeverityWarning,
+					Check:    CheckSecureBootDB,
+					Location: db.name,
+					Message: fmt.Sprintf("%s is empty although SecureBoot is checked, so no SecureBoot boot matches; "+
+						"record the %s of the machine or set has_secureboot to false", db.name, db.name),
+				})
+			}
+		}
+	}
+	return findings
+}
+
+// mbSchemaFields are the fields the reference state schema describes: those of the top level,
+// and those of the entries of each list section with object entries.
+var mbSchemaFields = sync.OnceValues(func() ([]string, map[string][]string) {
+	var schema struct {
+		Properties map[string]struct {
+			Items struct {
+				Properties map[string]json.RawMessage `json:"properties"`
+			} `json:"items"`
+		} `json:"properties"`
+	}
+	if err := json.Unmarshal(mbReferenceStateSchema, &schema); err != nil {
+		panic(fmt.Sprintf("measured boot reference state schema: %v", err))
+	}
+	entries := map[string][]string{}
+	for section, prop := range schema.Properties {
+		if len(prop.Items.Properties) > 0 {
+			entries[section] = slices.Collect(maps.Keys(prop.Items.Properties))
+		}
+	}
+	return slices.Collect(maps.Keys(schema.Properties)), entries
+})
+
+// lintUnknownMBFields warns about fields the example measured boot policy does not read. The
+// verifier stores reference states as they are, so custom policy engines may use them.
+func lintUnknownMBFields(doc map[string]any) []Finding {
+	top, entries := mbSchemaFields()
+	var findings []Finding
+	unknown := func(location string) {
+		findings = append(findings, Finding{
+			Severity: SeverityWarning,
+			Check:    CheckUnknownField,
+			Location: location,
+			Message:  fmt.Sprintf("%s is not read by the example measured boot policy of the verifier; keep it only for a custom policy engine", location),
+		})
+	}
+	for _, key := range slices.Sorted(maps.Keys(doc)) {
+		if !slices.Contains(top, key) {
+			unknown(key)
+		}
+	}
+	for _, section := range slices.Sorted(maps.Keys(entries)) {
+		list, _ := doc[section].([]any)
+		for i, entry := range list {
+			fields, _ := entry.(map[string]any)
+			for _, key := range slices.Sorted(maps.Keys(fields)) {
+				if !slices.Contains(entries[section], key) {
+					unknown(fmt.Sprintf("%s[%d].%s", section, i, key))
+				}
+			}
+		}
+	}
+	return findings
+}
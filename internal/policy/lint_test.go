@@ -0,0 +1,138 @@
+package policy
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func checks(findings []Finding) []string {
+	var names []string
+	for _, f := range findings {
+		names = append(names, f.Check)
+	}
+	return names
+}
+
+func TestLintRuntimePolicy(t *testing.T) {
+	valid := NewRuntimePolicy(time.Unix(0, 0))
+	valid.AddDigest("/usr/bin/bash", sha256Hex("bash"))
+	valid.Excludes = []string{"/tmp(/.*)?"}
+	data, err := json.Marshal(valid)
+	require.NoError(t, err)
+	assert.Empty(t, LintRuntimePolicy(data))
+
+	tests := []struct {
+		name     string
+		edit     func(doc map[string]any)
+		want     []string
+		location string
+		message  string
+	}{
+		{"missing version", func(doc map[string]any) { doc["meta"] = map[string]any{} },
+			[]string{CheckMissingVersion}, "meta.version", "set it to 1"},
+		{"missing version and section", func(doc map[string]any) { delete(doc, "meta"); delete(doc, "ima-buf") },
+			[]string{CheckMissingVersion, CheckSchema}, "meta.version", ""},
+		{"invalid exclude", func(doc map[string]any) { doc["excludes"] = []string{"/tmp", "/opt/(cache"} },
+			[]string{CheckInvalidExclude}, "excludes[1]", "/opt/(cache"},
+		{"broad exclude", func(doc map[string]any) { doc["excludes"] = []string{"/.*"} },
+			[]string{CheckBroadExclude}, "excludes[0]", "/usr/bin/bash"},
+		{"exclude of a system directory", func(doc map[string]any) { doc["excludes"] = []string{"/usr/lib64(/.*)?"} },
+			[]string{CheckBroadExclude}, "excludes[0]", "/usr/lib64/libc.so.6"},
+		{"empty digests", func(doc map[string]any) { doc["keyrings"] = map[string]any{".ima": []string{}} },
+			[]string{CheckEmptyDigests}, `keyrings[".ima"]`, "no accepted digests"},
+		{"sha1 only", func(doc map[string]any) {
+			digests := map[string]any{"/usr/bin/mixed": []string{strings.Repeat("a", 40), sha256Hex("x")}}
+			for _, path := range []string{"/a", "/b", "/c", "/d", "/e", "/f"} {
+				digests[path] = []string{strings.Repeat("b", 40)}
+			}
+			doc["digests"] = digests
+		}, []string{CheckSHA1Only}, "digests", "6 paths are only accepted with SHA-1 digests (/a, /b, /c, /d, /e and 1 more)"},
+		{"schema", func(doc map[string]any) { doc["release"] = "one" }, []string{CheckSchema}, "", "release"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var doc map[string]any
+			require.NoError(t, json.Unmarshal(data, &doc))
+			tt.edit(doc)
+			edited, err := json.Marshal(doc)
+			require.NoError(t, err)
+
+			findings := LintRuntimePolicy(edited)
+			assert.Equal(t, tt.want, checks(findings))
+			require.NotEmpty(t, findings)
+			assert.Equal(t, tt.location, findings[0].Location)
+			if tt.message != "" {
+				assert.Contains(t, findings[0].Message, tt.message)
+			}
+		})
+	}
+
+	t.Run("severities", func(t *testing.T) {
+		assert.True(t, HasErrors(LintRuntimePolicy([]byte(`{"digests": `))))
+		assert.Equal(t, []string{CheckJSON}, checks(LintRuntimePolicy([]byte(`{"digests": `))))
+		unversioned := strings.Replace(string(data), `"version":1`, `"other":1`, 1)
+		require.NotEqual(t, string(data), unversioned)
+		assert.False(t, HasErrors(LintRuntimePolicy([]byte(unversioned))), "a missing version is a warning")
+
+		broad := *valid
+		broad.Excludes = []string{".*"}
+		data, err := json.Marshal(broad)
+		require.NoError(t, err)
+		findings := LintRuntimePolicy(data)
+		require.Len(t, findings, 1)
+		assert.Equal(t, SeverityWarning, findings[0].Severity)
+		assert.False(t, HasErrors(findings))
+	})
+}
+
+func TestLintMBReferenceState(t *testing.T) {
+	state, err := FromEventLog(parseBootLog(t, true), false)
+	require.NoError(t, err)
+	data, err := json.Marshal(state)
+	require.NoError(t, err)
+	assert.Empty(t, LintMBReferenceState(data))
+
+	t.Run("without SecureBoot", func(t *testing.T) {
+		state, err := FromEventLog(parseBootLog(t, false), true)
+		require.NoError(t, err)
+		data, err := json.Marshal(state)
+		require.NoError(t, err)
+		assert.Empty(t, LintMBReferenceState(data))
+	})
+
+	tests := []struct {
+		name string
+		edit func(doc map[string]any)
+		want []string
+	}{
+		{"not a reference state", func(doc map[string]any) { clear(doc); doc["meta"] = map[string]any{}; doc["events"] = []any{} },
+			[]string{CheckSchema, CheckUnknownField, CheckUnknownField}},
+		{"unknown fields", func(doc map[string]any) {
+			doc["vendor_db"] = []any{}
+			doc["kernels"].([]any)[0].(map[string]any)["kernel_cmdline"] = "ro quiet"
+		}, []string{CheckUnknownField, CheckUnknownField}},
+		{"other hash banks", func(doc map[string]any) {
+			doc["mokdig"] = []any{map[string]any{"sha1": "0x" + strings.Repeat("ab", 20), "sm3_256": "0x" + strings.Repeat("cd", 32)}}
+		}, nil},
+		{"digest format", func(doc map[string]any) { doc["mokdig"] = []any{map[string]any{"sha256": "abc"}} }, []string{CheckSchema}},
+		{"empty", func(doc map[string]any) { clear(doc) }, []string{CheckEmptyPolicy}},
+		{"no kernels", func(doc map[string]any) { doc["kernels"] = []any{} }, []string{CheckNoKernels}},
+		{"no firmware", func(doc map[string]any) { doc["scrtm_and_bios"] = []any{} }, []string{CheckNoFirmware}},
+		{"empty db", func(doc map[string]any) { doc["db"] = []any{}; delete(doc, "has_secureboot") }, []string{CheckSecureBootDB}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var doc map[string]any
+			require.NoError(t, json.Unmarshal(data, &doc))
+			tt.edit(doc)
+			edited, err := json.Marshal(doc)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, checks(LintMBReferenceState(edited)))
+		})
+	}
+}
@@ -0,0 +1,210 @@
+package policy
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/keylime/keylime-mcp/internal/tpm"
+	"github.com/keylime/keylime-mcp/internal/tpm/eventlog"
+)
+
+// ErrSecureBootDisabled is returned by FromEventLog when the log shows SecureBoot off.
+var ErrSecureBootDisabled = errors.New("SecureBoot is disabled in the event log")
+
+// MBReferenceState is a measured boot reference state in the format of keylime-policy,
+// as evaluated by the example measured boot policy of the verifier.
+type MBReferenceState struct {
+	HasSecureBoot bool           `json:"has_secureboot"`
+	SCRTMAndBIOS  []SCRTMAndBIOS `json:"scrtm_and_bios"`
+	PK            []MBSignature  `json:"pk"`
+	KEK           []MBSignature  `json:"kek"`
+	DB            []MBSignature  `json:"db"`
+	DBX           []MBSignature  `json:"dbx"`
+	MokDig        []MBDigest     `json:"mokdig"`
+	MokXDig       []MBDigest     `json:"mokxdig"`
+	Kernels       []MBKernel     `json:"kernels"`
+}
+
+// SCRTMAndBIOS holds the digests of the core root of trust and the platform firmware.
+type SCRTMAndBIOS struct {
+	SCRTM            *MBDigest  `json:"scrtm,omitempty"`
+	PlatformFirmware []MBDigest `json:"platform_firmware"`
+}
+
+// MBDigest is an event digest; values are 0x-prefixed hex.
+type MBDigest struct {
+	SHA256 string `json:"sha256"`
+}
+
+// MBSignature is an entry of a SecureBoot signature database.
+type MBSignature struct {
+	SignatureOwner string `json:"SignatureOwner"`
+	SignatureData  string `json:"SignatureData"`
+}
+
+// MBKernel holds the digests of one boot chain: Authenticode digests of the EFI
+// applications and plain digests of the files grub loads.
+type MBKernel struct {
+	ShimAuthcode   string `json:"shim_authcode_sha256,omitempty"`
+	GrubAuthcode   string `json:"grub_authcode_sha256,omitempty"`
+	KernelAuthcode string `json:"kernel_authcode_sha256,omitempty"`
+	KernelPlain    string `json:"kernel_plain_sha256,omitempty"`
+	InitrdPlain    string `json:"initrd_plain_sha256,omitempty"`
+}
+
+// FromEventLog builds a measured boot reference state from the event log of a known-good
+// boot. Without skipSecureBoot, a log with SecureBoot disabled is rejected with
+// ErrSecureBootDisabled; with it, the SecureBoot databases are left out of the state.
+func FromEventLog(log *eventlog.Log, skipSecureBoot bool) (*MBReferenceState, error) {
+	if !slices.Contains(log.Algorithms(), tpm.AlgSHA256) {
+		return nil, errors.New("event log has no sha256 digests")
+	}
+	enabled, err := secureBootEnabled(log)
+	if err != nil {
+		return nil, err
+	}
+	if !enabled && !skipSecureBoot {
+		return nil, ErrSecureBootDisabled
+	}
+
+	state := &MBReferenceState{
+		HasSecureBoot: !skipSecureBoot,
+		SCRTMAndBIOS:  []SCRTMAndBIOS{firmwareDigests(log)},
+		PK:            []MBSignature{},
+		KEK:           []MBSignature{},
+		DB:            []MBSignature{},
+		DBX:           []MBSignature{},
+		MokDig:        []MBDigest{},
+		MokXDig:       []MBDigest{},
+	}
+	if state.HasSecureBoot {
+		if err := state.addSignatureDatabases(log); err != nil {
+			return nil, err
+		}
+	}
+	for _, event := range log.Events {
+		if event.PCR != 14 || event.Type != eventlog.EvIPL {
+			continue
+		}
+		switch eventString(event) {
+		case "MokList":
+			state.MokDig = append(state.MokDig, eventDigest(event))
+		case "MokListX":
+			state.MokXDig = append(state.MokXDig, eventDigest(event))
+		}
+	}
+	kernel, err := bootChain(log)
+	if err != nil {
+		return nil, err
+	}
+	state.Kernels = []MBKernel{kernel}
+	return state, nil
+}
+
+// secureBootEnabled reads the SecureBoot variable measured into PCR 7.
+func secureBootEnabled(log *eventlog.Log) (bool, error) {
+	for _, event := range log.Events {
+		if event.Type != eventlog.EvEFIVariableDriverConfig {
+			continue
+		}
+		v, err := eventlog.ParseVariableData(event.Data)
+		if err != nil {
+			return false, fmt.Errorf("event %d: %w", event.Index, err)
+		}
+		if v.VendorGUID == eventlog.GlobalVariableGUID && v.Name == "SecureBoot" {
+			return len(v.Data) == 1 && v.Data[0] == 1, nil
+		}
+	}
+	return false, nil
+}
+
+func firmwareDigests(log *eventlog.Log) SCRTMAndBIOS {
+	out := SCRTMAndBIOS{PlatformFirmware: []MBDigest{}}
+	for _, event := range log.Events {
+		switch event.Type {
+		case eventlog.EvSCRTMVersion:
+			if out.SCRTM == nil {
+				d := eventDigest(event)
+				out.SCRTM = &d
+			}
+		case eventlog.EvEFIPlatformFirmwareBlob, eventlog.EvEFIPlatformFirmwareBlob2:
+			out.PlatformFirmware = append(out.PlatformFirmware, eventDigest(event))
+		}
+	}
+	return out
+}
+
+// addSignatureDatabases adds the PK, KEK, db and dbx entries of the EFI variable events.
+func (s *MBReferenceState) addSignatureDatabases(log *eventlog.Log) error {
+	databases := map[string]*[]MBSignature{"PK": &s.PK, "KEK": &s.KEK, "db": &s.DB, "dbx": &s.DBX}
+	for _, event := range log.Events {
+		if event.Type != eventlog.EvEFIVariableDriverConfig {
+			continue
+		}
+		v, err := eventlog.ParseVariableData(event.Data)
+		if err != nil {
+			return fmt.Errorf("event %d: %w", event.Index, err)
+		}
+		db, ok := databases[v.Name]
+		if !ok {
+			continue
+		}
+		sigs, err := eventlog.ParseSignatureLists(v.Data)
+		if err != nil {
+			return fmt.Errorf("event %d (%s): %w", event.Index, v.Name, err)
+		}
+		for _, sig := range sigs {
+			*db = append(*db, MBSignature{SignatureOwner: sig.Owner.String(), SignatureData: hex0x(sig.Data)})
+		}
+	}
+	return nil
+}
+
+// bootChain takes the boot applications measured into PCR 4, in order shim, grub and
+// kernel, and the kernel and initrd grub measured into PCR 9.
+func bootChain(log *eventlog.Log) (MBKernel, error) {
+	var apps []string
+	var kernel MBKernel
+	for _, event := range log.Events {
+		switch {
+		case event.PCR == 4 && event.Type == eventlog.EvEFIBootServicesApp:
+			apps = append(apps, eventDigest(event).SHA256)
+		case event.PCR == 9 && event.Type == eventlog.EvIPL:
+			name := eventString(event)
+			if kernel.KernelPlain == "" && strings.Contains(name, "vmlinuz") {
+				kernel.KernelPlain = eventDigest(event).SHA256
+			}
+			if kernel.InitrdPlain == "" && (strings.Contains(name, "initrd") || strings.Contains(name, "initramfs")) {
+				kernel.InitrdPlain = eventDigest(event).SHA256
+			}
+		}
+	}
+	switch {
+	case len(apps) >= 3:
+		kernel.ShimAuthcode, kernel.GrubAuthcode, kernel.KernelAuthcode = apps[0], apps[1], apps[len(apps)-1]
+	case len(apps) == 2:
+		kernel.GrubAuthcode, kernel.KernelAuthcode = apps[0], apps[1]
+	default:
+		return MBKernel{}, fmt.Errorf("event log measures %d boot applications; expected a boot loader and a kernel", len(apps))
+	}
+	return kernel, nil
+}
+
+func eventDigest(event eventlog.Event) MBDigest {
+	d, _ := event.Digest(tpm.AlgSHA256)
+	return MBDigest{SHA256: hex0x(d)}
+}
+
+// eventString returns the NUL-terminated string data of an event.
+func eventString(event eventlog.Event) string {
+	data, _, _ := bytes.Cut(event.Data, []byte{0})
+	return string(data)
+}
+
+func hex0x(b []byte) string {
+	return "0x" + hex.EncodeToString(b)
+}
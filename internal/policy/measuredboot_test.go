@@ -0,0 +1,74 @@
+package policy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/keylime/keylime-mcp/internal/tpm/eventlog"
+	"github.com/keylime/keylime-mcp/internal/tpm/tpmtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func digest0x(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "0x" + hex.EncodeToString(sum[:])
+}
+
+func parseBootLog(t *testing.T, secureBoot bool) *eventlog.Log {
+	t.Helper()
+	log, err := eventlog.Parse(tpmtest.BootLog(secureBoot))
+	require.NoError(t, err)
+	return log
+}
+
+func TestFromEventLog(t *testing.T) {
+	t.Run("SecureBoot", func(t *testing.T) {
+		state, err := FromEventLog(parseBootLog(t, true), false)
+		require.NoError(t, err)
+
+		assert.True(t, state.HasSecureBoot)
+		assert.Equal(t, []MBKernel{{
+			ShimAuthcode:   digest0x(tpmtest.ShimImage),
+			GrubAuthcode:   digest0x(tpmtest.GrubImage),
+			KernelAuthcode: digest0x(tpmtest.KernelImage),
+			KernelPlain:    digest0x(tpmtest.KernelImage),
+			InitrdPlain:    digest0x(tpmtest.InitrdImage),
+		}}, state.Kernels)
+
+		require.Len(t, state.PK, 1)
+		assert.Equal(t, "0x"+hex.EncodeToString(tpmtest.BootCerts["PK"]), state.PK[0].SignatureData)
+		assert.Equal(t, "0000000f-0000-0000-0000-000000000000", state.PK[0].SignatureOwner)
+		assert.Len(t, state.KEK, 1)
+		assert.Len(t, state.DB, 1)
+		assert.Len(t, state.DBX, 1)
+		assert.Len(t, state.MokDig, 1)
+		assert.Len(t, state.MokXDig, 1)
+
+		require.Len(t, state.SCRTMAndBIOS, 1)
+		assert.NotNil(t, state.SCRTMAndBIOS[0].SCRTM)
+		assert.Len(t, state.SCRTMAndBIOS[0].PlatformFirmware, 1)
+	})
+
+	t.Run("SecureBoot disabled", func(t *testing.T) {
+		_, err := FromEventLog(parseBootLog(t, false), false)
+		assert.ErrorIs(t, err, ErrSecureBootDisabled)
+
+		state, err := FromEventLog(parseBootLog(t, false), true)
+		require.NoError(t, err)
+		assert.False(t, state.HasSecureBoot)
+		assert.Empty(t, state.PK)
+		assert.NotNil(t, state.DB, "databases are empty lists, not null")
+		assert.Equal(t, digest0x(tpmtest.KernelImage), state.Kernels[0].KernelAuthcode)
+	})
+
+	t.Run("missing boot applications", func(t *testing.T) {
+		log, err := eventlog.Parse(tpmtest.NewEventLog().
+			Add(7, eventlog.EvEFIVariableDriverConfig, tpmtest.EFIVariable(eventlog.GlobalVariableGUID, "SecureBoot", []byte{1})).
+			Bytes())
+		require.NoError(t, err)
+		_, err = FromEventLog(log, false)
+		assert.ErrorContains(t, err, "0 boot applications")
+	})
+}
@@ -0,0 +1,183 @@
+// Package policy builds and inspects Keylime runtime and measured boot policies.
+package policy
+
+import (
+	"crypto"
+	_ "crypto/sha1" // #nosec G505 -- registers SHA-1 for policies that ask for it
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+)
+
+// RuntimePolicyVersion is the runtime policy format version Keylime expects in meta.version.
+const RuntimePolicyVersion = 1
+
+// generatorUnknown is Keylime's RUNTIME_POLICY_GENERATOR value for policies not converted
+// from a legacy allowlist.
+const generatorUnknown = 0
+
+// RuntimePolicy is a Keylime runtime policy: the file digests IMA measurements must match,
+// the paths the verifier ignores, and how it reads the IMA log.
+type RuntimePolicy struct {
+	Meta             RuntimePolicyMeta   `json:"meta"`
+	Release          int                 `json:"release"`
+	Digests          map[string][]string `json:"digests"`
+	Excludes         []string            `json:"excludes"`
+	Keyrings         map[string][]string `json:"keyrings"`
+	IMA              IMAConfig           `json:"ima"`
+	IMABuf           map[string][]string `json:"ima-buf"`
+	VerificationKeys string              `json:"verification-keys"`
+	// Extra keeps fields this package does not know, so that editing a policy does not drop them.
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// RuntimePolicyMeta identifies the format and creation time of a runtime policy.
+type RuntimePolicyMeta struct {
+	Version   int    `json:"version"`
+	Generator int    `json:"generator"`
+	Timestamp string `json:"timestamp,omitempty"`
+	// Extra keeps fields this package does not know.
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// IMAConfig holds the IMA log settings of a runtime policy.
+type IMAConfig struct {
+	IgnoredKeyrings []string `json:"ignored_keyrings"`
+	LogHashAlg      string   `json:"log_hash_alg"`
+	DMPolicy        any      `json:"dm_policy"`
+	// Extra keeps fields this package does not know.
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+func (p *RuntimePolicy) UnmarshalJSON(data []byte) error {
+	type plain RuntimePolicy
+	return unmarshalWithExtra(data, (*plain)(p), &p.Extra)
+}
+
+func (p RuntimePolicy) MarshalJSON() ([]byte, error) {
+	type plain RuntimePolicy
+	return marshalWithExtra(plain(p), p.Extra)
+}
+
+func (m *RuntimePolicyMeta) UnmarshalJSON(data []byte) error {
+	type plain RuntimePolicyMeta
+	return unmarshalWithExtra(data, (*plain)(m), &m.Extra)
+}
+
+func (m RuntimePolicyMeta) MarshalJSON() ([]byte, error) {
+	type plain RuntimePolicyMeta
+	return marshalWithExtra(plain(m), m.Extra)
+}
+
+func (c *IMAConfig) UnmarshalJSON(data []byte) error {
+	type plain IMAConfig
+	return unmarshalWithExtra(data, (*plain)(c), &c.Extra)
+}
+
+func (c IMAConfig) MarshalJSON() ([]byte, error) {
+	type plain IMAConfig
+	return marshalWithExtra(plain(c), c.Extra)
+}
+
+// unmarshalWithExtra decodes data into v and stores the fields v has no json tag for in extra.
+func unmarshalWithExtra(data []byte, v any, extra *map[string]json.RawMessage) error {
+	if err := json.Unmarshal(data, v); err != nil {
+		return err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	t := reflect.TypeOf(v).Elem()
+	for i := range t.NumField() {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		delete(fields, name)
+	}
+	*extra = nil
+	if len(fields) > 0 {
+		*extra = fields
+	}
+	return nil
+}
+
+// marshalWithExtra encodes v and adds the fields in extra that v does not set itself.
+func marshalWithExtra(v any, extra map[string]json.RawMessage) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil || len(extra) == 0 {
+		return data, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	for name, value := range extra {
+		if _, ok := fields[name]; !ok {
+			fields[name] = value
+		}
+	}
+	return json.Marshal(fields)
+}
+
+// NewRuntimePolicy returns an empty runtime policy stamped with now.
+func NewRuntimePolicy(now time.Time) *RuntimePolicy {
+	return &RuntimePolicy{
+		Meta: RuntimePolicyMeta{
+			Version:   RuntimePolicyVersion,
+			Generator: generatorUnknown,
+			Timestamp: now.UTC().Format(time.RFC3339),
+		},
+		Digests:  map[string][]string{},
+		Excludes: []string{},
+		Keyrings: map[string][]string{},
+		IMA:      IMAConfig{IgnoredKeyrings: []string{}, LogHashAlg: "sha1"},
+		IMABuf:   map[string][]string{},
+	}
+}
+
+// AddDigest records digest as accepted for path, keeping existing digests.
+func (p *RuntimePolicy) AddDigest(path, digest string) {
+	addUnique(p.Digests, path, digest)
+}
+
+func addUnique(m map[string][]string, key, value string) {
+	if !slices.Contains(m[key], value) {
+		m[key] = append(m[key], value)
+	}
+}
+
+// HashAlgorithms are the file hash algorithms IMA and Keylime support, by name.
+var HashAlgorithms = map[string]crypto.Hash{
+	"sha1":   crypto.SHA1,
+	"sha256": crypto.SHA256,
+	"sha384": crypto.SHA384,
+	"sha512": crypto.SHA512,
+}
+
+// HashByName returns the hash algorithm called name, e.g. "sha256".
+func HashByName(name string) (crypto.Hash, error) {
+	h, ok := HashAlgorithms[name]
+	if !ok {
+		return 0, fmt.Errorf("unsupported hash algorithm %q (use sha1, sha256, sha384 or sha512)", name)
+	}
+	return h, nil
+}
+
+// ParseRuntimePolicy decodes a runtime policy; sections missing from data are left empty.
+func ParseRuntimePolicy(data []byte) (*RuntimePolicy, error) {
+	p := NewRuntimePolicy(time.Time{})
+	p.Meta = RuntimePolicyMeta{}
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("invalid runtime policy: %w", err)
+	}
+	for _, m := range []*map[string][]string{&p.Digests, &p.Keyrings, &p.IMABuf} {
+		if *m == nil {
+			*m = map[string][]string{}
+		}
+	}
+	return p, nil
+}
@@ -0,0 +1,81 @@
+package policy
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/google/jsonschema-go/jsonschema"
+)
+
+// runtimePolicySchema is the JSON schema the Keylime verifier checks runtime policies against.
+//
+//go:embed runtime_policy_schema.json
+var runtimePolicySchema []byte
+
+// mbReferenceStateSchema describes the reference states the example measured boot policy
+// of the verifier evaluates, as written by FromEventLog and keylime-policy.
+//
+//go:embed mb_reference_state_schema.json
+var mbReferenceStateSchema []byte
+
+var (
+	resolvedRuntimeSchema = sync.OnceValues(func() (*jsonschema.Resolved, error) { return resolveSchema(runtimePolicySchema) })
+	resolvedMBSchema      = sync.OnceValues(func() (*jsonschema.Resolved, error) { return resolveSchema(mbReferenceStateSchema) })
+)
+
+func resolveSchema(data []byte) (*jsonschema.Resolved, error) {
+	var schema jsonschema.Schema
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return nil, err
+	}
+	return schema.Resolve(nil)
+}
+
+// ValidateRuntimePolicy checks a runtime policy document against the Keylime schema and
+// compiles its excludes, which the schema only describes as regular expressions.
+func ValidateRuntimePolicy(data []byte) error {
+	doc, err := decodeDocument("runtime policy", data)
+	if err != nil {
+		return err
+	}
+	if err := validateRuntimeSchema(doc); err != nil {
+		return err
+	}
+	var p RuntimePolicy
+	if err := json.Unmarshal(data, &p); err != nil {
+		return fmt.Errorf("invalid runtime policy: %w", err)
+	}
+	if _, err := CompileExcludes(p.Excludes); err != nil {
+		return err
+	}
+	return nil
+}
+
+func decodeDocument(kind string, data []byte) (any, error) {
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%s is not valid JSON: %w", kind, err)
+	}
+	return doc, nil
+}
+
+func validateRuntimeSchema(doc any) error {
+	return validateSchema(resolvedRuntimeSchema, "runtime policy does not match the Keylime schema", doc)
+}
+
+func validateMBSchema(doc any) error {
+	return validateSchema(resolvedMBSchema, "measured boot policy is not a valid reference state", doc)
+}
+
+func validateSchema(resolved func() (*jsonschema.Resolved, error), msg string, doc any) error {
+	schema, err := resolved()
+	if err != nil {
+		return fmt.Errorf("policy schema: %w", err)
+	}
+	if err := schema.Validate(doc); err != nil {
+		return fmt.Errorf("%s: %w", msg, err)
+	}
+	return nil
+}
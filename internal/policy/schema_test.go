@@ -0,0 +1,49 @@
+package policy
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateRuntimePolicy(t *testing.T) {
+	valid := NewRuntimePolicy(time.Unix(0, 0))
+	valid.AddDigest("/usr/bin/bash", sha256Hex("bash"))
+	valid.Excludes = []string{"/tmp(/.*)?"}
+	data, err := json.Marshal(valid)
+	require.NoError(t, err)
+	require.NoError(t, ValidateRuntimePolicy(data))
+
+	tests := []struct {
+		name    string
+		edit    func(doc map[string]any)
+		wantErr string
+	}{
+		{"short digest", func(doc map[string]any) { doc["digests"] = map[string]any{"/bin/sh": []string{"abc"}} }, "pattern"},
+		{"upper-case digest", func(doc map[string]any) {
+			doc["keyrings"] = map[string]any{".ima": []string{"AB" + sha256Hex("x")[2:]}}
+		}, "pattern"},
+		{"missing section", func(doc map[string]any) { delete(doc, "ima-buf") }, "ima-buf"},
+		{"unknown section", func(doc map[string]any) { doc["allowlist"] = map[string]any{} }, "allowlist"},
+		{"meta version", func(doc map[string]any) { doc["meta"] = map[string]any{"version": 0} }, "minimum"},
+		{"log hash algorithm", func(doc map[string]any) {
+			doc["ima"] = map[string]any{"ignored_keyrings": []string{}, "log_hash_alg": "md5"}
+		}, "log_hash_alg"},
+		{"exclude regex", func(doc map[string]any) { doc["excludes"] = []string{"("} }, "invalid exclude"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var doc map[string]any
+			require.NoError(t, json.Unmarshal(data, &doc))
+			tt.edit(doc)
+			edited, err := json.Marshal(doc)
+			require.NoError(t, err)
+			err = ValidateRuntimePolicy(edited)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
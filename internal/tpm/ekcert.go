@@ -0,0 +1,132 @@
+package tpm
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// oidSubjectAltName is marked critical in EK certificates, which carry the TPM manufacturer,
+// model and version as a directoryName that crypto/x509 does not interpret.
+var oidSubjectAltName = asn1.ObjectIdentifier{2, 5, 29, 17}
+
+// ParseEKCertificate decodes an EK certificate given as PEM, DER, or base64 encoded DER
+// (the form the registrar returns in ekcert).
+func ParseEKCertificate(data []byte) (*x509.Certificate, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, errors.New("EK certificate is empty")
+	}
+	if block, _ := pem.Decode(data); block != nil {
+		data = block.Bytes
+	} else if decoded, err := base64.StdEncoding.DecodeString(string(data)); err == nil {
+		data = decoded
+	}
+	cert, err := x509.ParseCertificate(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid EK certificate: %w", err)
+	}
+	return cert, nil
+}
+
+// CertStore holds TPM manufacturer CA certificates, like Keylime's tpm_cert_store.
+type CertStore struct {
+	roots         *x509.CertPool
+	intermediates *x509.CertPool
+	count         int
+}
+
+// LoadCertStore reads every PEM or DER certificate in dir. Self-signed certificates are
+// trusted as roots; the others are used as intermediates.
+func LoadCertStore(dir string) (*CertStore, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read TPM cert store: %w", err)
+	}
+	store := &CertStore{roots: x509.NewCertPool(), intermediates: x509.NewCertPool()}
+	for _, entry := range entries {
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if entry.IsDir() || (ext != ".pem" && ext != ".crt" && ext != ".cer" && ext != ".der") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name())) // #nosec G304 -- files of the operator-configured cert store
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", entry.Name(), err)
+		}
+		certs, err := parseCertificates(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", entry.Name(), err)
+		}
+		for _, cert := range certs {
+			store.add(cert)
+		}
+	}
+	if store.count == 0 {
+		return nil, fmt.Errorf("no certificates found in TPM cert store %s", dir)
+	}
+	return store, nil
+}
+
+func (s *CertStore) add(cert *x509.Certificate) {
+	if bytes.Equal(cert.RawIssuer, cert.RawSubject) && cert.CheckSignatureFrom(cert) == nil {
+		s.roots.AddCert(cert)
+	} else {
+		s.intermediates.AddCert(cert)
+	}
+	s.count++
+}
+
+// parseCertificates decodes all PEM blocks of data, or data as a single DER certificate.
+func parseCertificates(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for rest := data; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) > 0 {
+		return certs, nil
+	}
+	cert, err := x509.ParseCertificate(data)
+	if err != nil {
+		return nil, err
+	}
+	return []*x509.Certificate{cert}, nil
+}
+
+// Verify checks that cert chains to a manufacturer root of the store.
+func (s *CertStore) Verify(cert *x509.Certificate) error {
+	c := *cert
+	c.UnhandledCriticalExtensions = nil
+	for _, oid := range cert.UnhandledCriticalExtensions {
+		if !oid.Equal(oidSubjectAltName) {
+			c.UnhandledCriticalExtensions = append(c.UnhandledCriticalExtensions, oid)
+		}
+	}
+	_, err := c.Verify(x509.VerifyOptions{
+		Roots:         s.roots,
+		Intermediates: s.intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny}, // EK certificates use the TCG EKCertificate purpose
+	})
+	if err != nil {
+		return fmt.Errorf("EK certificate is not issued by a trusted TPM manufacturer: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+package eventlog
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+// GUID is an EFI GUID in its binary, mixed-endian layout.
+type GUID [16]byte
+
+// ParseGUID parses the canonical form, e.g. "8be4df61-93ca-11d2-aa0d-00e098032b8c".
+func ParseGUID(s string) (GUID, error) {
+	var g GUID
+	var a uint32
+	var b, c uint16
+	var d [8]byte
+	n, err := fmt.Sscanf(s, "%08x-%04x-%04x-%02x%02x-%02x%02x%02x%02x%02x%02x",
+		&a, &b, &c, &d[0], &d[1], &d[2], &d[3], &d[4], &d[5], &d[6], &d[7])
+	if err != nil || n != 11 || len(s) != 36 {
+		return g, fmt.Errorf("invalid GUID %q", s)
+	}
+	binary.LittleEndian.PutUint32(g[0:], a)
+	binary.LittleEndian.PutUint16(g[4:], b)
+	binary.LittleEndian.PutUint16(g[6:], c)
+	copy(g[8:], d[:])
+	return g, nil
+}
+
+func mustGUID(s string) GUID {
+	g, err := ParseGUID(s)
+	if err != nil {
+		panic(err)
+	}
+	return g
+}
+
+func (g GUID) String() string {
+	return fmt.Sprintf("%08x-%04x-%04x-%x-%x",
+		binary.LittleEndian.Uint32(g[0:]), binary.LittleEndian.Uint16(g[4:]), binary.LittleEndian.Uint16(g[6:]), g[8:10], g[10:])
+}
+
+// Well-known vendor and signature type GUIDs
+var (
+	GlobalVariableGUID = mustGUID("8be4df61-93ca-11d2-aa0d-00e098032b8c")
+	ImageSecurityGUID  = mustGUID("d719b2cb-3d3a-4596-a3bc-dad00e67656f")
+	ShimLockGUID       = mustGUID("605dab50-e046-4300-abb6-3dd810dd8b23")
+	CertX509GUID       = mustGUID("a5c059a1-94e4-4aa7-87b5-ab155c2bf072")
+	CertSHA256GUID     = mustGUID("c1c41626-504c-4092-aca9-41f936934328")
+)
+
+// VariableData is the UEFI_VARIABLE_DATA of EFI variable events.
+type VariableData struct {
+	VendorGUID GUID
+	Name       string
+	Data       []byte
+}
+
+// ParseVariableData decodes the data of EV_EFI_VARIABLE_* events.
+func ParseVariableData(data []byte) (*VariableData, error) {
+	r := &reader{data: data}
+	v := &VariableData{}
+	copy(v.VendorGUID[:], r.bytes(16))
+	nameLen, dataLen := r.u64(), r.u64()
+	if r.err == nil && (nameLen > uint64(len(r.data))/2 || dataLen > uint64(len(r.data))) {
+		return nil, fmt.Errorf("invalid UEFI variable data: %w", errTruncated)
+	}
+	v.Name = utf16String(r.bytes(int(nameLen) * 2))
+	v.Data = r.bytes(int(dataLen))
+	if r.err != nil {
+		return nil, fmt.Errorf("invalid UEFI variable data: %w", r.err)
+	}
+	return v, nil
+}
+
+// SignatureData is one entry of an EFI_SIGNATURE_LIST, e.g. a certificate of the db.
+type SignatureData struct {
+	Type  GUID // e.g. CertX509GUID
+	Owner GUID
+	Data  []byte
+}
+
+// ParseSignatureLists decodes the EFI_SIGNATURE_LIST array of the PK, KEK, db and dbx variables.
+func ParseSignatureLists(data []byte) ([]SignatureData, error) {
+	var sigs []SignatureData
+	r := &reader{data: data}
+	for len(r.data) > 0 {
+		var sigType GUID
+		copy(sigType[:], r.bytes(16))
+		listSize, headerSize, sigSize := r.u32(), r.u32(), r.u32()
+		if r.err != nil {
+			return nil, fmt.Errorf("invalid signature list: %w", r.err)
+		}
+		const listHeader = 28
+		if sigSize <= 16 || listSize < listHeader+headerSize || (listSize-listHeader-headerSize)%sigSize != 0 {
+			return nil, errors.New("invalid signature list sizes")
+		}
+		r.bytes(int(headerSize))
+		for range (listSize - listHeader - headerSize) / sigSize {
+			sig := SignatureData{Type: sigType}
+			copy(sig.Owner[:], r.bytes(16))
+			sig.Data = r.bytes(int(sigSize) - 16)
+			sigs = append(sigs, sig)
+		}
+		if r.err != nil {
+			return nil, fmt.Errorf("invalid signature list: %w", r.err)
+		}
+	}
+	return sigs, nil
+}
+
+// ImageLoadEvent is the UEFI_IMAGE_LOAD_EVENT of EV_EFI_BOOT_SERVICES_APPLICATION events.
+type ImageLoadEvent struct {
+	LocationInMemory uint64
+	LengthInMemory   uint64
+	LinkTimeAddress  uint64
+	DevicePath       []byte
+}
+
+// ParseImageLoadEvent decodes the data of EV_EFI_BOOT_SERVICES_* and runtime driver events.
+func ParseImageLoadEvent(data []byte) (*ImageLoadEvent, error) {
+	r := &reader{data: data}
+	e := &ImageLoadEvent{LocationInMemory: r.u64(), LengthInMemory: r.u64(), LinkTimeAddress: r.u64()}
+	pathLen := r.u64()
+	if r.err == nil && pathLen > uint64(len(r.data)) {
+		return nil, fmt.Errorf("invalid image load event: %w", errTruncated)
+	}
+	e.DevicePath = r.bytes(int(pathLen))
+	if r.err != nil {
+		return nil, fmt.Errorf("invalid image load event: %w", r.err)
+	}
+	return e, nil
+}
+
+// FilePath returns the file path nodes of the device path, e.g. `\EFI\fedora\shimx64.efi`.
+func (e *ImageLoadEvent) FilePath() string {
+	const (
+		mediaType    = 0x04
+		filePathType = 0x04
+		endType      = 0x7f
+	)
+	var parts []string
+	p := e.DevicePath
+	for len(p) >= 4 {
+		nodeType, subType := p[0], p[1]
+		length := int(binary.LittleEndian.Uint16(p[2:4]))
+		if length < 4 || length > len(p) || nodeType == endType {
+			break
+		}
+		if nodeType == mediaType && subType == filePathType {
+			parts = append(parts, utf16String(p[4:length]))
+		}
+		p = p[length:]
+	}
+	return strings.Join(parts, "")
+}
+
+// GPT is the UEFI_GPT_DATA of an EV_EFI_GPT_EVENT.
+type GPT struct {
+	DiskGUID   GUID
+	Partitions []Partition
+}
+
+// Partition is a GPT partition entry.
+type Partition struct {
+	TypeGUID   GUID
+	UniqueGUID GUID
+	FirstLBA   uint64
+	LastLBA    uint64
+	Attributes uint64
+	Name       string
+}
+
+// ParseGPT decodes the data of an EV_EFI_GPT_EVENT.
+func ParseGPT(data []byte) (*GPT, error) {
+	const headerSize = 92
+	r := &reader{data: data}
+	header := r.bytes(headerSize)
+	count := r.u64()
+	if r.err != nil {
+		return nil, fmt.Errorf("invalid GPT event: %w", r.err)
+	}
+	if string(header[:8]) != "EFI PART" {
+		return nil, errors.New("invalid GPT event: missing EFI PART signature")
+	}
+	gpt := &GPT{}
+	copy(gpt.DiskGUID[:], header[56:72])
+	entrySize := binary.LittleEndian.Uint32(header[84:88])
+	if entrySize < 128 || count > uint64(len(r.data))/uint64(entrySize) {
+		return nil, fmt.Errorf("invalid GPT event: %d partitions of %d bytes", count, entrySize)
+	}
+	for range count {
+		entry := &reader{data: r.bytes(int(entrySize))}
+		var part Partition
+		copy(part.TypeGUID[:], entry.bytes(16))
+		copy(part.UniqueGUID[:], entry.bytes(16))
+		part.FirstLBA, part.LastLBA, part.Attributes = entry.u64(), entry.u64(), entry.u64()
+		part.Name = utf16String(entry.bytes(72))
+		gpt.Partitions = append(gpt.Partitions, part)
+	}
+	return gpt, nil
+}
+
+// utf16String decodes little-endian UTF-16 up to the first NUL.
+func utf16String(b []byte) string {
+	units := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		u := binary.LittleEndian.Uint16(b[i:])
+		if u == 0 {
+			break
+		}
+		units = append(units, u)
+	}
+	return string(utf16.Decode(units))
+}
@@ -0,0 +1,337 @@
+// Package eventlog parses the TCG PC Client binary event log, as found in
+// /sys/kernel/security/tpm0/binary_bios_measurements, and the UEFI structures its events carry.
+package eventlog
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/keylime/keylime-mcp/internal/tpm"
+)
+
+// EventType is the type of a TCG event.
+type EventType uint32
+
+// Event types of the TCG PC Client Platform Firmware Profile
+const (
+	EvPrebootCert              EventType = 0x00000000
+	EvPostCode                 EventType = 0x00000001
+	EvNoAction                 EventType = 0x00000003
+	EvSeparator                EventType = 0x00000004
+	EvAction                   EventType = 0x00000005
+	EvEventTag                 EventType = 0x00000006
+	EvSCRTMContents            EventType = 0x00000007
+	EvSCRTMVersion             EventType = 0x00000008
+	EvCPUMicrocode             EventType = 0x00000009
+	EvPlatformConfigFlags      EventType = 0x0000000A
+	EvTableOfDevices           EventType = 0x0000000B
+	EvCompactHash              EventType = 0x0000000C
+	EvIPL                      EventType = 0x0000000D
+	EvIPLPartitionData         EventType = 0x0000000E
+	EvNonhostCode              EventType = 0x0000000F
+	EvNonhostConfig            EventType = 0x00000010
+	EvNonhostInfo              EventType = 0x00000011
+	EvOmitBootDeviceEvents     EventType = 0x00000012
+	EvEFIVariableDriverConfig  EventType = 0x80000001
+	EvEFIVariableBoot          EventType = 0x80000002
+	EvEFIBootServicesApp       EventType = 0x80000003
+	EvEFIBootServicesDriver    EventType = 0x80000004
+	EvEFIRuntimeServicesDriver EventType = 0x80000005
+	EvEFIGPTEvent              EventType = 0x80000006
+	EvEFIAction                EventType = 0x80000007
+	EvEFIPlatformFirmwareBlob  EventType = 0x80000008
+	EvEFIHandoffTables         EventType = 0x80000009
+	EvEFIPlatformFirmwareBlob2 EventType = 0x8000000A
+	EvEFIHandoffTables2        EventType = 0x8000000B
+	EvEFIVariableBoot2         EventType = 0x8000000C
+	EvEFIHCRTMEvent            EventType = 0x80000010
+	EvEFIVariableAuthority     EventType = 0x800000E0
+)
+
+var eventTypeNames = map[EventType]string{
+	EvPrebootCert:              "EV_PREBOOT_CERT",
+	EvPostCode:                 "EV_POST_CODE",
+	EvNoAction:                 "EV_NO_ACTION",
+	EvSeparator:                "EV_SEPARATOR",
+	EvAction:                   "EV_ACTION",
+	EvEventTag:                 "EV_EVENT_TAG",
+	EvSCRTMContents:            "EV_S_CRTM_CONTENTS",
+	EvSCRTMVersion:             "EV_S_CRTM_VERSION",
+	EvCPUMicrocode:             "EV_CPU_MICROCODE",
+	EvPlatformConfigFlags:      "EV_PLATFORM_CONFIG_FLAGS",
+	EvTableOfDevices:           "EV_TABLE_OF_DEVICES",
+	EvCompactHash:              "EV_COMPACT_HASH",
+	EvIPL:                      "EV_IPL",
+	EvIPLPartitionData:         "EV_IPL_PARTITION_DATA",
+	EvNonhostCode:              "EV_NONHOST_CODE",
+	EvNonhostConfig:            "EV_NONHOST_CONFIG",
+	EvNonhostInfo:              "EV_NONHOST_INFO",
+	EvOmitBootDeviceEvents:     "EV_OMIT_BOOT_DEVICE_EVENTS",
+	EvEFIVariableDriverConfig:  "EV_EFI_VARIABLE_DRIVER_CONFIG",
+	EvEFIVariableBoot:          "EV_EFI_VARIABLE_BOOT",
+	EvEFIBootServicesApp:       "EV_EFI_BOOT_SERVICES_APPLICATION",
+	EvEFIBootServicesDriver:    "EV_EFI_BOOT_SERVICES_DRIVER",
+	EvEFIRuntimeServicesDriver: "EV_EFI_RUNTIME_SERVICES_DRIVER",
+	EvEFIGPTEvent:              "EV_EFI_GPT_EVENT",
+	EvEFIAction:                "EV_EFI_ACTION",
+	EvEFIPlatformFirmwareBlob:  "EV_EFI_PLATFORM_FIRMWARE_BLOB",
+	EvEFIHandoffTables:         "EV_EFI_HANDOFF_TABLES",
+	EvEFIPlatformFirmwareBlob2: "EV_EFI_PLATFORM_FIRMWARE_BLOB2",
+	EvEFIHandoffTables2:        "EV_EFI_HANDOFF_TABLES2",
+	EvEFIVariableBoot2:         "EV_EFI_VARIABLE_BOOT2",
+	EvEFIHCRTMEvent:            "EV_EFI_HCRTM_EVENT",
+	EvEFIVariableAuthority:     "EV_EFI_VARIABLE_AUTHORITY",
+}
+
+func (t EventType) String() string {
+	if name, ok := eventTypeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("EV_UNKNOWN_%#08x", uint32(t))
+}
+
+// specIDSignature starts the first event of a crypto-agile log.
+var specIDSignature = []byte("Spec ID Event03\x00")
+
+// maxEventSize bounds the data of a single event.
+const maxEventSize = 16 * 1024 * 1024
+
+// Event is one measurement of the log.
+type Event struct {
+	Index   int // position in the log, from 0
+	PCR     uint32
+	Type    EventType
+	Digests map[uint16][]byte // by TPM_ALG_ID
+	Data    []byte
+}
+
+// Digest returns the digest of the event in the bank of alg.
+func (e Event) Digest(alg uint16) ([]byte, bool) {
+	d, ok := e.Digests[alg]
+	return d, ok
+}
+
+// SpecID is the header event of a crypto-agile log.
+type SpecID struct {
+	PlatformClass uint32
+	SpecVersion   string
+	UintnSize     uint8
+	DigestSizes   map[uint16]uint16 // by TPM_ALG_ID
+}
+
+// Log is a parsed event log. SpecID is nil for SHA-1 logs in the TCG 1.2 format.
+type Log struct {
+	SpecID *SpecID
+	Events []Event
+}
+
+// Algorithms returns the banks the log has digests for.
+func (l *Log) Algorithms() []uint16 {
+	if l.SpecID == nil {
+		return []uint16{tpm.AlgSHA1}
+	}
+	algs := make([]uint16, 0, len(l.SpecID.DigestSizes))
+	for alg := range l.SpecID.DigestSizes {
+		algs = append(algs, alg)
+	}
+	return algs
+}
+
+// Parse decodes a binary event log. The header event of a crypto-agile log is consumed
+// into SpecID and not listed in Events.
+func Parse(data []byte) (*Log, error) {
+	r := &reader{data: data}
+	first, err := r.event1()
+	if err != nil {
+		return nil, fmt.Errorf("event 0: %w", err)
+	}
+	log := &Log{}
+	if first.Type == EvNoAction && bytes.HasPrefix(first.Data, specIDSignature) {
+		if log.SpecID, err = parseSpecID(first.Data); err != nil {
+			return nil, err
+		}
+	} else {
+		log.Events = append(log.Events, first)
+	}
+
+	for index := 1; len(r.data) > 0; index++ {
+		var event Event
+		if log.SpecID != nil {
+			event, err = r.event2(log.SpecID.DigestSizes)
+		} else {
+			event, err = r.event1()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("event %d: %w", index, err)
+		}
+		event.Index = index
+		log.Events = append(log.Events, event)
+	}
+	return log, nil
+}
+
+func parseSpecID(data []byte) (*SpecID, error) {
+	r := &reader{data: data[len(specIDSignature):]}
+	spec := &SpecID{PlatformClass: r.u32(), DigestSizes: map[uint16]uint16{}}
+	minor, major, errata := r.u8(), r.u8(), r.u8()
+	spec.SpecVersion = fmt.Sprintf("%d.%d-%d", major, minor, errata)
+	spec.UintnSize = r.u8()
+	count := r.u32()
+	if r.err == nil && count > 64 {
+		return nil, fmt.Errorf("Spec ID event lists %d algorithms", count)
+	}
+	for range count {
+		alg, size := r.u16(), r.u16()
+		spec.DigestSizes[alg] = size
+	}
+	if r.err != nil {
+		return nil, fmt.Errorf("invalid Spec ID event: %w", r.err)
+	}
+	if len(spec.DigestSizes) == 0 {
+		return nil, errors.New("Spec ID event lists no algorithms")
+	}
+	return spec, nil
+}
+
+// HashName returns the lower-case name of a TPM hash algorithm, e.g. "sha256".
+func HashName(alg uint16) string {
+	switch alg {
+	case tpm.AlgSHA1:
+		return "sha1"
+	case tpm.AlgSHA256:
+		return "sha256"
+	case tpm.AlgSHA384:
+		return "sha384"
+	case tpm.AlgSHA512:
+		return "sha512"
+	case tpm.AlgSM3:
+		return "sm3_256"
+	}
+	return fmt.Sprintf("alg_%#04x", alg)
+}
+
+// Replay computes the PCR values the log extends, in the bank of alg.
+func (l *Log) Replay(alg uint16) (map[uint32][]byte, error) {
+	hash, err := tpm.HashFromAlg(alg)
+	if err != nil {
+		return nil, err
+	}
+	pcrs := map[uint32][]byte{}
+	for _, event := range l.Events {
+		if event.Type == EvNoAction {
+			continue
+		}
+		digest, ok := event.Digest(alg)
+		if !ok {
+			return nil, fmt.Errorf("event %d has no %s digest", event.Index, HashName(alg))
+		}
+		pcrs[event.PCR] = extend(hash, pcrs[event.PCR], digest)
+	}
+	return pcrs, nil
+}
+
+func extend(hash crypto.Hash, pcr, digest []byte) []byte {
+	if pcr == nil {
+		pcr = make([]byte, hash.Size())
+	}
+	h := hash.New()
+	h.Write(pcr)
+	h.Write(digest)
+	return h.Sum(nil)
+}
+
+// reader reads little-endian event log structures.
+type reader struct {
+	data []byte
+	err  error
+}
+
+var errTruncated = errors.New("structure truncated")
+
+func (r *reader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(r.data) {
+		r.err = errTruncated
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *reader) u8() uint8 {
+	if b := r.bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *reader) u16() uint16 {
+	if b := r.bytes(2); b != nil {
+		return binary.LittleEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *reader) u32() uint32 {
+	if b := r.bytes(4); b != nil {
+		return binary.LittleEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *reader) u64() uint64 {
+	if b := r.bytes(8); b != nil {
+		return binary.LittleEndian.Uint64(b)
+	}
+	return 0
+}
+
+// eventData reads a 32-bit size followed by the event data.
+func (r *reader) eventData() []byte {
+	size := r.u32()
+	if r.err == nil && size > maxEventSize {
+		r.err = fmt.Errorf("event data of %d bytes", size)
+		return nil
+	}
+	return r.bytes(int(size))
+}
+
+// event1 reads a TCG_PCR_EVENT with a SHA-1 digest.
+func (r *reader) event1() (Event, error) {
+	event := Event{PCR: r.u32(), Type: EventType(r.u32())}
+	digest := r.bytes(20)
+	event.Data = r.eventData()
+	if r.err != nil {
+		return Event{}, r.err
+	}
+	event.Digests = map[uint16][]byte{tpm.AlgSHA1: digest}
+	return event, nil
+}
+
+// event2 reads a crypto-agile TCG_PCR_EVENT2.
+func (r *reader) event2(sizes map[uint16]uint16) (Event, error) {
+	event := Event{PCR: r.u32(), Type: EventType(r.u32()), Digests: map[uint16][]byte{}}
+	count := r.u32()
+	if r.err == nil && int(count) > len(sizes) {
+		return Event{}, fmt.Errorf("%d digests, but the log has %d banks", count, len(sizes))
+	}
+	for range count {
+		alg := r.u16()
+		size, ok := sizes[alg]
+		if r.err == nil && !ok {
+			return Event{}, fmt.Errorf("digest of algorithm %#04x not in the Spec ID event", alg)
+		}
+		event.Digests[alg] = r.bytes(int(size))
+	}
+	event.Data = r.eventData()
+	if r.err != nil {
+		return Event{}, r.err
+	}
+	return event, nil
+}
@@ -0,0 +1,120 @@
+package eventlog_test
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	"github.com/keylime/keylime-mcp/internal/tpm"
+	"github.com/keylime/keylime-mcp/internal/tpm/eventlog"
+	"github.com/keylime/keylime-mcp/internal/tpm/tpmtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func find(t *testing.T, log *eventlog.Log, eventType eventlog.EventType) eventlog.Event {
+	t.Helper()
+	for _, event := range log.Events {
+		if event.Type == eventType {
+			return event
+		}
+	}
+	t.Fatalf("no %s event", eventType)
+	return eventlog.Event{}
+}
+
+func TestParse(t *testing.T) {
+	log, err := eventlog.Parse(tpmtest.BootLog(true))
+	require.NoError(t, err)
+
+	require.NotNil(t, log.SpecID)
+	assert.Equal(t, "2.0-0", log.SpecID.SpecVersion)
+	assert.Equal(t, map[uint16]uint16{tpm.AlgSHA1: 20, tpm.AlgSHA256: 32}, log.SpecID.DigestSizes)
+	require.Len(t, log.Events, 24)
+	assert.Equal(t, 1, log.Events[0].Index, "the header is not an event")
+	assert.Equal(t, eventlog.EvSCRTMVersion, log.Events[0].Type)
+
+	shim := find(t, log, eventlog.EvEFIBootServicesApp)
+	assert.Equal(t, uint32(4), shim.PCR)
+	digest, ok := shim.Digest(tpm.AlgSHA256)
+	require.True(t, ok)
+	want := sha256.Sum256(tpmtest.ShimImage)
+	assert.Equal(t, want[:], digest)
+
+	image, err := eventlog.ParseImageLoadEvent(shim.Data)
+	require.NoError(t, err)
+	assert.Equal(t, `\EFI\fedora\shimx64.efi`, image.FilePath())
+
+	gpt, err := eventlog.ParseGPT(find(t, log, eventlog.EvEFIGPTEvent).Data)
+	require.NoError(t, err)
+	require.Len(t, gpt.Partitions, 2)
+	assert.Equal(t, "EFI System Partition", gpt.Partitions[0].Name)
+	assert.Equal(t, uint64(4096), gpt.Partitions[1].FirstLBA)
+
+	t.Run("replay", func(t *testing.T) {
+		pcrs, err := log.Replay(tpm.AlgSHA256)
+		require.NoError(t, err)
+		assert.Len(t, pcrs, 11)
+		assert.Len(t, pcrs[4], 32)
+	})
+
+	t.Run("event type names", func(t *testing.T) {
+		assert.Equal(t, "EV_EFI_BOOT_SERVICES_APPLICATION", eventlog.EvEFIBootServicesApp.String())
+		assert.Equal(t, "EV_UNKNOWN_0x00000099", eventlog.EventType(0x99).String())
+	})
+}
+
+func TestParseErrors(t *testing.T) {
+	valid := tpmtest.BootLog(true)
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr string
+	}{
+		{"empty", nil, "event 0: structure truncated"},
+		{"truncated event", valid[:len(valid)-3], "event 24: structure truncated"},
+		{"unknown bank", append(append([]byte{}, valid...), 0, 0, 0, 0, 1, 0, 0, 0, 1, 0, 0, 0, 0x99, 0x99), "not in the Spec ID event"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := eventlog.Parse(tt.data)
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestEFIStructures(t *testing.T) {
+	t.Run("variable and signature lists", func(t *testing.T) {
+		owner := eventlog.GUID{0x0f}
+		data := append(tpmtest.SignatureList(eventlog.CertX509GUID, owner, []byte("cert-a"), []byte("cert-b")),
+			tpmtest.SignatureList(eventlog.CertSHA256GUID, owner, make([]byte, 32))...)
+		v, err := eventlog.ParseVariableData(tpmtest.EFIVariable(eventlog.ImageSecurityGUID, "db", data))
+		require.NoError(t, err)
+		assert.Equal(t, "db", v.Name)
+		assert.Equal(t, eventlog.ImageSecurityGUID, v.VendorGUID)
+
+		sigs, err := eventlog.ParseSignatureLists(v.Data)
+		require.NoError(t, err)
+		require.Len(t, sigs, 3)
+		assert.Equal(t, []byte("cert-b"), sigs[1].Data)
+		assert.Equal(t, owner, sigs[1].Owner)
+		assert.Equal(t, eventlog.CertSHA256GUID, sigs[2].Type)
+
+		_, err = eventlog.ParseSignatureLists(data[:40])
+		assert.Error(t, err)
+	})
+
+	t.Run("GUID", func(t *testing.T) {
+		const s = "8be4df61-93ca-11d2-aa0d-00e098032b8c"
+		g, err := eventlog.ParseGUID(s)
+		require.NoError(t, err)
+		assert.Equal(t, s, g.String())
+		assert.Equal(t, byte(0x61), g[0], "first field is little-endian")
+		_, err = eventlog.ParseGUID("not-a-guid")
+		assert.Error(t, err)
+	})
+
+	t.Run("invalid GPT", func(t *testing.T) {
+		_, err := eventlog.ParseGPT(make([]byte, 100))
+		assert.ErrorContains(t, err, "EFI PART")
+	})
+}
@@ -0,0 +1,321 @@
+package tpm
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+)
+
+const (
+	attestMagic     = 0xff544347 // TPM_GENERATED_VALUE
+	attestTypeQuote = 0x8018     // TPM_ST_ATTEST_QUOTE
+)
+
+// DataPCR is the PCR the agent extends with its transport key before an identity quote, so
+// that the quote vouches for the key.
+const DataPCR = 16
+
+// Layout of the PCR blob: tpm2-tools' in-memory TPML_PCR_SELECTION and TPML_DIGEST structures.
+const (
+	pcrBlobSelections     = 16 // TPMS_PCR_SELECTION slots, each padded to 8 bytes
+	pcrBlobSlotSize       = 8
+	pcrBlobDigests        = 8  // TPM2B_DIGEST slots of a TPML_DIGEST
+	pcrBlobDigestSize     = 64 // sizeof(TPMU_HA)
+	maxPCRBlobDigestLists = 8  // TPML_DIGESTs, enough for all 24 PCRs of two banks
+)
+
+// Quote is a TPM2_Quote as sent by the Keylime agent: the signed TPMS_ATTEST, its
+// TPMT_SIGNATURE and the PCR values it covers.
+type Quote struct {
+	Attest    []byte
+	Signature []byte
+	PCRs      []byte
+}
+
+// ParseQuote decodes a quote in the agent's wire format: "r" followed by the base64 encoded
+// TPMS_ATTEST, TPMT_SIGNATURE and PCR blob, separated by colons.
+func ParseQuote(s string) (*Quote, error) {
+	if !strings.HasPrefix(s, "r") {
+		return nil, errors.New(`quote must start with "r"`)
+	}
+	parts := strings.Split(s[1:], ":")
+	if len(parts) < 2 {
+		return nil, errors.New("quote must contain attestation and signature")
+	}
+	decoded := make([][]byte, len(parts))
+	for i, part := range parts {
+		b, err := base64.StdEncoding.DecodeString(part)
+		if err != nil {
+			return nil, fmt.Errorf("quote part %d: %w", i+1, err)
+		}
+		decoded[i] = b
+	}
+	q := &Quote{Attest: decoded[0], Signature: decoded[1]}
+	if len(decoded) > 2 {
+		q.PCRs = decoded[2]
+	}
+	return q, nil
+}
+
+// String encodes the quote in the agent's wire format.
+func (q *Quote) String() string {
+	parts := []string{
+		base64.StdEncoding.EncodeToString(q.Attest),
+		base64.StdEncoding.EncodeToString(q.Signature),
+	}
+	if q.PCRs != nil {
+		parts = append(parts, base64.StdEncoding.EncodeToString(q.PCRs))
+	}
+	return "r" + strings.Join(parts, ":")
+}
+
+// Attest holds the fields of a quote's TPMS_ATTEST that Keylime checks.
+type Attest struct {
+	ExtraData     []byte // the nonce given to TPM2_Quote
+	Clock         uint64
+	ResetCount    uint32
+	RestartCount  uint32
+	PCRSelections []PCRSelection
+	PCRDigest     []byte
+}
+
+// PCRSelection is a TPMS_PCR_SELECTION: the PCRs of one bank that a quote covers.
+type PCRSelection struct {
+	HashAlg uint16
+	PCRs    []int
+}
+
+// ParseAttest decodes a TPMS_ATTEST of type TPM_ST_ATTEST_QUOTE.
+func ParseAttest(data []byte) (*Attest, error) {
+	r := &reader{data: data}
+	if magic := r.u32(); r.err == nil && magic != attestMagic {
+		return nil, fmt.Errorf("TPMS_ATTEST has magic %#08x, not TPM_GENERATED_VALUE", magic)
+	}
+	if typ := r.u16(); r.err == nil && typ != attestTypeQuote {
+		return nil, fmt.Errorf("TPMS_ATTEST has type %#04x, not a quote", typ)
+	}
+	r.tpm2b() // qualifiedSigner
+	a := &Attest{ExtraData: r.tpm2b()}
+	a.Clock = r.u64()
+	a.ResetCount = r.u32()
+	a.RestartCount = r.u32()
+	r.u8()  // safe
+	r.u64() // firmwareVersion
+	for range min(r.u32(), pcrBlobSelections) {
+		hashAlg := r.u16()
+		a.PCRSelections = append(a.PCRSelections, PCRSelection{HashAlg: hashAlg, PCRs: selectedPCRs(r.bytes(int(r.u8())))})
+	}
+	a.PCRDigest = r.tpm2b()
+	if r.err != nil {
+		return nil, fmt.Errorf("invalid TPMS_ATTEST: %w", r.err)
+	}
+	return a, nil
+}
+
+// VerifyQuote checks that the quote is signed by ak and was made for nonce, that the PCR
+// values sent with it match the signed digest, and that PCR 16 holds data extended into the
+// reset PCR. It returns the decoded attestation.
+func VerifyQuote(ak crypto.PublicKey, q *Quote, nonce, data []byte) (*Attest, error) {
+	attest, err := ParseAttest(q.Attest)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := verifySignature(ak, q.Attest, q.Signature)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(attest.ExtraData, nonce) {
+		return nil, errors.New("quote was not made for the requested nonce")
+	}
+	if err := verifyPCRs(attest, hash, q.PCRs, data); err != nil {
+		return nil, err
+	}
+	return attest, nil
+}
+
+// verifyPCRs checks the PCR blob of a quote against its attestation, like Keylime's check_pcrs.
+func verifyPCRs(attest *Attest, hash crypto.Hash, blob, data []byte) error {
+	selections, values, err := ParsePCRs(blob)
+	if err != nil {
+		return err
+	}
+	if !slices.EqualFunc(selections, attest.PCRSelections, func(a, b PCRSelection) bool {
+		return a.HashAlg == b.HashAlg && slices.Equal(a.PCRs, b.PCRs)
+	}) {
+		return errors.New("PCR values do not match the PCR selection of the quote")
+	}
+	h := hash.New()
+	for _, value := range values {
+		h.Write(value)
+	}
+	if !bytes.Equal(h.Sum(nil), attest.PCRDigest) {
+		return errors.New("PCR values do not match the PCR digest signed in the quote")
+	}
+
+	bound, i := false, 0
+	for _, sel := range selections {
+		for _, pcr := range sel.PCRs {
+			if pcr == DataPCR {
+				bankHash, err := HashFromAlg(sel.HashAlg)
+				if err != nil {
+					return err
+				}
+				if !bytes.Equal(values[i], extendReset(bankHash, data)) {
+					return fmt.Errorf("PCR %d does not hold the key sent with the quote", DataPCR)
+				}
+				bound = true
+			}
+			i++
+		}
+	}
+	if !bound {
+		return fmt.Errorf("quote does not cover PCR %d, which binds the agent's key", DataPCR)
+	}
+	return nil
+}
+
+// extendReset returns the value of a reset PCR after extending it with the hash of data.
+func extendReset(hash crypto.Hash, data []byte) []byte {
+	h := hash.New()
+	h.Write(data)
+	measured := h.Sum(nil)
+	h.Reset()
+	h.Write(make([]byte, hash.Size()))
+	h.Write(measured)
+	return h.Sum(nil)
+}
+
+// ParsePCRs decodes the PCR blob of a quote: the selected PCRs and their values in the
+// order the TPM hashed them. The agent writes the blob as tpm2-tools keeps it in memory,
+// little-endian with padding, and Keylime's tpm_util reads it the same way.
+func ParsePCRs(blob []byte) ([]PCRSelection, [][]byte, error) {
+	r := &reader{data: blob}
+	le32 := func() uint32 {
+		if b := r.bytes(4); b != nil {
+			return binary.LittleEndian.Uint32(b)
+		}
+		return 0
+	}
+
+	count := le32()
+	if count > pcrBlobSelections {
+		return nil, nil, fmt.Errorf("invalid PCR blob: %d PCR selections", count)
+	}
+	var selections []PCRSelection
+	wanted := 0
+	for i := range uint32(pcrBlobSelections) {
+		slot := r.bytes(pcrBlobSlotSize)
+		if slot == nil || i >= count {
+			continue
+		}
+		size := int(slot[2])
+		if size > 4 {
+			return nil, nil, fmt.Errorf("invalid PCR blob: PCR select of %d bytes", size)
+		}
+		sel := PCRSelection{HashAlg: binary.LittleEndian.Uint16(slot), PCRs: selectedPCRs(slot[3 : 3+size])}
+		wanted += len(sel.PCRs)
+		selections = append(selections, sel)
+	}
+
+	lists := le32()
+	if lists > maxPCRBlobDigestLists {
+		return nil, nil, fmt.Errorf("invalid PCR blob: %d digest lists", lists)
+	}
+	var values [][]byte
+	for range lists {
+		n := le32()
+		for j := range uint32(pcrBlobDigests) {
+			slot := r.bytes(2 + pcrBlobDigestSize)
+			if slot == nil {
+				break
+			}
+			size := int(binary.LittleEndian.Uint16(slot))
+			if size > pcrBlobDigestSize {
+				return nil, nil, fmt.Errorf("invalid PCR blob: digest of %d bytes", size)
+			}
+			if j < n {
+				values = append(values, slot[2:2+size])
+			}
+		}
+	}
+	if r.err != nil {
+		return nil, nil, fmt.Errorf("invalid PCR blob: %w", r.err)
+	}
+	if len(values) != wanted {
+		return nil, nil, fmt.Errorf("invalid PCR blob: %d values for %d selected PCRs", len(values), wanted)
+	}
+	return selections, values, nil
+}
+
+// selectedPCRs returns the PCR indices set in a pcrSelect bitmap.
+func selectedPCRs(mask []byte) []int {
+	var pcrs []int
+	for i, b := range mask {
+		for bit := range 8 {
+			if b&(1<<bit) != 0 {
+				pcrs = append(pcrs, i*8+bit)
+			}
+		}
+	}
+	return pcrs
+}
+
+// verifySignature verifies a TPMT_SIGNATURE over data and returns its hash algorithm.
+func verifySignature(pub crypto.PublicKey, data, signature []byte) (crypto.Hash, error) {
+	r := &reader{data: signature}
+	sigAlg := r.u16()
+	hashAlg := r.u16()
+	if r.err != nil {
+		return 0, fmt.Errorf("invalid TPMT_SIGNATURE: %w", r.err)
+	}
+	hash, err := HashFromAlg(hashAlg)
+	if err != nil {
+		return 0, err
+	}
+	h := hash.New()
+	h.Write(data)
+	digest := h.Sum(nil)
+
+	switch sigAlg {
+	case AlgRSASSA, AlgRSAPSS:
+		sig := r.tpm2b()
+		if r.err != nil {
+			return 0, fmt.Errorf("invalid RSA signature: %w", r.err)
+		}
+		key, ok := pub.(*rsa.PublicKey)
+		if !ok {
+			return 0, errors.New("RSA signature but the key is not RSA")
+		}
+		if sigAlg == AlgRSAPSS {
+			err = rsa.VerifyPSS(key, hash, digest, sig, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthAuto})
+		} else {
+			err = rsa.VerifyPKCS1v15(key, hash, digest, sig)
+		}
+		if err != nil {
+			return 0, errors.New("quote signature does not verify with the attestation key")
+		}
+		return hash, nil
+	case AlgECDSA:
+		sigR, sigS := r.tpm2b(), r.tpm2b()
+		if r.err != nil {
+			return 0, fmt.Errorf("invalid ECDSA signature: %w", r.err)
+		}
+		key, ok := pub.(*ecdsa.PublicKey)
+		if !ok {
+			return 0, errors.New("ECDSA signature but the key is not ECC")
+		}
+		if !ecdsa.Verify(key, digest, new(big.Int).SetBytes(sigR), new(big.Int).SetBytes(sigS)) {
+			return 0, errors.New("quote signature does not verify with the attestation key")
+		}
+		return hash, nil
+	}
+	return 0, fmt.Errorf("unsupported signature algorithm %#04x", sigAlg)
+}
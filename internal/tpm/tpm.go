@@ -0,0 +1,194 @@
+// Package tpm decodes the TPM 2.0 structures Keylime passes around (TPM2B_PUBLIC keys,
+// quotes, EK certificates) and verifies them without talking to a TPM.
+package tpm
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// TPM_ALG_ID values used by Keylime
+const (
+	AlgRSA      uint16 = 0x0001
+	AlgSHA1     uint16 = 0x0004
+	AlgSHA256   uint16 = 0x000B
+	AlgSHA384   uint16 = 0x000C
+	AlgSHA512   uint16 = 0x000D
+	AlgNull     uint16 = 0x0010
+	AlgSM3      uint16 = 0x0012
+	AlgRSASSA   uint16 = 0x0014
+	AlgRSAPSS   uint16 = 0x0016
+	AlgECDSA    uint16 = 0x0018
+	AlgECC      uint16 = 0x0023
+	EccNistP256 uint16 = 0x0003
+	EccNistP384 uint16 = 0x0004
+	EccNistP521 uint16 = 0x0005
+)
+
+// defaultRSAExponent is used when a TPMS_RSA_PARMS has exponent 0.
+const defaultRSAExponent = 65537
+
+// HashFromAlg returns the Go hash of a TPM hash algorithm.
+func HashFromAlg(alg uint16) (crypto.Hash, error) {
+	switch alg {
+	case AlgSHA1:
+		return crypto.SHA1, nil
+	case AlgSHA256:
+		return crypto.SHA256, nil
+	case AlgSHA384:
+		return crypto.SHA384, nil
+	case AlgSHA512:
+		return crypto.SHA512, nil
+	}
+	return 0, fmt.Errorf("unsupported hash algorithm %#04x", alg)
+}
+
+var errShort = errors.New("structure truncated")
+
+// reader reads big-endian TPM structures.
+type reader struct {
+	data []byte
+	err  error
+}
+
+func (r *reader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n > len(r.data) {
+		r.err = errShort
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *reader) u8() uint8 {
+	if b := r.bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *reader) u16() uint16 {
+	if b := r.bytes(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *reader) u32() uint32 {
+	if b := r.bytes(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *reader) u64() uint64 {
+	if b := r.bytes(8); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+
+// tpm2b reads a TPM2B_* buffer: a 16-bit size followed by that many bytes.
+func (r *reader) tpm2b() []byte {
+	return r.bytes(int(r.u16()))
+}
+
+// ParsePublic decodes a TPM2B_PUBLIC (as stored by the registrar in aik_tpm and ek_tpm)
+// or a bare TPMT_PUBLIC into an RSA or ECDSA public key.
+func ParsePublic(data []byte) (crypto.PublicKey, error) {
+	if len(data) >= 2 && int(binary.BigEndian.Uint16(data)) == len(data)-2 {
+		data = data[2:]
+	}
+	r := &reader{data: data}
+	keyType := r.u16()
+	r.u16()   // nameAlg
+	r.u32()   // objectAttributes
+	r.tpm2b() // authPolicy
+	skipSymmetric(r)
+	if scheme := r.u16(); scheme != AlgNull {
+		r.u16() // scheme hash
+	}
+
+	switch keyType {
+	case AlgRSA:
+		bits := r.u16()
+		exponent := r.u32()
+		modulus := r.tpm2b()
+		if r.err != nil {
+			return nil, fmt.Errorf("invalid RSA TPMT_PUBLIC: %w", r.err)
+		}
+		if exponent == 0 {
+			exponent = defaultRSAExponent
+		}
+		if len(modulus)*8 != int(bits) {
+			return nil, fmt.Errorf("RSA modulus is %d bits, expected %d", len(modulus)*8, bits)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(modulus), E: int(exponent)}, nil
+	case AlgECC:
+		curveID := r.u16()
+		if kdf := r.u16(); kdf != AlgNull {
+			r.u16() // kdf hash
+		}
+		x, y := r.tpm2b(), r.tpm2b()
+		if r.err != nil {
+			return nil, fmt.Errorf("invalid ECC TPMT_PUBLIC: %w", r.err)
+		}
+		curve, err := curveFromID(curveID)
+		if err != nil {
+			return nil, err
+		}
+		size := (curve.Params().BitSize + 7) / 8
+		if len(x) > size || len(y) > size {
+			return nil, errors.New("ECC point coordinates are too long")
+		}
+		point := make([]byte, 1+2*size)
+		point[0] = 4 // uncompressed
+		copy(point[1+size-len(x):], x)
+		copy(point[1+2*size-len(y):], y)
+		pub, err := ecdsa.ParseUncompressedPublicKey(curve, point)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ECC point: %w", err)
+		}
+		return pub, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %#04x", keyType)
+}
+
+// skipSymmetric skips a TPMT_SYM_DEF_OBJECT.
+func skipSymmetric(r *reader) {
+	if alg := r.u16(); alg != AlgNull {
+		r.u16() // keyBits
+		r.u16() // mode
+	}
+}
+
+func curveFromID(id uint16) (elliptic.Curve, error) {
+	switch id {
+	case EccNistP256:
+		return elliptic.P256(), nil
+	case EccNistP384:
+		return elliptic.P384(), nil
+	case EccNistP521:
+		return elliptic.P521(), nil
+	}
+	return nil, fmt.Errorf("unsupported ECC curve %#04x", id)
+}
+
+// SamePublicKey reports whether two RSA or ECDSA public keys are equal.
+func SamePublicKey(a, b crypto.PublicKey) bool {
+	type equaler interface{ Equal(crypto.PublicKey) bool }
+	if e, ok := a.(equaler); ok {
+		return e.Equal(b)
+	}
+	return false
+}
@@ -0,0 +1,157 @@
+package tpm_test
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/pem"
+	"testing"
+
+	"github.com/keylime/keylime-mcp/internal/tpm"
+	"github.com/keylime/keylime-mcp/internal/tpm/tpmtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTPM(t *testing.T, keyAlg uint16) *tpmtest.TPM {
+	t.Helper()
+	sim, err := tpmtest.New(keyAlg)
+	require.NoError(t, err)
+	return sim
+}
+
+func TestParsePublic(t *testing.T) {
+	for name, alg := range map[string]uint16{"rsa": tpm.AlgRSA, "ecc": tpm.AlgECC} {
+		t.Run(name, func(t *testing.T) {
+			sim := newTPM(t, alg)
+
+			ak, err := tpm.ParsePublic(sim.AKPublic())
+			require.NoError(t, err)
+			assert.True(t, tpm.SamePublicKey(ak, sim.AK.Public()))
+
+			ek, err := tpm.ParsePublic(sim.EKPublic()[2:]) // bare TPMT_PUBLIC
+			require.NoError(t, err)
+			assert.True(t, tpm.SamePublicKey(ek, sim.EKCert.PublicKey))
+			assert.False(t, tpm.SamePublicKey(ek, ak))
+		})
+	}
+
+	t.Run("truncated", func(t *testing.T) {
+		data := newTPM(t, tpm.AlgECC).AKPublic()
+		_, err := tpm.ParsePublic(data[:len(data)-10])
+		assert.Error(t, err)
+	})
+
+	t.Run("unsupported type", func(t *testing.T) {
+		_, err := tpm.ParsePublic([]byte{0x00, 0x08, 0x00, 0x25, 0, 0, 0, 0, 0, 0})
+		assert.ErrorContains(t, err, "unsupported key type")
+	})
+}
+
+func TestVerifyQuote(t *testing.T) {
+	for name, alg := range map[string]uint16{"rsa": tpm.AlgRSA, "ecc": tpm.AlgECC} {
+		t.Run(name, func(t *testing.T) {
+			sim := newTPM(t, alg)
+			ak, err := tpm.ParsePublic(sim.AKPublic())
+			require.NoError(t, err)
+			nonce := []byte("abcdefghij0123456789")
+			pubKey := []byte("-----BEGIN PUBLIC KEY-----\ntransport\n-----END PUBLIC KEY-----\n")
+
+			quote, err := sim.Quote(nonce, pubKey)
+			require.NoError(t, err)
+			parsed, err := tpm.ParseQuote(quote.String())
+			require.NoError(t, err)
+
+			attest, err := tpm.VerifyQuote(ak, parsed, nonce, pubKey)
+			require.NoError(t, err)
+			assert.Equal(t, nonce, attest.ExtraData)
+			assert.Len(t, attest.PCRDigest, 32)
+			assert.Equal(t, []tpm.PCRSelection{{HashAlg: tpm.AlgSHA256, PCRs: []int{tpm.DataPCR}}}, attest.PCRSelections)
+
+			_, err = tpm.VerifyQuote(ak, parsed, []byte("another-nonce"), pubKey)
+			assert.ErrorContains(t, err, "nonce")
+
+			other, err := tpm.ParsePublic(newTPM(t, alg).AKPublic())
+			require.NoError(t, err)
+			_, err = tpm.VerifyQuote(other, parsed, nonce, pubKey)
+			assert.ErrorContains(t, err, "does not verify")
+
+			_, err = tpm.VerifyQuote(ak, parsed, nonce, []byte("swapped key"))
+			assert.ErrorContains(t, err, "PCR 16 does not hold the key")
+		})
+	}
+
+	t.Run("tampered PCR values", func(t *testing.T) {
+		sim := newTPM(t, tpm.AlgRSA)
+		ak, err := tpm.ParsePublic(sim.AKPublic())
+		require.NoError(t, err)
+		nonce, pubKey := []byte("nonce"), []byte("key")
+		quote, err := sim.Quote(nonce, pubKey)
+		require.NoError(t, err)
+
+		// PCR 16 set to the value of another key, without a matching signed digest
+		measured := sha256.Sum256([]byte("other key"))
+		forged := sha256.Sum256(append(make([]byte, 32), measured[:]...))
+		tests := map[string]struct {
+			pcrs []byte
+			want string
+		}{
+			"forged value":       {tpmtest.PCRBlob(tpm.AlgSHA256, []int{tpm.DataPCR}, forged[:]), "do not match the PCR digest"},
+			"other selection":    {tpmtest.PCRBlob(tpm.AlgSHA256, []int{15}, forged[:]), "do not match the PCR selection"},
+			"missing values":     {tpmtest.PCRBlob(tpm.AlgSHA256, []int{tpm.DataPCR}), "0 values for 1 selected PCRs"},
+			"truncated":          {quote.PCRs[:100], "invalid PCR blob"},
+			"no PCR values sent": {nil, "invalid PCR blob"},
+		}
+		for name, tt := range tests {
+			t.Run(name, func(t *testing.T) {
+				tampered := *quote
+				tampered.PCRs = tt.pcrs
+				_, err := tpm.VerifyQuote(ak, &tampered, nonce, pubKey)
+				assert.ErrorContains(t, err, tt.want)
+			})
+		}
+	})
+
+	t.Run("malformed", func(t *testing.T) {
+		_, err := tpm.ParseQuote("xAAAA:BBBB")
+		assert.Error(t, err)
+		_, err = tpm.ParseQuote("rAAAA")
+		assert.Error(t, err)
+		_, err = tpm.ParseAttest([]byte{0xff, 0x54, 0x43, 0x47, 0x80, 0x17})
+		assert.ErrorContains(t, err, "not a quote")
+	})
+}
+
+func TestEKCertificate(t *testing.T) {
+	sim := newTPM(t, tpm.AlgRSA)
+	dir := t.TempDir()
+	require.NoError(t, sim.WriteCA(dir))
+	store, err := tpm.LoadCertStore(dir)
+	require.NoError(t, err)
+
+	encodings := map[string][]byte{
+		"der":    sim.EKCert.Raw,
+		"base64": []byte(base64.StdEncoding.EncodeToString(sim.EKCert.Raw)),
+		"pem":    pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: sim.EKCert.Raw}),
+	}
+	for name, data := range encodings {
+		t.Run(name, func(t *testing.T) {
+			cert, err := tpm.ParseEKCertificate(data)
+			require.NoError(t, err)
+			assert.NoError(t, store.Verify(cert))
+		})
+	}
+
+	t.Run("other manufacturer", func(t *testing.T) {
+		assert.ErrorContains(t, store.Verify(newTPM(t, tpm.AlgECC).EKCert), "not issued by a trusted TPM manufacturer")
+	})
+
+	t.Run("not a certificate", func(t *testing.T) {
+		_, err := tpm.ParseEKCertificate([]byte("test-ek-cert"))
+		assert.Error(t, err)
+	})
+
+	t.Run("empty store", func(t *testing.T) {
+		_, err := tpm.LoadCertStore(t.TempDir())
+		assert.ErrorContains(t, err, "no certificates")
+	})
+}
@@ -0,0 +1,162 @@
+package tpmtest
+
+import (
+	"bytes"
+	"crypto/sha1" // #nosec G505 -- event logs keep a SHA-1 bank
+	"crypto/sha256"
+	"encoding/binary"
+	"unicode/utf16"
+
+	"github.com/keylime/keylime-mcp/internal/tpm"
+	"github.com/keylime/keylime-mcp/internal/tpm/eventlog"
+)
+
+// EventLog writes a crypto-agile event log with SHA-1 and SHA-256 banks.
+type EventLog struct {
+	buf bytes.Buffer
+}
+
+// NewEventLog starts a log with its Spec ID header event.
+func NewEventLog() *EventLog {
+	l := &EventLog{}
+	var spec bytes.Buffer
+	spec.WriteString("Spec ID Event03\x00")
+	le(&spec, uint32(0), uint8(0), uint8(2), uint8(0), uint8(2), uint32(2),
+		tpm.AlgSHA1, uint16(sha1.Size), tpm.AlgSHA256, uint16(sha256.Size), uint8(0))
+
+	le(&l.buf, uint32(0), uint32(eventlog.EvNoAction), [20]byte{}, uint32(spec.Len()))
+	l.buf.Write(spec.Bytes())
+	return l
+}
+
+// Add appends an event whose digests are the hashes of data.
+func (l *EventLog) Add(pcr uint32, eventType eventlog.EventType, data []byte) *EventLog {
+	return l.AddDigest(pcr, eventType, data, data)
+}
+
+// AddDigest appends an event whose digests are the hashes of measured rather than of data,
+// like the Authenticode digest of a boot application.
+func (l *EventLog) AddDigest(pcr uint32, eventType eventlog.EventType, measured, data []byte) *EventLog {
+	d1, d256 := sha1.Sum(measured), sha256.Sum256(measured) // #nosec G401 -- SHA-1 bank of the log
+	le(&l.buf, pcr, uint32(eventType), uint32(2), tpm.AlgSHA1, d1, tpm.AlgSHA256, d256, uint32(len(data)))
+	l.buf.Write(data)
+	return l
+}
+
+// Bytes returns the binary log.
+func (l *EventLog) Bytes() []byte {
+	return l.buf.Bytes()
+}
+
+// EFIVariable encodes a UEFI_VARIABLE_DATA.
+func EFIVariable(vendor eventlog.GUID, name string, data []byte) []byte {
+	var b bytes.Buffer
+	units := utf16.Encode([]rune(name))
+	le(&b, vendor, uint64(len(units)), uint64(len(data)), units)
+	b.Write(data)
+	return b.Bytes()
+}
+
+// SignatureList encodes an EFI_SIGNATURE_LIST of equally sized entries.
+func SignatureList(sigType, owner eventlog.GUID, entries ...[]byte) []byte {
+	var b bytes.Buffer
+	size := 16 + len(entries[0])
+	le(&b, sigType, uint32(28+size*len(entries)), uint32(0), uint32(size))
+	for _, entry := range entries {
+		le(&b, owner)
+		b.Write(entry)
+	}
+	return b.Bytes()
+}
+
+// ImageLoad encodes a UEFI_IMAGE_LOAD_EVENT whose device path is a single file path.
+func ImageLoad(path string) []byte {
+	var node bytes.Buffer
+	units := append(utf16.Encode([]rune(path)), 0)
+	le(&node, uint8(0x04), uint8(0x04), uint16(4+2*len(units)), units)
+	le(&node, uint8(0x7f), uint8(0xff), uint16(4))
+
+	var b bytes.Buffer
+	le(&b, uint64(0x1000), uint64(0x20000), uint64(0), uint64(node.Len()))
+	b.Write(node.Bytes())
+	return b.Bytes()
+}
+
+// GPT encodes a UEFI_GPT_DATA with one partition entry per name.
+func GPT(disk eventlog.GUID, names ...string) []byte {
+	var b bytes.Buffer
+	b.WriteString("EFI PART")
+	le(&b, uint32(0x00010000), uint32(92), uint32(0), uint32(0),
+		uint64(1), uint64(0), uint64(34), uint64(0), disk, uint64(2), uint32(len(names)), uint32(128), uint32(0))
+	le(&b, uint64(len(names)))
+	for i, name := range names {
+		var partName [36]uint16
+		copy(partName[:], utf16.Encode([]rune(name)))
+		le(&b, eventlog.GUID{byte(i + 1)}, eventlog.GUID{0xa0, byte(i + 1)}, uint64(2048*(i+1)), uint64(2048*(i+2)-1), uint64(0), partName)
+	}
+	return b.Bytes()
+}
+
+// Boot images measured by BootLog; the policy digests are the SHA-256 of these contents.
+var (
+	ShimImage   = []byte("shim image")
+	GrubImage   = []byte("grub image")
+	KernelImage = []byte("kernel image")
+	InitrdImage = []byte("initrd image")
+)
+
+// BootCerts are the contents of the PK, KEK and db certificates in BootLog.
+var BootCerts = map[string][]byte{
+	"PK":  []byte("platform key certificate"),
+	"KEK": []byte("key exchange certificate"),
+	"db":  []byte("signature db certificate"),
+}
+
+// BootLog returns the event log of a UEFI boot through shim, grub and a Linux kernel.
+func BootLog(secureBoot bool) []byte {
+	owner := eventlog.GUID{0x0f}
+	enabled := []byte{0}
+	if secureBoot {
+		enabled[0] = 1
+	}
+	l := NewEventLog().
+		Add(0, eventlog.EvSCRTMVersion, utf16Bytes("1.0")).
+		Add(0, eventlog.EvEFIPlatformFirmwareBlob, make([]byte, 16)).
+		Add(7, eventlog.EvEFIVariableDriverConfig, EFIVariable(eventlog.GlobalVariableGUID, "SecureBoot", enabled))
+	for _, name := range []string{"PK", "KEK"} {
+		l.Add(7, eventlog.EvEFIVariableDriverConfig, EFIVariable(eventlog.GlobalVariableGUID, name,
+			SignatureList(eventlog.CertX509GUID, owner, BootCerts[name])))
+	}
+	l.Add(7, eventlog.EvEFIVariableDriverConfig, EFIVariable(eventlog.ImageSecurityGUID, "db",
+		SignatureList(eventlog.CertX509GUID, owner, BootCerts["db"])))
+	revoked := sha256.Sum256([]byte("revoked"))
+	l.Add(7, eventlog.EvEFIVariableDriverConfig, EFIVariable(eventlog.ImageSecurityGUID, "dbx",
+		SignatureList(eventlog.CertSHA256GUID, owner, revoked[:])))
+	for pcr := uint32(0); pcr <= 7; pcr++ {
+		l.Add(pcr, eventlog.EvSeparator, make([]byte, 4))
+	}
+
+	return l.Add(5, eventlog.EvEFIGPTEvent, GPT(eventlog.GUID{0xd1}, "EFI System Partition", "root")).
+		AddDigest(4, eventlog.EvEFIBootServicesApp, ShimImage, ImageLoad(`\EFI\fedora\shimx64.efi`)).
+		Add(14, eventlog.EvIPL, []byte("MokList\x00")).
+		Add(14, eventlog.EvIPL, []byte("MokListX\x00")).
+		AddDigest(4, eventlog.EvEFIBootServicesApp, GrubImage, ImageLoad(`\EFI\fedora\grubx64.efi`)).
+		AddDigest(9, eventlog.EvIPL, KernelImage, []byte("(hd0,gpt2)/vmlinuz-6.10.0\x00")).
+		Add(8, eventlog.EvIPL, []byte("kernel_cmdline: (hd0,gpt2)/vmlinuz-6.10.0 root=/dev/sda2 ro\x00")).
+		AddDigest(9, eventlog.EvIPL, InitrdImage, []byte("(hd0,gpt2)/initramfs-6.10.0.img\x00")).
+		AddDigest(4, eventlog.EvEFIBootServicesApp, KernelImage, ImageLoad("")).
+		Bytes()
+}
+
+func utf16Bytes(s string) []byte {
+	var b bytes.Buffer
+	le(&b, append(utf16.Encode([]rune(s)), 0))
+	return b.Bytes()
+}
+
+// le writes values in little-endian order.
+func le(b *bytes.Buffer, values ...any) {
+	for _, v := range values {
+		_ = binary.Write(b, binary.LittleEndian, v)
+	}
+}
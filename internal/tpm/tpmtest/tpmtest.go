@@ -0,0 +1,403 @@
+// Package tpmtest simulates the TPM identity of a Keylime agent for tests: a manufacturer
+// CA, an endorsement key with its certificate, an attestation key, and the agent endpoint
+// that answers identity quotes.
+package tpmtest
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1" // #nosec G505 -- Keylime encrypts U with RSA-OAEP SHA-1
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/keylime/keylime-mcp/internal/tpm"
+)
+
+// TPM holds the keys and certificates of one simulated TPM.
+type TPM struct {
+	CA     *x509.Certificate // manufacturer root that issued EKCert
+	EKCert *x509.Certificate
+	EK     crypto.Signer
+	AK     crypto.Signer
+}
+
+// New creates a TPM whose EK and AK are RSA 2048 (tpm.AlgRSA) or NIST P-256 (tpm.AlgECC) keys.
+func New(keyAlg uint16) (*TPM, error) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{Organization: []string{"Test TPM Manufacturer"}, CommonName: "Test EK Root CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		return nil, err
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &TPM{CA: ca}
+	if t.EK, err = newKey(keyAlg); err != nil {
+		return nil, err
+	}
+	if t.AK, err = newKey(keyAlg); err != nil {
+		return nil, err
+	}
+	if t.EKCert, err = issueEKCert(ca, caKey, t.EK.Public()); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func newKey(keyAlg uint16) (crypto.Signer, error) {
+	switch keyAlg {
+	case tpm.AlgRSA:
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case tpm.AlgECC:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	}
+	return nil, fmt.Errorf("unsupported key algorithm %#04x", keyAlg)
+}
+
+// issueEKCert issues an EK certificate that, like real ones, has an empty subject and a
+// critical subjectAltName holding only the TPM manufacturer as a directoryName.
+func issueEKCert(ca *x509.Certificate, caKey crypto.Signer, ek crypto.PublicKey) (*x509.Certificate, error) {
+	manufacturer, err := asn1.Marshal(pkix.Name{ExtraNames: []pkix.AttributeTypeAndValue{
+		{Type: asn1.ObjectIdentifier{2, 23, 133, 2, 1}, Value: "id:54455354"},
+	}}.ToRDNSequence())
+	if err != nil {
+		return nil, err
+	}
+	san, err := asn1.Marshal([]asn1.RawValue{{Class: asn1.ClassContextSpecific, Tag: 4, IsCompound: true, Bytes: manufacturer}})
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber:       big.NewInt(2),
+		NotBefore:          time.Now().Add(-time.Hour),
+		NotAfter:           time.Now().Add(24 * time.Hour),
+		KeyUsage:           x509.KeyUsageKeyEncipherment,
+		UnknownExtKeyUsage: []asn1.ObjectIdentifier{{2, 23, 133, 8, 1}},
+		ExtraExtensions:    []pkix.Extension{{Id: asn1.ObjectIdentifier{2, 5, 29, 17}, Critical: true, Value: san}},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, ek, caKey)
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(der)
+}
+
+// WriteCA writes the manufacturer root to dir, as a TPM cert store.
+func (t *TPM) WriteCA(dir string) error {
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: t.CA.Raw})
+	return os.WriteFile(filepath.Join(dir, "test-manufacturer.pem"), data, 0600)
+}
+
+// EKPublic returns the EK as a TPM2B_PUBLIC, as the registrar stores it in ek_tpm.
+func (t *TPM) EKPublic() []byte {
+	return EncodePublic(t.EK.Public())
+}
+
+// AKPublic returns the AK as a TPM2B_PUBLIC, as the registrar stores it in aik_tpm.
+func (t *TPM) AKPublic() []byte {
+	return EncodePublic(t.AK.Public())
+}
+
+// Registration returns the registrar fields of the TPM, base64 encoded like the registrar returns them.
+func (t *TPM) Registration() (aik, ek, ekcert string) {
+	return base64.StdEncoding.EncodeToString(t.AKPublic()),
+		base64.StdEncoding.EncodeToString(t.EKPublic()),
+		base64.StdEncoding.EncodeToString(t.EKCert.Raw)
+}
+
+// EncodePublic encodes an RSA or P-256 public key as a TPM2B_PUBLIC.
+func EncodePublic(pub crypto.PublicKey) []byte {
+	var b bytes.Buffer
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		writeU16(&b, tpm.AlgRSA)
+		writeU16(&b, tpm.AlgSHA256)
+		writeU32(&b, 0x00050072) // fixedTPM, fixedParent, sensitiveDataOrigin, userWithAuth, restricted, sign
+		writeU16(&b, 0)          // authPolicy
+		writeU16(&b, tpm.AlgNull)
+		writeU16(&b, tpm.AlgRSASSA)
+		writeU16(&b, tpm.AlgSHA256)
+		writeU16(&b, uint16(key.N.BitLen())) // #nosec G115 -- RSA key sizes fit in 16 bits
+		writeU32(&b, 0)                      // default exponent
+		write2B(&b, key.N.Bytes())
+	case *ecdsa.PublicKey:
+		writeU16(&b, tpm.AlgECC)
+		writeU16(&b, tpm.AlgSHA256)
+		writeU32(&b, 0x00050072)
+		writeU16(&b, 0)
+		writeU16(&b, tpm.AlgNull)
+		writeU16(&b, tpm.AlgECDSA)
+		writeU16(&b, tpm.AlgSHA256)
+		writeU16(&b, tpm.EccNistP256)
+		writeU16(&b, tpm.AlgNull) // kdf
+		point, _ := key.Bytes()   // 0x04 || X || Y
+		size := (len(point) - 1) / 2
+		write2B(&b, point[1:1+size])
+		write2B(&b, point[1+size:])
+	}
+	var out bytes.Buffer
+	write2B(&out, b.Bytes())
+	return out.Bytes()
+}
+
+// Quote returns an identity quote over PCR 16 for nonce, signed by the AK, with data
+// extended into PCR 16 as the agent does with its transport key.
+func (t *TPM) Quote(nonce, data []byte) (*tpm.Quote, error) {
+	measured := sha256.Sum256(data)
+	pcr16 := sha256.Sum256(append(make([]byte, 32), measured[:]...))
+	pcrDigest := sha256.Sum256(pcr16[:])
+	var attest bytes.Buffer
+	writeU32(&attest, 0xff544347) // TPM_GENERATED_VALUE
+	writeU16(&attest, 0x8018)     // TPM_ST_ATTEST_QUOTE
+	write2B(&attest, []byte("qualified-signer"))
+	write2B(&attest, nonce)
+	_ = binary.Write(&attest, binary.BigEndian, uint64(time.Now().UnixMilli()))
+	writeU32(&attest, 1) // resetCount
+	writeU32(&attest, 0) // restartCount
+	attest.WriteByte(1)  // safe
+	_ = binary.Write(&attest, binary.BigEndian, uint64(0x2000))
+	writeU32(&attest, 1) // one PCR selection
+	writeU16(&attest, tpm.AlgSHA256)
+	attest.Write([]byte{3, 0x00, 0x00, 0x01}) // PCR 16
+	write2B(&attest, pcrDigest[:])
+
+	digest := sha256.Sum256(attest.Bytes())
+	sig, err := t.AK.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		return nil, err
+	}
+	var signature bytes.Buffer
+	switch t.AK.Public().(type) {
+	case *rsa.PublicKey:
+		writeU16(&signature, tpm.AlgRSASSA)
+		writeU16(&signature, tpm.AlgSHA256)
+		write2B(&signature, sig)
+	case *ecdsa.PublicKey:
+		var parsed struct{ R, S *big.Int }
+		if _, err := asn1.Unmarshal(sig, &parsed); err != nil {
+			return nil, err
+		}
+		writeU16(&signature, tpm.AlgECDSA)
+		writeU16(&signature, tpm.AlgSHA256)
+		write2B(&signature, parsed.R.Bytes())
+		write2B(&signature, parsed.S.Bytes())
+	}
+	return &tpm.Quote{Attest: attest.Bytes(), Signature: signature.Bytes(), PCRs: PCRBlob(tpm.AlgSHA256, []int{16}, pcr16[:])}, nil
+}
+
+// PCRBlob encodes the values of PCRs of one bank the way the agent sends them with a quote.
+func PCRBlob(hashAlg uint16, pcrs []int, values ...[]byte) []byte {
+	var b bytes.Buffer
+	le := func(v any) { _ = binary.Write(&b, binary.LittleEndian, v) }
+	le(uint32(1)) // one TPMS_PCR_SELECTION
+	mask := make([]byte, 4)
+	for _, pcr := range pcrs {
+		mask[pcr/8] |= 1 << (pcr % 8)
+	}
+	le(hashAlg)
+	b.WriteByte(3)
+	b.Write(mask)
+	b.WriteByte(0)              // padding
+	b.Write(make([]byte, 15*8)) // unused selections
+	le(uint32(1))               // one TPML_DIGEST
+	le(uint32(len(values)))     // #nosec G115 -- at most 8 values
+	for i := range 8 {
+		digest := make([]byte, 64) // TPMU_HA
+		var size int
+		if i < len(values) {
+			size = copy(digest, values[i])
+		}
+		le(uint16(size)) // #nosec G115 -- at most 64
+		b.Write(digest)
+	}
+	return b.Bytes()
+}
+
+// Agent serves the identity and key delivery endpoints of a Keylime agent backed by a TPM:
+//
+//	GET  /version                               {"supported_version": Version}
+//	GET  /v{version}/quotes/identity?nonce=...  {"quote": ..., "hash_alg": ..., "pubkey": ...}
+//	POST /v{version}/keys/ukey                  {"auth_tag": ..., "encrypted_key": ..., "payload": ...}
+type Agent struct {
+	TPM     *TPM
+	Version string // API version the agent supports; defaults to 2.2
+	// Nonce, when set, is quoted instead of the requested nonce, like a replayed quote.
+	Nonce []byte
+	// RejectUKey makes /keys/ukey fail, like an agent that cannot decrypt U.
+	RejectUKey bool
+	// PubKey, when set, is sent with quotes instead of the quoted transport key, like a key
+	// swapped on the way.
+	PubKey string
+	// PCRs, when set, is sent with quotes instead of the quoted PCR values.
+	PCRs []byte
+
+	mu       sync.Mutex
+	nk       *rsa.PrivateKey // transport key whose public half is sent with quotes
+	delivery *KeyDelivery
+}
+
+// KeyDelivery is what the agent received on /keys/ukey, with U already decrypted.
+type KeyDelivery struct {
+	U       []byte
+	AuthTag string
+	Payload string
+}
+
+// Delivery returns the last key delivered to the agent, or nil.
+func (a *Agent) Delivery() *KeyDelivery {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.delivery
+}
+
+func (a *Agent) transportKey() (*rsa.PrivateKey, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.nk == nil {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, err
+		}
+		a.nk = key
+	}
+	return a.nk, nil
+}
+
+func (a *Agent) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	version := a.Version
+	if version == "" {
+		version = "2.2"
+	}
+	switch r.URL.Path {
+	case "/v" + version + "/keys/ukey":
+		a.receiveUKey(w, r)
+	case "/version":
+		respond(w, http.StatusOK, map[string]any{"supported_version": version})
+	case "/v" + version + "/quotes/identity":
+		nonce := []byte(r.URL.Query().Get("nonce"))
+		if len(nonce) == 0 {
+			respond(w, http.StatusBadRequest, map[string]any{})
+			return
+		}
+		if a.Nonce != nil {
+			nonce = a.Nonce
+		}
+		nk, err := a.transportKey()
+		if err != nil {
+			respond(w, http.StatusInternalServerError, map[string]any{})
+			return
+		}
+		pubDER, err := x509.MarshalPKIXPublicKey(&nk.PublicKey)
+		if err != nil {
+			respond(w, http.StatusInternalServerError, map[string]any{})
+			return
+		}
+		pubKey := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}))
+		quote, err := a.TPM.Quote(nonce, []byte(pubKey))
+		if err != nil {
+			respond(w, http.StatusInternalServerError, map[string]any{})
+			return
+		}
+		if a.PubKey != "" {
+			pubKey = a.PubKey
+		}
+		if a.PCRs != nil {
+			quote.PCRs = a.PCRs
+		}
+		encAlg, signAlg := "rsa", "rsassa"
+		if _, ok := a.TPM.AK.Public().(*ecdsa.PublicKey); ok {
+			encAlg, signAlg = "ecc", "ecdsa"
+		}
+		respond(w, http.StatusOK, map[string]any{
+			"quote":    quote.String(),
+			"hash_alg": "sha256",
+			"enc_alg":  encAlg,
+			"sign_alg": signAlg,
+			"pubkey":   pubKey,
+		})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// receiveUKey decrypts U with the transport key, as the agent does, and keeps it with the payload.
+func (a *Agent) receiveUKey(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		AuthTag      string `json:"auth_tag"`
+		EncryptedKey string `json:"encrypted_key"`
+		Payload      string `json:"payload"`
+	}
+	if a.RejectUKey || r.Method != http.MethodPost || json.NewDecoder(r.Body).Decode(&req) != nil {
+		respond(w, http.StatusBadRequest, map[string]any{})
+		return
+	}
+	nk, err := a.transportKey()
+	if err != nil {
+		respond(w, http.StatusInternalServerError, map[string]any{})
+		return
+	}
+	encrypted, err := base64.StdEncoding.DecodeString(req.EncryptedKey)
+	if err != nil {
+		respond(w, http.StatusBadRequest, map[string]any{})
+		return
+	}
+	u, err := rsa.DecryptOAEP(sha1.New(), nil, nk, encrypted, nil) // #nosec G401 -- Keylime encrypts U with RSA-OAEP SHA-1
+	if err != nil {
+		respond(w, http.StatusBadRequest, map[string]any{})
+		return
+	}
+	a.mu.Lock()
+	a.delivery = &KeyDelivery{U: u, AuthTag: req.AuthTag, Payload: req.Payload}
+	a.mu.Unlock()
+	respond(w, http.StatusOK, map[string]any{})
+}
+
+func respond(w http.ResponseWriter, code int, results any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(map[string]any{"code": code, "status": http.StatusText(code), "results": results})
+}
+
+func writeU16(b *bytes.Buffer, v uint16) {
+	_ = binary.Write(b, binary.BigEndian, v)
+}
+
+func writeU32(b *bytes.Buffer, v uint32) {
+	_ = binary.Write(b, binary.BigEndian, v)
+}
+
+func write2B(b *bytes.Buffer, data []byte) {
+	writeU16(b, uint16(len(data))) // #nosec G115 -- test structures are far below 64 KiB
+	b.Write(data)
+}
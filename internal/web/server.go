@@ -162,7 +162,7 @@ func (s *Server) handleMessage(msg agent.Message) {
 		if msg.ToolResult != nil {
 			s.send(SSEvent{
 				Event: "tool-result",
-				Data:  s.renderToolResult(msg.ToolResult.ToolID, msg.ToolResult.Output),
+				Data:  s.renderToolResult(msg.ToolResult),
 			})
 		}
 	}
@@ -396,10 +396,12 @@ func (s *Server) renderMessage(role, content, toolID string, tool *agent.ToolReq
 	return buf.String()
 }
 
-func (s *Server) renderToolResult(toolID, content string) string {
+func (s *Server) renderToolResult(result *agent.ToolResult) string {
 	data := map[string]any{
-		"ToolID":  toolID,
-		"Content": content,
+		"ToolID":    result.ToolID,
+		"Content":   result.Output,
+		"IsError":   result.IsError,
+		"ErrorCode": result.ErrorCode,
 	}
 
 	var buf bytes.Buffer
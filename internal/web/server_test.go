@@ -378,3 +378,19 @@ func TestSend(t *testing.T) {
 		}
 	})
 }
+
+func TestRenderToolResult(t *testing.T) {
+	s := newTestServer(t)
+
+	t.Run("success", func(t *testing.T) {
+		html := s.renderToolResult(&agent.ToolResult{ToolID: "t1", Output: "ok"})
+		assert.Contains(t, html, `class="tool-result"`)
+		assert.NotContains(t, html, "data-error-code")
+	})
+
+	t.Run("error with code", func(t *testing.T) {
+		html := s.renderToolResult(&agent.ToolResult{ToolID: "t1", Output: "[not_found] gone", IsError: true, ErrorCode: "not_found"})
+		assert.Contains(t, html, `class="tool-result error"`)
+		assert.Contains(t, html, `data-error-code="not_found"`)
+	})
+}